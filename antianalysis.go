@@ -0,0 +1,213 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// AntiAnalysisFinding is a sign the program checks for debuggers, virtual machines, sandboxes or analysis tools.
+// Each one only shows the program contains the check, not that it acts on the result.
+type AntiAnalysisFinding struct {
+	Tag       string // anti-debug, anti-vm, anti-sandbox or timing-check
+	Technique string
+	Evidence  string // the import, function, string or instruction that matched
+}
+
+type antiAnalysisIndicator struct {
+	tag       string
+	technique string
+	needles   []string
+}
+
+// Windows APIs, matched against the imports and, for APIs resolved at runtime by name, the strings of the file
+var antiAnalysisAPIs = []antiAnalysisIndicator{
+	{"anti-debug", "debugger check", []string{"IsDebuggerPresent", "CheckRemoteDebuggerPresent", "NtQueryInformationProcess", "OutputDebugStringA", "OutputDebugStringW"}},
+	{"anti-debug", "debugger detach", []string{"DbgUiRemoteBreakin", "NtSetInformationThread", "NtRemoveProcessDebug"}},
+	{"timing-check", "timing check", []string{"QueryPerformanceCounter", "GetTickCount", "GetTickCount64", "NtQuerySystemTime"}},
+}
+
+// Functions of packages that implement the checks, matched against the function names
+var antiAnalysisFunctions = []antiAnalysisIndicator{
+	{"anti-debug", "ptrace self-attach", []string{"syscall.PtraceAttach", "golang.org/x/sys/unix.PtraceAttach", "syscall.PtraceDetach", "golang.org/x/sys/unix.PtraceDetach"}},
+	{"anti-vm", "virtual machine detection library", []string{"github.com/ShellCode33/VM-Detection/", "github.com/klauspost/cpuid/v2.(*CPUInfo).VM"}},
+}
+
+// Artifacts the checks look for, matched against the contents of the file
+var antiAnalysisStrings = []antiAnalysisIndicator{
+	{"anti-debug", "tracer check", []string{"TracerPid"}},
+	{"anti-vm", "VirtualBox artifact", []string{"VBoxService.exe", "VBoxTray.exe", "VBoxGuest", "VBOX HARDDISK", "VirtualBox Guest Additions", "\\\\.\\VBoxMiniRdrDN"}},
+	{"anti-vm", "VMware artifact", []string{"vmtoolsd.exe", "vmwaretray.exe", "vmwareuser.exe", "VMware Tools", "VMware Virtual", "vmhgfs"}},
+	{"anti-vm", "QEMU artifact", []string{"QEMU HARDDISK", "qemu-ga", "QEMU Virtual CPU"}},
+	{"anti-vm", "Hyper-V artifact", []string{"vmicheartbeat", "Virtual HD ATA"}},
+	{"anti-vm", "hypervisor vendor", []string{"KVMKVMKVM", "Microsoft Hv", "VBoxVBoxVBox", "XenVMMXenVMM", "prl hyperv"}},
+	{"anti-vm", "virtual machine hardware", []string{"/sys/class/dmi/id/product_name", "/sys/class/dmi/id/sys_vendor", "08:00:27", "00:0C:29", "00:0c:29", "00:50:56"}},
+	{"anti-sandbox", "sandbox artifact", []string{"SbieDll.dll", "cuckoomon", "wine_get_unix_file_name", "C:\\analysis", "sandboxie"}},
+	{"anti-debug", "analysis tool check", []string{"x64dbg", "ollydbg", "windbg.exe", "ida64.exe", "idaq.exe", "wireshark.exe", "procmon.exe", "processhacker.exe", "fiddler.exe"}},
+}
+
+// golang.org/x/sys/windows declares every API it wraps by name whether or not the program calls it, so the names
+// of runtime resolved APIs are only meaningful without it
+const windowsSysPackage = "golang.org/x/sys/windows"
+
+// APIs some Go runtime versions resolve by name for their own use
+var goRuntimeAPIs = map[string]bool{
+	"QueryPerformanceCounter":   true,
+	"NtQueryInformationProcess": true,
+}
+
+// detectAntiAnalysis looks for the indicators in the imports, function names, strings and code of the file
+func detectAntiAnalysis(file *objfile.File, tab *gosym.Table) ([]AntiAnalysisFinding, error) {
+	seen := make(map[AntiAnalysisFinding]bool)
+	var findings []AntiAnalysisFinding
+	report := func(tag string, technique string, evidence string) {
+		finding := AntiAnalysisFinding{Tag: tag, Technique: technique, Evidence: evidence}
+		if !seen[finding] {
+			seen[finding] = true
+			findings = append(findings, finding)
+		}
+	}
+
+	// PE imports are named function:library
+	imports, _ := file.ImportedSymbols()
+	imported := make(map[string]bool)
+	for _, name := range imports {
+		imported[strings.SplitN(name, ":", 2)[0]] = true
+	}
+
+	wrapsWindowsAPIs := false
+	for _, fn := range tab.Funcs {
+		if packageMatches(fn.PackageName(), windowsSysPackage) {
+			wrapsWindowsAPIs = true
+		}
+		for _, indicator := range antiAnalysisFunctions {
+			for _, needle := range indicator.needles {
+				if strings.HasPrefix(fn.Name, needle) {
+					report(indicator.tag, indicator.technique, "function "+fn.Name)
+				}
+			}
+		}
+	}
+
+	fileData, err := file.Data()
+	if err != nil {
+		return findings, err
+	}
+
+	for _, indicator := range antiAnalysisAPIs {
+		for _, api := range indicator.needles {
+			if imported[api] {
+				report(indicator.tag, indicator.technique, "import "+api)
+			} else if !wrapsWindowsAPIs && !goRuntimeAPIs[api] && containsString(fileData, api) {
+				report(indicator.tag, indicator.technique, "resolves "+api)
+			}
+		}
+	}
+
+	for _, indicator := range antiAnalysisStrings {
+		for _, needle := range indicator.needles {
+			if bytes.Contains(fileData, []byte(needle)) {
+				report(indicator.tag, indicator.technique, fmt.Sprintf("string %q", needle))
+			}
+		}
+	}
+
+	for _, finding := range instructionChecks(file, tab) {
+		report(finding.Tag, finding.Technique, finding.Evidence)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Tag < findings[j].Tag
+	})
+	return findings, nil
+}
+
+// containsString matches whole API names, GetTickCount shouldn't match inside GetTickCount64
+func containsString(data []byte, s string) bool {
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], []byte(s))
+		if idx == -1 {
+			return false
+		}
+		end := offset + idx + len(s)
+		if end == len(data) || !isIdentifierByte(data[end]) {
+			return true
+		}
+		offset = end
+	}
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Packages that use CPUID to detect instruction set extensions, which every program linking them would match
+var cpuFeaturePackages = []string{"golang.org/x/sys/cpu", "github.com/klauspost/cpuid", "github.com/intel-go/cpuid", "vendor/golang.org/x/sys/cpu"}
+
+// instructionChecks finds RDTSC, used to time code and notice single stepping, and CPUID, used to read the
+// hypervisor bit and vendor, outside of the standard library. The runtime uses both itself.
+func instructionChecks(file *objfile.File, tab *gosym.Table) []AntiAnalysisFinding {
+	arch := file.GOARCH()
+	if arch != "amd64" && arch != "386" {
+		return nil
+	}
+
+	textStart, text, err := file.Text()
+	if err != nil {
+		return nil
+	}
+
+	opcodes := []struct {
+		tag       string
+		technique string
+		op        string
+		encoding  []byte
+	}{
+		{"timing-check", "timing check", "RDTSC", []byte{0x0f, 0x31}},
+		{"anti-vm", "hypervisor check", "CPUID", []byte{0x0f, 0xa2}},
+	}
+
+	var findings []AntiAnalysisFinding
+	for _, opcode := range opcodes {
+		checked := make(map[uint64]bool)
+		for offset := 0; ; {
+			idx := bytes.Index(text[offset:], opcode.encoding)
+			if idx == -1 {
+				break
+			}
+			pc := textStart + uint64(offset+idx)
+			offset += idx + 1
+
+			fn := tab.PCToFunc(pc)
+			if fn == nil || checked[fn.Entry] || isStdPackage(fn.PackageName()) {
+				continue
+			}
+			checked[fn.Entry] = true
+
+			isFeatureDetection := false
+			for _, pkg := range cpuFeaturePackages {
+				if packageMatches(fn.PackageName(), pkg) {
+					isFeatureDetection = true
+				}
+			}
+			if isFeatureDetection {
+				continue
+			}
+
+			// the bytes may be part of another instruction, only decoding the function tells
+			file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+				if inst.Op == opcode.op {
+					findings = append(findings, AntiAnalysisFinding{Tag: opcode.tag, Technique: opcode.technique, Evidence: fmt.Sprintf("%s in %s", opcode.op, fn.Name)})
+					return false
+				}
+				return true
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,72 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The artifacts a run can be limited to with -only, and those each needs computed first. The build info gives the
+// version that picks the layout of the pclntab, whose moduledata locates the types and the string headers. Whatever
+// no requested artifact needs isn't computed, the detections included.
+var artifactDependencies = map[string][]string{
+	"buildinfo": nil,
+	"pclntab":   {"buildinfo"},
+	"functions": {"pclntab"},
+	"files":     {"pclntab"},
+	"types":     {"pclntab"},
+	"strings":   {"pclntab"},
+}
+
+// artifactSet holds the requested artifacts and their dependencies, nil when everything is computed
+type artifactSet map[string]bool
+
+// the artifacts of this run, set from -only
+var onlyArtifacts artifactSet
+
+// set from -triage, the run stops once the build info and a valid pclntab header are found
+var fastTriage bool
+
+// parseArtifacts reads a comma separated list of artifacts, adding what they depend on
+func parseArtifacts(list string) (artifactSet, error) {
+	artifacts := make(artifactSet)
+	var add func(name string) error
+	add = func(name string) error {
+		dependencies, ok := artifactDependencies[name]
+		if !ok {
+			return fmt.Errorf("unknown artifact %s, expected one of %s", name, strings.Join(artifactNames(), ", "))
+		}
+		if artifacts[name] {
+			return nil
+		}
+		artifacts[name] = true
+		for _, dependency := range dependencies {
+			if err := add(dependency); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, name := range strings.Split(list, ",") {
+		if err := add(strings.TrimSpace(name)); err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+func artifactNames() []string {
+	var names []string
+	for name := range artifactDependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wants tells whether the artifact is computed
+func (s artifactSet) wants(name string) bool {
+	return s == nil || s[name]
+}
@@ -0,0 +1,203 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	rtdebug "runtime/debug"
+	"sort"
+	"sync"
+)
+
+// Batch mode analyzes many files in one run, directories are walked recursively. Each file's result is printed
+// as soon as it's done, in JSON mode as one line per file so the output can be streamed into other tools.
+type batchResult struct {
+	File   string
+	Error  string      `json:",omitempty"`
+	Result interface{} `json:",omitempty"`
+}
+
+var errSkippedFile = errors.New("skipped")
+
+// Analysis holds the whole file and several of its sections at once, estimate the peak as a multiple of the size
+const batchMemoryFactor = 4
+
+func collectBatchFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		var dirFiles []string
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				logger.Warn("skipping unreadable path", "path", path, "error", err)
+				return nil
+			}
+			if d.Type().IsRegular() {
+				dirFiles = append(dirFiles, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(dirFiles)
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
+
+// checkWorkerMemory refuses files whose analysis is estimated to need more than the per worker budget, in bytes.
+// A budget of 0 means no limit.
+func checkWorkerMemory(fileName string, budget uint64) error {
+	if budget == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+
+	if estimate := uint64(info.Size()) * batchMemoryFactor; estimate > budget {
+		return fmt.Errorf("%w, analysis needs an estimated %d MB which exceeds the -worker-memory budget of %d MB", errSkippedFile, estimate>>20, budget>>20)
+	}
+	return nil
+}
+
+// analyzeRecovering turns a panic on a malformed file into its error, one sample mustn't end a batch of many
+func analyzeRecovering(fileName string, analyze func(fileName string) (ExtractMetadata, error)) (metadata ExtractMetadata, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("analysis panicked", "file", fileName, "panic", r, "stack", string(rtdebug.Stack()))
+			metadata, err = ExtractMetadata{}, fmt.Errorf("analysis panicked: %v", r)
+		}
+	}()
+	return analyze(fileName)
+}
+
+// runBatch processes the files with the given number of concurrent workers. process returns an exit code per file,
+// the batch exits with the most significant one, the lowest non-zero code.
+func runBatch(files []string, workers int, process func(fileName string) int) int {
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	var codeLock sync.Mutex
+	exitCode := exitOK
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fileName := range jobs {
+				code := process(fileName)
+
+				codeLock.Lock()
+				if code != exitOK && (exitCode == exitOK || code < exitCode) {
+					exitCode = code
+				}
+				codeLock.Unlock()
+			}
+		}()
+	}
+
+	for _, fileName := range files {
+		jobs <- fileName
+	}
+	close(jobs)
+	wg.Wait()
+	return exitCode
+}
+
+// shardWriter spreads the JSON lines of a batch over numbered files in a directory, each holding at most size
+// results, so a corpus run yields files that downstream tools can load and split up between them. A shard is written
+// to a temporary file and only moved into place once full, or at the end of the batch: an interrupted run leaves the
+// complete shards. Each line is one result.
+type shardWriter struct {
+	dir   string
+	size  int
+	index int
+	lines int
+	file  *atomicFile
+
+	midLine bool // the last write didn't end its line
+}
+
+func newShardWriter(dir string, size int) (*shardWriter, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("shard size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &shardWriter{dir: dir, size: size}, nil
+}
+
+// Write takes a result line in as many writes as the caller likes, the shards are only switched between lines
+func (w *shardWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.file != nil && w.lines >= w.size && !w.midLine {
+			if err := w.Close(); err != nil {
+				return written, err
+			}
+		}
+		if w.file == nil {
+			file, err := createAtomicFile(filepath.Join(w.dir, fmt.Sprintf("results-%06d.jsonl", w.index)))
+			if err != nil {
+				return written, err
+			}
+			w.file, w.lines = file, 0
+			w.index++
+		}
+
+		end := bytes.IndexByte(p, '\n') + 1
+		if end == 0 {
+			end = len(p)
+		}
+		n, err := w.file.Write(p[:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		w.midLine = p[end-1] != '\n'
+		if !w.midLine {
+			w.lines++
+		}
+		p = p[end:]
+	}
+	return written, nil
+}
+
+// Close moves the shard being written into place
+func (w *shardWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Commit()
+	w.file = nil
+	return err
+}
+
+// Abort drops the shard being written
+func (w *shardWriter) Abort() {
+	if w.file != nil {
+		w.file.Abort()
+		w.file = nil
+	}
+}
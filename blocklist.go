@@ -0,0 +1,135 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The bundled list, -blocklist adds the entries of another file to it
+//
+//go:embed blocklists/default.txt
+var defaultBlocklist string
+
+// BlocklistMatch is a module or package of the binary that is on the blocklist
+type BlocklistMatch struct {
+	Prefix      string // the blocklist entry
+	Category    string // c2-framework, loader, stealer, tunneling, ...
+	Description string `json:",omitempty"`
+	Matched     string // the module or package path that matched
+	Source      string // module for build info dependencies, package for recovered functions
+}
+
+type blocklistEntry struct {
+	prefix      string
+	category    string
+	description string
+}
+
+// parseBlocklist reads lines of a path prefix, a category and an optional description
+func parseBlocklist(name string, r io.Reader) ([]blocklistEntry, error) {
+	var entries []blocklistEntry
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected prefix category [description]", name, lineNumber)
+		}
+		entries = append(entries, blocklistEntry{
+			prefix:      strings.TrimSuffix(parts[0], "/"),
+			category:    parts[1],
+			description: strings.Join(parts[2:], " "),
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// loadBlocklist returns the bundled entries followed by those of the given file, if any
+func loadBlocklist(path string) ([]blocklistEntry, error) {
+	entries, err := parseBlocklist("default blocklist", strings.NewReader(defaultBlocklist))
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return entries, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	extra, err := parseBlocklist(path, f)
+	if err != nil {
+		return nil, err
+	}
+	return append(entries, extra...), nil
+}
+
+// matchBlocklist checks the dependencies of the build info and, for binaries without one or with vendored code, the
+// packages of the recovered functions
+func matchBlocklist(metadata ExtractMetadata, entries []blocklistEntry) []BlocklistMatch {
+	var matches []BlocklistMatch
+	seen := make(map[string]bool)
+	check := func(path string, source string) {
+		for _, entry := range entries {
+			key := entry.prefix + " " + path
+			if seen[key] || !packageMatches(path, entry.prefix) {
+				continue
+			}
+			seen[key] = true
+			matches = append(matches, BlocklistMatch{
+				Prefix:      entry.prefix,
+				Category:    entry.category,
+				Description: entry.description,
+				Matched:     path,
+				Source:      source,
+			})
+		}
+	}
+
+	check(metadata.BuildInfo.Main.Path, "module")
+	for _, dep := range metadata.BuildInfo.Deps {
+		check(dep.Path, "module")
+		if dep.Replace != nil {
+			check(dep.Replace.Path, "module")
+		}
+	}
+
+	// a module path usually covers its packages, only report packages of modules that weren't matched already
+	seenPackages := make(map[string]bool)
+	var packages []string
+	for _, fn := range metadata.UserFunctions {
+		pkg := strings.TrimPrefix(fn.PackageName, "vendor/")
+		if !seenPackages[pkg] {
+			seenPackages[pkg] = true
+			packages = append(packages, pkg)
+		}
+	}
+	sort.Strings(packages)
+
+	for _, pkg := range packages {
+		covered := false
+		for _, match := range matches {
+			if match.Source == "module" && packageMatches(pkg, match.Matched) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			check(pkg, "package")
+		}
+	}
+	return matches
+}
@@ -0,0 +1,185 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+	"github.com/mandiant/GoReSym/runtime/debug"
+)
+
+// BuildSettings describes how the binary was built. Go 1.18 and later record the settings in the build info, for
+// older or stripped binaries some of them are inferred from the rest of the file and the reasons listed as Evidence.
+type BuildSettings struct {
+	Source        string               // buildinfo, or heuristics when the binary has none
+	Compiler      string               `json:",omitempty"`
+	BuildMode     string               `json:",omitempty"`
+	CGOEnabled    *bool                `json:",omitempty"`
+	Trimpath      *bool                `json:",omitempty"`
+	Race          bool                 `json:",omitempty"`
+	ArchLevel     string               `json:",omitempty"` // the microarchitecture level, ex: GOAMD64=v3 or GOARM=7
+	Tags          []string             `json:",omitempty"`
+	Experiments   []string             `json:",omitempty"` // GOEXPERIMENT
+	Ldflags       string               `json:",omitempty"`
+	Gcflags       string               `json:",omitempty"`
+	Asmflags      string               `json:",omitempty"`
+	CGOFlags      map[string]string    `json:",omitempty"` // CGO_CFLAGS, CGO_LDFLAGS, ... when set
+	GODEBUG       string               `json:",omitempty"` // the DefaultGODEBUG of the main module
+	CryptoBackend string               `json:",omitempty"` // go, boringcrypto, go-fips140, openssl, cng or commoncrypto, see cryptobackend.go
+	CryptoModule  string               `json:",omitempty"` // the GOFIPS140 version of the Go Cryptographic Module
+	FIPSOnly      bool                 `json:",omitempty"` // crypto/tls/fipsonly restricts TLS to FIPS approved settings
+	Other         []debug.BuildSetting `json:",omitempty"` // settings this version of GoReSym doesn't know
+	Evidence      []string             `json:",omitempty"` // how the settings not read from the build info were inferred
+}
+
+// Settings reported elsewhere, GOOS and GOARCH as OS and Arch, the vcs ones as VCS
+var reportedBuildSettings = map[string]bool{"GOOS": true, "GOARCH": true}
+
+var archLevelSettings = map[string]bool{
+	"GOAMD64": true, "GOARM": true, "GOARM64": true, "GO386": true, "GOMIPS": true, "GOMIPS64": true,
+	"GOPPC64": true, "GORISCV64": true, "GOWASM": true,
+}
+
+// buildSettingsFromInfo sorts the settings of the build info into their fields
+func buildSettingsFromInfo(settings []debug.BuildSetting) *BuildSettings {
+	build := &BuildSettings{Source: "buildinfo"}
+	for _, setting := range settings {
+		key, value := setting.Key, setting.Value
+		switch {
+		case key == "-compiler":
+			build.Compiler = value
+		case key == "-buildmode":
+			build.BuildMode = value
+		case key == "-trimpath":
+			trimpath := value == "true"
+			build.Trimpath = &trimpath
+		case key == "-race":
+			build.Race = value == "true"
+		case key == "-tags":
+			build.Tags = strings.Split(value, ",")
+		case key == "-ldflags":
+			build.Ldflags = value
+		case key == "-gcflags":
+			build.Gcflags = value
+		case key == "-asmflags":
+			build.Asmflags = value
+		case key == "CGO_ENABLED":
+			cgo := value == "1"
+			build.CGOEnabled = &cgo
+		case strings.HasPrefix(key, "CGO_"):
+			if value != "" {
+				if build.CGOFlags == nil {
+					build.CGOFlags = make(map[string]string)
+				}
+				build.CGOFlags[key] = value
+			}
+		case archLevelSettings[key]:
+			build.ArchLevel = key + "=" + value
+		case key == "GOEXPERIMENT":
+			build.Experiments = strings.Split(value, ",")
+		case key == "DefaultGODEBUG":
+			build.GODEBUG = value
+		case key == "GOFIPS140":
+			if value != "off" {
+				build.CryptoModule = value
+			}
+		case reportedBuildSettings[key] || strings.HasPrefix(key, "vcs"):
+		default:
+			build.Other = append(build.Other, setting)
+		}
+	}
+
+	// -trimpath is only recorded when it's set
+	if build.Trimpath == nil {
+		trimpath := false
+		build.Trimpath = &trimpath
+	}
+	return build
+}
+
+// inferBuildSettings recovers what it can of the settings of a binary without build info, or with the build info of
+// a Go release before 1.18 that didn't record them
+func inferBuildSettings(file *objfile.File, tab *gosym.Table, sections []SectionMetadata) *BuildSettings {
+	build := &BuildSettings{Source: "heuristics"}
+	evidence := func(reason string) {
+		build.Evidence = append(build.Evidence, reason)
+	}
+
+	// -trimpath rewrites the source paths to module paths, and those of the standard library to package paths
+	var absolutePath string
+	for path := range tab.Files {
+		if isAbsolutePath(path) && (absolutePath == "" || path < absolutePath) {
+			absolutePath = path
+		}
+	}
+	if len(tab.Files) > 0 {
+		trimpath := absolutePath == ""
+		build.Trimpath = &trimpath
+		if trimpath {
+			evidence("trimpath: all source paths are relative")
+		} else {
+			evidence("no trimpath: absolute source path " + absolutePath)
+		}
+	}
+
+	cgo := false
+	functions := make(map[string]bool)
+	packages := make(map[string]bool)
+	for _, fn := range tab.Funcs {
+		functions[fn.Name] = true
+		packages[fn.PackageName()] = true
+		if !cgo && (fn.PackageName() == "runtime/cgo" || strings.HasPrefix(fn.Name, "_cgo_") || strings.HasPrefix(fn.Name, "x_cgo_")) {
+			cgo = true
+			evidence("cgo: function " + fn.Name)
+		}
+	}
+	build.CGOEnabled = &cgo
+
+	// with cgo the net and os/user packages call the C library unless the pure Go versions were selected with tags
+	if cgo {
+		if packages["net"] && !functions["net._C2func_getaddrinfo"] && !functions["net._Cfunc_getaddrinfo"] {
+			build.Tags = append(build.Tags, "netgo")
+			evidence("netgo: net doesn't use the cgo resolver")
+		}
+		if packages["os/user"] && !functions["os/user._Cfunc_mygetpwuid_r"] && !functions["os/user._C2func_mygetpwuid_r"] {
+			build.Tags = append(build.Tags, "osusergo")
+			evidence("osusergo: os/user doesn't use the C library")
+		}
+	}
+
+	if fileData, err := file.Data(); err == nil && bytes.Contains(fileData, []byte("WARNING: DATA RACE")) {
+		build.Race = true
+		evidence("race: the race detector runtime is linked in")
+	}
+
+	// -ldflags=-s drops the symbol table, -w the DWARF sections
+	var ldflags []string
+	if symbols, err := file.Symbols(); err != nil || len(symbols) == 0 {
+		ldflags = append(ldflags, "-s")
+		evidence("-s: no symbol table")
+	}
+	hasDWARF := false
+	for _, sec := range sections {
+		name := strings.TrimLeft(sec.Name, "._")
+		if name == "debug_info" || name == "zdebug_info" {
+			hasDWARF = true
+		}
+	}
+	if !hasDWARF {
+		ldflags = append(ldflags, "-w")
+		evidence("-w: no DWARF sections")
+	}
+	build.Ldflags = strings.Join(ldflags, " ")
+
+	sort.Strings(build.Tags)
+	return build
+}
+
+func isAbsolutePath(path string) bool {
+	// C:\ or C:/ on Windows
+	isDrive := len(path) > 2 && path[1] == ':' && (path[2] == '\\' || path[2] == '/')
+	return strings.HasPrefix(path, "/") || isDrive
+}
@@ -0,0 +1,176 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+	"github.com/mandiant/GoReSym/runtime/debug"
+)
+
+// C2Framework is an offensive framework the program is built from. Garbled builds hash the package and type names,
+// but keep the strings and the descriptors of their protobuf messages, so these identify them too.
+type C2Framework struct {
+	Family   string
+	Evidence []string // the packages, types with -t, protobuf descriptors and strings that matched
+	Versions []string `json:",omitempty"` // hints from the build info and the strings, ex: module github.com/jpillora/chisel v1.9.1
+}
+
+// Frameworks by their packages, the types of their messages, the .proto files they register and strings they all
+// hold. Every string of a signature has to be found, a single one being too common.
+var c2FrameworkSignatures = []struct {
+	family   string
+	packages []string // a package matches itself and every package below it
+	types    []string
+	protobuf []string // the names of the .proto files
+	strings  []string
+	version  string // the version follows this string, ex: the protocol of chisel-v3
+}{
+	{
+		family:   "sliver",
+		packages: []string{"github.com/bishopfox/sliver", "github.com/BishopFox/sliver"},
+		types:    []string{"*sliverpb.Envelope", "*sliverpb.Register", "*commonpb.Request"},
+		protobuf: []string{"sliverpb/sliver.proto", "commonpb/common.proto"},
+	},
+	{
+		family:   "merlin",
+		packages: []string{"github.com/Ne0nd0g/merlin", "github.com/Ne0nd0g/merlin-agent", "github.com/MythicAgents/merlin"},
+	},
+	{
+		family:   "poseidon",
+		packages: []string{"github.com/MythicAgents/poseidon"},
+		types:    []string{"*structs.CheckInMessage"},
+	},
+	{
+		// the actions of the protocol every Mythic agent speaks to its C2 profile
+		family:  "mythic-agent",
+		strings: []string{"get_tasking", "post_response", "checkin"},
+	},
+	{
+		family:   "chisel",
+		packages: []string{"github.com/jpillora/chisel"},
+		types:    []string{"*chserver.Server", "*chclient.Client"},
+		strings:  []string{"chisel-v"},
+		version:  "chisel-v",
+	},
+}
+
+// detectC2Frameworks gathers the packages of the functions, the parsed types, the protobuf descriptors and the data
+// of the sections for matchC2Frameworks
+func detectC2Frameworks(ctx context.Context, file *objfile.File, tab *gosym.Table, types []objfile.Type, protobuf []ProtobufFile, buildInfo debug.BuildInfo) []C2Framework {
+	packages := make(map[string]bool)
+	for _, fn := range tab.Funcs {
+		packages[fn.PackageName()] = true
+	}
+	typeNames := make(map[string]bool)
+	for _, typ := range types {
+		typeNames[typ.Str] = true
+	}
+	protoNames := make(map[string]bool)
+	for _, descriptor := range protobuf {
+		protoNames[descriptor.Name] = true
+	}
+	modules := append([]*debug.Module{&buildInfo.Main}, buildInfo.Deps...)
+
+	var datas [][]byte
+	if sections, err := file.Sections(); err == nil {
+		for _, sec := range sections {
+			if sec.FileSize == 0 {
+				continue
+			}
+			if data, err := sec.Data(); err == nil {
+				datas = append(datas, data)
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return matchC2Frameworks(packages, typeNames, protoNames, modules, datas)
+}
+
+// matchC2Frameworks reports the frameworks with evidence among the names, then looks for their strings in the data
+func matchC2Frameworks(packages map[string]bool, typeNames map[string]bool, protoNames map[string]bool, modules []*debug.Module, datas [][]byte) []C2Framework {
+	var frameworks []C2Framework
+	for _, signature := range c2FrameworkSignatures {
+		framework := C2Framework{Family: signature.family}
+		for _, prefix := range signature.packages {
+			for pkg := range packages {
+				if packageMatches(pkg, prefix) {
+					framework.Evidence = append(framework.Evidence, "package "+prefix)
+					break
+				}
+			}
+			for _, module := range modules {
+				if module.Path != "" && packageMatches(module.Path, prefix) && module.Version != "" && module.Version != "(devel)" {
+					framework.Versions = append(framework.Versions, "module "+module.Path+" "+module.Version)
+				}
+			}
+		}
+		for _, name := range signature.types {
+			if typeNames[name] {
+				framework.Evidence = append(framework.Evidence, "type "+name)
+			}
+		}
+		for _, name := range signature.protobuf {
+			if protoNames[name] {
+				framework.Evidence = append(framework.Evidence, "protobuf "+name)
+			}
+		}
+
+		if len(signature.strings) > 0 {
+			all := true
+			for _, needle := range signature.strings {
+				all = all && containsInSections(datas, needle)
+			}
+			if all {
+				framework.Evidence = append(framework.Evidence, "strings "+strings.Join(signature.strings, ", "))
+				if signature.version != "" {
+					framework.Versions = append(framework.Versions, versionsAfter(datas, signature.version)...)
+				}
+			}
+		}
+
+		if len(framework.Evidence) > 0 {
+			frameworks = append(frameworks, framework)
+		}
+	}
+	return frameworks
+}
+
+func containsInSections(datas [][]byte, needle string) bool {
+	for _, data := range datas {
+		if bytes.Contains(data, []byte(needle)) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionsAfter reads the distinct versions, digits and dots, following each occurrence of the prefix
+func versionsAfter(datas [][]byte, prefix string) []string {
+	var versions []string
+	for _, data := range datas {
+		for offset := 0; ; {
+			i := bytes.Index(data[offset:], []byte(prefix))
+			if i < 0 {
+				break
+			}
+			start := offset + i + len(prefix)
+			end := start
+			for end < len(data) && end-start < 16 && (data[end] >= '0' && data[end] <= '9' || data[end] == '.') {
+				end++
+			}
+			offset = start
+			if end > start && !slices.Contains(versions, prefix+string(data[start:end])) {
+				versions = append(versions, prefix+string(data[start:end]))
+			}
+		}
+	}
+	return versions
+}
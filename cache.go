@@ -0,0 +1,156 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// Results are cached by the SHA-256 of the input. A sample may be analyzed with different flags over time,
+// so each flag combination gets its own entry under the sample's hash.
+type cacheOptions struct {
+	PrintStdPkgs      bool
+	PrintFilePaths    bool
+	PrintTypes        bool
+	PrintStrings      bool
+	NoPrintFunctions  bool
+	ManualTypeAddress int
+	VersionOverride   string
+	MinStringLength   int
+	FunctionHashes    bool
+	Only              string
+	Triage            bool
+	Devirtualize      bool
+	Detectors         string
+}
+
+func hashFile(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachePath returns where the result for this file hash and flag set lives. The tool version is part of the key
+// so that upgrading GoReSym never serves results produced by older parsing logic.
+func cachePath(cacheDir string, fileHash string, options cacheOptions) string {
+	optionsKey := sha256.Sum256([]byte(fmt.Sprintf("%s|%+v", Version, options)))
+	return filepath.Join(cacheDir, fileHash[:2], fmt.Sprintf("%s_%s.json", fileHash, hex.EncodeToString(optionsKey[:8])))
+}
+
+func loadCachedResult(path string) (metadata ExtractMetadata, ok bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ExtractMetadata{}, false
+	}
+
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		logger.Debug("ignoring corrupt cache entry", "path", path, "error", err)
+		return ExtractMetadata{}, false
+	}
+	return metadata, true
+}
+
+// storeCachedResult replaces the entry atomically, concurrent runs on the same sample must never see a half written entry.
+// Partial results aren't stored, they depend on how long the run was allowed to take and mustn't stand in for a
+// complete one.
+func storeCachedResult(path string, metadata ExtractMetadata) error {
+	if metadata.Partial {
+		return nil
+	}
+	// timings describe one run, not the sample
+	metadata.Stats = nil
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	f, err := createAtomicFile(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// The parse cache holds what locating and parsing the tables of a sample found, which no flag changes. A run with
+// other flags, or after the results were evicted, starts from it instead of searching again. It lives under -cache
+// alongside the results, -no-cache ignores and replaces it too.
+var (
+	parseCacheDir     string
+	parseCacheRefresh bool
+)
+
+type parseCacheEntry struct {
+	PclntabVA   uint64
+	PclntabSize uint64
+	TextBase    uint64 // from the moduledata
+	ModuleData  objfile.ModuleData
+	Types       []objfile.Type // null until a run parsed them
+	Interfaces  []objfile.Type
+}
+
+// parseCachePath is keyed like cachePath, -v being the one flag the parse depends on
+func parseCachePath(cacheDir string, fileHash string, versionOverride string) string {
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s|%s", Version, versionOverride)))
+	return filepath.Join(cacheDir, fileHash[:2], fmt.Sprintf("%s_parse_%s.json", fileHash, hex.EncodeToString(key[:8])))
+}
+
+func loadParseCache(path string) *parseCacheEntry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var entry parseCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		logger.Debug("ignoring corrupt parse cache entry", "path", path, "error", err)
+		return nil
+	}
+	return &entry
+}
+
+// nonNilTypes keeps a sample without types from being taken for one whose types weren't parsed yet
+func nonNilTypes(types []objfile.Type) []objfile.Type {
+	if types == nil {
+		return []objfile.Type{}
+	}
+	return types
+}
+
+func storeParseCache(path string, entry *parseCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := createAtomicFile(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
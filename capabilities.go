@@ -0,0 +1,138 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// Capability is something the program is able to do, with the MITRE ATT&CK techniques it maps to
+type Capability struct {
+	Tag        string
+	Techniques []string `json:",omitempty"` // ATT&CK technique IDs, see https://attack.mitre.org/techniques/
+	Packages   []string `json:",omitempty"` // the linked packages that indicate it
+	CallSites  []string `json:",omitempty"` // caller -> API, for the calls from outside the standard library
+}
+
+// Capabilities are inferred from the packages a binary links and the APIs its own code calls. Go links only the
+// packages that are reachable, so a package being present is a reasonable hint the program uses it. APIs every
+// program links through the standard library, such as os.Remove, only count when code outside of it calls them.
+var capabilityPackages = []struct {
+	tag        string
+	techniques []string
+	packages   []string // a package matches itself and every package below it
+	apis       []string // functions whose callers are attributed the capability
+}{
+	{"network", []string{"T1095"}, []string{"net"}, []string{"net.Dial", "net.DialTimeout", "net.(*Dialer).DialContext", "net.Listen"}},
+	{"http", []string{"T1071.001"}, []string{"net/http"}, []string{"net/http.Get", "net/http.Post", "net/http.NewRequest", "net/http.(*Client).Do"}},
+	{"tls", []string{"T1573.002"}, []string{"crypto/tls"}, []string{"crypto/tls.Dial", "crypto/tls.Client"}},
+	{"crypto", nil, []string{"crypto"}, nil},
+	{"exec", []string{"T1059"}, []string{"os/exec"}, []string{"os/exec.Command", "os/exec.CommandContext", "os.StartProcess", "syscall.Exec", "syscall.ForkExec", "syscall.StartProcess"}},
+	{"compression", []string{"T1560.002"}, []string{"compress", "archive"}, nil},
+	{"cgo", nil, []string{"runtime/cgo"}, nil},
+	{"plugin", []string{"T1129"}, []string{"plugin"}, []string{"plugin.Open"}},
+	{"database", nil, []string{"database/sql"}, nil},
+	{"email", []string{"T1071.003"}, []string{"net/smtp"}, nil},
+	{"ssh", []string{"T1021.004"}, []string{"golang.org/x/crypto/ssh"}, nil},
+	{"websocket", []string{"T1071.001"}, []string{"golang.org/x/net/websocket", "github.com/gorilla/websocket", "nhooyr.io/websocket"}, nil},
+	{"grpc", []string{"T1071.001"}, []string{"google.golang.org/grpc"}, nil},
+	{"windows-registry", []string{"T1012", "T1112"}, []string{"golang.org/x/sys/windows/registry"}, nil},
+	{"dns", []string{"T1071.004"}, []string{"github.com/miekg/dns"}, []string{"net.LookupTXT", "net.(*Resolver).LookupTXT"}},
+	{"proxy", []string{"T1090"}, []string{"golang.org/x/net/proxy", "github.com/armon/go-socks5", "github.com/things-go/go-socks5"}, nil},
+	{"native-api", []string{"T1106"}, nil, []string{"syscall.Syscall", "syscall.Syscall6", "syscall.Syscall9", "syscall.SyscallN", "syscall.(*LazyProc).Call", "syscall.(*Proc).Call", "golang.org/x/sys/windows.(*LazyProc).Call", "golang.org/x/sys/windows.(*Proc).Call"}},
+	{"windows-service", []string{"T1543.003"}, []string{"golang.org/x/sys/windows/svc/mgr"}, nil},
+	{"wmi", []string{"T1047"}, []string{"github.com/StackExchange/wmi", "github.com/yusufpapurcu/wmi"}, nil},
+	{"com", []string{"T1559.001"}, []string{"github.com/go-ole/go-ole"}, nil},
+	{"screen-capture", []string{"T1113"}, []string{"github.com/kbinani/screenshot", "github.com/vova616/screenshot"}, nil},
+	{"clipboard", []string{"T1115"}, []string{"github.com/atotto/clipboard", "golang.design/x/clipboard"}, nil},
+	{"system-discovery", []string{"T1082"}, []string{"github.com/shirou/gopsutil/host"}, []string{"os.Hostname"}},
+	{"user-discovery", []string{"T1033"}, []string{"os/user"}, nil},
+	{"process-discovery", []string{"T1057"}, []string{"github.com/mitchellh/go-ps", "github.com/shirou/gopsutil/process", "github.com/shirou/gopsutil/v3/process"}, nil},
+	{"file-discovery", []string{"T1083"}, nil, []string{"path/filepath.Walk", "path/filepath.WalkDir", "os.ReadDir", "io/ioutil.ReadDir"}},
+	{"file-deletion", []string{"T1070.004"}, nil, []string{"os.Remove", "os.RemoveAll"}},
+	{"encoding", []string{"T1132.001"}, nil, []string{"encoding/base64.(*Encoding).DecodeString", "encoding/hex.DecodeString"}},
+}
+
+// callers listed per capability, most binaries call the common APIs from many places
+const maxCapabilityCallSites = 10
+
+func packageMatches(pkg string, prefix string) bool {
+	return pkg == prefix || strings.HasPrefix(pkg, prefix+"/")
+}
+
+// detectCapabilities matches the packages of all functions and decodes the functions outside of the standard library
+// for calls to the APIs. Call sites are only attributed on architectures with a decoder.
+func detectCapabilities(ctx context.Context, file *objfile.File, tab *gosym.Table) []Capability {
+	packages := make(map[string]bool)
+	apis := make(map[uint64]string)
+	wanted := make(map[string]bool)
+	for _, capability := range capabilityPackages {
+		for _, api := range capability.apis {
+			wanted[api] = true
+		}
+	}
+	for _, fn := range tab.Funcs {
+		packages[fn.PackageName()] = true
+		if wanted[fn.Name] {
+			apis[fn.Entry] = fn.Name
+		}
+	}
+
+	callSites := make(map[string][]string) // by API
+	seen := make(map[string]bool)
+	for _, fn := range tab.Funcs {
+		if ctx.Err() != nil {
+			break
+		}
+		if isStdPackage(fn.PackageName()) {
+			continue
+		}
+		caller := fn.Name
+		file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			if api, ok := apis[inst.Call]; ok && !seen[caller+" "+api] {
+				seen[caller+" "+api] = true
+				callSites[api] = append(callSites[api], caller)
+			}
+			return true
+		})
+	}
+
+	var capabilities []Capability
+	for _, entry := range capabilityPackages {
+		capability := Capability{Tag: entry.tag, Techniques: entry.techniques}
+		for _, prefix := range entry.packages {
+			for pkg := range packages {
+				if packageMatches(pkg, prefix) {
+					capability.Packages = append(capability.Packages, prefix)
+					break
+				}
+			}
+		}
+		for _, api := range entry.apis {
+			for _, caller := range callSites[api] {
+				if len(capability.CallSites) < maxCapabilityCallSites {
+					capability.CallSites = append(capability.CallSites, caller+" -> "+api)
+				}
+			}
+		}
+
+		if len(capability.Packages) > 0 || len(capability.CallSites) > 0 {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	return capabilities
+}
+
+// capabilityTags returns the sorted tags of the capabilities
+func capabilityTags(capabilities []Capability) []string {
+	var tags []string
+	for _, capability := range capabilities {
+		tags = append(tags, capability.Tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
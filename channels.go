@@ -0,0 +1,139 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// ChannelUse is what a function outside the standard library does with channels, recovered from its calls to the
+// runtime: the element types of the channels it makes and how often it sends, receives, selects and closes. Together
+// they sketch which goroutines talk to each other and what they pass along.
+type ChannelUse struct {
+	Function string
+	Makes    []string `json:",omitempty"` // the element types, ex: int or *main.Job, ? when the type wasn't resolved
+	Sends    int      `json:",omitempty"`
+	Receives int      `json:",omitempty"`
+	Selects  int      `json:",omitempty"`
+	Closes   int      `json:",omitempty"`
+}
+
+// The runtime functions the compiler calls for channel operations. A select with one case and a default compiles to
+// selectnbsend or selectnbrecv, an empty select to block.
+var channelAPIs = map[string]string{
+	"runtime.makechan": "make", "runtime.makechan64": "make",
+	"runtime.chansend1": "send", "runtime.selectnbsend": "send",
+	"runtime.chanrecv1": "receive", "runtime.chanrecv2": "receive", "runtime.selectnbrecv": "receive", "runtime.selectnbrecv2": "receive",
+	"runtime.selectgo": "select", "runtime.block": "select",
+	"runtime.closechan": "close",
+}
+
+// extractChannelUses decodes the functions calling the channel functions. The channel type passed to makechan is the
+// last type address loaded before the call.
+func extractChannelUses(ctx context.Context, file *objfile.File, tab *gosym.Table, moduleData *objfile.ModuleData, version string, is64bit bool, littleendian bool) ([]ChannelUse, error) {
+	apis := make(map[uint64]string)
+	for _, fn := range tab.Funcs {
+		if op, ok := channelAPIs[fn.Name]; ok {
+			apis[fn.Entry] = op
+		}
+	}
+	if len(apis) == 0 {
+		return nil, nil
+	}
+	targets := make(map[uint64]bool)
+	for entry := range apis {
+		targets[entry] = true
+	}
+
+	textStart, text, err := file.Text()
+	if err != nil {
+		return nil, err
+	}
+
+	var callers []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+		fn := tab.PCToFunc(pc)
+		if fn == nil || decoded[fn.Entry] || isStdPackage(fn.PackageName()) {
+			continue
+		}
+		decoded[fn.Entry] = true
+		callers = append(callers, fn)
+	}
+
+	elementTypes := make(map[uint64]string)
+	elementType := func(address uint64) string {
+		if element, ok := elementTypes[address]; ok {
+			return element
+		}
+		element := "?"
+		if types, err := file.ParseType(ctx, version, moduleData, address, is64bit, littleendian); err == nil {
+			for _, typ := range types {
+				if typ.VA == address && typ.Kind == "Chan" {
+					element = channelElement(typ.Str)
+				}
+			}
+		}
+		elementTypes[address] = element
+		return element
+	}
+
+	var uses []ChannelUse
+	for _, fn := range callers {
+		if ctx.Err() != nil {
+			break
+		}
+		use := ChannelUse{Function: fn.Name}
+		var lastType uint64
+		file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			for _, ref := range inst.Refs {
+				if ref >= moduleData.Types && ref < moduleData.ETypes {
+					lastType = ref
+				}
+			}
+			if inst.Call == 0 {
+				return true
+			}
+			switch apis[inst.Call] {
+			case "make":
+				element := "?"
+				if lastType != 0 {
+					element = elementType(lastType)
+				}
+				use.Makes = append(use.Makes, element)
+			case "send":
+				use.Sends++
+			case "receive":
+				use.Receives++
+			case "select":
+				use.Selects++
+			case "close":
+				use.Closes++
+			}
+			lastType = 0
+			return true
+		})
+		if len(use.Makes)+use.Sends+use.Receives+use.Selects+use.Closes == 0 {
+			continue
+		}
+		sort.Strings(use.Makes)
+		uses = append(uses, use)
+	}
+
+	sort.Slice(uses, func(i, j int) bool {
+		return uses[i].Function < uses[j].Function
+	})
+	return uses, ctx.Err()
+}
+
+// channelElement unwraps the element of a channel type as the type parser names it, chan(*main.Job) -> *main.Job
+func channelElement(channelType string) string {
+	if element, ok := strings.CutPrefix(channelType, "chan("); ok {
+		return strings.TrimSuffix(element, ")")
+	}
+	return channelType
+}
@@ -0,0 +1,228 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MalwareConfig is the configuration of a known malware family or offensive framework, pulled from the strings
+type MalwareConfig struct {
+	Family string
+	Values []ConfigValue
+}
+
+// ConfigValue is one setting of the configuration
+type ConfigValue struct {
+	Key     string
+	Value   string
+	Address uint64 // of the string holding it
+}
+
+// A configExtractor recognizes one family by the packages it links and pulls its settings from the strings. Adding a
+// family only takes another entry in configExtractors.
+type configExtractor struct {
+	family   string
+	packages []string // the binary is of the family when it links one of these, or a package below them
+	fields   []configField
+}
+
+// A configField is a setting, found as a string that matches the pattern and is referenced by one of the functions
+type configField struct {
+	key     string
+	pattern *regexp.Regexp
+
+	// prefixes of the functions referencing the string. Without any, only strings no code references qualify:
+	// package variables initialized at link time, which is how -ldflags=-X bakes the settings in.
+	functions []string
+
+	// optional, expands an encoded value into its settings, the value is kept as is when it fails
+	decode func(value string) (map[string]string, error)
+}
+
+var (
+	configURLPattern       = regexp.MustCompile(`^(?:https?|h2c?|http3|wss?|mtls|wg|dns|tcp|udp|smb)://\S+$`)
+	configUserAgentPattern = regexp.MustCompile(`^Mozilla/\d\.\d \(`)
+	configDurationPattern  = regexp.MustCompile(`^\d+(?:ms|s|m|h)$`)
+	configUUIDPattern      = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	configBase64Pattern    = regexp.MustCompile(`^[A-Za-z0-9+/]{40,}={0,2}$`)
+)
+
+var configExtractors = []configExtractor{
+	{
+		// the agent's defaults are main package variables the builder overrides with -X
+		family:   "merlin",
+		packages: []string{"github.com/Ne0nd0g/merlin-agent", "github.com/Ne0nd0g/merlin/pkg/agent"},
+		fields: []configField{
+			{key: "url", pattern: configURLPattern},
+			{key: "useragent", pattern: configUserAgentPattern},
+			{key: "sleep", pattern: configDurationPattern},
+			{key: "protocol", pattern: regexp.MustCompile(`^(?:http|https|h2|h2c|http3|udp|tcp|smb)$`)},
+		},
+	},
+	{
+		// the payload UUID and the base64 encoded JSON of each C2 profile are set with -X in the profiles package
+		family:   "poseidon",
+		packages: []string{"github.com/MythicAgents/poseidon"},
+		fields: []configField{
+			{key: "uuid", pattern: configUUIDPattern},
+			{key: "profile", pattern: configBase64Pattern, decode: decodeBase64JSON},
+		},
+	},
+	{
+		// unobfuscated implants reference their C2 URLs from the transports package
+		family:   "sliver",
+		packages: []string{"github.com/bishopfox/sliver", "github.com/BishopFox/sliver"},
+		fields: []configField{
+			{key: "c2", pattern: configURLPattern, functions: []string{"github.com/bishopfox/sliver/implant/sliver/transports"}},
+		},
+	},
+}
+
+// parseConfigFamilies reads the value of -extract-config, a comma separated list of families or all
+func parseConfigFamilies(value string) ([]configExtractor, error) {
+	if value == "all" {
+		return configExtractors, nil
+	}
+
+	var selected []configExtractor
+	for _, family := range strings.Split(value, ",") {
+		found := false
+		for _, extractor := range configExtractors {
+			if extractor.family == strings.TrimSpace(family) {
+				selected = append(selected, extractor)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown family %s, expected all or some of %s", family, strings.Join(configFamilies(), ", "))
+		}
+	}
+	return selected, nil
+}
+
+func configFamilies() []string {
+	var families []string
+	for _, extractor := range configExtractors {
+		families = append(families, extractor.family)
+	}
+	return families
+}
+
+// extractConfigs runs the extractors of the families the binary belongs to. The packages are matched among the user
+// functions and the build info dependencies, so garbled binaries, whose package names are hashed, aren't recognized.
+func extractConfigs(metadata ExtractMetadata, extractors []configExtractor) []MalwareConfig {
+	packages := make(map[string]bool)
+	for _, fn := range metadata.UserFunctions {
+		packages[fn.PackageName] = true
+	}
+	for _, dep := range metadata.BuildInfo.Deps {
+		packages[dep.Path] = true
+	}
+	packages[metadata.BuildInfo.Main.Path] = true
+
+	var configs []MalwareConfig
+	for _, extractor := range extractors {
+		linked := false
+		for pkg := range packages {
+			for _, prefix := range extractor.packages {
+				if packageMatches(pkg, prefix) {
+					linked = true
+				}
+			}
+		}
+		if !linked {
+			continue
+		}
+
+		config := MalwareConfig{Family: extractor.family}
+		seen := make(map[string]bool)
+		add := func(key string, value string, address uint64) {
+			if !seen[key+"="+value] {
+				seen[key+"="+value] = true
+				config.Values = append(config.Values, ConfigValue{Key: key, Value: value, Address: address})
+			}
+		}
+
+		for _, str := range metadata.Strings {
+			for _, field := range extractor.fields {
+				if !field.pattern.MatchString(str.Value) || !referencedBy(str, field.functions) {
+					continue
+				}
+
+				if field.decode != nil {
+					if decoded, err := field.decode(str.Value); err == nil {
+						keys := make([]string, 0, len(decoded))
+						for key := range decoded {
+							keys = append(keys, key)
+						}
+						sort.Strings(keys)
+						for _, key := range keys {
+							add(field.key+"."+key, decoded[key], str.Address)
+						}
+						continue
+					}
+				}
+				add(field.key, str.Value, str.Address)
+			}
+		}
+
+		if len(config.Values) > 0 {
+			configs = append(configs, config)
+		}
+	}
+	return configs
+}
+
+// referencedBy tells whether one of the functions references the string, or with no functions whether no code does
+func referencedBy(str StringMetadata, functions []string) bool {
+	if len(functions) == 0 {
+		return len(str.Functions) == 0
+	}
+	for _, name := range str.Functions {
+		for _, prefix := range functions {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeBase64JSON flattens a base64 encoded JSON object into its keys, nested ones joined with dots
+func decodeBase64JSON(value string) (map[string]string, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]string)
+	var flatten func(prefix string, value any)
+	flatten = func(prefix string, value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			for key, nested := range v {
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				flatten(key, nested)
+			}
+		case string:
+			flat[prefix] = v
+		default:
+			encoded, _ := json.Marshal(v)
+			flat[prefix] = string(encoded)
+		}
+	}
+	flatten("", object)
+	return flat, nil
+}
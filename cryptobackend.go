@@ -0,0 +1,94 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+)
+
+// Packages that replace the Go implementation of the standard library's cryptography. The Microsoft and Red Hat
+// toolchains vendor them into the standard library.
+var cryptoBackendPackages = []struct {
+	prefix  string
+	backend string
+}{
+	{"vendor/github.com/microsoft/go-crypto-winnative", "cng"},
+	{"github.com/microsoft/go-crypto-winnative", "cng"},
+	{"vendor/github.com/microsoft/go-crypto-darwin", "commoncrypto"},
+	{"github.com/microsoft/go-crypto-darwin", "commoncrypto"},
+	{"vendor/github.com/golang-fips/openssl", "openssl"},
+	{"github.com/golang-fips/openssl", "openssl"},
+	{"vendor/github.com/golang-fips/openssl-fips", "openssl"},
+}
+
+// GOEXPERIMENTs of the Microsoft toolchain that select the platform's crypto library
+var cryptoBackendExperiments = map[string]string{
+	"systemcrypto":  "system",
+	"opensslcrypto": "openssl",
+	"cngcrypto":     "cng",
+	"darwincrypto":  "commoncrypto",
+	"boringcrypto":  "boringcrypto",
+}
+
+// detectCryptoBackend sets the library the standard library's cryptography runs on: go, boringcrypto, go-fips140
+// for the Go Cryptographic Module of Go 1.24 and later, openssl, cng or commoncrypto, and whether crypto/tls was
+// restricted to FIPS approved settings. The functions tell, the build info only records how it was asked for.
+func detectCryptoBackend(tab *gosym.Table, build *BuildSettings) {
+	evidence := func(reason string) {
+		build.Evidence = append(build.Evidence, reason)
+	}
+
+	backend := ""
+	usesCrypto := false
+	for _, fn := range tab.Funcs {
+		pkg := fn.PackageName()
+		if strings.HasPrefix(pkg, "crypto/") {
+			usesCrypto = true
+		}
+
+		switch {
+		case fn.Name == "crypto/internal/boring/sig.BoringCrypto" || strings.Contains(fn.Name, "_goboringcrypto_"):
+			if backend == "" {
+				backend = "boringcrypto"
+				evidence("boringcrypto: function " + fn.Name)
+			}
+		case fn.Name == "crypto/internal/boring/sig.FIPSOnly":
+			if !build.FIPSOnly {
+				build.FIPSOnly = true
+				evidence("fips only: crypto/tls/fipsonly is linked in")
+			}
+		case strings.HasPrefix(pkg, "crypto/internal/fips140/v"):
+			// GOFIPS140 selects a frozen version of the module, its packages carry the version in their path
+			if backend == "" {
+				version := strings.Split(strings.TrimPrefix(pkg, "crypto/internal/fips140/"), "/")[0]
+				backend = "go-fips140"
+				build.CryptoModule = version
+				evidence("go-fips140: package " + pkg)
+			}
+		default:
+			for _, known := range cryptoBackendPackages {
+				if backend == "" && packageMatches(pkg, known.prefix) {
+					backend = known.backend
+					evidence(known.backend + ": package " + pkg)
+				}
+			}
+		}
+	}
+
+	for _, experiment := range build.Experiments {
+		if experimentBackend, ok := cryptoBackendExperiments[experiment]; ok && backend == "" {
+			backend = experimentBackend
+			evidence(experimentBackend + ": GOEXPERIMENT=" + experiment)
+		}
+	}
+	if build.CryptoModule != "" && backend == "" {
+		backend = "go-fips140"
+	}
+
+	// programs without any cryptography have no backend to speak of
+	if backend == "" && usesCrypto {
+		backend = "go"
+	}
+	build.CryptoBackend = backend
+}
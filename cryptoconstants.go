@@ -0,0 +1,390 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// CryptoConstant is a table or a set of initial values an algorithm can't do without, found in the data or as the
+// immediates of the code. Finding one in a function outside of the standard library and the well known crypto
+// modules points at a hand rolled implementation, often the cipher protecting a malware's configuration.
+type CryptoConstant struct {
+	Name      string // AES S-box, SHA-256 IV, ChaCha sigma, ... or substitution table for a permutation of unknown origin
+	Algorithm string `json:",omitempty"`
+	Address   uint64
+	Section   string
+	Functions []string `json:",omitempty"` // the functions holding the constant, or referencing it from the code
+}
+
+// The constants as the words the algorithms define them with, found in either byte order. The first two words are
+// looked for in the code as the immediates of consecutive instructions. The halves of the SHA-384 and SHA-512 words
+// are the SHA-224 and SHA-256 ones, the 32 bit words aren't reported within the 64 bit ones.
+var cryptoConstantWords = []struct {
+	name      string
+	algorithm string
+	size      int // of a word, 4 or 8
+	words     []uint64
+}{
+	{"MD5/SHA-1 IV", "MD5/SHA-1", 4, []uint64{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}},
+	{"MD5 round constants", "MD5", 4, []uint64{0xd76aa478, 0xe8c7b756, 0x242070db, 0xc1bdceee}},
+	{"SHA-1 round constants", "SHA-1", 4, []uint64{0x5a827999, 0x6ed9eba1, 0x8f1bbcdc, 0xca62c1d6}},
+	{"SHA-256 IV", "SHA-256", 4, []uint64{0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a}},
+	{"SHA-224 IV", "SHA-224", 4, []uint64{0xc1059ed8, 0x367cd507, 0x3070dd17, 0xf70e5939}},
+	{"SHA-256 round constants", "SHA-256", 4, []uint64{0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5}},
+	{"SHA-512/BLAKE2b IV", "SHA-512/BLAKE2b", 8, []uint64{0x6a09e667f3bcc908, 0xbb67ae8584caa73b}},
+	{"SHA-384 IV", "SHA-384", 8, []uint64{0xcbbb9d5dc1059ed8, 0x629a292a367cd507}},
+	{"SHA-512 round constants", "SHA-512", 8, []uint64{0x428a2f98d728ae22, 0x7137449123ef65cd}},
+	{"Keccak round constants", "SHA-3", 8, []uint64{0x800000000000808a, 0x8000000080008000}},
+	{"ChaCha/Salsa sigma", "ChaCha20/Salsa20", 4, []uint64{0x61707865, 0x3320646e, 0x79622d32, 0x6b206574}},
+	{"ChaCha/Salsa tau", "ChaCha20/Salsa20", 4, []uint64{0x61707865, 0x3120646e, 0x79622d36, 0x6b206574}},
+	{"Blowfish P-array", "Blowfish", 4, []uint64{0x243f6a88, 0x85a308d3, 0x13198a2e, 0x03707344}},
+}
+
+// Substitution tables by their first bytes. Any other permutation of the 256 byte values in the data is reported
+// as a substitution table of unknown origin, custom ciphers are often built around one.
+var substitutionTables = []struct {
+	name      string
+	algorithm string
+	prefix    []byte
+}{
+	{"AES S-box", "AES", []byte{0x63, 0x7c, 0x77, 0x7b, 0xf2, 0x6b, 0x6f, 0xc5, 0x30, 0x01, 0x67, 0x2b, 0xfe, 0xd7, 0xab, 0x76}},
+	{"AES inverse S-box", "AES", []byte{0x52, 0x09, 0x6a, 0xd5, 0x30, 0x36, 0xa5, 0x38, 0xbf, 0x40, 0xa3, 0x9e, 0x81, 0xf3, 0xd7, 0xfb}},
+	{"SM4 S-box", "SM4", []byte{0xd6, 0x90, 0xe9, 0xfe, 0xcc, 0xe1, 0x3d, 0xb7, 0x16, 0xb6, 0x14, 0xc2, 0x28, 0xfb, 0x2c, 0x05}},
+	{"Kuznyechik/Streebog Pi", "GOST", []byte{0xfc, 0xee, 0xdd, 0x11, 0xcf, 0x6e, 0x31, 0x16, 0xfb, 0xc4, 0xfa, 0xda, 0x23, 0xc5, 0x04, 0x4d}},
+	{"Camellia S-box", "Camellia", []byte{0x70, 0x82, 0x2c, 0xec, 0xb3, 0x27, 0xc0, 0xe5, 0xe4, 0x85, 0x57, 0x35, 0xea, 0x0c, 0xae, 0x41}},
+	{"Twofish q0", "Twofish", []byte{0xa9, 0x67, 0xb3, 0xe8, 0x04, 0xfd, 0xa3, 0x76, 0x9a, 0x92, 0x80, 0x78, 0xe4, 0xdd, 0xd1, 0x38}},
+	{"Twofish q1", "Twofish", []byte{0x75, 0xf3, 0xc6, 0xf4, 0xdb, 0x7b, 0xfb, 0xc8, 0x4a, 0xd3, 0xe6, 0x6b, 0x45, 0x7d, 0xe8, 0x4b}},
+	{"RC2 PITABLE", "RC2", []byte{0xd9, 0x78, 0xf9, 0xc4, 0x19, 0xdd, 0xb5, 0xed, 0x28, 0xe9, 0xfd, 0x79, 0x4a, 0xa0, 0xd8, 0x9d}},
+	{"MD2 S-box", "MD2", []byte{0x29, 0x2e, 0x43, 0xc9, 0xa2, 0xd8, 0x7c, 0x01, 0x3d, 0x36, 0x54, 0xa1, 0xec, 0xf0, 0x06, 0x13}},
+	// permutations with nothing to do with crypto, such as the bit reversal table of math/bits
+	{"", "", []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}},
+	{"", "", []byte{0x00, 0x80, 0x40, 0xc0, 0x20, 0xa0, 0x60, 0xe0, 0x10, 0x90, 0x50, 0xd0, 0x30, 0xb0, 0x70, 0xf0}},
+}
+
+// RC4 has no constant, its key schedule fills the state with the identity permutation in a loop. Implementations
+// are found by their function names instead.
+var rc4Packages = []string{"crypto/rc4"}
+
+// the most functions listed for a constant, and the most bytes between the immediates of consecutive instructions
+const (
+	maxConstantFunctions = 5
+	maxImmediateDistance = 64
+)
+
+// findCryptoConstants scans the data for the tables and words of well known algorithms and for permutations of the
+// byte values, and the code for the words loaded as immediates. Constants in the data are attributed to the
+// functions referencing them on amd64, 386 and arm64.
+func findCryptoConstants(ctx context.Context, file *objfile.File, tab *gosym.Table) ([]CryptoConstant, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []CryptoConstant
+	dataHits := make(map[uint64]int) // address -> index into found
+	seenInFunction := make(map[string]bool)
+	for _, sec := range sections {
+		if ctx.Err() != nil {
+			break
+		}
+		if sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+
+		// the read only data of Mach-O files lives in executable sections too, code is what's inside functions
+		if sec.Executable {
+			for _, constant := range scanCodeConstants(data) {
+				address := sec.Addr + constant.Address
+				fn := tab.PCToFunc(address)
+				if fn == nil || seenInFunction[constant.Name+" "+fn.Name] {
+					continue
+				}
+				seenInFunction[constant.Name+" "+fn.Name] = true
+				constant.Address = address
+				constant.Section = sec.Name
+				constant.Functions = []string{fn.Name}
+				found = append(found, constant)
+			}
+		}
+
+		for _, constant := range append(scanDataConstants(data), scanSubstitutionTables(data)...) {
+			constant.Address += sec.Addr
+			if sec.Executable && tab.PCToFunc(constant.Address) != nil {
+				continue
+			}
+			constant.Section = sec.Name
+			dataHits[constant.Address] = len(found)
+			found = append(found, constant)
+		}
+	}
+
+	if len(dataHits) > 0 {
+		if textStart, text, err := file.Text(); err == nil {
+			targets := make(map[uint64]bool, len(dataHits))
+			for address := range dataHits {
+				targets[address] = true
+			}
+			references := dataReferenceSites(file.GOARCH(), textStart, text, targets)
+			sites := make([]uint64, 0, len(references))
+			for site := range references {
+				sites = append(sites, site)
+			}
+			slices.Sort(sites)
+
+			// the C code of cgo builds isn't in the pclntab, its functions are named by the symbol table if any
+			var symbols []objfile.Sym
+			for _, site := range sites {
+				if tab.PCToFunc(site) == nil {
+					symbols, _ = file.Symbols()
+					break
+				}
+			}
+
+			for _, site := range sites {
+				name := ""
+				if fn := tab.PCToFunc(site); fn != nil {
+					name = fn.Name
+				} else {
+					name = symbolAt(symbols, site)
+				}
+				constant := &found[dataHits[references[site]]]
+				if name == "" || len(constant.Functions) >= maxConstantFunctions || slices.Contains(constant.Functions, name) {
+					continue
+				}
+				constant.Functions = append(constant.Functions, name)
+			}
+		}
+	}
+
+	rc4 := make(map[string]int) // package -> index into found
+	for _, fn := range tab.Funcs {
+		if !strings.Contains(strings.ToLower(fn.Name), "rc4") || strings.HasPrefix(fn.Name[strings.LastIndex(fn.Name, ".")+1:], "init") {
+			continue
+		}
+		pkg := fn.PackageName()
+		if isStdPackage(pkg) && !slices.Contains(rc4Packages, pkg) {
+			continue
+		}
+		index, ok := rc4[pkg]
+		if !ok {
+			index = len(found)
+			rc4[pkg] = index
+			found = append(found, CryptoConstant{Name: "RC4 implementation", Algorithm: "RC4", Address: fn.Entry})
+		}
+		if len(found[index].Functions) < maxConstantFunctions {
+			found[index].Functions = append(found[index].Functions, fn.Name)
+		}
+	}
+
+	for i := range found {
+		sort.Strings(found[i].Functions)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Address < found[j].Address
+	})
+	return found, nil
+}
+
+// scanDataConstants finds the words of the constants laid out in a row, with their offset as Address
+func scanDataConstants(data []byte) []CryptoConstant {
+	var found []CryptoConstant
+	for _, constant := range cryptoConstantWords {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			pattern := encodeConstantWords(order, constant.size, constant.words)
+			previous := -1
+			for offset := 0; ; {
+				index := bytes.Index(data[offset:], pattern)
+				if index < 0 {
+					break
+				}
+				// SIMD code lays tables out with the words repeated, the copies right after a hit are the same table
+				if start := offset + index; previous < 0 || start > previous+2*len(pattern) {
+					found = append(found, CryptoConstant{Name: constant.name, Algorithm: constant.algorithm, Address: uint64(start)})
+					previous = start
+				}
+				offset += index + len(pattern)
+			}
+		}
+	}
+	return found
+}
+
+// scanCodeConstants finds the first two words of the constants as immediates close to each other, with their offset
+// as Address. x86 encodes immediates in little endian, other architectures load large constants from literal pools.
+func scanCodeConstants(code []byte) []CryptoConstant {
+	var found []CryptoConstant
+	var wide [][2]int // the spans of the 64 bit immediates found
+	for _, size := range []int{8, 4} {
+		for _, constant := range cryptoConstantWords {
+			if constant.size != size {
+				continue
+			}
+			first := encodeConstantWords(binary.LittleEndian, constant.size, constant.words[:1])
+			second := encodeConstantWords(binary.LittleEndian, constant.size, constant.words[1:2])
+			for offset := 0; ; {
+				index := bytes.Index(code[offset:], first)
+				if index < 0 {
+					break
+				}
+				start := offset + index
+				offset = start + len(first)
+				end := bytes.Index(code[offset:min(offset+maxImmediateDistance, len(code))], second)
+				if end < 0 || slices.ContainsFunc(wide, func(span [2]int) bool { return start >= span[0] && start < span[1] }) {
+					continue
+				}
+				if size == 8 {
+					wide = append(wide, [2]int{start, offset + end + len(second)})
+				}
+				found = append(found, CryptoConstant{Name: constant.name, Algorithm: constant.algorithm, Address: uint64(start)})
+			}
+		}
+	}
+	return found
+}
+
+func encodeConstantWords(order binary.ByteOrder, size int, words []uint64) []byte {
+	pattern := make([]byte, size*len(words))
+	for i, word := range words {
+		if size == 8 {
+			order.PutUint64(pattern[i*8:], word)
+		} else {
+			order.PutUint32(pattern[i*4:], uint32(word))
+		}
+	}
+	return pattern
+}
+
+// scanSubstitutionTables finds the runs of 256 bytes holding every byte value once, with their offset as Address.
+// The counts of the values in a window sliding over the data tell in a single pass.
+func scanSubstitutionTables(data []byte) []CryptoConstant {
+	var found []CryptoConstant
+	if len(data) < 256 {
+		return nil
+	}
+
+	var counts [256]int
+	distinct := 0
+	add := func(b byte) {
+		if counts[b] == 0 {
+			distinct++
+		}
+		counts[b]++
+	}
+	remove := func(b byte) {
+		counts[b]--
+		if counts[b] == 0 {
+			distinct--
+		}
+	}
+
+	for i := 0; i < 256; i++ {
+		add(data[i])
+	}
+	for start := 0; ; {
+		if distinct == 256 {
+			if constant, ok := nameSubstitutionTable(data[start : start+256]); ok {
+				constant.Address = uint64(start)
+				found = append(found, constant)
+			}
+			// the windows overlapping this table aren't others
+			next := start + 256
+			if next+256 > len(data) {
+				break
+			}
+			counts = [256]int{}
+			distinct = 0
+			for i := next; i < next+256; i++ {
+				add(data[i])
+			}
+			start = next
+			continue
+		}
+		if start+256 >= len(data) {
+			break
+		}
+		remove(data[start])
+		add(data[start+256])
+		start++
+	}
+	return found
+}
+
+func nameSubstitutionTable(table []byte) (CryptoConstant, bool) {
+	for _, known := range substitutionTables {
+		if bytes.HasPrefix(table, known.prefix) {
+			return CryptoConstant{Name: known.name, Algorithm: known.algorithm}, known.name != ""
+		}
+	}
+	return CryptoConstant{Name: "substitution table"}, true
+}
+
+// dataReferenceSites finds the instructions referencing the targets without decoding the code: the RIP relative
+// operands of amd64, the absolute ones of 386, and the ADRP and ADD pairs of arm64
+func dataReferenceSites(arch string, textStart uint64, text []byte, targets map[uint64]bool) map[uint64]uint64 {
+	sites := make(map[uint64]uint64)
+	switch arch {
+	case "amd64", "386":
+		for i := 1; i+4 <= len(text); i++ {
+			// a ModRM byte for a 32 bit displacement without base and index
+			if text[i-1]&0xc7 != 0x05 {
+				continue
+			}
+			target := uint64(binary.LittleEndian.Uint32(text[i:]))
+			if arch == "amd64" {
+				target = textStart + uint64(i+4) + uint64(int64(int32(target)))
+			}
+			if targets[target] {
+				sites[textStart+uint64(i)] = target
+			}
+		}
+	case "arm64":
+		for i := 0; i+4 <= len(text); i += 4 {
+			word := binary.LittleEndian.Uint32(text[i:])
+			if word&0x9f000000 != 0x90000000 { // ADRP
+				continue
+			}
+			register := word & 0x1f
+			immediate := int64(word>>29&3 | (word>>5&0x7ffff)<<2)
+			immediate = immediate << 43 >> 43 // sign extend the 21 bits
+			page := (textStart+uint64(i))&^0xfff + uint64(immediate<<12)
+
+			// the ADD of the low bits follows within a few instructions
+			for j := i + 4; j < i+20 && j+4 <= len(text); j += 4 {
+				add := binary.LittleEndian.Uint32(text[j:])
+				if add&0xffc00000 == 0x91000000 && (add>>5)&0x1f == register {
+					if target := page + uint64(add>>10&0xfff); targets[target] {
+						sites[textStart+uint64(i)] = target
+					}
+					break
+				}
+			}
+		}
+	}
+	return sites
+}
+
+// symbolAt names the symbol holding the address, the symbols sorted by address. Symbols without a size hold
+// everything up to the next one.
+func symbolAt(symbols []objfile.Sym, address uint64) string {
+	i := sort.Search(len(symbols), func(i int) bool { return symbols[i].Addr > address }) - 1
+	if i < 0 {
+		return ""
+	}
+	symbol := symbols[i]
+	if symbol.Size > 0 && address >= symbol.Addr+uint64(symbol.Size) {
+		return ""
+	}
+	return symbol.Name
+}
@@ -0,0 +1,530 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"math/bits"
+	"regexp"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// MiningMetadata reports what a miner needs: the wallet receiving the mined coins, the pool it mines for and
+// the mining code. Wallet addresses are only reported when their checksum holds, so random strings of the right
+// alphabet and length aren't.
+type MiningMetadata struct {
+	Wallets []WalletAddress    `json:",omitempty"`
+	Pools   []MiningPool       `json:",omitempty"`
+	Miners  []MinerFingerprint `json:",omitempty"`
+}
+
+type WalletAddress struct {
+	Currency string // BTC, ETH or XMR
+	Format   string // P2PKH, P2SH, P2WPKH, P2WSH, P2TR, EIP-55, hex, standard, subaddress or integrated
+	Value    string
+	Address  uint64
+	Section  string
+	Checksum bool // false for Ethereum addresses in a single case, which don't carry one
+}
+
+type MiningPool struct {
+	Value   string // a stratum URL, or the host of a known pool
+	Address uint64
+	Section string
+}
+
+type MinerFingerprint struct {
+	Name     string
+	Version  string `json:",omitempty"`
+	Evidence string // the package or the string that matched
+}
+
+var stratumRegex = regexp.MustCompile(`^stratum\+(?:tcp|ssl|tls)://[A-Za-z0-9.\-]+(?::\d{1,5})?`)
+
+// the public pools cryptojacking campaigns mine for the most, matched with their subdomains
+var miningPoolDomains = []string{
+	"supportxmr.com", "moneroocean.stream", "minexmr.com", "nanopool.org", "2miners.com", "f2pool.com", "hashvault.pro",
+	"c3pool.com", "herominers.com", "unmineable.com", "nicehash.com", "ethermine.org", "xmrpool.eu", "minergate.com",
+	"dwarfpool.com", "antpool.com", "viabtc.com", "slushpool.com", "p2pool.io",
+}
+
+// Miners by the packages of Go mining code, or the strings of a miner embedded to be dropped. The first group of the
+// pattern is the version.
+var minerSignatures = []struct {
+	name     string
+	packages []string
+	needle   string
+	pattern  *regexp.Regexp
+}{
+	{"xmrig", nil, "XMRig", regexp.MustCompile(`XMRig/(\d+\.\d+\.\d+)`)},
+	{"xmrig", nil, "donate-level", regexp.MustCompile(`"donate-level"|--donate-level`)},
+	{"randomx", []string{"git.gammaspectra.live/P2Pool/go-randomx", "github.com/ngchain/go-randomx"}, "RandomX\x03", regexp.MustCompile(`RandomX\x03`)},
+	{"cryptonight", nil, "cryptonight", regexp.MustCompile(`cryptonight(?:[-/][a-z0-9]+)?`)},
+	{"ethash", []string{"github.com/ethereum/go-ethereum/consensus/ethash"}, "", nil},
+	{"astrobwt", []string{"github.com/deroproject/derohe/astrobwt", "github.com/deroproject/derosuite/astrobwt"}, "", nil},
+	{"gominer", []string{"github.com/robvanmieghem/gominer"}, "", nil},
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+const bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// the shortest run of base58 characters holding an address, legacy Bitcoin addresses are 26 to 35 characters and
+// Monero ones 95 or 106
+const minBase58Run = 26
+
+// the longest stratum URL matched, hosts are short
+const maxStratumURL = 256
+
+// detectCryptojacking scans the data sections for wallet addresses and mining pools, and the packages and data for
+// miners
+func detectCryptojacking(ctx context.Context, file *objfile.File, tab *gosym.Table) (*MiningMetadata, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &MiningMetadata{}
+	seen := make(map[string]bool)
+	for _, sec := range sections {
+		if ctx.Err() != nil {
+			break
+		}
+		if sec.Executable || sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+
+		for _, wallet := range scanWallets(data) {
+			if !seen[wallet.Value] {
+				seen[wallet.Value] = true
+				wallet.Address += sec.Addr
+				wallet.Section = sec.Name
+				metadata.Wallets = append(metadata.Wallets, wallet)
+			}
+		}
+
+		for _, pool := range scanMiningPools(data) {
+			if !seen[pool.Value] {
+				seen[pool.Value] = true
+				pool.Address += sec.Addr
+				pool.Section = sec.Name
+				metadata.Pools = append(metadata.Pools, pool)
+			}
+		}
+
+		for _, signature := range minerSignatures {
+			if signature.pattern == nil || seen["miner "+signature.name] || !bytes.Contains(data, []byte(signature.needle)) {
+				continue
+			}
+			if match := signature.pattern.FindSubmatch(data); match != nil {
+				seen["miner "+signature.name] = true
+				miner := MinerFingerprint{Name: signature.name, Evidence: strings.ToValidUTF8(string(match[0]), "?")}
+				if len(match) > 1 {
+					miner.Version = string(match[1])
+				}
+				metadata.Miners = append(metadata.Miners, miner)
+			}
+		}
+	}
+
+	packages := make(map[string]bool)
+	for _, fn := range tab.Funcs {
+		packages[fn.PackageName()] = true
+	}
+	for _, signature := range minerSignatures {
+		if seen["miner "+signature.name] {
+			continue
+		}
+		for _, prefix := range signature.packages {
+			for pkg := range packages {
+				if packageMatches(pkg, prefix) && !seen["miner "+signature.name] {
+					seen["miner "+signature.name] = true
+					metadata.Miners = append(metadata.Miners, MinerFingerprint{Name: signature.name, Evidence: "package " + prefix})
+				}
+			}
+		}
+	}
+
+	if len(metadata.Wallets) == 0 && len(metadata.Pools) == 0 && len(metadata.Miners) == 0 {
+		return nil, nil
+	}
+	return metadata, nil
+}
+
+// scanWallets finds the addresses in the data, with their offset as Address. Strings are packed without separators,
+// so every start and length an address could have within a run of its alphabet is tried.
+func scanWallets(data []byte) []WalletAddress {
+	var wallets []WalletAddress
+	for start := 0; start < len(data); {
+		if strings.IndexByte(base58Alphabet, data[start]) < 0 {
+			start++
+			continue
+		}
+		end := start
+		for end < len(data) && strings.IndexByte(base58Alphabet, data[end]) >= 0 {
+			end++
+		}
+		if end-start >= minBase58Run {
+			wallets = append(wallets, scanBase58Run(data, start, end)...)
+		}
+		start = end
+	}
+
+	for offset := 0; ; {
+		index := bytes.Index(data[offset:], []byte("bc1"))
+		if index < 0 {
+			break
+		}
+		offset += index
+		for _, length := range []int{62, 42} {
+			if offset+length <= len(data) {
+				if format, ok := validateBech32Address(string(data[offset : offset+length])); ok {
+					wallets = append(wallets, WalletAddress{Currency: "BTC", Format: format, Value: string(data[offset : offset+length]), Address: uint64(offset), Checksum: true})
+					break
+				}
+			}
+		}
+		offset += 3
+	}
+
+	for offset := 0; ; {
+		index := bytes.Index(data[offset:], []byte("0x"))
+		if index < 0 || offset+index+42 > len(data) {
+			break
+		}
+		offset += index
+		if format, checksum, ok := validateEthereumAddress(data[offset:], string(data[offset+2:offset+42])); ok {
+			wallets = append(wallets, WalletAddress{Currency: "ETH", Format: format, Value: string(data[offset : offset+42]), Address: uint64(offset), Checksum: checksum})
+		}
+		offset += 2
+	}
+	return wallets
+}
+
+// scanMiningPools finds the stratum URLs and the hosts of known pools in the data, with their offset as Address.
+// The literals are looked up first, a regular expression over all the data would take seconds on large binaries.
+func scanMiningPools(data []byte) []MiningPool {
+	var pools []MiningPool
+	for offset := 0; ; offset++ {
+		index := bytes.Index(data[offset:], []byte("stratum+"))
+		if index < 0 {
+			break
+		}
+		offset += index
+		if match := stratumRegex.Find(data[offset:min(offset+maxStratumURL, len(data))]); match != nil {
+			pools = append(pools, MiningPool{Value: string(match), Address: uint64(offset)})
+		}
+	}
+
+	isHostByte := func(c byte) bool {
+		return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.'
+	}
+	for _, domain := range miningPoolDomains {
+		for offset := 0; ; {
+			index := bytes.Index(data[offset:], []byte(domain))
+			if index < 0 {
+				break
+			}
+			start := offset + index
+			end := start + len(domain)
+			offset = end
+			if start > 0 && isHostByte(data[start-1]) && data[start-1] != '.' {
+				continue
+			}
+			for start > 0 && isHostByte(data[start-1]) {
+				start--
+			}
+			if end < len(data) && data[end] == ':' {
+				port := end + 1
+				for port < len(data) && port-end <= 5 && data[port] >= '0' && data[port] <= '9' {
+					port++
+				}
+				if port > end+1 {
+					end = port
+				}
+			}
+			// URLs are reported whole by the stratum lookup
+			if start >= len("stratum+tcp://") && bytes.HasPrefix(data[start-len("stratum+tcp://"):], []byte("stratum+")) {
+				continue
+			}
+			pools = append(pools, MiningPool{Value: strings.TrimLeft(string(data[start:end]), ".-"), Address: uint64(start)})
+		}
+	}
+	return pools
+}
+
+func scanBase58Run(data []byte, start int, end int) []WalletAddress {
+	var wallets []WalletAddress
+	for i := start; i+minBase58Run <= end; i++ {
+		switch data[i] {
+		case '1', '3':
+			for length := 35; length >= 26; length-- {
+				if i+length > end {
+					continue
+				}
+				if format, ok := validateBase58CheckAddress(string(data[i : i+length])); ok {
+					wallets = append(wallets, WalletAddress{Currency: "BTC", Format: format, Value: string(data[i : i+length]), Address: uint64(i), Checksum: true})
+					i += length - 1
+					break
+				}
+			}
+		case '4', '8':
+			for _, length := range []int{106, 95} {
+				if i+length > end {
+					continue
+				}
+				if format, ok := validateMoneroAddress(string(data[i : i+length])); ok {
+					wallets = append(wallets, WalletAddress{Currency: "XMR", Format: format, Value: string(data[i : i+length]), Address: uint64(i), Checksum: true})
+					i += length - 1
+					break
+				}
+			}
+		}
+	}
+	return wallets
+}
+
+// validateBase58CheckAddress checks the version and the double SHA256 checksum of a legacy Bitcoin address
+func validateBase58CheckAddress(address string) (string, bool) {
+	decoded := base58Decode(address)
+	if len(decoded) != 25 {
+		return "", false
+	}
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], decoded[21:]) {
+		return "", false
+	}
+	switch decoded[0] {
+	case 0x00:
+		return "P2PKH", true
+	case 0x05:
+		return "P2SH", true
+	}
+	return "", false
+}
+
+// base58Decode decodes the big endian number of Bitcoin's encoding, each leading 1 stands for a zero byte
+func base58Decode(encoded string) []byte {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for i := 0; i < len(encoded); i++ {
+		digit := strings.IndexByte(base58Alphabet, encoded[i])
+		if digit < 0 {
+			return nil
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+	zeros := 0
+	for zeros < len(encoded) && encoded[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), value.Bytes()...)
+}
+
+// validateBech32Address checks a segwit address: bech32 for witness version 0 and bech32m for the later ones
+func validateBech32Address(address string) (string, bool) {
+	values := []byte{3, 3, 0, 2, 3} // the expanded human readable part, "bc"
+	for _, c := range address[3:] {
+		digit := strings.IndexRune(bech32Alphabet, c)
+		if digit < 0 {
+			return "", false
+		}
+		values = append(values, byte(digit))
+	}
+	checksum := bech32Polymod(values)
+	version := values[5]
+	switch {
+	case version == 0 && checksum == 1 && len(address) == 42:
+		return "P2WPKH", true
+	case version == 0 && checksum == 1 && len(address) == 62:
+		return "P2WSH", true
+	case version == 1 && checksum == 0x2bc830a3 && len(address) == 62:
+		return "P2TR", true
+	}
+	return "", false
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+// validateEthereumAddress checks the EIP-55 checksum of an address in mixed case. Addresses in a single case carry
+// none, they're only taken when nothing follows them and they hold a letter, so runs of digits aren't.
+func validateEthereumAddress(data []byte, address string) (string, bool, bool) {
+	letters, upper, lower := 0, false, false
+	for _, c := range address {
+		switch {
+		case c >= 'a' && c <= 'f':
+			letters++
+			lower = true
+		case c >= 'A' && c <= 'F':
+			letters++
+			upper = true
+		case c < '0' || c > '9':
+			return "", false, false
+		}
+	}
+	if letters == 0 {
+		return "", false, false
+	}
+	if !upper || !lower {
+		if len(data) > 42 && strings.IndexByte("0123456789abcdefABCDEF", data[42]) >= 0 {
+			return "", false, false
+		}
+		return "hex", false, true
+	}
+
+	hash := hex.EncodeToString(keccak256([]byte(strings.ToLower(address))))
+	for i, c := range address {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' || c >= 'A' && c <= 'F' && hash[i] < '8' {
+			return "", false, false
+		}
+	}
+	return "EIP-55", true, true
+}
+
+// Monero's base58 encodes blocks of 8 bytes as 11 characters, the last block of n bytes takes the length here
+var moneroBlockLengths = map[int]int{2: 1, 3: 2, 5: 3, 6: 4, 7: 5, 9: 6, 10: 7, 11: 8}
+
+// validateMoneroAddress checks the network byte and the Keccak-256 checksum of a main network address
+func validateMoneroAddress(address string) (string, bool) {
+	var decoded []byte
+	for start := 0; start < len(address); start += 11 {
+		block := address[start:min(start+11, len(address))]
+		size, ok := moneroBlockLengths[len(block)]
+		if !ok {
+			return "", false
+		}
+		var value uint64
+		for i := 0; i < len(block); i++ {
+			digit := strings.IndexByte(base58Alphabet, block[i])
+			if digit < 0 {
+				return "", false
+			}
+			high, low := bits.Mul64(value, 58)
+			if high != 0 {
+				return "", false
+			}
+			value, high = bits.Add64(low, uint64(digit), 0)
+			if high != 0 {
+				return "", false
+			}
+		}
+		if size < 8 && value>>(8*size) != 0 {
+			return "", false
+		}
+		for i := size - 1; i >= 0; i-- {
+			decoded = append(decoded, byte(value>>(8*i)))
+		}
+	}
+	if len(decoded) < 5 || !bytes.Equal(keccak256(decoded[:len(decoded)-4])[:4], decoded[len(decoded)-4:]) {
+		return "", false
+	}
+	switch {
+	case decoded[0] == 18 && len(decoded) == 69:
+		return "standard", true
+	case decoded[0] == 42 && len(decoded) == 69:
+		return "subaddress", true
+	case decoded[0] == 19 && len(decoded) == 77:
+		return "integrated", true
+	}
+	return "", false
+}
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var (
+	keccakRotations = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	keccakLanes     = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+// keccak256 is the original Keccak padding Ethereum and Monero use, not the SHA3-256 standardized later
+func keccak256(data []byte) []byte {
+	const rate = 136
+	var state [25]uint64
+
+	padded := append(append([]byte{}, data...), 0x01)
+	for len(padded)%rate != 0 {
+		padded = append(padded, 0)
+	}
+	padded[len(padded)-1] |= 0x80
+
+	for block := 0; block < len(padded); block += rate {
+		for i := 0; i < rate/8; i++ {
+			for b := 0; b < 8; b++ {
+				state[i] ^= uint64(padded[block+8*i+b]) << (8 * b)
+			}
+		}
+		keccakF1600(&state)
+	}
+
+	digest := make([]byte, 32)
+	for i := range digest {
+		digest[i] = byte(state[i/8] >> (8 * (i % 8)))
+	}
+	return digest
+}
+
+func keccakF1600(state *[25]uint64) {
+	var column [5]uint64
+	for round := 0; round < 24; round++ {
+		// theta
+		for i := 0; i < 5; i++ {
+			column[i] = state[i] ^ state[i+5] ^ state[i+10] ^ state[i+15] ^ state[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := column[(i+4)%5] ^ bits.RotateLeft64(column[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				state[j+i] ^= t
+			}
+		}
+
+		// rho and pi
+		t := state[1]
+		for i := 0; i < 24; i++ {
+			j := keccakLanes[i]
+			t, state[j] = state[j], bits.RotateLeft64(t, keccakRotations[i])
+		}
+
+		// chi
+		for j := 0; j < 25; j += 5 {
+			copy(column[:], state[j:j+5])
+			for i := 0; i < 5; i++ {
+				state[j+i] ^= ^column[(i+1)%5] & column[(i+2)%5]
+			}
+		}
+
+		// iota
+		state[0] ^= keccakRoundConstants[round]
+	}
+}
@@ -193,6 +193,12 @@ func (t *LineTable) isGo12(versionOverride string) bool {
 	return t.Version >= ver12
 }
 
+// IsGo12 reports whether this is a Go 1.2 (or later) symbol table, reading only its header and the bounds of
+// its tables.
+func (t *LineTable) IsGo12(versionOverride string) bool {
+	return t.isGo12(versionOverride)
+}
+
 const (
 	go12magic  = 0xfffffffb
 	go116magic = 0xfffffffa
@@ -364,6 +370,10 @@ func (t *LineTable) go12Funcs() []Func {
 
 	funcs := make([]Func, ft.Count())
 	syms := make([]Sym, len(funcs))
+	// every function's name is cached
+	if len(t.funcNames) == 0 {
+		t.funcNames = make(map[uint32]string, len(funcs))
+	}
 	for i := range funcs {
 		f := &funcs[i]
 		f.Entry = ft.pc(i)
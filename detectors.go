@@ -0,0 +1,108 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The detections, by the name -detect and pipelines list them, in the order they run once the pclntab is found.
+// None runs unless asked for, so a plain run costs and prints what it always did. The sections, build settings and
+// origins are always computed, the rest of the results depends on them.
+var detectorOrder = []string{
+	"fuzzy-hashes", "packing",
+	"simhash", "obfuscation", "tls-callbacks", "stdlib", "capabilities", "anti-analysis", "persistence", "syscalls",
+	"routes", "channels", "regexes", "environment", "flags", "telemetry", "protobuf", "runtime-tuning",
+	"injected-strings", "modules", "target", "native-libraries", "timestamps", "signature", "resources",
+	"key-material", "licenses", "root-cas", "time-zones", "cryptojacking", "crypto-constants",
+	// after the types and strings
+	"scripting", "c2-frameworks", "sql",
+	// on the result, cached or not
+	"blocklist", "typosquats", "go-release",
+}
+
+// The results a detection reads, computed along with it
+var detectorDependencies = map[string][]string{
+	"resources":     {"signature"},
+	"root-cas":      {"key-material"},
+	"c2-frameworks": {"protobuf"},
+}
+
+// detectorSet holds the detections of a run, nil when none runs
+type detectorSet map[string]bool
+
+// the detections of the command line, set from -detect and the pipeline
+var enabledDetectors detectorSet
+
+func isDetector(name string) bool {
+	for _, detector := range detectorOrder {
+		if detector == name {
+			return true
+		}
+	}
+	return false
+}
+
+// add enables the detection and those it depends on
+func (s detectorSet) add(name string) error {
+	if !isDetector(name) {
+		return fmt.Errorf("unknown detection %s, expected all or %s", name, strings.Join(detectorNames(), ", "))
+	}
+	s[name] = true
+	for _, dependency := range detectorDependencies[name] {
+		s[dependency] = true
+	}
+	return nil
+}
+
+// parseDetectors adds the comma separated detections to those of base. all enables every one.
+func parseDetectors(list string, base detectorSet) (detectorSet, error) {
+	detectors := make(detectorSet)
+	for name := range base {
+		detectors[name] = true
+	}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			for _, detector := range detectorOrder {
+				detectors[detector] = true
+			}
+			continue
+		}
+		if err := detectors.add(name); err != nil {
+			return nil, err
+		}
+	}
+	return detectors, nil
+}
+
+func detectorNames() []string {
+	names := append([]string(nil), detectorOrder...)
+	sort.Strings(names)
+	return names
+}
+
+// runs tells whether the detection runs, on its own or for a detection reading its results
+func (s detectorSet) runs(name string) bool {
+	if s[name] {
+		return true
+	}
+	for detector, dependencies := range detectorDependencies {
+		if s[detector] && slices.Contains(dependencies, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// String lists the detections, it keys the cache
+func (s detectorSet) String() string {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,237 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// DevirtualizedCalls resolves Go's dynamic dispatch from the itabs, the method tables the linker builds for each
+// pair of interface and concrete type converted to it. Methods is the call edge set from each interface method to the
+// concrete methods implementing it, CallSites are the calls through an itab in the functions outside the standard
+// library.
+type DevirtualizedCalls struct {
+	Methods   []InterfaceMethod
+	CallSites []InterfaceCallSite `json:",omitempty"`
+}
+
+// InterfaceMethod is a method of an interface and the concrete methods a call to it can reach
+type InterfaceMethod struct {
+	Interface string
+	Method    string
+	Targets   []string
+}
+
+// InterfaceCallSite is a call through slot Slot of an itab, methods are sorted by name. The itab isn't known at the
+// call, Candidates counts the concrete methods found at that slot of any itab. Targets is set when the function loads
+// the itab itself.
+type InterfaceCallSite struct {
+	Function   string
+	Address    uint64
+	Slot       int
+	Interface  string   `json:",omitempty"`
+	Method     string   `json:",omitempty"`
+	Targets    []string `json:",omitempty"`
+	Candidates int
+}
+
+// devirtualizeCalls is set by -devirtualize, the call sites of a large program take a few seconds and megabytes
+var devirtualizeCalls bool
+
+type itab struct {
+	address   uint64
+	inter     uint64
+	name      string // of the interface
+	functions []string
+}
+
+// itabFunOffset returns the offset of the method table in the itab. Go 1.10 dropped the link and bad fields,
+// Go 1.22 the padding after the hash.
+func itabFunOffset(version string, ptrSize uint64) uint64 {
+	semver := goSemver(version)
+	known := semver != "" && semver != "unknown"
+	switch {
+	case known && compareSemver(semver, "1.10") < 0:
+		return 3*ptrSize + 8
+	case known && compareSemver(semver, "1.22") < 0:
+		return 2*ptrSize + 8
+	}
+	// the hash is padded to the pointer size
+	return 2*ptrSize + ptrSize
+}
+
+// readITabs walks the itablinks, reading each method table until a word that isn't a function entry
+func readITabs(ctx context.Context, file *objfile.File, tab *gosym.Table, moduleData *objfile.ModuleData, version string, is64bit bool, littleendian bool) []itab {
+	ptrSize := uint64(4)
+	if is64bit {
+		ptrSize = 8
+	}
+	funOffset := itabFunOffset(version, ptrSize)
+
+	functions := make(map[uint64]string, len(tab.Funcs))
+	for _, fn := range tab.Funcs {
+		functions[fn.Entry] = fn.Name
+	}
+
+	interfaceNames := make(map[uint64]string)
+	interfaceName := func(address uint64) string {
+		if name, ok := interfaceNames[address]; ok {
+			return name
+		}
+		name := ""
+		if types, err := file.ParseType(ctx, version, moduleData, address, is64bit, littleendian); err == nil && len(types) > 0 {
+			name = types[0].Str
+		}
+		interfaceNames[address] = name
+		return name
+	}
+
+	var itabs []itab
+	for i := uint64(0); i < moduleData.ITablinks.Len && ctx.Err() == nil; i++ {
+		address, err := file.ReadPointerSizeMem(uint64(moduleData.ITablinks.Data)+ptrSize*i, is64bit, littleendian)
+		if err != nil {
+			continue
+		}
+		inter, err := file.ReadPointerSizeMem(address, is64bit, littleendian)
+		if err != nil {
+			continue
+		}
+
+		current := itab{address: address, inter: inter}
+		for slot := uint64(0); ; slot++ {
+			method, err := file.ReadPointerSizeMem(address+funOffset+slot*ptrSize, is64bit, littleendian)
+			name, ok := functions[method]
+			if err != nil || !ok {
+				break
+			}
+			current.functions = append(current.functions, name)
+		}
+		if len(current.functions) == 0 {
+			continue
+		}
+		if current.name = interfaceName(inter); current.name == "" {
+			continue
+		}
+		itabs = append(itabs, current)
+	}
+	return itabs
+}
+
+// methodName returns the method of a method's function name, pkg.(*T).Write -> Write
+func methodName(function string) string {
+	return function[strings.LastIndex(function, ".")+1:]
+}
+
+// devirtualize builds the edge set from the itabs, then decodes the functions outside the standard library for
+// indirect calls through a register loaded from an itab's method table
+func devirtualize(ctx context.Context, file *objfile.File, tab *gosym.Table, moduleData *objfile.ModuleData, version string, is64bit bool, littleendian bool) (*DevirtualizedCalls, error) {
+	itabs := readITabs(ctx, file, tab, moduleData, version, is64bit, littleendian)
+	if len(itabs) == 0 {
+		return nil, ctx.Err()
+	}
+
+	ptrSize := int64(4)
+	if is64bit {
+		ptrSize = 8
+	}
+	funOffset := int64(itabFunOffset(version, uint64(ptrSize)))
+
+	// keyed by the interface type, names like client.Interface are only unique within a package
+	type methodKey struct {
+		inter  uint64
+		name   string
+		method string
+	}
+	targets := make(map[methodKey]map[string]bool)
+	bySlot := make(map[int]map[string]bool)
+	byAddress := make(map[uint64]*itab)
+	for i := range itabs {
+		it := &itabs[i]
+		byAddress[it.address] = it
+		for slot, function := range it.functions {
+			key := methodKey{it.inter, it.name, methodName(function)}
+			if targets[key] == nil {
+				targets[key] = make(map[string]bool)
+			}
+			targets[key][function] = true
+			if bySlot[slot] == nil {
+				bySlot[slot] = make(map[string]bool)
+			}
+			bySlot[slot][function] = true
+		}
+	}
+
+	report := &DevirtualizedCalls{}
+	for key, functions := range targets {
+		method := InterfaceMethod{Interface: key.name, Method: key.method}
+		for function := range functions {
+			method.Targets = append(method.Targets, function)
+		}
+		sort.Strings(method.Targets)
+		report.Methods = append(report.Methods, method)
+	}
+	sort.Slice(report.Methods, func(i, j int) bool {
+		if report.Methods[i].Interface != report.Methods[j].Interface {
+			return report.Methods[i].Interface < report.Methods[j].Interface
+		}
+		return report.Methods[i].Method < report.Methods[j].Method
+	})
+
+	for _, fn := range tab.Funcs {
+		if ctx.Err() != nil {
+			break
+		}
+		if isStdPackage(fn.PackageName()) {
+			continue
+		}
+
+		// the displacement each register was last loaded from, and the last itab the function referenced
+		loads := make(map[string]int64)
+		var loaded *itab
+		err := file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			for _, ref := range inst.Refs {
+				if it, ok := byAddress[ref]; ok {
+					loaded = it
+				}
+			}
+
+			dest := canonicalRegister(inst.Dest)
+			isCall := inst.Op == "CALL" || inst.Op == "BLR"
+			if isCall && inst.Call == 0 && strings.HasSuffix(inst.Shape, " r") {
+				disp, ok := loads[dest]
+				if ok && disp >= funOffset && (disp-funOffset)%ptrSize == 0 {
+					slot := int((disp - funOffset) / ptrSize)
+					site := InterfaceCallSite{Function: fn.Name, Address: inst.PC, Slot: slot, Candidates: len(bySlot[slot])}
+					if loaded != nil && slot < len(loaded.functions) {
+						site.Interface, site.Method = loaded.name, methodName(loaded.functions[slot])
+						site.Targets = []string{loaded.functions[slot]}
+					}
+					report.CallSites = append(report.CallSites, site)
+				}
+			}
+			if isCall {
+				clear(loads)
+				return true
+			}
+
+			if dest == "" || strings.HasPrefix(dest, "SP+") {
+				return true
+			}
+			if (inst.Op == "MOV" || inst.Op == "LDR") && inst.Base != "" && canonicalRegister(inst.Base) != "SP" {
+				loads[dest] = inst.Disp
+			} else {
+				delete(loads, dest)
+			}
+			return true
+		})
+		if err != nil {
+			// the architecture has no decoder, the edge set still holds
+			break
+		}
+	}
+	return report, ctx.Err()
+}
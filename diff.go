@@ -0,0 +1,442 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// GoReSym diff compares two builds of a program, such as two versions of a malware family.
+// Functions, types and strings are matched by name. Functions that disappear from one side and appear on the other
+// with an identical body are reported as renamed, this catches obfuscators and refactors that only change symbol names.
+// The remaining ones are paired by the MinHash of their bodies, so functions that were renamed and changed, or whose
+// names were garbled, are still matched along with how similar they are.
+type DiffItem struct {
+	Kind       string // function, type or string
+	Name       string
+	OldName    string  `json:",omitempty"` // previous name of a renamed function
+	OldAddress uint64  `json:",omitempty"`
+	NewAddress uint64  `json:",omitempty"`
+	Similarity float64 `json:",omitempty"` // estimated share of code of changed and renamed functions, 1 for identical code
+}
+
+type DiffReport struct {
+	Old             string
+	New             string
+	OldVersion      string
+	NewVersion      string
+	SimHashDistance int // differing bits of the symbol SimHashes, see simhash.go
+	Added           []DiffItem
+	Removed         []DiffItem
+	Changed         []DiffItem
+	Renamed         []DiffItem
+}
+
+// Functions are only paired by similarity when they have at least this many instructions, short ones look alike
+const minSimilarFunctionSize = 2 * shingleSize
+
+// MinHash slots are grouped in bands, two functions are compared if any band is equal. Bands shared by more functions
+// than this are wrappers and stubs that tell nothing apart, they're ignored.
+const (
+	minHashBandSize    = 2
+	maxMinHashBandSize = 64
+)
+
+// functionBodyHashes hashes each function by its instruction shapes, see hashFunction
+func functionBodyHashes(fileName string, funcs []FuncMetadata) (map[string]functionHash, error) {
+	file, err := objfile.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := make(map[string]functionHash, len(funcs))
+	for _, fn := range funcs {
+		hash, err := hashFunction(file, fn)
+		if err != nil {
+			continue
+		}
+		hashes[fn.FullName] = hash
+	}
+	return hashes, nil
+}
+
+func diffFunctions(report *DiffReport, oldFuncs []FuncMetadata, newFuncs []FuncMetadata, oldHashes map[string]functionHash, newHashes map[string]functionHash, threshold float64) {
+	oldByName := make(map[string]FuncMetadata, len(oldFuncs))
+	for _, fn := range oldFuncs {
+		oldByName[fn.FullName] = fn
+	}
+	newByName := make(map[string]FuncMetadata, len(newFuncs))
+	for _, fn := range newFuncs {
+		newByName[fn.FullName] = fn
+	}
+
+	var removed, added []FuncMetadata
+	for _, fn := range oldFuncs {
+		newFn, ok := newByName[fn.FullName]
+		if !ok {
+			removed = append(removed, fn)
+			continue
+		}
+
+		oldHash, newHash := oldHashes[fn.FullName], newHashes[fn.FullName]
+		if oldHash.exact != newHash.exact {
+			similarity := minHashSimilarity(oldHash.minHash, newHash.minHash)
+			report.Changed = append(report.Changed, DiffItem{Kind: "function", Name: fn.FullName, OldAddress: fn.Start, NewAddress: newFn.Start, Similarity: similarity})
+		}
+	}
+	for _, fn := range newFuncs {
+		if _, ok := oldByName[fn.FullName]; !ok {
+			added = append(added, fn)
+		}
+	}
+
+	// a body only identifies a rename if it's unique on both sides, small wrappers often share identical bodies
+	removedByHash := make(map[string][]FuncMetadata)
+	for _, fn := range removed {
+		if hash, ok := oldHashes[fn.FullName]; ok {
+			removedByHash[hash.exact] = append(removedByHash[hash.exact], fn)
+		}
+	}
+	addedByHash := make(map[string][]FuncMetadata)
+	for _, fn := range added {
+		if hash, ok := newHashes[fn.FullName]; ok {
+			addedByHash[hash.exact] = append(addedByHash[hash.exact], fn)
+		}
+	}
+
+	renamed := make(map[string]bool)
+	for hash, oldMatches := range removedByHash {
+		newMatches := addedByHash[hash]
+		if len(oldMatches) != 1 || len(newMatches) != 1 {
+			continue
+		}
+
+		report.Renamed = append(report.Renamed, DiffItem{Kind: "function", Name: newMatches[0].FullName, OldName: oldMatches[0].FullName, OldAddress: oldMatches[0].Start, NewAddress: newMatches[0].Start, Similarity: 1})
+		renamed["old|"+oldMatches[0].FullName] = true
+		renamed["new|"+newMatches[0].FullName] = true
+	}
+
+	var unmatchedRemoved, unmatchedAdded []FuncMetadata
+	for _, fn := range removed {
+		if !renamed["old|"+fn.FullName] {
+			unmatchedRemoved = append(unmatchedRemoved, fn)
+		}
+	}
+	for _, fn := range added {
+		if !renamed["new|"+fn.FullName] {
+			unmatchedAdded = append(unmatchedAdded, fn)
+		}
+	}
+
+	for _, item := range matchSimilarFunctions(unmatchedRemoved, unmatchedAdded, oldHashes, newHashes, threshold) {
+		report.Renamed = append(report.Renamed, item)
+		renamed["old|"+item.OldName] = true
+		renamed["new|"+item.Name] = true
+	}
+
+	for _, fn := range unmatchedRemoved {
+		if !renamed["old|"+fn.FullName] {
+			report.Removed = append(report.Removed, DiffItem{Kind: "function", Name: fn.FullName, OldAddress: fn.Start})
+		}
+	}
+	for _, fn := range unmatchedAdded {
+		if !renamed["new|"+fn.FullName] {
+			report.Added = append(report.Added, DiffItem{Kind: "function", Name: fn.FullName, NewAddress: fn.Start})
+		}
+	}
+}
+
+// matchSimilarFunctions pairs functions whose MinHash similarity is at least the threshold, the most similar pairs
+// first. Each function is paired at most once.
+func matchSimilarFunctions(oldFuncs []FuncMetadata, newFuncs []FuncMetadata, oldHashes map[string]functionHash, newHashes map[string]functionHash, threshold float64) []DiffItem {
+	if threshold <= 0 || threshold > 1 {
+		return nil
+	}
+
+	bandKey := func(signature []uint32, band int) string {
+		return fmt.Sprint(band, signature[band*minHashBandSize:(band+1)*minHashBandSize])
+	}
+	comparable := func(hash functionHash, ok bool) bool {
+		return ok && len(hash.minHash) == minHashSlots && hash.size >= minSimilarFunctionSize
+	}
+
+	buckets := make(map[string][]int)
+	for i, fn := range newFuncs {
+		hash, ok := newHashes[fn.FullName]
+		if !comparable(hash, ok) {
+			continue
+		}
+		for band := 0; band < minHashSlots/minHashBandSize; band++ {
+			key := bandKey(hash.minHash, band)
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	type candidate struct {
+		old, new   int
+		similarity float64
+	}
+	var candidates []candidate
+	for i, fn := range oldFuncs {
+		oldHash, ok := oldHashes[fn.FullName]
+		if !comparable(oldHash, ok) {
+			continue
+		}
+
+		compared := make(map[int]bool)
+		for band := 0; band < minHashSlots/minHashBandSize; band++ {
+			bucket := buckets[bandKey(oldHash.minHash, band)]
+			if len(bucket) > maxMinHashBandSize {
+				continue
+			}
+
+			for _, j := range bucket {
+				if compared[j] {
+					continue
+				}
+				compared[j] = true
+
+				newHash := newHashes[newFuncs[j].FullName]
+				// functions of very different lengths aren't the same function, however alike their instructions
+				if oldHash.size > 2*newHash.size || newHash.size > 2*oldHash.size {
+					continue
+				}
+				if similarity := minHashSimilarity(oldHash.minHash, newHash.minHash); similarity >= threshold {
+					candidates = append(candidates, candidate{i, j, similarity})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].similarity > candidates[b].similarity })
+
+	var matches []DiffItem
+	oldMatched := make(map[int]bool)
+	newMatched := make(map[int]bool)
+	for _, c := range candidates {
+		if oldMatched[c.old] || newMatched[c.new] {
+			continue
+		}
+		oldMatched[c.old] = true
+		newMatched[c.new] = true
+
+		oldFn, newFn := oldFuncs[c.old], newFuncs[c.new]
+		matches = append(matches, DiffItem{Kind: "function", Name: newFn.FullName, OldName: oldFn.FullName, OldAddress: oldFn.Start, NewAddress: newFn.Start, Similarity: c.similarity})
+	}
+	return matches
+}
+
+func diffTypes(report *DiffReport, oldTypes []objfile.Type, newTypes []objfile.Type) {
+	oldByName := make(map[string]objfile.Type, len(oldTypes))
+	for _, typ := range oldTypes {
+		oldByName[typ.Str] = typ
+	}
+	newByName := make(map[string]objfile.Type, len(newTypes))
+	for _, typ := range newTypes {
+		newByName[typ.Str] = typ
+	}
+
+	for name, typ := range oldByName {
+		newTyp, ok := newByName[name]
+		if !ok {
+			report.Removed = append(report.Removed, DiffItem{Kind: "type", Name: name, OldAddress: typ.VA})
+		} else if typ.Reconstructed != newTyp.Reconstructed {
+			report.Changed = append(report.Changed, DiffItem{Kind: "type", Name: name, OldAddress: typ.VA, NewAddress: newTyp.VA})
+		}
+	}
+	for name, typ := range newByName {
+		if _, ok := oldByName[name]; !ok {
+			report.Added = append(report.Added, DiffItem{Kind: "type", Name: name, NewAddress: typ.VA})
+		}
+	}
+}
+
+func diffStrings(report *DiffReport, oldStrings []StringMetadata, newStrings []StringMetadata) {
+	oldByValue := make(map[string]uint64, len(oldStrings))
+	for _, s := range oldStrings {
+		oldByValue[s.Value] = s.Address
+	}
+	newByValue := make(map[string]uint64, len(newStrings))
+	for _, s := range newStrings {
+		newByValue[s.Value] = s.Address
+	}
+
+	for value, address := range oldByValue {
+		if _, ok := newByValue[value]; !ok {
+			report.Removed = append(report.Removed, DiffItem{Kind: "string", Name: value, OldAddress: address})
+		}
+	}
+	for value, address := range newByValue {
+		if _, ok := oldByValue[value]; !ok {
+			report.Added = append(report.Added, DiffItem{Kind: "string", Name: value, NewAddress: address})
+		}
+	}
+}
+
+func sortDiffItems(items []DiffItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Name < items[j].Name
+	})
+}
+
+func diffBinaries(ctx context.Context, oldFile string, newFile string, printStdPkgs bool, threshold float64) (DiffReport, error) {
+	report := DiffReport{Old: oldFile, New: newFile}
+
+	// the symbol SimHashes are the only detection compared
+	detectors := detectorSet{"simhash": true}
+	oldMetadata, err := analyzeFile(ctx, oldFile, detectors, printStdPkgs, false, true, true, false, 0, "")
+	if err != nil {
+		return report, fmt.Errorf("failed to parse %s: %w", oldFile, err)
+	}
+	newMetadata, err := analyzeFile(ctx, newFile, detectors, printStdPkgs, false, true, true, false, 0, "")
+	if err != nil {
+		return report, fmt.Errorf("failed to parse %s: %w", newFile, err)
+	}
+	report.OldVersion = oldMetadata.Version
+	report.NewVersion = newMetadata.Version
+	if distance, err := simHashDistance(oldMetadata.SimHash, newMetadata.SimHash); err == nil {
+		report.SimHashDistance = distance
+	}
+
+	oldFuncs := append(oldMetadata.UserFunctions, oldMetadata.StdFunctions...)
+	newFuncs := append(newMetadata.UserFunctions, newMetadata.StdFunctions...)
+
+	hashPhase := beginPhase("hashing function bodies")
+	oldHashes, err := functionBodyHashes(oldFile, oldFuncs)
+	if err != nil {
+		hashPhase.end("")
+		return report, err
+	}
+	newHashes, err := functionBodyHashes(newFile, newFuncs)
+	if err != nil {
+		hashPhase.end("")
+		return report, err
+	}
+	hashPhase.end(fmt.Sprintf("%d old, %d new", len(oldHashes), len(newHashes)))
+
+	diffFunctions(&report, oldFuncs, newFuncs, oldHashes, newHashes, threshold)
+	diffTypes(&report, append(oldMetadata.Types, oldMetadata.Interfaces...), append(newMetadata.Types, newMetadata.Interfaces...))
+	diffStrings(&report, oldMetadata.Strings, newMetadata.Strings)
+
+	sortDiffItems(report.Added)
+	sortDiffItems(report.Removed)
+	sortDiffItems(report.Changed)
+	sortDiffItems(report.Renamed)
+	return report, nil
+}
+
+func printDiffForHuman(w io.Writer, report DiffReport) {
+	fmt.Fprintln(w, "----GoReSym diff----")
+	fmt.Fprintf(w, "%-20s %s (%s)\n", "Old:", report.Old, report.OldVersion)
+	fmt.Fprintf(w, "%-20s %s (%s)\n", "New:", report.New, report.NewVersion)
+	fmt.Fprintf(w, "%-20s %d of 64 bits\n", "SimHash distance:", report.SimHashDistance)
+
+	sections := []struct {
+		title  string
+		marker string
+		items  []DiffItem
+	}{
+		{"-ADDED-", "+", report.Added},
+		{"-REMOVED-", "-", report.Removed},
+		{"-CHANGED-", "~", report.Changed},
+		{"-RENAMED-", ">", report.Renamed},
+	}
+
+	for _, section := range sections {
+		fmt.Fprintf(w, "\n%s\n", section.title)
+		if len(section.items) == 0 {
+			fmt.Fprintln(w, "<NONE>")
+			continue
+		}
+
+		for _, item := range section.items {
+			similarity := ""
+			if item.Similarity > 0 {
+				similarity = fmt.Sprintf(" (%.0f%% similar)", item.Similarity*100)
+			}
+
+			if item.OldName != "" {
+				fmt.Fprintf(w, "%s %-10s %q -> %q%s\n", section.marker, item.Kind, item.OldName, item.Name, similarity)
+			} else {
+				fmt.Fprintf(w, "%s %-10s %q%s\n", section.marker, item.Kind, item.Name, similarity)
+			}
+		}
+	}
+}
+
+// diffMain implements `GoReSym diff [flags] old new`, args excludes the subcommand name
+func diffMain(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	printStdPkgs := flags.Bool("d", false, "Also compare functions of standard packages")
+	humanView := flags.Bool("human", false, "Human view, print the differences flat rather than json")
+	timeout := flags.Duration("timeout", 0, "Stop analysis after this long, ex: 30s")
+	threshold := flags.Float64("similarity", 0.7, "Pair the remaining functions whose code is at least this similar, from 0 to 1. 0 only pairs identical code")
+	outputPath := flags.String("o", "", "Write the report to this file instead of stdout. It's replaced atomically once the diff completes")
+	normalize := flags.String("normalize", "", "Normalize the names of the report once matched, see GoReSym -normalize")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Println(TextToJson("error", "usage: GoReSym diff [flags] old new"))
+		return exitError
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var normalizer *nameNormalizer
+	if *normalize != "" {
+		var err error
+		if normalizer, err = parseNormalizer(*normalize); err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -normalize: %s", err)))
+			return exitError
+		}
+	}
+
+	report, err := diffBinaries(ctx, flags.Arg(0), flags.Arg(1), *printStdPkgs, *threshold)
+	if err != nil {
+		fmt.Println(TextToJson("error", err.Error()))
+		return exitCodeForError(err)
+	}
+	if normalizer != nil {
+		normalizer.diffReport(&report)
+	}
+
+	var out io.Writer = os.Stdout
+	var outputFile *atomicFile
+	if *outputPath != "" {
+		outputFile, err = createAtomicFile(*outputPath)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to create output file: %s", err)))
+			return exitError
+		}
+		out = outputFile
+	}
+
+	if *humanView {
+		printDiffForHuman(out, report)
+	} else {
+		fmt.Fprintln(out, DataToJson(report))
+	}
+
+	if outputFile != nil {
+		if err := outputFile.Commit(); err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to write output file: %s", err)))
+			return exitError
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,118 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// EnvironmentVariable is a variable the program reads or sets, recovered from the string constant passed to the
+// call. Malware reads variables to find the user's profile or to be configured by its loader, and the variables
+// read by the standard library tell the knobs of the runtime.
+type EnvironmentVariable struct {
+	Name    string
+	Readers []string `json:",omitempty"` // the first few functions reading it
+	Writers []string `json:",omitempty"` // the first few functions setting or unsetting it
+}
+
+// The functions taking a variable name as their first argument, true for those setting it. os.Getenv can be inlined,
+// leaving calls to the functions it calls. os.ExpandEnv takes a template naming the variables instead.
+var environmentAPIs = map[string]bool{
+	"os.Getenv": false, "os.LookupEnv": false, "syscall.Getenv": false, "internal/testlog.Getenv": false,
+	"os.ExpandEnv": false,
+	"os.Setenv":    true, "os.Unsetenv": true, "syscall.Setenv": true, "syscall.Unsetenv": true,
+}
+
+var (
+	environmentNameRegex      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+	environmentReferenceRegex = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+const maxEnvironmentCallers = 5
+
+// extractEnvironment decodes the functions calling the environment functions and takes the last string loaded
+// before each call as the variable
+func extractEnvironment(ctx context.Context, file *objfile.File, tab *gosym.Table) ([]EnvironmentVariable, error) {
+	apis := make(map[uint64]string)
+	targets := make(map[uint64]bool)
+	for _, fn := range tab.Funcs {
+		if _, ok := environmentAPIs[fn.Name]; ok {
+			apis[fn.Entry] = fn.Name
+			targets[fn.Entry] = true
+		}
+	}
+	if len(apis) == 0 {
+		return nil, nil
+	}
+
+	sections, err := loadStringSections(file)
+	if err != nil {
+		return nil, err
+	}
+	textStart, text, err := file.Text()
+	if err != nil {
+		return nil, err
+	}
+
+	var callers []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+		fn := tab.PCToFunc(pc)
+		if fn == nil || decoded[fn.Entry] || targets[fn.Entry] {
+			continue
+		}
+		decoded[fn.Entry] = true
+		callers = append(callers, fn)
+	}
+
+	variables := make(map[string]*EnvironmentVariable)
+	record := func(name string, caller string, write bool) {
+		variable, ok := variables[name]
+		if !ok {
+			variable = &EnvironmentVariable{Name: name}
+			variables[name] = variable
+		}
+		list := &variable.Readers
+		if write {
+			list = &variable.Writers
+		}
+		if len(*list) < maxEnvironmentCallers && !slices.Contains(*list, caller) {
+			*list = append(*list, caller)
+		}
+	}
+
+	for _, fn := range callers {
+		if ctx.Err() != nil {
+			break
+		}
+		caller := fn.Name
+		callStringArguments(file, sections, fn, targets, func(_ uint64, target uint64, strs []string) {
+			if len(strs) == 0 {
+				return
+			}
+			api := apis[target]
+			argument := strs[len(strs)-1]
+			if api == "os.ExpandEnv" {
+				for _, match := range environmentReferenceRegex.FindAllStringSubmatch(argument, -1) {
+					record(match[1], caller, false)
+				}
+			} else if environmentNameRegex.MatchString(argument) {
+				record(argument, caller, environmentAPIs[api])
+			}
+		})
+	}
+
+	var result []EnvironmentVariable
+	for _, variable := range variables {
+		result = append(result, *variable)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
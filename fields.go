@@ -0,0 +1,313 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// -fields prunes the JSON output to a list of dotted paths, ex: strings.value,functions.name.
+// Paths are matched case insensitively against the JSON keys, selecting an object or list keeps everything below it,
+// and lists are transparent: strings.value selects Value in every element of Strings.
+//
+// A few short names are accepted for the common sections, functions covers both user and standard functions.
+var fieldAliases = map[string][]string{
+	"functions": {"userfunctions", "stdfunctions"},
+}
+
+// per section aliases for the fields of the elements
+var elementFieldAliases = map[string]map[string]string{
+	"userfunctions": {"name": "fullname", "package": "packagename", "address": "start"},
+	"stdfunctions":  {"name": "fullname", "package": "packagename", "address": "start"},
+	"types":         {"name": "str", "address": "va"},
+	"interfaces":    {"name": "str", "address": "va"},
+}
+
+type fieldTree map[string]fieldTree
+
+func parseFields(fields string) (fieldTree, error) {
+	tree := fieldTree{}
+	for _, path := range strings.Split(fields, ",") {
+		path = strings.ToLower(strings.TrimSpace(path))
+		if path == "" {
+			continue
+		}
+
+		parts := strings.Split(path, ".")
+		for _, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("invalid field %q", path)
+			}
+		}
+
+		roots := []string{parts[0]}
+		if alias, ok := fieldAliases[parts[0]]; ok {
+			roots = alias
+		}
+
+		for _, root := range roots {
+			node := tree.child(root)
+			for _, part := range parts[1:] {
+				if alias, ok := elementFieldAliases[root][part]; ok {
+					part = alias
+				}
+				node = node.child(part)
+			}
+		}
+	}
+
+	if len(tree) == 0 {
+		return nil, fmt.Errorf("no fields given")
+	}
+	return tree, nil
+}
+
+func (t fieldTree) child(name string) fieldTree {
+	if _, ok := t[name]; !ok {
+		t[name] = fieldTree{}
+	}
+	return t[name]
+}
+
+// orderedObject keeps the key order of a decoded JSON object, so pruned output reads like the full output
+type orderedObject []orderedField
+
+type orderedField struct {
+	key   string
+	value interface{}
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := orderedObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, orderedField{key.(string), value})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return token, nil
+}
+
+func pruneFields(value interface{}, tree fieldTree) interface{} {
+	if len(tree) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case orderedObject:
+		pruned := orderedObject{}
+		for _, field := range v {
+			if sub, ok := tree[strings.ToLower(field.key)]; ok {
+				pruned = append(pruned, orderedField{field.key, pruneFields(field.value, sub)})
+			}
+		}
+		return pruned
+	case []interface{}:
+		pruned := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			pruned = append(pruned, pruneFields(elem, tree))
+		}
+		return pruned
+	}
+	return value
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// selectFields returns data reduced to the selected fields, ready to be marshalled. It walks data itself, so only the
+// selected values are left for the encoder however large the rest of the results is.
+func selectFields(data interface{}, tree fieldTree) (interface{}, error) {
+	return selectValue(reflect.ValueOf(data), tree)
+}
+
+func selectValue(value reflect.Value, tree fieldTree) (interface{}, error) {
+	if !value.IsValid() {
+		return nil, nil
+	}
+	if len(tree) == 0 {
+		return value.Interface(), nil
+	}
+	// values encoding themselves are pruned from their JSON, ex: time.Time
+	if value.Type().Implements(marshalerType) {
+		return selectMarshaled(value.Interface(), tree)
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil, nil
+		}
+		return selectValue(value.Elem(), tree)
+	case reflect.Struct:
+		obj := orderedObject{}
+		err := selectStructFields(&obj, value, tree)
+		return obj, err
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil, nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			// encoded as a base64 string
+			return value.Interface(), nil
+		}
+		list := make([]interface{}, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elem, err := selectValue(value.Index(i), tree)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, elem)
+		}
+		return list, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return nil, nil
+		}
+		// sorted by key like the encoder does
+		keys := make(map[string]reflect.Value)
+		var names []string
+		for _, key := range value.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			keys[name] = key
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		obj := orderedObject{}
+		for _, name := range names {
+			if sub, ok := tree[strings.ToLower(name)]; ok {
+				elem, err := selectValue(value.MapIndex(keys[name]), sub)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, orderedField{name, elem})
+			}
+		}
+		return obj, nil
+	}
+	return value.Interface(), nil
+}
+
+// selectStructFields appends the selected fields of a struct under their JSON names, the fields of embedded structs
+// as its own
+func selectStructFields(obj *orderedObject, value reflect.Value, tree fieldTree) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := selectStructFields(obj, value.Field(i), tree); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		sub, ok := tree[strings.ToLower(name)]
+		if !ok || (strings.Contains(","+options+",", ",omitempty,") && isEmptyValue(value.Field(i))) {
+			continue
+		}
+		selected, err := selectValue(value.Field(i), sub)
+		if err != nil {
+			return err
+		}
+		*obj = append(*obj, orderedField{name, selected})
+	}
+	return nil
+}
+
+// isEmptyValue tells whether omitempty leaves the value out, as the encoder decides it
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return value.IsNil()
+	}
+	return false
+}
+
+// selectMarshaled prunes what a value encodes itself as
+func selectMarshaled(data interface{}, tree fieldTree) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.UseNumber()
+	decoded, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	return pruneFields(decoded, tree), nil
+}
@@ -0,0 +1,257 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// functionPackage returns the package of a fully qualified function name, such as net/http for net/http.(*Client).Do
+func functionPackage(name string) string {
+	return (&gosym.Sym{Name: name}).PackageName()
+}
+
+// typePackage returns the package qualifier of a type name. Runtime type names only hold the last element of the
+// package path, *http.Request for a net/http type, so that's all a filter can match against for types.
+func typePackage(name string) string {
+	name = strings.TrimLeft(name, "*[]0123456789")
+	if strings.HasPrefix(name, "map[") || strings.HasPrefix(name, "chan ") || strings.HasPrefix(name, "func(") || strings.HasPrefix(name, "struct {") || strings.HasPrefix(name, "interface {") {
+		return ""
+	}
+
+	if i := strings.Index(name, "."); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// filterPackages drops everything belonging to a package matching exclude from every output section.
+// Strings are attributed to the functions referencing them, a string is only dropped once all of those are excluded.
+// It returns how many functions, types, strings and entries of the other sections were dropped.
+func filterPackages(metadata *ExtractMetadata, exclude *regexp.Regexp) int {
+	return filterMetadata(metadata,
+		func(fn FuncMetadata) bool { return !exclude.MatchString(fn.PackageName) },
+		func(typ objfile.Type) bool { return !exclude.MatchString(typePackage(typ.Str)) },
+		func(kind nameKind, name string) bool {
+			switch kind {
+			case functionNameKind:
+				name = functionPackage(name)
+			case typeNameKind:
+				name = typePackage(name)
+			}
+			return !exclude.MatchString(name)
+		})
+}
+
+// filterOrigins keeps the functions, types and strings of the listed origins, and the entries of the other sections
+// naming them. Types whose origin is unknown are kept. Functions go by the origin of their package, classified again
+// when no listed function has it, such as standard functions without -d.
+func filterOrigins(metadata *ExtractMetadata, keep map[string]bool) int {
+	packages := make(map[string]string)
+	for _, functions := range [][]FuncMetadata{metadata.UserFunctions, metadata.StdFunctions} {
+		for _, fn := range functions {
+			packages[fn.PackageName] = fn.Origin
+		}
+	}
+	types := make(map[string]string)
+	for _, list := range [][]objfile.Type{metadata.Types, metadata.Interfaces} {
+		for _, typ := range list {
+			types[typ.Str] = typ.Origin
+		}
+	}
+	classifier := newOriginClassifier(metadata.BuildInfo, nil)
+	return filterMetadata(metadata,
+		func(fn FuncMetadata) bool { return keep[fn.Origin] },
+		func(typ objfile.Type) bool { return typ.Origin == "" || keep[typ.Origin] },
+		func(kind nameKind, name string) bool {
+			if kind == typeNameKind {
+				return types[name] == "" || keep[types[name]]
+			}
+			if kind == functionNameKind {
+				name = functionPackage(name)
+			}
+			origin, ok := packages[name]
+			if !ok {
+				origin = classifier.packageOrigin(name)
+			}
+			return keep[origin]
+		})
+}
+
+// The sections filterMetadata leaves be: the blocklist and typosquat matches are about what was linked in, whatever
+// the output shows, and the others don't name functions of their own
+var unfilteredFields = map[string]bool{
+	"UserFunctions": true, "StdFunctions": true, "Types": true, "Interfaces": true, "Strings": true,
+	"TabMeta": true, "ModuleMeta": true, "BuildInfo": true, "Modules": true, "Blocklisted": true, "Typosquats": true, "Errors": true, "Stats": true,
+}
+
+// The fields listing the package paths a finding comes from, such as those of a capability
+var packageListFields = map[string]bool{"Packages": true}
+
+// filterMetadata drops the functions, types and strings the keep functions reject, keepName tells for the other
+// names of the results, from the functions referencing a string to the callers of an API, whether they stay. It
+// returns how many items were dropped.
+func filterMetadata(metadata *ExtractMetadata, keepFunction func(FuncMetadata) bool, keepType func(objfile.Type) bool, keepName func(kind nameKind, name string) bool) int {
+	before := len(metadata.UserFunctions) + len(metadata.StdFunctions) + len(metadata.Types) + len(metadata.Interfaces) + len(metadata.Strings)
+
+	// remember where the excluded functions are, to drop their string references too
+	var excluded []FuncMetadata
+	var userFunctions, stdFunctions []FuncMetadata
+	for _, fn := range metadata.UserFunctions {
+		if keepFunction(fn) {
+			userFunctions = append(userFunctions, fn)
+		} else {
+			excluded = append(excluded, fn)
+		}
+	}
+	for _, fn := range metadata.StdFunctions {
+		if keepFunction(fn) {
+			stdFunctions = append(stdFunctions, fn)
+		} else {
+			excluded = append(excluded, fn)
+		}
+	}
+	sort.Slice(excluded, func(i, j int) bool { return excluded[i].Start < excluded[j].Start })
+	metadata.UserFunctions = userFunctions
+	metadata.StdFunctions = stdFunctions
+
+	filterTypes := func(types []objfile.Type) []objfile.Type {
+		var kept []objfile.Type
+		for _, typ := range types {
+			if keepType(typ) {
+				kept = append(kept, typ)
+			}
+		}
+		return kept
+	}
+	metadata.Types = filterTypes(metadata.Types)
+	metadata.Interfaces = filterTypes(metadata.Interfaces)
+
+	var strs []StringMetadata
+	for _, s := range metadata.Strings {
+		if len(s.Functions) == 0 {
+			strs = append(strs, s)
+			continue
+		}
+
+		var functions []string
+		for _, name := range s.Functions {
+			if keepName(functionNameKind, name) {
+				functions = append(functions, name)
+			}
+		}
+		if len(functions) == 0 {
+			continue
+		}
+		s.Functions = functions
+
+		var xrefs []uint64
+		for _, xref := range s.Xrefs {
+			i := sort.Search(len(excluded), func(i int) bool { return excluded[i].End > xref })
+			if i == len(excluded) || xref < excluded[i].Start {
+				xrefs = append(xrefs, xref)
+			}
+		}
+		s.Xrefs = xrefs
+		strs = append(strs, s)
+	}
+	metadata.Strings = strs
+	dropped := before - (len(metadata.UserFunctions) + len(metadata.StdFunctions) + len(metadata.Types) + len(metadata.Interfaces) + len(metadata.Strings))
+
+	value := reflect.ValueOf(metadata).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if name := value.Type().Field(i).Name; !unfilteredFields[name] {
+			filterNames(value.Field(i), name, keepName, &dropped)
+		}
+	}
+	if metadata.Stdlib != nil {
+		var packages []StdPackage
+		for _, pkg := range metadata.Stdlib.Packages {
+			if keepName(packagePathKind, pkg.Path) {
+				packages = append(packages, pkg)
+			} else {
+				dropped++
+			}
+		}
+		metadata.Stdlib.Packages = packages
+	}
+	return dropped
+}
+
+// keepsName tells whether a name of field stays. Call sites go by their caller.
+func keepsName(field, name string, keepName func(kind nameKind, name string) bool) bool {
+	switch {
+	case name == "":
+		return true
+	case functionNameFields[field]:
+		return keepName(functionNameKind, name)
+	case typeNameFields[field]:
+		return keepName(typeNameKind, name)
+	case packagePathFields[field], packageListFields[field]:
+		return keepName(packagePathKind, name)
+	case callSiteFields[field]:
+		caller, _, _ := strings.Cut(name, " -> ")
+		return keepName(functionNameKind, caller)
+	}
+	return true
+}
+
+// filterNames walks the results like rewriteNames, dropping the names keepName rejects from the lists of names, and
+// the entries of lists naming a rejected function, type or package, or left without any of the names they listed. It
+// tells whether value is such an entry, and counts the entries dropped.
+func filterNames(value reflect.Value, field string, keepName func(kind nameKind, name string) bool, dropped *int) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !value.IsNil() {
+			return filterNames(value.Elem(), field, keepName, dropped)
+		}
+	case reflect.Struct:
+		rejected, listed, left := false, false, false
+		for i := 0; i < value.NumField(); i++ {
+			if !value.Type().Field(i).IsExported() {
+				continue
+			}
+			fieldValue, name := value.Field(i), value.Type().Field(i).Name
+			if fieldValue.Kind() == reflect.String {
+				rejected = rejected || !keepsName(name, fieldValue.String(), keepName)
+				continue
+			}
+			nameList := fieldValue.Kind() == reflect.Slice && fieldValue.Len() > 0 && fieldValue.Type().Elem().Kind() == reflect.String &&
+				(functionNameFields[name] || packageListFields[name] || callSiteFields[name])
+			filterNames(fieldValue, name, keepName, dropped)
+			if nameList {
+				listed, left = true, left || fieldValue.Len() > 0
+			}
+		}
+		return rejected || (listed && !left)
+	case reflect.Slice:
+		kept := 0
+		for i := 0; i < value.Len(); i++ {
+			item := value.Index(i)
+			var drop bool
+			if item.Kind() == reflect.String {
+				drop = !keepsName(field, item.String(), keepName)
+			} else {
+				drop = filterNames(item, field, keepName, dropped)
+				if drop {
+					*dropped++
+				}
+			}
+			if !drop {
+				value.Index(kept).Set(item)
+				kept++
+			}
+		}
+		if kept == 0 && value.Len() > 0 {
+			value.Set(reflect.Zero(value.Type()))
+		} else {
+			value.SetLen(kept)
+		}
+	}
+	return false
+}
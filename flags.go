@@ -0,0 +1,160 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// CommandLineFlag is a flag the program registers, recovered from the string constants passed to the registering
+// calls. It documents the interface of an unknown tool without running it. cobra's flags are registered with pflag.
+type CommandLineFlag struct {
+	Name      string
+	Shorthand string `json:",omitempty"`
+	Type      string `json:",omitempty"` // as named by the registering call, ex: string, bool, duration, stringslice
+	Default   string `json:",omitempty"` // only recovered when it's a string constant
+	Usage     string `json:",omitempty"`
+	Library   string // flag or pflag
+	Function  string // the function registering it
+	Address   uint64 // of the registering call
+}
+
+// The packages registering flags and the name each is reported under
+var flagLibraries = []struct {
+	pkg  string
+	name string
+}{
+	{"flag", "flag"},
+	{"github.com/spf13/pflag", "pflag"},
+}
+
+var (
+	// the methods of flag and pflag registering a flag, named after the type of its value, Var for those taking the
+	// value and P for those taking a shorthand
+	flagMethodRegex = regexp.MustCompile(`^(Bool|BoolFunc|Count|Duration|Float32|Float64|Func|Int|Int8|Int16|Int32|Int64|` +
+		`Uint|Uint8|Uint16|Uint32|Uint64|String|IP|IPMask|IPNet|BytesBase64|BytesHex|StringArray|StringToString|` +
+		`StringToInt|StringToInt64|Text|[A-Z]\w*Slice)?(Var)?(P)?$`)
+	flagNameRegex = regexp.MustCompile(`^[A-Za-z0-9][\w.\-]*$`)
+)
+
+type flagAPI struct {
+	library   string
+	base      string // the type of the value, value for Var
+	shorthand bool
+}
+
+// extractFlags decodes the functions calling the registering functions. The name is the first string loaded before
+// the call and the usage the last. Libraries whose registering methods are small enough to be inlined, such as
+// kingpin, leave no call to find.
+func extractFlags(ctx context.Context, file *objfile.File, tab *gosym.Table) ([]CommandLineFlag, error) {
+	apis := make(map[uint64]flagAPI)
+	targets := make(map[uint64]bool)
+	for _, fn := range tab.Funcs {
+		if api, ok := newFlagAPI(fn.Name); ok {
+			apis[fn.Entry] = api
+			targets[fn.Entry] = true
+		}
+	}
+	if len(apis) == 0 {
+		return nil, nil
+	}
+
+	sections, err := loadStringSections(file)
+	if err != nil {
+		return nil, err
+	}
+	textStart, text, err := file.Text()
+	if err != nil {
+		return nil, err
+	}
+
+	var callers []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+		fn := tab.PCToFunc(pc)
+		if fn == nil || decoded[fn.Entry] || targets[fn.Entry] || flagLibrary(fn.PackageName()) != "" || isStdPackage(fn.PackageName()) {
+			continue
+		}
+		decoded[fn.Entry] = true
+		callers = append(callers, fn)
+	}
+
+	var flags []CommandLineFlag
+	for _, fn := range callers {
+		if ctx.Err() != nil {
+			break
+		}
+		caller := fn.Name
+		callStringArguments(file, sections, fn, targets, func(pc uint64, target uint64, strs []string) {
+			if flag, ok := newCommandLineFlag(apis[target], strs); ok {
+				flag.Function, flag.Address = caller, pc
+				flags = append(flags, flag)
+			}
+		})
+	}
+	return flags, nil
+}
+
+// newFlagAPI tells whether the function is one of the registering functions of flag or pflag, or their FlagSet
+// methods
+func newFlagAPI(name string) (flagAPI, bool) {
+	pkg := (&gosym.Sym{Name: name}).PackageName()
+	library := flagLibrary(pkg)
+	if library == "" || len(name) <= len(pkg)+1 {
+		return flagAPI{}, false
+	}
+	receiver, method := "", name[len(pkg)+1:]
+	if i := strings.LastIndexByte(method, '.'); i >= 0 {
+		receiver, method = method[:i], method[i+1:]
+	}
+	if receiver != "" && receiver != "(*FlagSet)" {
+		return flagAPI{}, false
+	}
+	match := flagMethodRegex.FindStringSubmatch(method)
+	if match == nil || method == "P" || (match[1] == "Text" && match[2] == "") {
+		return flagAPI{}, false
+	}
+	base := strings.ToLower(match[1])
+	if base == "" {
+		base = "value"
+	}
+	return flagAPI{library: library, base: base, shorthand: match[3] != ""}, true
+}
+
+// newCommandLineFlag reads the flag from the strings of a flag or pflag call. A shorthand is a single character
+// following the name, and only string flags have a default among the strings. An empty string isn't loaded, so
+// a string flag with a single other string is taken to have an empty default.
+func newCommandLineFlag(api flagAPI, strs []string) (CommandLineFlag, bool) {
+	// the arguments not fitting in registers are stored to the stack first, moving the usage before the name
+	if len(strs) > 1 && !flagNameRegex.MatchString(strs[0]) && flagNameRegex.MatchString(strs[1]) {
+		strs = append(strs[1:len(strs):len(strs)], strs[0])
+	}
+	if len(strs) == 0 || !flagNameRegex.MatchString(strs[0]) {
+		return CommandLineFlag{}, false
+	}
+	flag := CommandLineFlag{Name: strs[0], Type: api.base, Library: api.library}
+	rest := strs[1:]
+	if api.shorthand && len(rest) > 0 && len(rest[0]) == 1 {
+		flag.Shorthand, rest = rest[0], rest[1:]
+	}
+	if api.base == "string" && len(rest) > 1 {
+		flag.Default, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 0 {
+		flag.Usage = rest[len(rest)-1]
+	}
+	return flag, true
+}
+
+func flagLibrary(pkg string) string {
+	for _, library := range flagLibraries {
+		if packageMatches(pkg, library.pkg) {
+			return library.name
+		}
+	}
+	return ""
+}
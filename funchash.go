@@ -0,0 +1,136 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// Functions are hashed by the shapes of their instructions. Registers, constants and addresses are left out of the
+// shape, so the hashes survive recompilation and relinking as long as the code itself is the same.
+//
+// The exact hash matches functions with identical code. The MinHash estimates how much code two functions share:
+// every run of shingleSize instructions is hashed minHashSlots times with different seeds, and each slot keeps the
+// smallest value. The fraction of equal slots of two functions approximates the overlap of their instruction runs.
+const (
+	shingleSize  = 4
+	minHashSlots = 16
+)
+
+type functionHash struct {
+	exact   string
+	minHash []uint32
+	size    int // instructions, or 4 byte chunks without a decoder
+}
+
+// hashFunction decodes the function's instructions, architectures without a decoder fall back to its raw bytes
+func hashFunction(file *objfile.File, fn FuncMetadata) (functionHash, error) {
+	var shapes []string
+	err := file.Decode(fn.Start, fn.End, func(inst objfile.Instruction) bool {
+		shapes = append(shapes, inst.Shape)
+		return true
+	})
+
+	if err != nil {
+		code, err := file.ReadMemory(fn.Start, fn.End-fn.Start)
+		if err != nil {
+			return functionHash{}, err
+		}
+
+		shapes = shapes[:0]
+		for i := 0; i < len(code); i += 4 {
+			shapes = append(shapes, hex.EncodeToString(code[i:min(i+4, len(code))]))
+		}
+	}
+
+	h := sha1.New()
+	for _, shape := range shapes {
+		h.Write([]byte(shape))
+		h.Write([]byte{'\n'})
+	}
+	return functionHash{exact: hex.EncodeToString(h.Sum(nil)), minHash: minHashShapes(shapes), size: len(shapes)}, nil
+}
+
+func minHashShapes(shapes []string) []uint32 {
+	if len(shapes) == 0 {
+		return nil
+	}
+
+	signature := make([]uint32, minHashSlots)
+	for i := range signature {
+		signature[i] = ^uint32(0)
+	}
+
+	// functions shorter than a shingle are one shingle
+	count := max(len(shapes)-shingleSize+1, 1)
+	for start := 0; start < count; start++ {
+		h := fnv.New64a()
+		for _, shape := range shapes[start:min(start+shingleSize, len(shapes))] {
+			h.Write([]byte(shape))
+			h.Write([]byte{'\n'})
+		}
+		shingle := h.Sum64()
+
+		for slot := range signature {
+			if value := uint32(mixSeed(shingle, uint64(slot)) >> 32); value < signature[slot] {
+				signature[slot] = value
+			}
+		}
+	}
+	return signature
+}
+
+// mixSeed derives the slot's hash from the shingle hash, splitmix64 finalizer
+func mixSeed(x uint64, seed uint64) uint64 {
+	x ^= seed * 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func encodeMinHash(signature []uint32) string {
+	data := make([]byte, 4*len(signature))
+	for i, value := range signature {
+		binary.BigEndian.PutUint32(data[4*i:], value)
+	}
+	return hex.EncodeToString(data)
+}
+
+// minHashSimilarity estimates the share of instruction runs two functions have in common, from 0 to 1
+func minHashSimilarity(a []uint32, b []uint32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+// hashFunctions fills in the Hash and MinHash of each function
+func hashFunctions(fileName string, funcs []FuncMetadata) error {
+	file, err := objfile.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for i := range funcs {
+		hash, err := hashFunction(file, funcs[i])
+		if err != nil {
+			logger.Debug("failed to hash function", "function", funcs[i].FullName, "error", err)
+			continue
+		}
+		funcs[i].Hash = hash.exact
+		funcs[i].MinHash = encodeMinHash(hash.minHash)
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// FuzzyHash holds the similarity digests of the file or one of its sections, in the formats ssdeep and the tlsh tool
+// print, so they compare directly against hashes computed elsewhere
+type FuzzyHash struct {
+	Source string // file, or the name of the section
+	SSDEEP string
+	TLSH   string `json:",omitempty"` // not defined for less than 50 bytes or too uniform data
+}
+
+// The sections fuzzy hashed besides the file: the code and the read only data, as each format names them
+var fuzzyHashSections = map[string]bool{".text": true, "__text": true, ".rodata": true, "__rodata": true, ".rdata": true}
+
+// fuzzyHashes hashes the whole file, then the code and read only data sections in the order of the file
+func fuzzyHashes(file *objfile.File) ([]FuzzyHash, uint64, error) {
+	data, err := file.Data()
+	if err != nil {
+		return nil, 0, err
+	}
+	hashes := []FuzzyHash{{Source: "file", SSDEEP: ssdeepHash(data), TLSH: tlshHash(data)}}
+	hashed := uint64(len(data))
+
+	sections, err := file.Sections()
+	if err != nil {
+		return hashes, hashed, err
+	}
+	for _, sec := range sections {
+		if !fuzzyHashSections[sec.Name] || sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		if uint64(len(data)) > sec.FileSize {
+			data = data[:sec.FileSize]
+		}
+		hashes = append(hashes, FuzzyHash{Source: sec.Name, SSDEEP: ssdeepHash(data), TLSH: tlshHash(data)})
+		hashed += uint64(len(data))
+	}
+	return hashes, hashed, nil
+}
+
+// ssdeep, context triggered piecewise hashing as ssdeep 2.14 implements it. Digests are computed for every block size
+// at once, doubling from 3, and the smallest block size whose digest has at least 32 characters is reported along
+// with the digest of twice the block size.
+const (
+	ssdeepRollingWindow  = 7
+	ssdeepMinBlockSize   = 3
+	ssdeepSpamSumLength  = 64
+	ssdeepNumBlockHashes = 31
+	ssdeepHashInit       = 0x27 // the low 6 bits of the FNV offset basis, only those are kept
+	ssdeepHashPrime      = 0x01000193
+	ssdeepBase64         = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type ssdeepBlockHash struct {
+	digest     []byte
+	h          byte
+	halfh      byte // the hash of the second digest, truncated to half the length
+	halfDigest byte
+}
+
+// FNV-1 of the low 6 bits only depends on the low 6 bits of the hash and the byte, so it's a table lookup
+var ssdeepSumTable = func() (table [64][64]byte) {
+	for h := range table {
+		for c := range table[h] {
+			table[h][c] = byte((uint32(h)*ssdeepHashPrime ^ uint32(c)) & 0x3f)
+		}
+	}
+	return table
+}()
+
+func ssdeepBlockSize(index int) int {
+	return ssdeepMinBlockSize << index
+}
+
+func ssdeepHash(data []byte) string {
+	var window [ssdeepRollingWindow]byte
+	var h1, h2, h3, n uint32
+
+	blocks := make([]ssdeepBlockHash, 1, ssdeepNumBlockHashes)
+	blocks[0] = ssdeepBlockHash{h: ssdeepHashInit, halfh: ssdeepHashInit}
+	start := 0
+	for _, c := range data {
+		// the rolling hash of the last 7 bytes decides where the pieces end
+		h2 -= h1
+		h2 += ssdeepRollingWindow * uint32(c)
+		h1 += uint32(c)
+		h1 -= uint32(window[n%ssdeepRollingWindow])
+		window[n%ssdeepRollingWindow] = c
+		n++
+		h3 = h3<<5 ^ uint32(c)
+		rolling := h1 + h2 + h3
+
+		sums := &ssdeepSumTable
+		for i := start; i < len(blocks); i++ {
+			blocks[i].h = sums[blocks[i].h][c&0x3f]
+			blocks[i].halfh = sums[blocks[i].halfh][c&0x3f]
+		}
+
+		// a piece ending at a block size also ends at the smaller ones
+		for i := start; i < len(blocks); i++ {
+			blockSize := uint32(ssdeepBlockSize(i))
+			if rolling%blockSize != blockSize-1 {
+				break
+			}
+
+			// the next block size starts from the state of this one at its first piece, it would be the same
+			if len(blocks[i].digest) == 0 && len(blocks) < ssdeepNumBlockHashes {
+				last := blocks[len(blocks)-1]
+				blocks = append(blocks, ssdeepBlockHash{h: last.h, halfh: last.halfh})
+			}
+
+			block := &blocks[i]
+			block.halfDigest = ssdeepBase64[block.halfh]
+			if len(block.digest) < ssdeepSpamSumLength-1 {
+				block.digest = append(block.digest, ssdeepBase64[block.h])
+				block.h = ssdeepHashInit
+				if len(block.digest) < ssdeepSpamSumLength/2 {
+					block.halfh = ssdeepHashInit
+					block.halfDigest = 0
+				}
+				continue
+			}
+
+			// the last character keeps changing, and the smallest block size can go once the next one is long enough
+			if len(block.digest) == ssdeepSpamSumLength-1 {
+				block.digest = append(block.digest, ssdeepBase64[block.h])
+			} else {
+				block.digest[ssdeepSpamSumLength-1] = ssdeepBase64[block.h]
+			}
+			if len(blocks)-start >= 2 && ssdeepBlockSize(start)*ssdeepSpamSumLength < len(data) && len(blocks[start+1].digest) >= ssdeepSpamSumLength/2 {
+				start++
+			}
+		}
+	}
+	rolling := h1 + h2 + h3
+
+	index := start
+	for ssdeepBlockSize(index)*ssdeepSpamSumLength < len(data) && index < ssdeepNumBlockHashes-1 {
+		index++
+	}
+	for index >= len(blocks) {
+		index--
+	}
+	for index > start && len(blocks[index].digest) < ssdeepSpamSumLength/2 {
+		index--
+	}
+
+	// the digest of a full block hash already ends with its last character
+	var hash strings.Builder
+	fmt.Fprintf(&hash, "%d:", ssdeepBlockSize(index))
+	block := blocks[index]
+	digest := block.digest
+	if len(digest) == ssdeepSpamSumLength {
+		digest = digest[:ssdeepSpamSumLength-1]
+	}
+	hash.Write(digest)
+	if rolling != 0 {
+		hash.WriteByte(ssdeepBase64[block.h])
+	} else if len(block.digest) == ssdeepSpamSumLength {
+		hash.WriteByte(block.digest[ssdeepSpamSumLength-1])
+	}
+	hash.WriteByte(':')
+
+	if index < len(blocks)-1 {
+		block := blocks[index+1]
+		hash.Write(block.digest[:min(len(block.digest), ssdeepSpamSumLength/2-1)])
+		if rolling != 0 {
+			hash.WriteByte(ssdeepBase64[block.halfh])
+		} else if block.halfDigest != 0 {
+			hash.WriteByte(block.halfDigest)
+		}
+	} else if rolling != 0 {
+		hash.WriteByte(ssdeepBase64[block.h])
+	}
+	return hash.String()
+}
+
+// ssdeepCompare scores two digests from 0 to 100 the way ssdeep -d does. Only digests of the same or neighbouring
+// block sizes are comparable, and the pieces must have a 7 character substring in common to score at all.
+func ssdeepCompare(a string, b string) int {
+	parse := func(digest string) (int, string, string, bool) {
+		parts := strings.SplitN(digest, ":", 3)
+		if len(parts) != 3 {
+			return 0, "", "", false
+		}
+		blockSize, err := strconv.Atoi(parts[0])
+		if err != nil || blockSize <= 0 {
+			return 0, "", "", false
+		}
+		second, _, _ := strings.Cut(parts[2], ",")
+		return blockSize, ssdeepEliminateSequences(parts[1]), ssdeepEliminateSequences(second), true
+	}
+	blockSize1, a1, a2, ok := parse(a)
+	if !ok {
+		return 0
+	}
+	blockSize2, b1, b2, ok := parse(b)
+	if !ok {
+		return 0
+	}
+
+	switch {
+	case blockSize1 == blockSize2:
+		if a1 == b1 {
+			return 100
+		}
+		return max(ssdeepScoreStrings(a1, b1, blockSize1), ssdeepScoreStrings(a2, b2, blockSize1*2))
+	case blockSize1 == blockSize2*2:
+		return ssdeepScoreStrings(a1, b2, blockSize1)
+	case blockSize2 == blockSize1*2:
+		return ssdeepScoreStrings(a2, b1, blockSize2)
+	}
+	return 0
+}
+
+// ssdeepEliminateSequences drops characters repeated more than 3 times in a row, long runs say little about similarity
+func ssdeepEliminateSequences(digest string) string {
+	var out []byte
+	for i := 0; i < len(digest); i++ {
+		if i >= 3 && digest[i] == digest[i-1] && digest[i] == digest[i-2] && digest[i] == digest[i-3] {
+			continue
+		}
+		out = append(out, digest[i])
+	}
+	return string(out)
+}
+
+func ssdeepScoreStrings(a string, b string, blockSize int) int {
+	if len(a) > ssdeepSpamSumLength || len(b) > ssdeepSpamSumLength || !ssdeepCommonSubstring(a, b) {
+		return 0
+	}
+
+	// edit distance with insertions and deletions costing 1 and substitutions 2
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution += 2
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous, current = current, previous
+	}
+
+	score := previous[len(b)] * ssdeepSpamSumLength / (len(a) + len(b))
+	score = 100 * score / ssdeepSpamSumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+
+	// small block sizes of short digests match by chance, cap their score by how much data they describe
+	if blockSize >= (99+ssdeepRollingWindow)/ssdeepRollingWindow*ssdeepMinBlockSize {
+		return score
+	}
+	return min(score, blockSize/ssdeepMinBlockSize*min(len(a), len(b)))
+}
+
+func ssdeepCommonSubstring(a string, b string) bool {
+	if len(a) < ssdeepRollingWindow || len(b) < ssdeepRollingWindow {
+		return false
+	}
+	for i := 0; i+ssdeepRollingWindow <= len(a); i++ {
+		if strings.Contains(b, a[i:i+ssdeepRollingWindow]) {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSH as the tlsh tool prints it: version T1, 128 buckets and a 1 byte checksum
+const (
+	tlshWindowSize    = 5
+	tlshBuckets       = 128
+	tlshCodeSize      = tlshBuckets / 4
+	tlshMinDataLength = 50
+)
+
+// the Pearson hash permutation TLSH maps the byte triplets with
+var tlshPearson = [256]byte{
+	1, 87, 49, 12, 176, 178, 102, 166, 121, 193, 6, 84, 249, 230, 44, 163,
+	14, 197, 213, 181, 161, 85, 218, 80, 64, 239, 24, 226, 236, 142, 38, 200,
+	110, 177, 104, 103, 141, 253, 255, 50, 77, 101, 81, 18, 45, 96, 31, 222,
+	25, 107, 190, 70, 86, 237, 240, 34, 72, 242, 20, 214, 244, 227, 149, 235,
+	97, 234, 57, 22, 60, 250, 82, 175, 208, 5, 127, 199, 111, 62, 135, 248,
+	174, 169, 211, 58, 66, 154, 106, 195, 245, 171, 17, 187, 182, 179, 0, 243,
+	132, 56, 148, 75, 128, 133, 158, 100, 130, 126, 91, 13, 153, 246, 216, 219,
+	119, 68, 223, 78, 83, 88, 201, 99, 122, 11, 92, 32, 136, 114, 52, 10,
+	138, 30, 48, 183, 156, 35, 61, 26, 143, 74, 251, 94, 129, 162, 63, 152,
+	170, 7, 115, 167, 241, 206, 3, 150, 55, 59, 151, 220, 90, 53, 23, 131,
+	125, 173, 15, 238, 79, 95, 89, 16, 105, 137, 225, 224, 217, 160, 37, 123,
+	118, 73, 2, 157, 46, 116, 9, 145, 134, 228, 207, 212, 202, 215, 69, 229,
+	27, 188, 67, 124, 168, 252, 42, 4, 29, 108, 21, 247, 19, 205, 39, 203,
+	233, 40, 186, 147, 198, 192, 155, 33, 164, 191, 98, 204, 165, 180, 117, 76,
+	140, 36, 210, 172, 41, 54, 159, 8, 185, 232, 113, 196, 231, 47, 146, 120,
+	51, 65, 28, 144, 254, 221, 93, 189, 194, 139, 112, 43, 71, 109, 184, 209,
+}
+
+func tlshMapping(salt, i, j, k byte) byte {
+	h := tlshPearson[salt]
+	h = tlshPearson[h^i]
+	h = tlshPearson[h^j]
+	return tlshPearson[h^k]
+}
+
+// tlshHash returns an empty string when the hash isn't defined for the data
+func tlshHash(data []byte) string {
+	if len(data) < tlshMinDataLength || uint64(len(data)) > math.MaxUint32 {
+		return ""
+	}
+
+	// each byte and the 4 before it count 6 of their triplets into the buckets
+	var buckets [256]uint32
+	var checksum byte
+	for i := tlshWindowSize - 1; i < len(data); i++ {
+		c0, c1, c2, c3, c4 := data[i], data[i-1], data[i-2], data[i-3], data[i-4]
+		checksum = tlshMapping(0, c0, c1, checksum)
+		buckets[tlshMapping(2, c0, c1, c2)]++
+		buckets[tlshMapping(3, c0, c1, c3)]++
+		buckets[tlshMapping(5, c0, c2, c3)]++
+		buckets[tlshMapping(7, c0, c2, c4)]++
+		buckets[tlshMapping(11, c0, c1, c4)]++
+		buckets[tlshMapping(13, c0, c3, c4)]++
+	}
+
+	sorted := make([]uint32, tlshBuckets)
+	copy(sorted, buckets[:tlshBuckets])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	q1, q2, q3 := sorted[tlshBuckets/4-1], sorted[tlshBuckets/2-1], sorted[tlshBuckets*3/4-1]
+
+	// more than half of the buckets have to be used
+	nonzero := 0
+	for _, count := range buckets[:tlshBuckets] {
+		if count > 0 {
+			nonzero++
+		}
+	}
+	if nonzero <= tlshBuckets/2 {
+		return ""
+	}
+
+	// each bucket becomes 2 bits, the quartile of its count
+	var code [tlshCodeSize]byte
+	for i := range code {
+		for j := 0; j < 4; j++ {
+			switch count := buckets[4*i+j]; {
+			case q3 < count:
+				code[i] += 3 << (j * 2)
+			case q2 < count:
+				code[i] += 2 << (j * 2)
+			case q1 < count:
+				code[i] += 1 << (j * 2)
+			}
+		}
+	}
+
+	q1Ratio := byte(uint32(float32(q1*100)/float32(q3)) % 16)
+	q2Ratio := byte(uint32(float32(q2*100)/float32(q3)) % 16)
+	swap := func(b byte) byte { return b>>4 | b<<4 }
+
+	// the header bytes have their nibbles swapped and the code is written from its last byte
+	var hash strings.Builder
+	hash.WriteString("T1")
+	fmt.Fprintf(&hash, "%02X%02X%02X", swap(checksum), swap(tlshLength(len(data))), q1Ratio<<4|q2Ratio)
+	for i := tlshCodeSize - 1; i >= 0; i-- {
+		fmt.Fprintf(&hash, "%02X", code[i])
+	}
+	return hash.String()
+}
+
+// tlshLength encodes the data length on a logarithmic scale, finer for small lengths
+func tlshLength(length int) byte {
+	const (
+		log1_5 = 0.4054651
+		log1_3 = 0.26236426
+		log1_1 = 0.095310180
+	)
+	logLength := math.Log(float64(float32(length)))
+	var value int
+	switch {
+	case length <= 656:
+		value = int(math.Floor(logLength / log1_5))
+	case length <= 3199:
+		value = int(math.Floor(logLength/log1_3 - 8.72777))
+	default:
+		value = int(math.Floor(logLength/log1_1 - 62.5472))
+	}
+	return byte(value & 0xff)
+}
@@ -0,0 +1,148 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// ObfuscationMetadata identifies the obfuscator a binary was built with. Confidence is the sum of the weights of the
+// hallmarks found, from 0 to 1, so tools consuming the output can decide how much to trust the recovered names.
+type ObfuscationMetadata struct {
+	Obfuscator string `json:",omitempty"` // set once the confidence reaches garbleMinConfidence
+	Confidence float64
+	Indicators []string
+}
+
+// The hallmarks of garble and how much each contributes to the confidence. Hashed names are the most telling, the
+// others also show up in binaries built with -trimpath, stripped by hand or packed.
+const (
+	garbleWeightPackageNames = 0.35 // import paths replaced by a hash
+	garbleWeightFileNames    = 0.2  // source paths replaced by a hashed file name without directory
+	garbleWeightVersion      = 0.2  // the Go version of the build info replaced by unknown
+	garbleWeightMagic        = 0.15 // pclntab magic randomized
+	garbleWeightLiterals     = 0.1  // -literals decrypts each literal in an inline closure
+
+	garbleMinConfidence = 0.5
+
+	// share of the user packages or files that have to look hashed, a few short mixed case names happen naturally
+	garbleMinHashedRatio = 0.5
+
+	// share of closures among the user functions above which -literals is assumed, ordinary code stays well below
+	garbleMinClosureRatio = 0.25
+	garbleMinClosures     = 50
+)
+
+// garble hashes names into base64 without padding, of at least 6 characters
+var garbleHashRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{5,}$`)
+
+var closureRegex = regexp.MustCompile(`\.func\d+$`)
+
+// The magics of the pclntab layouts of Go 1.2, 1.16, 1.18 and 1.20
+var pclntabMagics = map[uint32]bool{0xfffffffb: true, 0xfffffffa: true, 0xfffffff0: true, 0xfffffff1: true}
+
+// detectGarble scores the hallmarks of garble. Returns nil when none was found.
+func detectGarble(file *objfile.File, tab *gosym.Table, metadata ExtractMetadata) *ObfuscationMetadata {
+	obfuscation := &ObfuscationMetadata{}
+	indicate := func(weight float64, format string, args ...any) {
+		obfuscation.Confidence += weight
+		obfuscation.Indicators = append(obfuscation.Indicators, fmt.Sprintf(format, args...))
+	}
+
+	userPackages := make(map[string]bool)
+	closures, userFunctions := 0, 0
+	for _, fn := range tab.Funcs {
+		pkg := fn.PackageName()
+		if isStdPackage(pkg) || pkg == "main" || pkg == "" {
+			continue
+		}
+		userPackages[pkg] = true
+		userFunctions++
+		if closureRegex.MatchString(fn.Name) {
+			closures++
+		}
+	}
+
+	hashedPackages := 0
+	for pkg := range userPackages {
+		if isGarbleHash(pkg) {
+			hashedPackages++
+		}
+	}
+	if len(userPackages) > 0 && float64(hashedPackages)/float64(len(userPackages)) >= garbleMinHashedRatio {
+		indicate(garbleWeightPackageNames, "%d of %d packages have hashed names", hashedPackages, len(userPackages))
+	}
+
+	files, hashedFiles := 0, 0
+	for name := range tab.Files {
+		if name == "<autogenerated>" || name == "??" {
+			continue
+		}
+		files++
+		if !strings.ContainsAny(name, "/\\") && isGarbleHash(strings.TrimSuffix(name, path.Ext(name))) {
+			hashedFiles++
+		}
+	}
+	if files > 0 && float64(hashedFiles)/float64(files) >= garbleMinHashedRatio {
+		indicate(garbleWeightFileNames, "%d of %d source files have hashed names", hashedFiles, files)
+	}
+
+	if metadata.BuildInfo.GoVersion == "unknown" {
+		indicate(garbleWeightVersion, "the build info Go version is unknown")
+	}
+
+	if magic, ok := readPclntabMagic(file, metadata.TabMeta.VA); ok && !pclntabMagics[magic] {
+		indicate(garbleWeightMagic, "pclntab magic 0x%08x is not a Go magic", magic)
+	}
+
+	if closures >= garbleMinClosures && float64(closures)/float64(userFunctions) >= garbleMinClosureRatio {
+		indicate(garbleWeightLiterals, "%d of %d functions are closures, as -literals generates", closures, userFunctions)
+	}
+
+	if len(obfuscation.Indicators) == 0 {
+		return nil
+	}
+	obfuscation.Confidence = math.Min(1, math.Round(obfuscation.Confidence*100)/100)
+	if obfuscation.Confidence >= garbleMinConfidence {
+		obfuscation.Obfuscator = "garble"
+	}
+	return obfuscation
+}
+
+// isGarbleHash tells hashes from package and file names, which are rarely in mixed case
+func isGarbleHash(name string) bool {
+	if !garbleHashRegex.MatchString(name) {
+		return false
+	}
+	return strings.ToLower(name) != name && strings.ToUpper(name) != name
+}
+
+// readPclntabMagic reads the first 4 bytes of the pclntab in either byte order, as the file holds them
+func readPclntabMagic(file *objfile.File, va uint64) (uint32, bool) {
+	sections, err := file.Sections()
+	if err != nil {
+		return 0, false
+	}
+	for _, sec := range sections {
+		if va < sec.Addr || va+4 > sec.Addr+sec.FileSize {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil || va-sec.Addr+4 > uint64(len(data)) {
+			return 0, false
+		}
+		magic := data[va-sec.Addr:]
+		if le := binary.LittleEndian.Uint32(magic); pclntabMagics[le] {
+			return le, true
+		}
+		return binary.BigEndian.Uint32(magic), true
+	}
+	return 0, false
+}
@@ -0,0 +1,39 @@
+# Python >= 3.6
+# Generates syscallnames.go from the syscall numbers of golang.org/x/sys/unix, run with the path of a checkout:
+#   python3 generatesyscalls.py ~/go/pkg/mod/golang.org/x/sys@v0.15.0
+import re
+import subprocess
+import sys
+
+OUTPUT_FILE = "syscallnames.go"
+VAR_NAME = "linuxSyscallNames"
+
+# the architectures GoReSym can disassemble
+ARCHITECTURES = ["386", "amd64", "arm64"]
+
+if len(sys.argv) != 2:
+    sys.exit(f"usage: {sys.argv[0]} path/to/golang.org/x/sys")
+
+tables = {}
+for arch in ARCHITECTURES:
+    names = {}
+    with open(f"{sys.argv[1]}/unix/zsysnum_linux_{arch}.go") as f:
+        for line in f:
+            m = re.match(r"\s*SYS_(\w+)\s*=\s*(\d+)", line)
+            if m and int(m.group(2)) not in names:
+                names[int(m.group(2))] = m.group(1).lower()
+    tables[arch] = names
+
+with open(OUTPUT_FILE, "w") as f:
+    f.write("// Code generated by generatesyscalls.py from golang.org/x/sys/unix. DO NOT EDIT.\n\n")
+    f.write("package main\n\n")
+    f.write(f"var {VAR_NAME} = map[string]map[int64]string{{\n")
+    for arch in ARCHITECTURES:
+        f.write(f"\t\"{arch}\": {{\n")
+        for number, name in sorted(tables[arch].items()):
+            f.write(f"\t\t{number}: \"{name}\",\n")
+        f.write("\t},\n")
+    f.write("}\n")
+
+# aligns the values the way the rest of the tree is formatted
+subprocess.run(["gofmt", "-w", OUTPUT_FILE], check=True)
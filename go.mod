@@ -6,11 +6,30 @@ require (
 	github.com/elliotchance/orderedmap v1.4.0
 	github.com/pkg/profile v1.7.0
 	golang.org/x/arch v0.0.0-20201008161808-52c3e6f60cff
+	golang.org/x/sys v0.22.0
+	golang.org/x/term v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.33.1
 	rsc.io/binaryregexp v0.2.0
 )
 
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	modernc.org/strutil v1.2.0 // indirect
+	modernc.org/token v1.1.0 // indirect
+)
+
 require (
 	github.com/felixge/fgprof v0.9.3 // indirect
-	github.com/google/pprof v0.0.0-20230728192033-2ba5b33183c6 // indirect
-	golang.org/x/exp v0.0.0-20230811145659-89c5cff77bcb
+	github.com/google/pprof v0.0.0-20240409012703-83162a5b38cd // indirect
+	golang.org/x/exp v0.0.0-20231108232855-2478ac86f678
 )
@@ -0,0 +1,159 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+// The bundled release list and vulnerabilities, see the comments at the top of each file
+//
+//go:embed goreleases/releases.txt
+var goReleasesList string
+
+//go:embed goreleases/vulnerabilities.txt
+var goVulnerabilitiesList string
+
+// GoRelease is the support status of the Go release the binary was built with and the known vulnerabilities of its
+// runtime and standard library, as of the bundled lists
+type GoRelease struct {
+	Release         string            // the major release, ex: 1.21
+	Released        string            `json:",omitempty"` // the date of its first version
+	Status          string            // supported, end-of-life, or unknown for releases newer than the bundled list
+	EndOfLife       string            `json:",omitempty"` // the date support ended, when the second newer release came out
+	Vulnerabilities []GoVulnerability `json:",omitempty"`
+}
+
+type GoVulnerability struct {
+	CVE     string
+	Package string
+	Fixed   string // the version of the same release fixing it, or of the oldest release that got the fix
+	Summary string
+}
+
+type goReleaseDatabase struct {
+	releases        []string // oldest first
+	released        map[string]string
+	vulnerabilities []goVulnerabilityEntry
+}
+
+type goVulnerabilityEntry struct {
+	cve     string
+	pkg     string
+	fixed   []goFix
+	summary string
+}
+
+type goFix struct {
+	introduced string // empty when all older versions are affected
+	fixed      string
+}
+
+// loadGoReleases parses the bundled lists
+func loadGoReleases() (*goReleaseDatabase, error) {
+	db := &goReleaseDatabase{released: make(map[string]string)}
+	err := readGoReleaseLines("releases", goReleasesList, func(fields []string) error {
+		if len(fields) != 2 {
+			return fmt.Errorf("expected release date")
+		}
+		db.releases = append(db.releases, fields[0])
+		db.released[fields[0]] = fields[1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readGoReleaseLines("vulnerabilities", goVulnerabilitiesList, func(fields []string) error {
+		if len(fields) < 4 {
+			return fmt.Errorf("expected CVE package fixed summary")
+		}
+		entry := goVulnerabilityEntry{cve: fields[0], pkg: fields[1], summary: strings.Join(fields[3:], " ")}
+		for _, fix := range strings.Split(fields[2], ",") {
+			introduced, fixed, ok := strings.Cut(fix, "..")
+			if !ok {
+				introduced, fixed = "", fix
+			}
+			entry.fixed = append(entry.fixed, goFix{introduced, fixed})
+		}
+		db.vulnerabilities = append(db.vulnerabilities, entry)
+		return nil
+	})
+	return db, err
+}
+
+func readGoReleaseLines(name string, list string, parse func(fields []string) error) error {
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parse(strings.Fields(line)); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// majorRelease returns the release of a semantic version, 1.21.3 -> 1.21
+func majorRelease(version string) string {
+	version, _, _ = strings.Cut(version, "-")
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// annotate returns the status of the binary's Go release, nil when the version wasn't recovered
+func (db *goReleaseDatabase) annotate(goVersion string) *GoRelease {
+	version := goSemver(goVersion)
+	if version == "" || version == "unknown" || !strings.HasPrefix(version, "1.") {
+		return nil
+	}
+
+	release := &GoRelease{Release: majorRelease(version), Status: "unknown"}
+	for i, r := range db.releases {
+		if r != release.Release {
+			continue
+		}
+		release.Released = db.released[r]
+		release.Status = "supported"
+		if i+2 < len(db.releases) {
+			release.Status = "end-of-life"
+			release.EndOfLife = db.released[db.releases[i+2]]
+		}
+	}
+
+	for _, vuln := range db.vulnerabilities {
+		if fixed, ok := vuln.affects(version); ok {
+			release.Vulnerabilities = append(release.Vulnerabilities, GoVulnerability{CVE: vuln.cve, Package: vuln.pkg, Fixed: fixed, Summary: vuln.summary})
+		}
+	}
+	return release
+}
+
+// affects reports whether the version is older than the fix of its release, or than every fix, with the fix that
+// applies
+func (vuln *goVulnerabilityEntry) affects(version string) (string, bool) {
+	var applies *goFix
+	for i, fix := range vuln.fixed {
+		if majorRelease(fix.fixed) == majorRelease(version) {
+			applies = &vuln.fixed[i]
+			break
+		}
+		if applies == nil || compareSemver(fix.fixed, applies.fixed) < 0 {
+			applies = &vuln.fixed[i]
+		}
+	}
+	if applies == nil || compareSemver(version, applies.fixed) >= 0 {
+		return "", false
+	}
+	if applies.introduced != "" && compareSemver(version, applies.introduced) < 0 {
+		return "", false
+	}
+	return applies.fixed, true
+}
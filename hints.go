@@ -0,0 +1,215 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// A hints file supplies names the analyst already knows, they replace recovered names everywhere in the output.
+// One hint per line, blank lines and lines starting with # are ignored:
+//
+//	0x4a57a0 main.decryptConfig      names whatever function or type starts at the address
+//	/^main\.a(\d+)$/ main.handler$1  renames every function or type matching the regex, $1 refers to a group
+type symbolHints struct {
+	addresses map[uint64]string
+	patterns  []hintPattern
+}
+
+type hintPattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+func loadHints(path string) (*symbolHints, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hints := &symbolHints{addresses: make(map[uint64]string)}
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the regex may contain spaces, so it ends at the last / rather than at whitespace
+		if strings.HasPrefix(line, "/") {
+			end := strings.LastIndex(line, "/")
+			name := strings.TrimSpace(line[end+1:])
+			if end == 0 || name == "" {
+				return nil, fmt.Errorf("%s:%d: expected /regex/ name", path, lineNumber)
+			}
+
+			re, err := regexp.Compile(line[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+			hints.patterns = append(hints.patterns, hintPattern{re, name})
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected address name", path, lineNumber)
+		}
+
+		address, err := strconv.ParseUint(parts[0], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", path, lineNumber, parts[0])
+		}
+		hints.addresses[address] = parts[1]
+	}
+	return hints, scanner.Err()
+}
+
+// rename returns the hinted name for a symbol, address hints take precedence over patterns
+func (h *symbolHints) rename(address uint64, name string) (string, bool) {
+	if hinted, ok := h.addresses[address]; ok {
+		return hinted, true
+	}
+	return h.renamePattern(name)
+}
+
+func (h *symbolHints) renamePattern(name string) (string, bool) {
+	for _, pattern := range h.patterns {
+		if pattern.re.MatchString(name) {
+			return pattern.re.ReplaceAllString(name, pattern.replacement), true
+		}
+	}
+	return name, false
+}
+
+var (
+	// a qualified type name in Go source, ex: main.Config
+	qualifiedNameRegex = regexp.MustCompile(`\b[A-Za-z_][A-Za-z0-9_]*\.[A-Za-z_][A-Za-z0-9_]*\b`)
+	// a C identifier, the reconstructions name *main.Config _ptr_main_Config
+	cIdentifierRegex = regexp.MustCompile(`\b[A-Za-z_][A-Za-z0-9_]*\b`)
+)
+
+// applyHints renames functions and types wherever the results name them, from the function and type lists to the
+// analyses, the composite types and the reconstructed sources. Address hints take precedence over patterns.
+func applyHints(metadata *ExtractMetadata, hints *symbolHints) {
+	renamedFunctions := make(map[string]string)
+	renamedTypes := make(map[string]string)
+	matched := make(map[uint64]bool)
+
+	functionNames := make(map[*FuncMetadata]string)
+	for _, functions := range [][]FuncMetadata{metadata.UserFunctions, metadata.StdFunctions} {
+		for i := range functions {
+			fn := &functions[i]
+			functionNames[fn] = fn.FullName
+			if name, ok := hints.rename(fn.Start, fn.FullName); ok {
+				if _, ok := hints.addresses[fn.Start]; ok {
+					matched[fn.Start] = true
+				}
+				renamedFunctions[fn.FullName] = name
+			}
+		}
+	}
+	for _, types := range [][]objfile.Type{metadata.Types, metadata.Interfaces} {
+		for _, typ := range types {
+			if name, ok := hints.rename(typ.VA, typ.Str); ok {
+				if _, ok := hints.addresses[typ.VA]; ok {
+					matched[typ.VA] = true
+				}
+				renamedTypes[typ.Str] = name
+			}
+		}
+	}
+
+	rewriteNames(reflect.ValueOf(metadata).Elem(), "", func(kind nameKind, name string) string {
+		switch kind {
+		case functionNameKind:
+			if renamed, ok := renamedFunctions[name]; ok {
+				return renamed
+			}
+			// standard functions aren't listed without -d, their names only appear in the analyses
+			renamed, _ := hints.renamePattern(name)
+			return renamed
+		case typeNameKind:
+			if renamed, ok := renamedTypes[name]; ok {
+				return renamed
+			}
+			if renamed, ok := hints.renamePattern(name); ok {
+				return renamed
+			}
+			// composite types, ex: []*main.a12
+			return qualifiedNameRegex.ReplaceAllStringFunc(name, func(qualified string) string {
+				if renamed, ok := renamedTypes[qualified]; ok {
+					return renamed
+				}
+				return qualified
+			})
+		}
+		return name
+	})
+
+	// the package follows the name
+	for fn, name := range functionNames {
+		if fn.FullName != name {
+			fn.PackageName = functionPackage(fn.FullName)
+		}
+	}
+
+	// the reconstructed sources name the types in Go and in C
+	cNames := make(map[string]string)
+	for original, renamed := range renamedTypes {
+		cNames[objfile.CTypeName(original)] = objfile.CTypeName(renamed)
+	}
+	for _, types := range [][]objfile.Type{metadata.Types, metadata.Interfaces} {
+		for i := range types {
+			if types[i].CStr != "" {
+				types[i].CStr = objfile.CTypeName(types[i].Str)
+			}
+			types[i].Reconstructed = renameInSource(types[i].Reconstructed, renamedTypes, cNames)
+			types[i].CReconstructed = renameInSource(types[i].CReconstructed, renamedTypes, cNames)
+		}
+	}
+
+	for address, name := range hints.addresses {
+		if !matched[address] {
+			logger.Info("hint matched no function or type", hexAttr("address", address), "name", name)
+		}
+	}
+}
+
+// renameInSource renames the types a reconstructed definition refers to, by their Go names and their C names, which
+// carry a _ptr_ or _slice_ prefix for pointers and slices
+func renameInSource(source string, renamed map[string]string, cNames map[string]string) string {
+	if source == "" || len(renamed) == 0 {
+		return source
+	}
+	source = qualifiedNameRegex.ReplaceAllStringFunc(source, func(qualified string) string {
+		if name, ok := renamed[qualified]; ok {
+			return name
+		}
+		return qualified
+	})
+	return cIdentifierRegex.ReplaceAllStringFunc(source, func(identifier string) string {
+		base := identifier
+		for {
+			if rest, ok := strings.CutPrefix(base, "_ptr_"); ok {
+				base = rest
+			} else if rest, ok := strings.CutPrefix(base, "_slice_"); ok {
+				base = rest
+			} else {
+				break
+			}
+		}
+		if name, ok := cNames[base]; ok {
+			return identifier[:len(identifier)-len(base)] + name
+		}
+		return identifier
+	})
+}
@@ -0,0 +1,563 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "modernc.org/sqlite" // the database/sql driver of the index, in pure Go
+)
+
+// GoReSym index keeps the symbols, strings and hashes of analyzed samples in a SQLite database and ranks them by how
+// much they share with a new sample. An IndexEntry is what's stored of a sample, identified by the SHA-256 of the input.
+type IndexEntry struct {
+	ID             string // SHA-256 of the indexed binary or report
+	Name           string // the path it was added from
+	Version        string `json:",omitempty"`
+	BuildId        string `json:",omitempty"`
+	SimHash        string `json:",omitempty"`
+	Functions      []string
+	FunctionHashes []string    `json:",omitempty"` // of the user functions, present for binaries and -funchash reports
+	Strings        []string    `json:",omitempty"`
+	FuzzyHashes    []FuzzyHash `json:",omitempty"`
+	Added          time.Time
+}
+
+// IndexMatch is an indexed sample similar to the query. The similarities are 0 to 1, Score is their mean over the
+// ones both samples have data for.
+type IndexMatch struct {
+	ID              string
+	Name            string
+	Score           float64
+	Functions       float64  // Jaccard similarity of the user function names
+	FunctionHashes  float64  `json:",omitempty"` // of the user function code
+	Strings         float64  `json:",omitempty"`
+	FuzzyHash       float64  `json:",omitempty"` // the best ssdeep match of the file or a section of the same name
+	SimHashDistance int      // bits, see simhash.go
+	SameBuildId     bool     `json:",omitempty"`
+	SharedFunctions []string `json:",omitempty"` // the first few, as evidence
+}
+
+type IndexQueryResult struct {
+	Query   string
+	Indexed int // samples searched
+	Matches []IndexMatch
+}
+
+// The detections loadIndexInput runs, the fuzzy hashes other runs leave out included
+var indexDetectors = detectorSet{"simhash": true, "fuzzy-hashes": true}
+
+const (
+	// the shared function names listed per match
+	maxSharedFunctions = 10
+
+	// strings shorter than this are too common to tell samples apart
+	minIndexStringLength = 6
+)
+
+// loadIndexInput reads a GoReSym JSON report, or analyzes a binary the way the index needs it
+func loadIndexInput(ctx context.Context, fileName string) (IndexEntry, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	entry := IndexEntry{ID: sha256Hex(data), Name: fileName, Added: time.Now().UTC()}
+
+	var metadata ExtractMetadata
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &metadata); err != nil {
+			return entry, fmt.Errorf("failed to read report %s: %w", fileName, err)
+		}
+	} else {
+		metadata, err = analyzeFile(ctx, fileName, indexDetectors, false, false, false, true, false, 0, "")
+		if err != nil {
+			return entry, fmt.Errorf("failed to parse %s: %w", fileName, err)
+		}
+		if err := hashFunctions(fileName, metadata.UserFunctions); err != nil {
+			logger.Warn("indexing without function hashes", "file", fileName, "error", err)
+		}
+	}
+
+	entry.Version = metadata.Version
+	entry.BuildId = metadata.BuildId
+	entry.SimHash = metadata.SimHash
+	entry.FuzzyHashes = metadata.FuzzyHashes
+	for _, fn := range metadata.UserFunctions {
+		entry.Functions = append(entry.Functions, fn.FullName)
+		if fn.Hash != "" {
+			entry.FunctionHashes = append(entry.FunctionHashes, fn.Hash)
+		}
+	}
+	for _, str := range metadata.Strings {
+		if len(str.Value) >= minIndexStringLength {
+			entry.Strings = append(entry.Strings, str.Value)
+		}
+	}
+	entry.Functions = sortedUnique(entry.Functions)
+	entry.FunctionHashes = sortedUnique(entry.FunctionHashes)
+	entry.Strings = sortedUnique(entry.Strings)
+	return entry, nil
+}
+
+func sortedUnique(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// The index database, each kind of feature in a table indexed by value so a query only visits the samples sharing
+// something with it. Fuzzy hashes are looked up by block size, ssdeep only compares digests of neighbouring ones.
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS samples (
+	id INTEGER PRIMARY KEY,
+	sha256 TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL,
+	version TEXT NOT NULL,
+	build_id TEXT NOT NULL,
+	simhash TEXT NOT NULL,
+	functions INTEGER NOT NULL,
+	function_hashes INTEGER NOT NULL,
+	strings INTEGER NOT NULL,
+	added TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS samples_build_id ON samples (build_id);
+CREATE TABLE IF NOT EXISTS functions (name TEXT NOT NULL, sample INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS functions_name ON functions (name, sample);
+CREATE INDEX IF NOT EXISTS functions_sample ON functions (sample);
+CREATE TABLE IF NOT EXISTS strings (value TEXT NOT NULL, sample INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS strings_value ON strings (value, sample);
+CREATE INDEX IF NOT EXISTS strings_sample ON strings (sample);
+CREATE TABLE IF NOT EXISTS hashes (kind TEXT NOT NULL, source TEXT NOT NULL, value TEXT NOT NULL, block_size INTEGER NOT NULL, sample INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS hashes_value ON hashes (kind, value, sample);
+CREATE INDEX IF NOT EXISTS hashes_block_size ON hashes (kind, source, block_size);
+CREATE INDEX IF NOT EXISTS hashes_sample ON hashes (sample);
+`
+
+// The kinds of the hashes table: the code of a user function, and the fuzzy hashes of the file and its sections
+const (
+	functionHashKind = "function"
+	ssdeepHashKind   = "ssdeep"
+	tlshHashKind     = "tlsh"
+)
+
+// openIndex opens the index database, creating it and its tables if needed. It holds a single connection, the
+// temporary tables of a query live on the connection that created them.
+func openIndex(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	// another process adding to the index holds the write lock for the length of its transaction
+	if _, err := db.ExecContext(ctx, "PRAGMA busy_timeout = 10000;"+indexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open index %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// ssdeepDigestBlockSize is the block size a digest starts with, 0 for malformed ones
+func ssdeepDigestBlockSize(digest string) int {
+	blockSize, _, _ := strings.Cut(digest, ":")
+	size, _ := strconv.Atoi(blockSize)
+	return size
+}
+
+// insertAll runs the prepared statement once per row
+func insertAll(ctx context.Context, tx *sql.Tx, statement string, rows [][]any) error {
+	stmt, err := tx.PrepareContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addToIndex replaces the entry in one transaction, so a concurrent query never reads half an entry
+func addToIndex(ctx context.Context, db *sql.DB, entry IndexEntry) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"functions", "strings", "hashes"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE sample IN (SELECT id FROM samples WHERE sha256 = ?)", entry.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM samples WHERE sha256 = ?", entry.ID); err != nil {
+		return err
+	}
+	inserted, err := tx.ExecContext(ctx, "INSERT INTO samples (sha256, name, version, build_id, simhash, functions, function_hashes, strings, added) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.ID, entry.Name, entry.Version, entry.BuildId, entry.SimHash,
+		len(entry.Functions), len(entry.FunctionHashes), len(entry.Strings), entry.Added.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	sample, err := inserted.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	var functions, strs, hashes [][]any
+	for _, name := range entry.Functions {
+		functions = append(functions, []any{name, sample})
+	}
+	for _, value := range entry.Strings {
+		strs = append(strs, []any{value, sample})
+	}
+	for _, hash := range entry.FunctionHashes {
+		hashes = append(hashes, []any{functionHashKind, "", hash, 0, sample})
+	}
+	for _, hash := range entry.FuzzyHashes {
+		hashes = append(hashes, []any{ssdeepHashKind, hash.Source, hash.SSDEEP, ssdeepDigestBlockSize(hash.SSDEEP), sample})
+		if hash.TLSH != "" {
+			hashes = append(hashes, []any{tlshHashKind, hash.Source, hash.TLSH, 0, sample})
+		}
+	}
+	if err := insertAll(ctx, tx, "INSERT INTO functions VALUES (?, ?)", functions); err != nil {
+		return err
+	}
+	if err := insertAll(ctx, tx, "INSERT INTO strings VALUES (?, ?)", strs); err != nil {
+		return err
+	}
+	if err := insertAll(ctx, tx, "INSERT INTO hashes VALUES (?, ?, ?, ?, ?)", hashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// indexCandidate is an indexed sample sharing something with the query, with what the database counted of it
+type indexCandidate struct {
+	ID                   string
+	Name                 string
+	BuildId              string
+	SimHash              string
+	Functions            int // of the sample
+	FunctionHashes       int
+	Strings              int
+	SharedFunctions      int
+	SharedFunctionHashes int
+	SharedStrings        int
+	SharedFunctionNames  []string // the first few
+	FuzzyHashes          []FuzzyHash
+}
+
+// The candidates are the samples sharing a function name, code hash or string with the query, a fuzzy hash of a
+// comparable block size or the build ID. Only those are counted and returned, the query's own values are in the
+// temporary query_ tables.
+const indexQuery = `
+WITH shared_functions AS (
+	SELECT f.sample, count(*) AS n FROM query_functions q JOIN functions f ON f.name = q.value GROUP BY f.sample
+), shared_function_hashes AS (
+	SELECT h.sample, count(*) AS n FROM query_function_hashes q JOIN hashes h ON h.kind = 'function' AND h.value = q.value GROUP BY h.sample
+), shared_strings AS (
+	SELECT s.sample, count(*) AS n FROM query_strings q JOIN strings s ON s.value = q.value GROUP BY s.sample
+), candidates AS (
+	SELECT sample FROM shared_functions
+	UNION SELECT sample FROM shared_function_hashes
+	UNION SELECT sample FROM shared_strings
+	UNION SELECT h.sample FROM query_fuzzy_hashes q JOIN hashes h
+		ON h.kind = 'ssdeep' AND h.source = q.source AND h.block_size IN (q.block_size / 2, q.block_size, q.block_size * 2)
+	UNION SELECT id FROM samples WHERE build_id != '' AND build_id = @build_id
+)
+SELECT s.sha256, s.name, s.build_id, s.simhash, s.functions, s.function_hashes, s.strings,
+	coalesce(sf.n, 0), coalesce(sh.n, 0), coalesce(ss.n, 0),
+	(
+		SELECT json_group_array(name) FROM (
+			SELECT f.name FROM functions f JOIN query_functions q ON q.value = f.name WHERE f.sample = s.id ORDER BY f.name LIMIT @shared_functions
+		)
+	),
+	(
+		SELECT json_group_array(json_object('Source', source, 'SSDEEP', value)) FROM hashes WHERE sample = s.id AND kind = 'ssdeep'
+	)
+FROM candidates c JOIN samples s ON s.id = c.sample
+LEFT JOIN shared_functions sf ON sf.sample = s.id
+LEFT JOIN shared_function_hashes sh ON sh.sample = s.id
+LEFT JOIN shared_strings ss ON ss.sample = s.id
+WHERE s.sha256 != @id
+`
+
+// findIndexCandidates looks the query up in the database, returning the size of the index and the candidates. The
+// temporary tables are dropped with the transaction they were created in.
+func findIndexCandidates(ctx context.Context, db *sql.DB, query IndexEntry) (int, []indexCandidate, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	for table, values := range map[string][]string{"query_functions": query.Functions, "query_function_hashes": query.FunctionHashes, "query_strings": query.Strings} {
+		if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE "+table+" (value TEXT PRIMARY KEY)"); err != nil {
+			return 0, nil, err
+		}
+		var rows [][]any
+		for _, value := range values {
+			rows = append(rows, []any{value})
+		}
+		if err := insertAll(ctx, tx, "INSERT OR IGNORE INTO "+table+" VALUES (?)", rows); err != nil {
+			return 0, nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE query_fuzzy_hashes (source TEXT NOT NULL, block_size INTEGER NOT NULL)"); err != nil {
+		return 0, nil, err
+	}
+	var fuzzyHashes [][]any
+	for _, hash := range query.FuzzyHashes {
+		fuzzyHashes = append(fuzzyHashes, []any{hash.Source, ssdeepDigestBlockSize(hash.SSDEEP)})
+	}
+	if err := insertAll(ctx, tx, "INSERT INTO query_fuzzy_hashes VALUES (?, ?)", fuzzyHashes); err != nil {
+		return 0, nil, err
+	}
+
+	var indexed int
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM samples").Scan(&indexed); err != nil {
+		return 0, nil, err
+	}
+	rows, err := tx.QueryContext(ctx, indexQuery,
+		sql.Named("build_id", query.BuildId), sql.Named("shared_functions", maxSharedFunctions), sql.Named("id", query.ID))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var candidates []indexCandidate
+	for rows.Next() {
+		var candidate indexCandidate
+		var sharedFunctionNames, fuzzyHashes string
+		if err := rows.Scan(&candidate.ID, &candidate.Name, &candidate.BuildId, &candidate.SimHash,
+			&candidate.Functions, &candidate.FunctionHashes, &candidate.Strings,
+			&candidate.SharedFunctions, &candidate.SharedFunctionHashes, &candidate.SharedStrings,
+			&sharedFunctionNames, &fuzzyHashes); err != nil {
+			return 0, nil, err
+		}
+		if err := json.Unmarshal([]byte(sharedFunctionNames), &candidate.SharedFunctionNames); err != nil {
+			return 0, nil, fmt.Errorf("failed to read the candidates: %w", err)
+		}
+		if err := json.Unmarshal([]byte(fuzzyHashes), &candidate.FuzzyHashes); err != nil {
+			return 0, nil, fmt.Errorf("failed to read the candidates: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return indexed, candidates, rows.Err()
+}
+
+// jaccard is the share of the union two sets have in common, from their sizes and how many values they share
+func jaccard(a int, b int, shared int) float64 {
+	if a+b == 0 {
+		return 0
+	}
+	return float64(shared) / float64(a+b-shared)
+}
+
+// compareIndexCandidate scores how similar an indexed sample is to the query
+func compareIndexCandidate(query IndexEntry, candidate indexCandidate) IndexMatch {
+	match := IndexMatch{ID: candidate.ID, Name: candidate.Name, SimHashDistance: -1}
+	var scores []float64
+
+	if len(query.Functions) > 0 && candidate.Functions > 0 {
+		match.Functions = jaccard(len(query.Functions), candidate.Functions, candidate.SharedFunctions)
+		match.SharedFunctions = candidate.SharedFunctionNames
+		scores = append(scores, match.Functions)
+	}
+	if len(query.FunctionHashes) > 0 && candidate.FunctionHashes > 0 {
+		match.FunctionHashes = jaccard(len(query.FunctionHashes), candidate.FunctionHashes, candidate.SharedFunctionHashes)
+		scores = append(scores, match.FunctionHashes)
+	}
+	if len(query.Strings) > 0 && candidate.Strings > 0 {
+		match.Strings = jaccard(len(query.Strings), candidate.Strings, candidate.SharedStrings)
+		scores = append(scores, match.Strings)
+	}
+
+	compared := false
+	for _, a := range query.FuzzyHashes {
+		for _, b := range candidate.FuzzyHashes {
+			if a.Source != b.Source {
+				continue
+			}
+			compared = true
+			match.FuzzyHash = max(match.FuzzyHash, float64(ssdeepCompare(a.SSDEEP, b.SSDEEP))/100)
+		}
+	}
+	if compared {
+		scores = append(scores, match.FuzzyHash)
+	}
+
+	if distance, err := simHashDistance(query.SimHash, candidate.SimHash); err == nil {
+		match.SimHashDistance = distance
+	}
+
+	for _, score := range scores {
+		match.Score += score
+	}
+	if len(scores) > 0 {
+		match.Score /= float64(len(scores))
+	}
+
+	// the build ID hashes the inputs of the build, the same ID is the same program however the file was altered after
+	match.SameBuildId = query.BuildId != "" && query.BuildId == candidate.BuildId
+	if match.SameBuildId {
+		match.Score = 1
+	}
+	return match
+}
+
+// queryIndex ranks the indexed samples by similarity to the query, the best first. Samples sharing nothing with the
+// query aren't read at all.
+func queryIndex(ctx context.Context, db *sql.DB, query IndexEntry, limit int) (IndexQueryResult, error) {
+	result := IndexQueryResult{Query: query.Name}
+	indexed, candidates, err := findIndexCandidates(ctx, db, query)
+	if err != nil {
+		return result, err
+	}
+	result.Indexed = indexed
+	for _, candidate := range candidates {
+		if match := compareIndexCandidate(query, candidate); match.Score > 0 {
+			result.Matches = append(result.Matches, match)
+		}
+	}
+
+	sort.Slice(result.Matches, func(i, j int) bool {
+		if result.Matches[i].Score != result.Matches[j].Score {
+			return result.Matches[i].Score > result.Matches[j].Score
+		}
+		return result.Matches[i].Name < result.Matches[j].Name
+	})
+	if limit > 0 && len(result.Matches) > limit {
+		result.Matches = result.Matches[:limit]
+	}
+	return result, nil
+}
+
+func printIndexQueryForHuman(w io.Writer, result IndexQueryResult) {
+	fmt.Fprintf(w, "%d similar of %d indexed samples to %s\n\n", len(result.Matches), result.Indexed, result.Query)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCORE\tFUNCS\tCODE\tSTRINGS\tSSDEEP\tSIMHASH\tSAMPLE")
+	for _, match := range result.Matches {
+		name := match.Name
+		if match.SameBuildId {
+			name += " (same build ID)"
+		}
+		fmt.Fprintf(tw, "%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%d\t%s\n", match.Score, match.Functions, match.FunctionHashes, match.Strings, match.FuzzyHash, match.SimHashDistance, name)
+	}
+	tw.Flush()
+}
+
+func indexMain(args []string) int {
+	flags := flag.NewFlagSet("index", flag.ExitOnError)
+	indexPath := flags.String("db", "", "SQLite database holding the index, created if needed")
+	humanView := flags.Bool("human", false, "Human view, print the matches as a table rather than json")
+	limit := flags.Int("n", 10, "Report at most this many matches, 0 for all")
+	timeout := flags.Duration("timeout", 0, "Stop analysis of each binary after this long, ex: 30s")
+	outputPath := flags.String("o", "", "Write the matches to this file instead of stdout. It's replaced atomically once the query completes")
+	flags.Parse(args)
+
+	usage := "usage: GoReSym index -db file add file... | query file"
+	if *indexPath == "" || flags.NArg() < 2 || (flags.Arg(0) != "add" && flags.Arg(0) != "query") || (flags.Arg(0) == "query" && flags.NArg() != 2) {
+		fmt.Println(TextToJson("error", usage))
+		return exitError
+	}
+
+	load := func(fileName string) (IndexEntry, error) {
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+		return loadIndexInput(ctx, fileName)
+	}
+
+	if flags.Arg(0) == "add" {
+		db, err := openIndex(context.Background(), *indexPath)
+		if err != nil {
+			fmt.Println(TextToJson("error", err.Error()))
+			return exitError
+		}
+		defer db.Close()
+
+		exitCode := exitOK
+		for _, fileName := range flags.Args()[1:] {
+			entry, err := load(fileName)
+			if err == nil {
+				err = addToIndex(context.Background(), db, entry)
+			}
+			if err != nil {
+				fmt.Println(TextToJson("error", err.Error()))
+				exitCode = exitError
+				continue
+			}
+			logger.Info("indexed", "file", fileName, "id", entry.ID, "functions", len(entry.Functions), "strings", len(entry.Strings))
+		}
+		return exitCode
+	}
+
+	query, err := load(flags.Arg(1))
+	if err != nil {
+		fmt.Println(TextToJson("error", err.Error()))
+		return exitCodeForError(err)
+	}
+	// a missing database is an empty index, rather than one created by the query
+	result := IndexQueryResult{Query: query.Name}
+	if _, err := os.Stat(*indexPath); !errors.Is(err, fs.ErrNotExist) {
+		db, err := openIndex(context.Background(), *indexPath)
+		if err == nil {
+			defer db.Close()
+			result, err = queryIndex(context.Background(), db, query, *limit)
+		}
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to query index: %s", err)))
+			return exitError
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	var outputFile *atomicFile
+	if *outputPath != "" {
+		outputFile, err = createAtomicFile(*outputPath)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to create output file: %s", err)))
+			return exitError
+		}
+		out = outputFile
+	}
+
+	if *humanView {
+		printIndexQueryForHuman(out, result)
+	} else {
+		fmt.Fprintln(out, DataToJson(result))
+	}
+
+	if outputFile != nil {
+		if err := outputFile.Commit(); err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to write output file: %s", err)))
+			return exitError
+		}
+	}
+	return exitOK
+}
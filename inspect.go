@@ -0,0 +1,286 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/mandiant/GoReSym/buildinfo"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// GoReSym inspect answers the triage questions only: is this a Go binary, which Go release built it, and where are
+// the structures GoReSym would parse. It locates the pclntab and moduledata but doesn't enumerate functions, types or strings.
+type InspectArtifact struct {
+	Name    string // pclntab, moduledata, buildinfo, typelinks, itablinks or dwarf
+	Present bool
+	Section string `json:",omitempty"`
+	VA      uint64 `json:",omitempty"`
+	Offset  uint64 `json:",omitempty"` // file offset
+	Size    uint64 `json:",omitempty"` // bytes, or entries for typelinks and itablinks
+	Detail  string `json:",omitempty"`
+}
+
+type InspectReport struct {
+	File      string
+	IsGo      bool
+	Version   string `json:",omitempty"`
+	Arch      string `json:",omitempty"`
+	Artifacts []InspectArtifact
+}
+
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+var dwarfSectionNames = []string{".debug_info", ".zdebug_info", "__debug_info", "__zdebug_info"}
+
+func inspectFile(ctx context.Context, fileName string) (InspectReport, error) {
+	report := InspectReport{File: fileName}
+
+	file, err := objfile.Open(fileName)
+	if err != nil {
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			err = fmt.Errorf("%w: %w", errNotGoBinary, err)
+		}
+		return report, fmt.Errorf("invalid file: %w", err)
+	}
+	defer file.Close()
+
+	sections, err := file.Sections()
+	if err != nil {
+		return report, err
+	}
+
+	fileData, err := file.Data()
+	if err != nil {
+		return report, err
+	}
+
+	report.Arch = file.GOARCH()
+	report.Artifacts = append(report.Artifacts, inspectBuildInfo(fileName, fileData, sections, &report))
+	if report.Version == "" {
+		// moduledata layouts differ between releases, without a version old binaries aren't recognized
+		report.Version = normalizeGoVersion(scanGoVersion(fileData))
+	}
+
+	pclntab := InspectArtifact{Name: "pclntab"}
+	moduledata := InspectArtifact{Name: "moduledata"}
+	typelinks := InspectArtifact{Name: "typelinks"}
+	itablinks := InspectArtifact{Name: "itablinks"}
+
+	// same search as a full analysis, but the first candidate with a matching moduledata is enough to know where things are
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	defer cancelScan()
+	ch_tabs, err := file.PCLineTable(scanCtx, "", 0, 0)
+	if err != nil {
+		return report, fmt.Errorf("failed to read pclntab: %w", err)
+	}
+
+	for tab := range ch_tabs {
+		line := tab.ParsedPclntab.Go12line
+		_, moduleData, err := file.ModuleDataTable(ctx, tab.PclntabVA, report.Version, line.Version.String(), line.Ptrsize == 8, line.Binary.String() == "LittleEndian")
+		if err != nil || moduleData == nil {
+			continue
+		}
+
+		pclntab = locateArtifact("pclntab", sections, tab.PclntabVA)
+		pclntab.Size = uint64(len(tab.Pclntab))
+		pclntab.Detail = fmt.Sprintf("layout %s, %s, %d bit pointers", line.Version.String(), line.Binary.String(), line.Ptrsize*8)
+
+		moduledata = locateArtifact("moduledata", sections, moduleData.VA)
+		if moduleData.Typelinks.Len > 0 {
+			typelinks = locateArtifact("typelinks", sections, uint64(moduleData.Typelinks.Data))
+			typelinks.Size = moduleData.Typelinks.Len
+		}
+		if moduleData.ITablinks.Len > 0 {
+			itablinks = locateArtifact("itablinks", sections, uint64(moduleData.ITablinks.Data))
+			itablinks.Size = moduleData.ITablinks.Len
+		}
+
+		if report.Version == "" {
+			report.Version = pclntabReleases(line.Version.String())
+		}
+		break
+	}
+	cancelScan()
+
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	report.IsGo = pclntab.Present
+	report.Artifacts = append(report.Artifacts, pclntab, moduledata, typelinks, itablinks, inspectDWARF(sections))
+	return report, nil
+}
+
+// inspectBuildInfo finds the buildinfo header, it's in its own section for ELF and Mach-O but anywhere in the data of PE files
+func inspectBuildInfo(fileName string, fileData []byte, sections []objfile.Section, report *InspectReport) InspectArtifact {
+	artifact := InspectArtifact{Name: "buildinfo"}
+
+	// the header is 16 byte aligned, skip matches that aren't
+	offset := 0
+	for {
+		idx := bytes.Index(fileData[offset:], buildInfoMagic)
+		if idx == -1 {
+			return artifact
+		}
+		offset += idx
+		if offset%16 == 0 {
+			break
+		}
+		offset++
+	}
+
+	artifact.Present = true
+	artifact.Offset = uint64(offset)
+	for _, sec := range sections {
+		if sec.FileSize != 0 && artifact.Offset >= sec.Offset && artifact.Offset-sec.Offset < sec.FileSize {
+			artifact.Section = sec.Name
+			artifact.VA = sec.Addr + artifact.Offset - sec.Offset
+			break
+		}
+	}
+
+	if bi, err := buildinfo.ReadFile(fileName); err == nil {
+		report.Version = normalizeGoVersion(bi.GoVersion)
+		artifact.Detail = bi.Main.Path
+	} else {
+		artifact.Detail = err.Error()
+	}
+	return artifact
+}
+
+func inspectDWARF(sections []objfile.Section) InspectArtifact {
+	for _, sec := range sections {
+		for _, name := range dwarfSectionNames {
+			if sec.Name == name {
+				return InspectArtifact{Name: "dwarf", Present: true, Section: sec.Name, VA: sec.Addr, Offset: sec.Offset, Size: sec.FileSize}
+			}
+		}
+	}
+	return InspectArtifact{Name: "dwarf"}
+}
+
+// locateArtifact fills in the section and file offset of a virtual address
+func locateArtifact(name string, sections []objfile.Section, VA uint64) InspectArtifact {
+	artifact := InspectArtifact{Name: name, Present: true, VA: VA}
+	for _, sec := range sections {
+		if sec.Contains(VA) {
+			artifact.Section = sec.Name
+			artifact.Offset = sec.Offset + VA - sec.Addr
+			break
+		}
+	}
+	return artifact
+}
+
+// pclntabReleases is the closest thing to a version when there's no buildinfo, the range of releases using the layout
+func pclntabReleases(layout string) string {
+	switch layout {
+	case "1.2":
+		return "1.2-1.15"
+	case "1.16":
+		return "1.16-1.17"
+	case "1.18":
+		return "1.18-1.19"
+	case "1.20":
+		return "1.20-" + maxSupportedGoVersion
+	}
+	return ""
+}
+
+func printInspectForHuman(w io.Writer, report InspectReport) {
+	fmt.Fprintf(w, "%-12s %s\n", "File:", report.File)
+	fmt.Fprintf(w, "%-12s %t\n", "Go:", report.IsGo)
+	if report.Version != "" {
+		fmt.Fprintf(w, "%-12s %s\n", "Version:", report.Version)
+	}
+	if report.Arch != "" {
+		fmt.Fprintf(w, "%-12s %s\n", "Arch:", report.Arch)
+	}
+
+	fmt.Fprintln(w)
+	for _, artifact := range report.Artifacts {
+		if !artifact.Present {
+			fmt.Fprintf(w, "%-12s <NONE>\n", artifact.Name)
+			continue
+		}
+
+		location := []string{fmt.Sprintf("va 0x%x", artifact.VA), fmt.Sprintf("offset 0x%x", artifact.Offset)}
+		if artifact.Section != "" {
+			location = append(location, "in "+artifact.Section)
+		}
+		if artifact.Name == "typelinks" || artifact.Name == "itablinks" {
+			location = append(location, fmt.Sprintf("%d entries", artifact.Size))
+		} else if artifact.Size != 0 {
+			location = append(location, fmt.Sprintf("size 0x%x", artifact.Size))
+		}
+		fmt.Fprintf(w, "%-12s %s", artifact.Name, strings.Join(location, ", "))
+		if artifact.Detail != "" {
+			fmt.Fprintf(w, " (%s)", artifact.Detail)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func inspectMain(args []string) int {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	humanView := flags.Bool("human", false, "Human view, print the artifacts flat rather than json")
+	timeout := flags.Duration("timeout", 0, "Stop after this long, ex: 30s")
+	outputPath := flags.String("o", "", "Write the report to this file instead of stdout. It's replaced atomically once inspection completes")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println(TextToJson("error", "usage: GoReSym inspect [flags] file"))
+		return exitError
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	report, err := inspectFile(ctx, flags.Arg(0))
+	if err != nil {
+		fmt.Println(TextToJson("error", err.Error()))
+		return exitCodeForError(err)
+	}
+
+	var out io.Writer = os.Stdout
+	var outputFile *atomicFile
+	if *outputPath != "" {
+		outputFile, err = createAtomicFile(*outputPath)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to create output file: %s", err)))
+			return exitError
+		}
+		out = outputFile
+	}
+
+	if *humanView {
+		printInspectForHuman(out, report)
+	} else {
+		fmt.Fprintln(out, DataToJson(report))
+	}
+
+	if outputFile != nil {
+		if err := outputFile.Commit(); err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to write output file: %s", err)))
+			return exitError
+		}
+	}
+
+	if !report.IsGo {
+		return exitNotGoBinary
+	}
+	return exitOK
+}
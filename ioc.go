@@ -0,0 +1,221 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// IOC is a network indicator found in the recovered strings
+type IOC struct {
+	Type      string   // url, domain, ipv4, ipv6, onion or email
+	Value     string   // defanged with -defang
+	Addresses []uint64 // of the strings holding it
+}
+
+var (
+	iocURLRegex    = regexp.MustCompile(`\b(?:https?|ftp|wss?|tcp|udp)://[^\s"'<>\x60]+`)
+	iocEmailRegex  = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@(?:[A-Za-z0-9-]+\.)+[A-Za-z]{2,}\b`)
+	iocOnionRegex  = regexp.MustCompile(`\b(?:[a-z2-7]{56}|[a-z2-7]{16})\.onion\b`)
+	iocIPv4Regex   = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	iocIPv6Regex   = regexp.MustCompile(`(?i)\b(?:[0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\b|\b(?:[0-9a-f]{1,4}:){1,6}:(?:[0-9a-f]{1,4}:){0,5}[0-9a-f]{1,4}\b`)
+	iocDomainRegex = regexp.MustCompile(`\b(?:[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)+([a-z]{2,24})\b`)
+)
+
+// Go identifiers look like domains, such as fmt.Println or main.go, so bare domains need a lower case top level domain
+// from this list. Domains that are also common field names, such as .id or .work, are left out. URLs and email
+// addresses are unambiguous and don't need the list.
+var iocTopLevelDomains = map[string]bool{
+	"com": true, "net": true, "org": true, "info": true, "biz": true, "io": true, "co": true, "cc": true,
+	"ru": true, "su": true, "cn": true, "ir": true, "kp": true, "ua": true, "by": true, "kz": true, "tk": true, "ml": true,
+	"ga": true, "cf": true, "gq": true, "pw": true, "top": true, "xyz": true, "online": true, "site": true, "club": true,
+	"icu": true, "vip": true, "shop": true, "tech": true, "website": true, "app": true, "dev": true, "cloud": true,
+	"ws": true, "us": true, "uk": true, "de": true, "fr": true, "nl": true, "es": true, "pl": true, "br": true, "jp": true,
+	"kr": true, "tw": true, "hk": true, "sg": true, "vn": true, "tr": true, "eu": true,
+}
+
+// Hosts every Go binary names in its module and package paths, the domains of the SSH extension and algorithm names
+// such as aes128-gcm@openssh.com, and the documentation domains of RFC 2606
+var iocIgnoredDomains = []string{
+	"golang.org", "go.dev", "github.com", "gitlab.com", "bitbucket.org", "gopkg.in", "google.golang.org",
+	"go.googlesource.com", "cloud.google.com", "k8s.io", "sigs.k8s.io", "go.uber.org", "go.opentelemetry.io",
+	"openssh.com", "libssh.org", "example.com", "example.org", "example.net",
+}
+
+// extractIOCs collects the indicators of the recovered strings. The hosts of the module paths the binary was built
+// from aren't indicators, they name where its code came from.
+func extractIOCs(metadata ExtractMetadata, defang bool) []IOC {
+	ignored := make(map[string]bool)
+	for _, domain := range iocIgnoredDomains {
+		ignored[domain] = true
+	}
+	ignoreHost := func(path string) {
+		// only paths starting with a host, standard packages such as net/http don't
+		if host := strings.ToLower(strings.Split(path, "/")[0]); strings.Contains(host, ".") {
+			ignored[host] = true
+		}
+	}
+	for _, dep := range metadata.BuildInfo.Deps {
+		ignoreHost(dep.Path)
+	}
+	ignoreHost(metadata.BuildInfo.Path)
+	for _, fn := range append(metadata.UserFunctions, metadata.StdFunctions...) {
+		ignoreHost(fn.PackageName)
+	}
+
+	// strings scanned from the gaps between exact strings can run into each other, such as incorrectgithub.com or
+	// aes128-gcm@openssh.comapi, so the ignored domains match anywhere in a domain
+	isIgnored := func(domain string) bool {
+		domain = strings.ToLower(domain)
+		for ignoredDomain := range ignored {
+			if strings.Contains(domain, ignoredDomain) {
+				return true
+			}
+		}
+		return false
+	}
+
+	byKey := make(map[string]*IOC)
+	var order []string
+	add := func(iocType string, value string, address uint64) {
+		key := iocType + " " + value
+		ioc, ok := byKey[key]
+		if !ok {
+			ioc = &IOC{Type: iocType, Value: value}
+			byKey[key] = ioc
+			order = append(order, key)
+		}
+		if len(ioc.Addresses) == 0 || ioc.Addresses[len(ioc.Addresses)-1] != address {
+			ioc.Addresses = append(ioc.Addresses, address)
+		}
+	}
+
+	// decoded config values, such as the hosts of a base64 encoded profile, aren't among the strings
+	sources := metadata.Strings
+	for _, config := range metadata.Configs {
+		for _, value := range config.Values {
+			sources = append(sources, StringMetadata{Address: value.Address, Value: value.Value})
+		}
+	}
+
+	for _, str := range sources {
+		value := str.Value
+
+		// the hosts of URLs and email addresses aren't reported again as bare domains
+		var claimed []string
+		for _, match := range iocURLRegex.FindAllString(value, -1) {
+			match = strings.TrimRight(match, ".,;:)]}")
+			// hosts filled in at runtime, such as https://%s/api, and local hosts aren't indicators
+			host := urlHost(match)
+			if host == "" || strings.Contains(host, "%") || host == "localhost" || isIgnored(host) {
+				continue
+			}
+			if ip := net.ParseIP(host); ip != nil && !isRoutableIP(ip) {
+				continue
+			}
+			add("url", match, str.Address)
+			claimed = append(claimed, match)
+		}
+		for _, match := range iocEmailRegex.FindAllString(value, -1) {
+			if isIgnored(match[strings.IndexByte(match, '@')+1:]) {
+				continue
+			}
+			add("email", match, str.Address)
+			claimed = append(claimed, match)
+		}
+		for _, match := range iocOnionRegex.FindAllString(value, -1) {
+			add("onion", match, str.Address)
+			claimed = append(claimed, match)
+		}
+
+		rest := value
+		for _, match := range claimed {
+			rest = strings.ReplaceAll(rest, match, " ")
+		}
+
+		for _, loc := range iocIPv4Regex.FindAllStringIndex(rest, -1) {
+			match := rest[loc[0]:loc[1]]
+			// OIDs such as 2.5.4.3 or 1.3.6.1.4.1 look like addresses
+			if isOIDPart(rest, loc[0], loc[1]) || strings.HasPrefix(match, "2.5.4.") {
+				continue
+			}
+			if ip := net.ParseIP(match); ip != nil && isRoutableIP(ip) {
+				add("ipv4", match, str.Address)
+			}
+		}
+		for _, match := range iocIPv6Regex.FindAllString(rest, -1) {
+			if ip := net.ParseIP(match); ip != nil && ip.To4() == nil && isRoutableIP(ip) {
+				add("ipv6", match, str.Address)
+			}
+		}
+		for _, match := range iocDomainRegex.FindAllStringSubmatch(rest, -1) {
+			domain, tld := match[0], strings.ToLower(match[1])
+			if !iocTopLevelDomains[tld] || strings.HasSuffix(domain, ".onion") || isIgnored(domain) {
+				continue
+			}
+			add("domain", domain, str.Address)
+		}
+	}
+
+	iocs := make([]IOC, 0, len(order))
+	for _, key := range order {
+		ioc := *byKey[key]
+		if defang {
+			ioc.Value = defangIOC(ioc.Type, ioc.Value)
+		}
+		iocs = append(iocs, ioc)
+	}
+	sort.SliceStable(iocs, func(i, j int) bool {
+		return iocs[i].Type < iocs[j].Type
+	})
+	return iocs
+}
+
+func urlHost(url string) string {
+	host := url[strings.Index(url, "://")+3:]
+	if end := strings.IndexAny(host, "/?#"); end != -1 {
+		host = host[:end]
+	}
+	if at := strings.LastIndexByte(host, '@'); at != -1 {
+		host = host[at+1:]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// isOIDPart tells whether the dotted numbers at s[start:end] continue with more dotted numbers
+func isOIDPart(s string, start int, end int) bool {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	before := start >= 2 && s[start-1] == '.' && isDigit(s[start-2])
+	after := end+1 < len(s) && s[end] == '.' && isDigit(s[end+1])
+	return before || after
+}
+
+// isRoutableIP drops the addresses every program may name, such as loopback and the unspecified address
+func isRoutableIP(ip net.IP) bool {
+	return !ip.IsUnspecified() && !ip.IsLoopback() && !ip.IsMulticast() && !ip.IsLinkLocalUnicast() && !ip.Equal(net.IPv4bcast)
+}
+
+// defangIOC rewrites the indicator so it can't be clicked or resolved by accident, the usual notation of reports
+func defangIOC(iocType string, value string) string {
+	switch iocType {
+	case "url":
+		scheme, rest, _ := strings.Cut(value, "://")
+		scheme = strings.Replace(strings.Replace(scheme, "http", "hxxp", 1), "ftp", "fxp", 1)
+		host, path, _ := strings.Cut(rest, "/")
+		defanged := scheme + "[://]" + strings.ReplaceAll(host, ".", "[.]")
+		if path != "" || strings.Contains(rest, "/") {
+			defanged += "/" + path
+		}
+		return defanged
+	case "email":
+		return strings.ReplaceAll(strings.Replace(value, "@", "[@]", 1), ".", "[.]")
+	case "ipv6":
+		return strings.ReplaceAll(value, ":", "[:]")
+	}
+	return strings.ReplaceAll(value, ".", "[.]")
+}
@@ -0,0 +1,335 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// KeyMaterial is a certificate or key embedded in the binary, such as a pinned server certificate, a client
+// certificate with its private key, or an SSH key used to log into other hosts
+type KeyMaterial struct {
+	Kind        string // certificate, private key, public key, ssh private key or ssh public key
+	Encoding    string // PEM, DER or OpenSSH
+	Address     uint64
+	Section     string
+	KeyType     string     `json:",omitempty"` // RSA-2048, ECDSA-P256, Ed25519, ...
+	Subject     string     `json:",omitempty"` // certificates only
+	Issuer      string     `json:",omitempty"`
+	NotBefore   *time.Time `json:",omitempty"`
+	NotAfter    *time.Time `json:",omitempty"`
+	SelfSigned  bool       `json:",omitempty"`
+	CA          bool       `json:",omitempty"` // the basic constraints allow signing other certificates
+	Fingerprint string     // SHA256 of the DER encoding, or OpenSSH style for SSH keys
+
+	der []byte // certificates only, copied out of the mapped file for the root CA analysis
+}
+
+// the largest DER structure tried, certificates chains aren't nested so anything larger is noise
+const maxDERSize = 0x4000
+
+var sshPublicKeyTypes = []string{"ssh-rsa", "ssh-ed25519", "ssh-dss", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521"}
+
+// extractKeyMaterial scans the data sections for PEM blocks, DER certificates and keys, and SSH keys
+func extractKeyMaterial(file *objfile.File) ([]KeyMaterial, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []KeyMaterial
+	for _, sec := range sections {
+		if sec.Executable || sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+
+		for _, key := range scanPEM(data) {
+			key.Address += sec.Addr
+			key.Section = sec.Name
+			found = append(found, key)
+		}
+		for _, key := range scanDER(data) {
+			key.Address += sec.Addr
+			key.Section = sec.Name
+			found = append(found, key)
+		}
+		for _, key := range scanSSHPublicKeys(data) {
+			key.Address += sec.Addr
+			key.Section = sec.Name
+			found = append(found, key)
+		}
+	}
+	return found, nil
+}
+
+// the results of the scanners hold the offset into the data as Address
+func scanPEM(data []byte) []KeyMaterial {
+	var found []KeyMaterial
+	marker := []byte("-----BEGIN ")
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], marker)
+		if idx == -1 {
+			break
+		}
+		start := offset + idx
+		offset = start + len(marker)
+
+		block, _ := pem.Decode(data[start:])
+		if block == nil {
+			continue
+		}
+
+		var key *KeyMaterial
+		switch block.Type {
+		case "CERTIFICATE", "TRUSTED CERTIFICATE", "X509 CERTIFICATE":
+			key = parseCertificate(block.Bytes)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY", "DSA PRIVATE KEY":
+			key = parsePrivateKey(block.Type, block.Bytes)
+		case "PUBLIC KEY", "RSA PUBLIC KEY":
+			key = parsePublicKey(block.Bytes)
+		case "OPENSSH PRIVATE KEY":
+			key = &KeyMaterial{Kind: "ssh private key", KeyType: openSSHKeyType(block.Bytes), Fingerprint: sha256Hex(block.Bytes)}
+		}
+		if key == nil {
+			continue
+		}
+
+		if key.Encoding == "" {
+			key.Encoding = "PEM"
+		}
+		key.Address = uint64(start)
+		found = append(found, *key)
+	}
+	return found
+}
+
+// scanDER tries the ASN.1 SEQUENCEs that look like certificates or keys
+func scanDER(data []byte) []KeyMaterial {
+	var found []KeyMaterial
+	for offset := 0; offset+8 < len(data); {
+		idx := bytes.IndexByte(data[offset:], 0x30)
+		if idx == -1 {
+			break
+		}
+		start := offset + idx
+		offset = start + 1
+
+		size, headerSize := derLength(data[start:])
+		if size == 0 || size > maxDERSize || start+headerSize+size > len(data) {
+			continue
+		}
+		der := data[start : start+headerSize+size]
+		body := der[headerSize:]
+
+		var key *KeyMaterial
+		switch {
+		case headerSize >= 3 && len(body) > 1 && body[0] == 0x30 && (body[1] == 0x81 || body[1] == 0x82):
+			// a certificate, Ed25519 and EC ones can be under 256 bytes, or a public key whose algorithm identifier
+			// is the first SEQUENCE
+			if key = parseCertificate(der); key == nil {
+				key = parsePublicKey(der)
+			}
+		case bytes.HasPrefix(body, []byte{0x02, 0x01, 0x00}):
+			// PKCS#8 and PKCS#1 private keys start with version 0
+			key = parsePrivateKey("PRIVATE KEY", der)
+		case bytes.HasPrefix(body, []byte{0x02, 0x01, 0x01, 0x04}):
+			// SEC 1 EC private keys start with version 1 and the private key
+			key = parsePrivateKey("EC PRIVATE KEY", der)
+		case headerSize == 2 && bytes.HasPrefix(body, []byte{0x30}):
+			// short public keys, such as EC and Ed25519
+			key = parsePublicKey(der)
+		}
+		if key == nil {
+			continue
+		}
+
+		key.Encoding = "DER"
+		key.Address = uint64(start)
+		found = append(found, *key)
+		offset = start + len(der)
+	}
+	return found
+}
+
+// derLength returns the length of the contents and the size of the tag and length before them, 0 if invalid
+func derLength(data []byte) (int, int) {
+	if len(data) < 2 {
+		return 0, 0
+	}
+
+	switch lengthByte := data[1]; {
+	case lengthByte < 0x80:
+		return int(lengthByte), 2
+	case lengthByte == 0x81 && len(data) >= 3 && data[2] >= 0x80:
+		return int(data[2]), 3
+	case lengthByte == 0x82 && len(data) >= 4 && data[2] != 0:
+		return int(binary.BigEndian.Uint16(data[2:])), 4
+	}
+	return 0, 0
+}
+
+func parseCertificate(der []byte) *KeyMaterial {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil
+	}
+
+	notBefore, notAfter := cert.NotBefore.UTC(), cert.NotAfter.UTC()
+	return &KeyMaterial{
+		Kind:        "certificate",
+		KeyType:     publicKeyType(cert.PublicKey),
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotBefore:   &notBefore,
+		NotAfter:    &notAfter,
+		SelfSigned:  bytes.Equal(cert.RawSubject, cert.RawIssuer),
+		CA:          cert.IsCA,
+		Fingerprint: sha256Hex(der),
+		der:         bytes.Clone(der),
+	}
+}
+
+func parsePrivateKey(blockType string, der []byte) *KeyMaterial {
+	key := &KeyMaterial{Kind: "private key", Fingerprint: sha256Hex(der)}
+	switch blockType {
+	case "ENCRYPTED PRIVATE KEY":
+		key.KeyType = "encrypted"
+		return key
+	case "DSA PRIVATE KEY":
+		key.KeyType = "DSA"
+		return key
+	}
+
+	if parsed, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := parsed.(interface{ Public() crypto.PublicKey }); ok {
+			key.KeyType = publicKeyType(signer.Public())
+		}
+		return key
+	}
+	if parsed, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		key.KeyType = publicKeyType(&parsed.PublicKey)
+		return key
+	}
+	if parsed, err := x509.ParseECPrivateKey(der); err == nil {
+		key.KeyType = publicKeyType(&parsed.PublicKey)
+		return key
+	}
+	return nil
+}
+
+func parsePublicKey(der []byte) *KeyMaterial {
+	if parsed, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return &KeyMaterial{Kind: "public key", KeyType: publicKeyType(parsed), Fingerprint: sha256Hex(der)}
+	}
+	if parsed, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return &KeyMaterial{Kind: "public key", KeyType: publicKeyType(parsed), Fingerprint: sha256Hex(der)}
+	}
+	return nil
+}
+
+func publicKeyType(key any) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T", key)
+}
+
+// scanSSHPublicKeys finds authorized_keys style lines: the key type, then the base64 encoded key
+func scanSSHPublicKeys(data []byte) []KeyMaterial {
+	var found []KeyMaterial
+	for _, keyType := range sshPublicKeyTypes {
+		prefix := []byte(keyType + " AAAA")
+		for offset := 0; ; {
+			idx := bytes.Index(data[offset:], prefix)
+			if idx == -1 {
+				break
+			}
+			start := offset + idx
+			offset = start + len(prefix)
+
+			end := start + len(keyType) + 1
+			for end < len(data) && isBase64Byte(data[end]) {
+				end++
+			}
+			blob, err := base64.StdEncoding.DecodeString(string(data[start+len(keyType)+1 : end]))
+			if err != nil || sshKeyType(blob) != keyType {
+				continue
+			}
+
+			sum := sha256.Sum256(blob)
+			found = append(found, KeyMaterial{
+				Kind:        "ssh public key",
+				Encoding:    "OpenSSH",
+				Address:     uint64(start),
+				KeyType:     keyType,
+				Fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+			})
+			offset = end
+		}
+	}
+	return found
+}
+
+func isBase64Byte(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '+' || c == '/' || c == '='
+}
+
+// sshKeyType reads the key type the SSH wire format starts with
+func sshKeyType(blob []byte) string {
+	if len(blob) < 4 {
+		return ""
+	}
+	size := binary.BigEndian.Uint32(blob)
+	if uint64(size) > uint64(len(blob)-4) {
+		return ""
+	}
+	return string(blob[4 : 4+size])
+}
+
+// openSSHKeyType reads the type of the first public key of an openssh-key-v1 private key
+func openSSHKeyType(data []byte) string {
+	magic := []byte("openssh-key-v1\x00")
+	if !bytes.HasPrefix(data, magic) {
+		return ""
+	}
+
+	// cipher name, kdf name and kdf options precede the key count and the first public key
+	rest := data[len(magic):]
+	for i := 0; i < 3; i++ {
+		if len(rest) < 4 || uint64(binary.BigEndian.Uint32(rest)) > uint64(len(rest)-4) {
+			return ""
+		}
+		rest = rest[4+binary.BigEndian.Uint32(rest):]
+	}
+	if len(rest) < 8 {
+		return ""
+	}
+	return sshKeyType(rest[8:])
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
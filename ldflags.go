@@ -0,0 +1,201 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"encoding/binary"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// InjectedString is a string variable whose value was set at link time with -ldflags=-X, such as the version, the
+// commit or the release channel of a build, and sometimes a secret kept out of the source.
+type InjectedString struct {
+	Variable string // the package path and name, ex: main.version
+	Value    string
+	Address  uint64   `json:",omitempty"` // of the variable, from the symbol table
+	Kind     string   `json:",omitempty"` // version, commit, date, channel, feature or secret, guessed from the name and value
+	Sources  []string // build info for the -ldflags recorded with the build, symbols for the linker's .str symbols
+}
+
+// The variables the go command and the linker set themselves, reported as the version, build info and GODEBUG
+var toolchainInjectedStrings = map[string]bool{
+	"runtime.buildVersion": true, "runtime.defaultGOROOT": true, "runtime/internal/sys.DefaultGoroot": true,
+	"runtime.modinfo": true, "runtime.godebugDefault": true, "internal/buildcfg.defaultGOROOT": true,
+}
+
+// What the variables hold, the first kind matching the name or the value is reported
+var injectedStringKinds = []struct {
+	name  string
+	names *regexp.Regexp
+	value *regexp.Regexp
+}{
+	{"secret", regexp.MustCompile(`(?i)passw|pwd|token|secret|api.?key|private.?key|credential|auth|dsn`), regexp.MustCompile(`^(?:AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36}|xox[abpr]-|sk_live_|-----BEGIN)`)},
+	{"commit", regexp.MustCompile(`(?i)commit|revision|sha|githash|^rev$`), regexp.MustCompile(`^[0-9a-f]{7,40}$`)},
+	{"version", regexp.MustCompile(`(?i)version|^v(?:er)?$|tag`), regexp.MustCompile(`^v?[0-9]+\.[0-9]+(?:\.[0-9]+)?(?:[-+][0-9A-Za-z.\-+]*)?$`)},
+	{"date", regexp.MustCompile(`(?i)date|time|built|stamp`), regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}`)},
+	{"channel", regexp.MustCompile(`(?i)channel|stage|environment|^env$|flavou?r|edition|distribution`), nil},
+	{"feature", regexp.MustCompile(`(?i)feature|enable|disable|flag`), regexp.MustCompile(`^(?:true|false|enabled|disabled|on|off)$`)},
+}
+
+// injectedStringKind guesses what a variable holds from its name, then from its value
+func injectedStringKind(variable string, value string) string {
+	name := variable[strings.LastIndex(variable, ".")+1:]
+	for _, kind := range injectedStringKinds {
+		if kind.names.MatchString(name) {
+			return kind.name
+		}
+	}
+	for _, kind := range injectedStringKinds {
+		if kind.value != nil && kind.value.MatchString(value) {
+			return kind.name
+		}
+	}
+	return ""
+}
+
+// splitQuotedFields splits flags the way the go command quotes them, with single or double quotes around arguments
+// holding spaces
+func splitQuotedFields(s string) []string {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteByte(c)
+		case c == '\'' || c == '"':
+			quote, inField = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteByte(c)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// ldflagsInjections returns the variable=value pairs of the -X flags of -ldflags, in the -X name=value, -X=name=value
+// and --X forms the linker accepts
+func ldflagsInjections(ldflags string) map[string]string {
+	injections := make(map[string]string)
+	fields := splitQuotedFields(ldflags)
+	for i := 0; i < len(fields); i++ {
+		flag := strings.TrimPrefix(fields[i], "-")
+		var definition string
+		switch {
+		case flag == "-X" || flag == "X":
+			if i+1 >= len(fields) {
+				continue
+			}
+			i++
+			definition = fields[i]
+		case strings.HasPrefix(flag, "-X=") || strings.HasPrefix(flag, "X="):
+			_, definition, _ = strings.Cut(flag, "=")
+		default:
+			continue
+		}
+		if name, value, ok := strings.Cut(definition, "="); ok && name != "" {
+			injections[name] = value
+		}
+	}
+	return injections
+}
+
+// extractInjectedStrings reads the -X flags of the -ldflags the go command records with the build, which it leaves out
+// with -trimpath, then the variables the linker pointed at a string symbol of their name plus .str, which is how it
+// applies -X. The symbols are gone from binaries linked with -s.
+func extractInjectedStrings(file *objfile.File, build *BuildSettings, is64bit bool, littleendian bool) []InjectedString {
+	found := make(map[string]*InjectedString)
+	if build != nil {
+		for name, value := range ldflagsInjections(build.Ldflags) {
+			found[name] = &InjectedString{Variable: name, Value: value, Sources: []string{"build info"}}
+		}
+	}
+
+	if symbols, err := file.Symbols(); err == nil {
+		variables := make(map[string]objfile.Sym)
+		for _, sym := range symbols {
+			if sym.Code == 'D' || sym.Code == 'd' {
+				variables[sym.Name] = sym
+			}
+		}
+		pointerSize := uint64(4)
+		if is64bit {
+			pointerSize = 8
+		}
+		var order binary.ByteOrder = binary.BigEndian
+		if littleendian {
+			order = binary.LittleEndian
+		}
+
+		for _, sym := range symbols {
+			name, ok := strings.CutSuffix(sym.Name, ".str")
+			if !ok || !(sym.Code == 'R' || sym.Code == 'r' || sym.Code == 'D' || sym.Code == 'd') {
+				continue
+			}
+			variable, ok := variables[name]
+			if !ok {
+				continue
+			}
+
+			// the variable is a string header pointing at the symbol
+			header, err := file.ReadMemory(variable.Addr, 2*pointerSize)
+			if err != nil || uint64(len(header)) < 2*pointerSize {
+				continue
+			}
+			var data, length uint64
+			if is64bit {
+				data, length = order.Uint64(header), order.Uint64(header[8:])
+			} else {
+				data, length = uint64(order.Uint32(header)), uint64(order.Uint32(header[4:]))
+			}
+			if data != sym.Addr || length > maxStringLength {
+				continue
+			}
+			value := ""
+			if length > 0 {
+				raw, err := file.ReadMemory(data, length)
+				if err != nil || uint64(len(raw)) < length {
+					continue
+				}
+				value = string(raw[:length])
+			}
+
+			injected, ok := found[name]
+			if !ok {
+				injected = &InjectedString{Variable: name}
+				found[name] = injected
+			}
+			// the linked value wins, the last of several -X flags for a variable applies
+			injected.Value = value
+			injected.Address = variable.Addr
+			injected.Sources = append(injected.Sources, "symbols")
+		}
+	}
+
+	var injected []InjectedString
+	for name, value := range found {
+		if toolchainInjectedStrings[name] {
+			continue
+		}
+		value.Kind = injectedStringKind(value.Variable, value.Value)
+		injected = append(injected, *value)
+	}
+	sort.Slice(injected, func(i, j int) bool { return injected[i].Variable < injected[j].Variable })
+	return injected
+}
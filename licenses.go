@@ -0,0 +1,226 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/objfile"
+	"github.com/mandiant/GoReSym/runtime/debug"
+)
+
+// EmbeddedLicense is a license text or notice found in the data sections, such as a LICENSE file embedded with
+// go:embed or the notices a program prints. Binary-only deliveries rarely ship the licenses of their dependencies
+// next to them, these tell what the vendor did bundle.
+type EmbeddedLicense struct {
+	License   string // SPDX identifier, ex: MIT, Apache-2.0 or BSD-3-Clause
+	Address   uint64
+	Section   string
+	Copyright string   `json:",omitempty"` // the copyright line preceding the text, ex: Copyright (c) 2014 Sam Ghods
+	Modules   []string `json:",omitempty"` // the modules of the build info whose owner holds the copyright
+}
+
+// licenseAnchor is a phrase starting a license text, classify names the license from the text around it
+type licenseAnchor struct {
+	phrase   []byte
+	length   int // the usual length of the text, anchors within it are the same text
+	classify func(window []byte) string
+}
+
+var (
+	apacheVersionRegex = regexp.MustCompile(`Apache License,?\s+Version 2\.0`)
+	gplVersionRegex    = regexp.MustCompile(`(GNU (?:LESSER |LIBRARY |AFFERO )?GENERAL PUBLIC LICENSE)\s+Version ([1-3])`)
+	spdxRegex          = regexp.MustCompile(`SPDX-License-Identifier:\s*([A-Za-z0-9.+\-]+(?:\s+(?:OR|AND|WITH)\s+[A-Za-z0-9.+\-]+)*)`)
+	copyrightRegex     = regexp.MustCompile(`(?i)copyright\s+(?:\(c\)\s*|©\s*)?[0-9]{4}(?:\s*[-,]\s*(?:[0-9]{4}|present))*,?\s+(?:by\s+)?([^\n\r]{2,120})`)
+)
+
+func constantLicense(license string) func([]byte) string {
+	return func([]byte) string { return license }
+}
+
+var licenseAnchors = []licenseAnchor{
+	{[]byte("Apache License"), 11000, func(window []byte) string {
+		if apacheVersionRegex.Match(window) {
+			return "Apache-2.0"
+		}
+		return ""
+	}},
+	{[]byte("Permission is hereby granted, free of charge, to any person obtaining a copy"), 1000, constantLicense("MIT")},
+	{[]byte("Redistribution and use in source and binary forms"), 1500, func(window []byte) string {
+		if bytes.Contains(window, []byte("Neither the name")) || bytes.Contains(window, []byte("neither the name")) {
+			return "BSD-3-Clause"
+		}
+		return "BSD-2-Clause"
+	}},
+	{[]byte("Permission to use, copy, modify, and"), 800, func(window []byte) string {
+		if bytes.Contains(window, []byte("for any purpose with or without fee")) {
+			return "ISC"
+		}
+		return ""
+	}},
+	{[]byte("Mozilla Public License"), 16000, func(window []byte) string {
+		if bytes.Contains(window, []byte("Version 2.0")) || bytes.Contains(window, []byte("v. 2.0")) {
+			return "MPL-2.0"
+		}
+		return ""
+	}},
+	{[]byte("GENERAL PUBLIC LICENSE"), 30000, func(window []byte) string {
+		match := gplVersionRegex.FindSubmatch(window)
+		if match == nil {
+			return ""
+		}
+		version := map[string]string{"1": "1.0", "2": "2.0", "3": "3.0"}[string(match[2])]
+		switch {
+		case bytes.Contains(match[1], []byte("AFFERO")):
+			return "AGPL-" + version
+		case bytes.Contains(match[1], []byte("LESSER")) || bytes.Contains(match[1], []byte("LIBRARY")):
+			if version == "2.0" {
+				return "LGPL-2.1"
+			}
+			return "LGPL-" + version
+		}
+		return "GPL-" + version
+	}},
+	{[]byte("This is free and unencumbered software released into the public domain"), 1000, constantLicense("Unlicense")},
+	{[]byte("CC0 1.0 Universal"), 6000, constantLicense("CC0-1.0")},
+	{[]byte("SPDX-License-Identifier:"), 0, func(window []byte) string {
+		if match := spdxRegex.FindSubmatch(window); match != nil {
+			return string(match[1])
+		}
+		return ""
+	}},
+}
+
+// isTextByte tells the bytes of a license text apart from the binary data around it
+func isTextByte(c byte) bool {
+	return c == '\n' || c == '\r' || c == '\t' || (c >= 0x20 && c < 0x7f) || c >= 0x80
+}
+
+// scanLicenses finds the license texts of the data, the results hold the offset into the data as Address. The
+// copyright holder is the last copyright line in the text before the license, the license's own copyright, such as
+// the Free Software Foundation's, doesn't count.
+func scanLicenses(data []byte) []EmbeddedLicense {
+	var found []EmbeddedLicense
+	for _, anchor := range licenseAnchors {
+		covered := -1
+		for offset := 0; ; {
+			i := bytes.Index(data[offset:], anchor.phrase)
+			if i == -1 {
+				break
+			}
+			position := offset + i
+			offset = position + len(anchor.phrase)
+			if position < covered {
+				continue
+			}
+
+			// the text around the anchor, up to the binary data
+			start := position
+			for start > 0 && position-start < 2048 && isTextByte(data[start-1]) {
+				start--
+			}
+			end := offset
+			for end < len(data) && end-position < 1024 && isTextByte(data[end]) {
+				end++
+			}
+			// the version of the GPL family precedes its anchor
+			license := anchor.classify(data[max(start, position-64):end])
+			if license == "" {
+				continue
+			}
+			covered = position + anchor.length
+
+			embedded := EmbeddedLicense{License: license, Address: uint64(position)}
+			if matches := copyrightRegex.FindAllSubmatch(data[start:position], -1); len(matches) > 0 {
+				last := matches[len(matches)-1]
+				if !bytes.Contains(last[1], []byte("Free Software Foundation")) {
+					embedded.Copyright = strings.TrimSpace(string(last[0]))
+				}
+			}
+			found = append(found, embedded)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Address < found[j].Address })
+	return found
+}
+
+// extractLicenses scans the data sections for license texts and maps their copyright holders to the modules
+func extractLicenses(file *objfile.File, info debug.BuildInfo) ([]EmbeddedLicense, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []EmbeddedLicense
+	for _, sec := range sections {
+		if sec.Executable || sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		for _, license := range scanLicenses(data) {
+			license.Address += sec.Addr
+			license.Section = sec.Name
+			license.Modules = copyrightModules(license.Copyright, info)
+			found = append(found, license)
+		}
+	}
+	return found, nil
+}
+
+// copyrightHolders maps the collective holders of whole module families
+var copyrightHolders = map[string]string{
+	"the go authors":         "golang.org/x",
+	"the kubernetes authors": "k8s.io",
+}
+
+// copyrightModules returns the modules whose owner is named in the copyright line: the account of code hosts, ex:
+// github.com/gravitational for Gravitational, Inc., or the domain of vanity paths, ex: go.uber.org for Uber.
+func copyrightModules(copyright string, info debug.BuildInfo) []string {
+	if copyright == "" {
+		return nil
+	}
+	holder := strings.ToLower(copyright)
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(holder, func(r rune) bool { return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9') }) {
+		words[word] = true
+	}
+
+	var modules []string
+	check := func(path string) {
+		if path == "" {
+			return
+		}
+		for name, prefix := range copyrightHolders {
+			if strings.Contains(holder, name) && packageMatches(path, prefix) {
+				modules = append(modules, path)
+				return
+			}
+		}
+		parts := strings.Split(path, "/")
+		owner := ""
+		switch {
+		case len(parts) >= 3 && (parts[0] == "github.com" || parts[0] == "gitlab.com" || parts[0] == "bitbucket.org"):
+			owner = parts[1]
+		default:
+			if labels := strings.Split(parts[0], "."); len(labels) >= 2 {
+				owner = labels[len(labels)-2]
+			}
+		}
+		owner = strings.ToLower(owner)
+		if len(owner) >= 4 && words[owner] {
+			modules = append(modules, path)
+		}
+	}
+
+	check(info.Main.Path)
+	for _, dep := range info.Deps {
+		check(dep.Path)
+	}
+	sort.Strings(modules)
+	return modules
+}
@@ -0,0 +1,115 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Diagnostics go to stderr, or -log-file, so they never interleave with the JSON written to stdout.
+// Nothing below warnings is logged unless asked for, GoReSym is often run in bulk.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+var showProgress = false
+
+func parseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// configureLogging replaces the logger, format is text or json
+func configureLogging(level slog.Level, format string, output io.Writer) error {
+	options := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(output, options))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(output, options))
+	default:
+		return fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+	return nil
+}
+
+// hexAttr formats addresses the way every other GoReSym output does
+func hexAttr(key string, value uint64) slog.Attr {
+	return slog.String(key, fmt.Sprintf("0x%x", value))
+}
+
+// stderrIsTerminal decides if the progress line can be redrawn in place, otherwise one line per phase is printed
+func stderrIsTerminal() bool {
+	stat, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// A phase is one long running step of the analysis, such as locating the pclntab or parsing types.
+// When progress is enabled an indicator with the elapsed time is shown on stderr until the phase ends.
+type phase struct {
+	name    string
+	start   time.Time
+	elapsed time.Duration // set once the phase ended
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func beginPhase(name string) *phase {
+	p := &phase{name: name, start: time.Now(), done: make(chan struct{})}
+	logger.Debug("phase started", "phase", name)
+
+	if showProgress {
+		if stderrIsTerminal() {
+			p.wg.Add(1)
+			go p.spin()
+		} else {
+			fmt.Fprintf(os.Stderr, "GoReSym: %s...\n", name)
+		}
+	}
+	return p
+}
+
+func (p *phase) spin() {
+	defer p.wg.Done()
+	frames := []byte{'|', '/', '-', '\\'}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for i := 0; ; i++ {
+		fmt.Fprintf(os.Stderr, "\rGoReSym: %c %s (%s)", frames[i%len(frames)], p.name, time.Since(p.start).Truncate(100*time.Millisecond))
+		select {
+		case <-p.done:
+			// clear the line, the final status is printed by end
+			fmt.Fprint(os.Stderr, "\r\033[K")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// end stops the indicator and reports the phase duration. Detail is an optional summary, such as an item count.
+func (p *phase) end(detail string) {
+	if p.done == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+	p.done = nil
+
+	p.elapsed = time.Since(p.start)
+	elapsed := p.elapsed.Truncate(time.Millisecond)
+	if showProgress {
+		if detail != "" {
+			fmt.Fprintf(os.Stderr, "GoReSym: %s done (%s, %s)\n", p.name, elapsed, detail)
+		} else {
+			fmt.Fprintf(os.Stderr, "GoReSym: %s done (%s)\n", p.name, elapsed)
+		}
+	}
+	logger.Info("phase done", "phase", p.name, "elapsed", elapsed, "detail", detail)
+}
@@ -4,12 +4,25 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	rtdebug "runtime/debug"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	// we copy the go src directly, then change every include to github.com/mandiant/GoReSym/<whatever>
 	// this is required since we're using internal files. Our modifications are directly inside the copied source
@@ -19,6 +32,43 @@ import (
 	"github.com/mandiant/GoReSym/runtime/debug"
 )
 
+// Exit codes, so scripts can branch on the outcome without parsing the JSON
+const (
+	exitOK             = 0
+	exitError          = 1 // bad arguments, unreadable or skipped input
+	exitNotGoBinary    = 2 // not an executable, or one without Go metadata
+	exitRecoveryFailed = 3 // a Go binary, but its metadata couldn't be recovered
+	exitPartial        = 4 // analysis stopped early, the output is incomplete
+	exitFilterMatched  = 5 // -filter-package excluded at least one item
+	exitBlocklisted    = 6 // a dependency or package is on the blocklist
+	exitNotReproduced  = 7 // verify rebuilt the binary, but functions, types or strings diverge
+)
+
+var errNotGoBinary = errors.New("not a Go binary")
+
+// exitCodeForError tells failures to read the input apart from inputs that aren't Go and Go binaries we failed on
+func exitCodeForError(err error) int {
+	var pathErr *fs.PathError
+	if errors.Is(err, errNotGoBinary) {
+		return exitNotGoBinary
+	} else if errors.As(err, &pathErr) || errors.Is(err, errSkippedFile) {
+		return exitError
+	}
+	return exitRecoveryFailed
+}
+
+// resultExitCode is the code of a recovered result, filtered the number of items -filter-package excluded from it
+func resultExitCode(metadata ExtractMetadata, filtered int) int {
+	if metadata.Partial {
+		return exitPartial
+	} else if filtered > 0 {
+		return exitFilterMatched
+	} else if len(metadata.Blocklisted) > 0 {
+		return exitBlocklisted
+	}
+	return exitOK
+}
+
 func isStdPackage(pkg string) bool {
 	// Empty name is common for reflect/type functions and some runtime symbols
 	if len(strings.TrimSpace(pkg)) <= 0 {
@@ -49,24 +99,79 @@ type FuncMetadata struct {
 	End         uint64
 	PackageName string
 	FullName    string
+	Hash        string `json:",omitempty"` // instruction shapes, with -funchash, see funchash.go
+	MinHash     string `json:",omitempty"` // fuzzy hash of the instruction shapes, with -funchash
+	Origin      string `json:",omitempty"` // user, dependency or stdlib, see origin.go
 }
 
 type ExtractMetadata struct {
-	Version       string
-	BuildId       string
-	Arch          string
-	OS            string
-	TabMeta       PcLnTabMetadata
-	ModuleMeta    objfile.ModuleData
-	Types         []objfile.Type
-	Interfaces    []objfile.Type
-	BuildInfo     debug.BuildInfo
-	Files         []string
-	UserFunctions []FuncMetadata
-	StdFunctions  []FuncMetadata
+	Version         string
+	BuildId         string
+	Arch            string
+	OS              string
+	TabMeta         PcLnTabMetadata
+	ModuleMeta      objfile.ModuleData
+	Types           []objfile.Type
+	Interfaces      []objfile.Type
+	BuildInfo       debug.BuildInfo
+	Build           *BuildSettings     `json:",omitempty"` // the build info settings, or the ones inferred without them
+	VCS             *VCSMetadata       `json:",omitempty"` // the commit the main module was built from
+	Modules         *ModuleGraph       `json:",omitempty"` // the build info modules and the calls between them
+	Target          *TargetEnvironment `json:",omitempty"` // the platform, microarchitecture level, cgo and linking
+	Timestamps      *TimestampMetadata `json:",omitempty"`
+	Signature       *SignatureMetadata `json:",omitempty"` // PE and Mach-O only
+	Resources       *ResourcesMetadata `json:",omitempty"` // PE only
+	NativeLibraries []NativeLibrary    `json:",omitempty"` // statically linked C libraries of cgo builds
+	Files           []string
+	SourceTree      *SourceTree `json:",omitempty"` // the project layout rebuilt from the files, with -p
+	UserFunctions   []FuncMetadata
+	StdFunctions    []FuncMetadata
+	Sections        []SectionMetadata
+	FuzzyHashes     []FuzzyHash           `json:",omitempty"` // ssdeep and TLSH of the file, code and read only data
+	Packing         *PackingMetadata      `json:",omitempty"`
+	Obfuscation     *ObfuscationMetadata  `json:",omitempty"` // the obfuscator the binary was built with, if any
+	TLSCallbacks    []TLSCallback         `json:",omitempty"` // PE only
+	Capabilities    []Capability          `json:",omitempty"`
+	Stdlib          *StdlibLinkage        `json:",omitempty"` // the standard packages linked in and their code size
+	AntiAnalysis    []AntiAnalysisFinding `json:",omitempty"`
+	Persistence     []PersistenceMethod   `json:",omitempty"` // Run keys, services, scheduled tasks, launchd, systemd and cron
+	Syscalls        *SyscallMetadata      `json:",omitempty"` // Linux and macOS only
+	Scripting       *ScriptingMetadata    `json:",omitempty"` // embedded interpreters and their scripts
+	SQL             *SQLMetadata          `json:",omitempty"` // only found with -strings
+	Routes          []HTTPRoute           `json:",omitempty"` // registered with net/http and web frameworks
+	Channels        []ChannelUse          `json:",omitempty"` // the channels each function makes, sends on and receives from
+	Devirtualized   *DevirtualizedCalls   `json:",omitempty"` // only reported with -devirtualize
+	Regexes         []RegexPattern        `json:",omitempty"` // the patterns the program compiles
+	Environment     []EnvironmentVariable `json:",omitempty"` // the variables the program reads or sets
+	RuntimeTuning   []RuntimeSetting      `json:",omitempty"` // the GC, memory, scheduler and GODEBUG settings it imposes
+	InjectedStrings []InjectedString      `json:",omitempty"` // string variables set at link time with -ldflags=-X
+	Flags           []CommandLineFlag     `json:",omitempty"` // the command-line flags the program registers
+	Telemetry       *TelemetryMetadata    `json:",omitempty"` // metric and span names of the instrumentation
+	Protobuf        []ProtobufFile        `json:",omitempty"` // the descriptors of the generated protobuf code
+	C2Frameworks    []C2Framework         `json:",omitempty"` // offensive frameworks the program is built from
+	KeyMaterial     []KeyMaterial         `json:",omitempty"` // certificates and keys found in the data sections
+	Licenses        []EmbeddedLicense     `json:",omitempty"` // license texts found in the data sections, with their modules
+	RootCAs         *RootCAMetadata       `json:",omitempty"` // root bundles, certificate pools and custom roots
+	TimeZoneData    *TimeZoneData         `json:",omitempty"` // the embedded timezone database
+	Cryptojacking   *MiningMetadata       `json:",omitempty"` // wallet addresses, mining pools and miners
+	CryptoConstants []CryptoConstant      `json:",omitempty"` // S-boxes, IVs and round constants, with the functions using them
+	Configs         []MalwareConfig       `json:",omitempty"` // only reported with -extract-config
+	IOCs            []IOC                 `json:",omitempty"` // only reported with -iocs
+	GoRelease       *GoRelease            `json:",omitempty"` // support status and known vulnerabilities of the Go release
+	Vulnerabilities []Vulnerability       `json:",omitempty"` // only reported with -osv
+	YaraMatches     []YaraMatch           `json:",omitempty"` // only reported with -yara-rules
+	YaraSkipped     []YaraSkippedRule     `json:",omitempty"` // the rules of -yara-rules that weren't evaluated
+	Blocklisted     []BlocklistMatch      `json:",omitempty"` // dependencies and packages on the blocklist
+	Typosquats      []TyposquatMatch      `json:",omitempty"` // dependencies resembling popular modules
+	Strings         []StringMetadata      `json:",omitempty"`
+	Errors          []AnalysisError       `json:",omitempty"`
+	GoReSym         ToolInfo              // the GoReSym build that produced this report
+	Partial         bool                  `json:",omitempty"` // analysis was stopped early, such as by -timeout, and only holds what was recovered until then
+	SimHash         string                `json:",omitempty"` // locality sensitive hash of the function and package names, see simhash.go
+	Stats           *AnalysisStats        `json:",omitempty"` // only reported with -stats
 }
 
-func main_impl_tmpfile(fileBytes []byte, printStdPkgs bool, printFilePaths bool, printTypes bool, noPrintFunctions bool, manualTypeAddress int, versionOverride string) (metadata ExtractMetadata, err error) {
+func main_impl_tmpfile(ctx context.Context, fileBytes []byte, printStdPkgs bool, printFilePaths bool, printTypes bool, printStrings bool, noPrintFunctions bool, manualTypeAddress int, versionOverride string) (metadata ExtractMetadata, err error) {
 	tmpFile, err := os.CreateTemp(os.TempDir(), "goresym_tmp-")
 	if err != nil {
 		return ExtractMetadata{}, fmt.Errorf("failed to create temporary file: %s", err)
@@ -81,22 +186,127 @@ func main_impl_tmpfile(fileBytes []byte, printStdPkgs bool, printFilePaths bool,
 		return ExtractMetadata{}, fmt.Errorf("failed to close temporary file: %s", err)
 	}
 
-	return main_impl(tmpFile.Name(), printStdPkgs, printFilePaths, printTypes, noPrintFunctions, manualTypeAddress, versionOverride)
+	return main_impl(ctx, tmpFile.Name(), printStdPkgs, printFilePaths, printTypes, printStrings, noPrintFunctions, manualTypeAddress, versionOverride)
+}
+
+// An AnalysisError is a failure of one analyzer that didn't stop the rest of the analysis
+type AnalysisError struct {
+	Analyzer string
+	Stage    string
+	Message  string
+}
+
+func (metadata *ExtractMetadata) addError(analyzer string, stage string, err error) {
+	logger.Debug("analyzer failed", "analyzer", analyzer, "stage", stage, "error", err)
+	metadata.Errors = append(metadata.Errors, AnalysisError{Analyzer: analyzer, Stage: stage, Message: err.Error()})
+}
+
+// stoppedEarly marks the metadata as partial if ctx is done, so the caller can return what was recovered so far
+func stoppedEarly(ctx context.Context, metadata *ExtractMetadata, stage string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+
+	logger.Warn("analysis stopped early", "stage", stage, "reason", ctx.Err())
+	metadata.Partial = true
+	return true
+}
+
+// scanGoVersion finds the runtime.buildVersion string in the file data, for releases without buildinfo
+func scanGoVersion(fileData []byte) string {
+	// go1.<varies><garbage data>
+	idx := bytes.Index(fileData, []byte{0x67, 0x6F, 0x31, 0x2E})
+	if idx == -1 || len(fileData[idx:]) <= 10 {
+		return ""
+	}
+
+	version := "go1."
+	ver := fileData[idx+4 : idx+10]
+	for i, c := range ver {
+		// the string is _not_ null terminated, nor length delimited. So, filter till first non-numeric ascii
+		nextIsNumeric := (i+1) < len(ver) && ver[i+1] >= 0x30 && ver[i+1] <= 0x39
+
+		// careful not to end with a . at the end
+		if (c >= 0x30 && c <= 0x39 && c != ' ') || (c == '.' && nextIsNumeric) {
+			version += string([]byte{c})
+		} else {
+			break
+		}
+	}
+	return version
+}
+
+// normalizeGoVersion keeps the numeric part only, go1.17 -> 1.17
+func normalizeGoVersion(version string) string {
+	goVersionIdx := strings.Index(version, "go")
+	if goVersionIdx != -1 {
+		// "devel go1.18-2d1d548 Tue Dec 21 03:55:43 2021 +0000"
+		version = strings.Split(version[goVersionIdx+2:]+" ", " ")[0]
+
+		// go1.18-2d1d548
+		version = strings.Split(version+"-", "-")[0]
+	}
+	return version
+}
+
+func tabMetadata(tab *objfile.PclntabCandidate) PcLnTabMetadata {
+	meta := PcLnTabMetadata{CpuQuantum: tab.ParsedPclntab.Go12line.Quantum}
+
+	// quantum is the minimal unit for a program counter (1 on x86, 4 on most other systems).
+	// 386: 1, amd64: 1, arm: 4, arm64: 4, mips: 4, mips/64/64le/64be: 4, ppc64/64le: 4, riscv64: 4, s390x: 2, wasm: 1
+	meta.CpuQuantumStr = "x86/x64/wasm"
+	if meta.CpuQuantum == 2 {
+		meta.CpuQuantumStr = "s390x"
+	} else if meta.CpuQuantum == 4 {
+		meta.CpuQuantumStr = "arm/mips/ppc/riscv"
+	}
+
+	meta.VA = tab.PclntabVA
+	meta.Version = tab.ParsedPclntab.Go12line.Version.String()
+	meta.Endianess = tab.ParsedPclntab.Go12line.Binary.String()
+	meta.PointerSize = tab.ParsedPclntab.Go12line.Ptrsize
+	return meta
 }
 
-func main_impl(fileName string, printStdPkgs bool, printFilePaths bool, printTypes bool, noPrintFunctions bool, manualTypeAddress int, versionOverride string) (metadata ExtractMetadata, err error) {
-	extractMetadata := ExtractMetadata{}
+func main_impl(ctx context.Context, fileName string, printStdPkgs bool, printFilePaths bool, printTypes bool, printStrings bool, noPrintFunctions bool, manualTypeAddress int, versionOverride string) (metadata ExtractMetadata, err error) {
+	return analyzeFile(ctx, fileName, enabledDetectors, printStdPkgs, printFilePaths, printTypes, printStrings, noPrintFunctions, manualTypeAddress, versionOverride)
+}
+
+// analyzeFile is main_impl with the detections given rather than those of the command line, for the subcommands
+// that only need some
+func analyzeFile(ctx context.Context, fileName string, detectors detectorSet, printStdPkgs bool, printFilePaths bool, printTypes bool, printStrings bool, noPrintFunctions bool, manualTypeAddress int, versionOverride string) (metadata ExtractMetadata, err error) {
+	extractMetadata := ExtractMetadata{GoReSym: currentToolInfo()}
 
 	file, err := objfile.Open(fileName)
 	if err != nil {
+		// a path error means the file couldn't be read, anything else means it isn't an executable we know
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			err = fmt.Errorf("%w: %w", errNotGoBinary, err)
+		}
 		return ExtractMetadata{}, fmt.Errorf("invalid file: %w", err)
 	}
+	// unmaps the file, nothing reported may point into its data
+	defer file.Close()
+
+	logger.Info("analyzing", "file", fileName)
+
+	stats := &AnalysisStats{}
+	extractMetadata.Stats = stats
+	if info, err := os.Stat(fileName); err == nil {
+		stats.FileSize = uint64(info.Size())
+	}
+	analysisStart := time.Now()
+	defer func() { stats.Seconds = time.Since(analysisStart).Seconds() }()
 
+	buildInfoPhase := beginPhase("reading build info")
+	scannedBytes := uint64(0)
 	buildId, err := buildid.ReadFile(fileName)
 	if err == nil {
 		extractMetadata.BuildId = buildId
 	} else {
 		extractMetadata.BuildId = ""
+		extractMetadata.addError("buildid", "reading build info", err)
 	}
 
 	// try to get version the 'correct' way, also fill out buildSettings if parsing was ok
@@ -113,6 +323,8 @@ func main_impl(fileName string, printStdPkgs bool, printFilePaths bool, printTyp
 		}
 
 		extractMetadata.BuildInfo = *bi
+	} else {
+		extractMetadata.addError("buildinfo", "reading build info", err)
 	}
 
 	// Optional bruteforce any one of these, but only if they weren't previous found in the buildinfo
@@ -122,28 +334,13 @@ func main_impl(fileName string, printStdPkgs bool, printFilePaths bool, printTyp
 			extractMetadata.Arch = file.GOARCH()
 		}
 
-		fileData, fileDataErr := os.ReadFile(fileName)
+		fileData, fileDataErr := file.Data()
 		if fileDataErr == nil {
+			scannedBytes = uint64(len(fileData))
 
 			// GOVERSION
 			if extractMetadata.Version == "" {
-				// go1.<varies><garbage data>
-				idx := bytes.Index(fileData, []byte{0x67, 0x6F, 0x31, 0x2E})
-				if idx != -1 && len(fileData[idx:]) > 10 {
-					extractMetadata.Version = "go1."
-					ver := fileData[idx+4 : idx+10]
-					for i, c := range ver {
-						// the string is _not_ null terminated, nor length delimited. So, filter till first non-numeric ascii
-						nextIsNumeric := (i+1) < len(ver) && ver[i+1] >= 0x30 && ver[i+1] <= 0x39
-
-						// careful not to end with a . at the end
-						if (c >= 0x30 && c <= 0x39 && c != ' ') || (c == '.' && nextIsNumeric) {
-							extractMetadata.Version += string([]byte{c})
-						} else {
-							break
-						}
-					}
-				}
+				extractMetadata.Version = scanGoVersion(fileData)
 			}
 
 			// GOOS
@@ -185,53 +382,148 @@ func main_impl(fileName string, printStdPkgs bool, printFilePaths bool, printTyp
 		}
 	}
 
+	buildInfoPhase.end(fmt.Sprintf("version %q", extractMetadata.Version))
+	stats.record(buildInfoPhase, 0, scannedBytes)
+	if stoppedEarly(ctx, &extractMetadata, "reading build info") {
+		return extractMetadata, nil
+	}
+
+	if !onlyArtifacts.wants("pclntab") {
+		// as it would be once the pclntab was found
+		if len(versionOverride) > 0 {
+			extractMetadata.Version = versionOverride
+		}
+		extractMetadata.Version = normalizeGoVersion(extractMetadata.Version)
+		return extractMetadata, nil
+	}
+
+	if fastTriage {
+		headerPhase := beginPhase("locating pclntab header")
+		tab, err := file.PclntabHeader(ctx, versionOverride)
+		headerPhase.end("")
+		if stoppedEarly(ctx, &extractMetadata, "locating pclntab header") {
+			return extractMetadata, nil
+		}
+		if err == nil {
+			stats.record(headerPhase, 1, uint64(len(tab.Pclntab)))
+			if len(versionOverride) > 0 {
+				extractMetadata.Version = versionOverride
+			}
+			extractMetadata.Version = normalizeGoVersion(extractMetadata.Version)
+			extractMetadata.TabMeta = tabMetadata(tab)
+			return extractMetadata, nil
+		}
+		// a stomped magic, as garble leaves, takes the moduledata to tell the layout
+		logger.Debug("no pclntab header as found in the file, searching", "error", err)
+		stats.record(headerPhase, 0, 0)
+	}
+
+	// only the detections use these, which -only leaves out
+	var packing *PackingMetadata
+	if onlyArtifacts == nil {
+		sectionsPhase := beginPhase("measuring sections")
+		sections, scannedBytes, err := sectionMetadata(file)
+		if err != nil {
+			extractMetadata.addError("sections", "measuring sections", err)
+		}
+		extractMetadata.Sections = sections
+		sectionsPhase.end(fmt.Sprintf("%d sections", len(sections)))
+		stats.record(sectionsPhase, len(sections), scannedBytes)
+
+		if detectors.runs("fuzzy-hashes") {
+			fuzzyHashPhase := beginPhase("fuzzy hashing")
+			fuzzy, hashedBytes, err := fuzzyHashes(file)
+			if err != nil {
+				extractMetadata.addError("fuzzy-hashes", "fuzzy hashing", err)
+			}
+			extractMetadata.FuzzyHashes = fuzzy
+			fuzzyHashPhase.end(fmt.Sprintf("%d hashes", len(fuzzy)))
+			stats.record(fuzzyHashPhase, len(fuzzy), hashedBytes)
+		}
+
+		if detectors.runs("packing") {
+			packing, err = detectPacking(fileName, file, sections)
+			if err != nil {
+				extractMetadata.addError("packing", "measuring sections", err)
+			} else if packing.Packed || len(packing.Indicators) > 0 {
+				extractMetadata.Packing = packing
+			}
+		}
+	}
+
+	var parseCacheEntryPath string
+	var parsed *parseCacheEntry
+	if parseCacheDir != "" {
+		if fileData, err := file.Data(); err == nil {
+			parseCacheEntryPath = parseCachePath(parseCacheDir, sha256Hex(fileData), versionOverride)
+			if !parseCacheRefresh {
+				parseCachePhase := beginPhase("loading cached parse")
+				parsed = loadParseCache(parseCacheEntryPath)
+				parseCachePhase.end("")
+				stats.record(parseCachePhase, 0, 0)
+			}
+		}
+	}
+
 	var knownPclntabVA = uint64(0)
 	var knownGoTextBase = uint64(0)
 
+	pclntabPhase := beginPhase("locating pclntab")
+	candidateCount := 0
+
+	// a cached location is parsed alone, its moduledata already known. Should it fail, the search starts over.
+	var cachedTab *objfile.PclntabCandidate
+	if parsed != nil {
+		cachedTab, err = file.PclntabAt(parsed.PclntabVA, parsed.PclntabSize, parsed.TextBase, versionOverride)
+		if err != nil {
+			logger.Debug("ignoring cached pclntab", "path", parseCacheEntryPath, "error", err)
+			parsed = nil
+		}
+	}
+
 restartParseWithRealTextBase:
-	ch_tabs, err := file.PCLineTable(versionOverride, knownPclntabVA, knownGoTextBase)
-	if err != nil {
-		return ExtractMetadata{}, fmt.Errorf("failed to read pclntab: %w", err)
+	// the candidate scanners keep running until cancelled, release them once we've picked a candidate or restart
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	var ch_tabs <-chan objfile.PclntabCandidate
+	if cachedTab != nil {
+		knownPclntabVA, knownGoTextBase = cachedTab.PclntabVA, cachedTab.SecStart
+		ch := make(chan objfile.PclntabCandidate, 1)
+		ch <- *cachedTab
+		close(ch)
+		ch_tabs = ch
+	} else {
+		ch_tabs, err = file.PCLineTable(scanCtx, versionOverride, knownPclntabVA, knownGoTextBase)
+		if err != nil {
+			cancelScan()
+			pclntabPhase.end("")
+			return ExtractMetadata{}, fmt.Errorf("failed to read pclntab: %w", err)
+		}
 	}
 
 	var moduleData *objfile.ModuleData = nil
 	var finalTab *objfile.PclntabCandidate = nil
 	for tab := range ch_tabs {
+		candidateCount++
+		logger.Debug("trying pclntab candidate", hexAttr("va", tab.PclntabVA))
 		if len(versionOverride) > 0 {
 			extractMetadata.Version = versionOverride
 		}
 
-		// numeric only, go1.17 -> 1.17
-		goVersionIdx := strings.Index(extractMetadata.Version, "go")
-		if goVersionIdx != -1 {
-			// "devel go1.18-2d1d548 Tue Dec 21 03:55:43 2021 +0000"
-			extractMetadata.Version = strings.Split(extractMetadata.Version[goVersionIdx+2:]+" ", " ")[0]
-
-			// go1.18-2d1d548
-			extractMetadata.Version = strings.Split(extractMetadata.Version+"-", "-")[0]
-		}
-
-		extractMetadata.TabMeta.CpuQuantum = tab.ParsedPclntab.Go12line.Quantum
+		extractMetadata.Version = normalizeGoVersion(extractMetadata.Version)
 
-		// quantum is the minimal unit for a program counter (1 on x86, 4 on most other systems).
-		// 386: 1, amd64: 1, arm: 4, arm64: 4, mips: 4, mips/64/64le/64be: 4, ppc64/64le: 4, riscv64: 4, s390x: 2, wasm: 1
-		extractMetadata.TabMeta.CpuQuantumStr = "x86/x64/wasm"
-		if extractMetadata.TabMeta.CpuQuantum == 2 {
-			extractMetadata.TabMeta.CpuQuantumStr = "s390x"
-		} else if extractMetadata.TabMeta.CpuQuantum == 4 {
-			extractMetadata.TabMeta.CpuQuantumStr = "arm/mips/ppc/riscv"
-		}
-
-		extractMetadata.TabMeta.VA = tab.PclntabVA
-		extractMetadata.TabMeta.Version = tab.ParsedPclntab.Go12line.Version.String()
-		extractMetadata.TabMeta.Endianess = tab.ParsedPclntab.Go12line.Binary.String()
-		extractMetadata.TabMeta.PointerSize = tab.ParsedPclntab.Go12line.Ptrsize
+		extractMetadata.TabMeta = tabMetadata(&tab)
 
 		// this can be a little tricky to locate and parse properly across all go versions
 		// since moduledata holds a pointer to the pclntab, we can (hopefully) find the right candidate by using it to find the moduledata.
 		// if that location works, then we must have given it the correct pclntab VA. At least in theory...
 		// The resolved offsets within the pclntab might have used the wrong base though! We'll fix that later.
-		_, tmpModData, err := file.ModuleDataTable(tab.PclntabVA, extractMetadata.Version, extractMetadata.TabMeta.Version, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+		var tmpModData *objfile.ModuleData
+		var err error
+		if cachedTab != nil {
+			tmpModData = &parsed.ModuleData
+		} else {
+			_, tmpModData, err = file.ModuleDataTable(ctx, tab.PclntabVA, extractMetadata.Version, extractMetadata.TabMeta.Version, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+		}
 		if err == nil && tmpModData != nil {
 			// if the search candidate relied on a moduledata va, make sure it lines up with ours now
 			stomppedMagicMetaConstraintsValid := true
@@ -243,6 +535,8 @@ restartParseWithRealTextBase:
 				// assign real base and restart pclntab parsing with correct VAs!
 				knownGoTextBase = tmpModData.TextVA
 				knownPclntabVA = tab.PclntabVA
+				logger.Debug("moduledata found, restarting pclntab parse with its text base", hexAttr("moduledata", tmpModData.VA), hexAttr("textbase", knownGoTextBase))
+				cancelScan()
 				goto restartParseWithRealTextBase
 			}
 
@@ -253,8 +547,23 @@ restartParseWithRealTextBase:
 		}
 	}
 
+	cancelScan()
+	pclntabPhase.end(fmt.Sprintf("%d candidates", candidateCount))
+	if finalTab != nil {
+		stats.record(pclntabPhase, candidateCount, uint64(len(finalTab.Pclntab)))
+	} else {
+		stats.record(pclntabPhase, candidateCount, 0)
+	}
+	if finalTab == nil && stoppedEarly(ctx, &extractMetadata, "locating pclntab") {
+		return extractMetadata, nil
+	}
+
 	if finalTab == nil {
-		return ExtractMetadata{}, fmt.Errorf("no valid pclntab found")
+		if packing != nil && packing.Packed {
+			// a packed Go binary only reveals its pclntab once unpacked
+			return ExtractMetadata{}, fmt.Errorf("no valid pclntab found, the file looks packed (%s): %w", packingSummary(packing), errNotGoBinary)
+		}
+		return ExtractMetadata{}, fmt.Errorf("no valid pclntab found: %w", errNotGoBinary)
 	}
 
 	// to be sure we got the right pclntab we had to have found a moduledat as well. If we didn't, then we failed to find the pclntab (correctly) as well
@@ -262,202 +571,1857 @@ restartParseWithRealTextBase:
 		return ExtractMetadata{}, fmt.Errorf("no valid moduledata found")
 	}
 
+	logger.Info("found pclntab", hexAttr("va", finalTab.PclntabVA), "version", extractMetadata.TabMeta.Version, hexAttr("moduledata", moduleData.VA))
+
 	extractMetadata.ModuleMeta = *moduleData
-	if printTypes && manualTypeAddress == 0 {
-		types, err := file.ParseTypeLinks(extractMetadata.Version, moduleData, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
-		if err == nil {
-			extractMetadata.Types = types
+	storeParsed := parsed == nil
+	if parsed == nil {
+		parsed = &parseCacheEntry{PclntabVA: finalTab.PclntabVA, PclntabSize: uint64(len(finalTab.Pclntab)), TextBase: finalTab.SecStart, ModuleData: *moduleData}
+		// an old pclntab read through its symtab isn't parsed again without searching, there's nothing to cache
+		if len(finalTab.Symtab) > 0 {
+			parseCacheEntryPath = ""
 		}
+	}
+	parsedTypes := parsed.Types != nil
 
-		// the ITabLinks did not always exist, older versions it will be NULL
-		interfaces, err := file.ParseITabLinks(extractMetadata.Version, moduleData, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
-		if err == nil {
-			extractMetadata.Interfaces = interfaces
+	if onlyArtifacts == nil {
+		if detectors.runs("simhash") {
+			extractMetadata.SimHash = symbolSimHash(finalTab.ParsedPclntab.Funcs)
 		}
-	} else if manualTypeAddress != 0 {
-		types, err := file.ParseType(extractMetadata.Version, moduleData, uint64(manualTypeAddress), extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
-		if err == nil {
-			extractMetadata.Types = types
+
+		if detectors.runs("obfuscation") {
+			extractMetadata.Obfuscation = detectGarble(file, finalTab.ParsedPclntab, extractMetadata)
 		}
-	}
 
-	if printFilePaths {
-		for k := range finalTab.ParsedPclntab.Files {
-			extractMetadata.Files = append(extractMetadata.Files, k)
+		if detectors.runs("tls-callbacks") {
+			callbacks, err := tlsCallbacks(file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("tls", "reading TLS callbacks", err)
+			}
+			extractMetadata.TLSCallbacks = callbacks
 		}
-	}
 
-	if !noPrintFunctions {
-		for _, elem := range finalTab.ParsedPclntab.Funcs {
-			if isStdPackage(elem.PackageName()) {
-				if printStdPkgs {
-					extractMetadata.StdFunctions = append(extractMetadata.StdFunctions, FuncMetadata{
-						Start:       elem.Entry,
-						End:         elem.End,
-						PackageName: elem.PackageName(),
-						FullName:    elem.Name,
-					})
-				}
-			} else {
-				extractMetadata.UserFunctions = append(extractMetadata.UserFunctions, FuncMetadata{
-					Start:       elem.Entry,
-					End:         elem.End,
-					PackageName: elem.PackageName(),
-					FullName:    elem.Name,
-				})
+		if detectors.runs("stdlib") {
+			stdlibPhase := beginPhase("auditing the standard library")
+			extractMetadata.Stdlib = stdlibLinkage(finalTab.ParsedPclntab)
+			stdPackages := 0
+			if extractMetadata.Stdlib != nil {
+				stdPackages = len(extractMetadata.Stdlib.Packages)
 			}
+			stdlibPhase.end(fmt.Sprintf("%d packages", stdPackages))
+			stats.record(stdlibPhase, stdPackages, 0)
 		}
-	}
 
-	return extractMetadata, nil
-}
+		if detectors.runs("capabilities") {
+			capabilitiesPhase := beginPhase("tagging capabilities")
+			extractMetadata.Capabilities = detectCapabilities(ctx, file, finalTab.ParsedPclntab)
+			capabilitiesPhase.end(fmt.Sprintf("%d capabilities", len(extractMetadata.Capabilities)))
+			stats.record(capabilitiesPhase, len(extractMetadata.Capabilities), 0)
+			if stoppedEarly(ctx, &extractMetadata, "tagging capabilities") {
+				return extractMetadata, nil
+			}
+		}
 
-func printForHuman(metadata ExtractMetadata) {
-	fmt.Println("----GoReSym----")
-	fmt.Println("Some information is omitted, for a full listing do not use human view")
-	fmt.Printf("%-20s %s\n", "Version:", metadata.Version)
-	fmt.Printf("%-20s %s\n", "Arch:", metadata.Arch)
-	fmt.Printf("%-20s %s\n", "OS:", metadata.OS)
-	fmt.Println("\n-BUILD INFO-")
-	fmt.Printf("%-20s %s\n", "GoVersion", metadata.BuildInfo.GoVersion)
-	fmt.Printf("%-20s %s\n", "Path", metadata.BuildInfo.Path)
-	fmt.Printf("%-20s %s\n", "Main.Path", metadata.BuildInfo.Main.Path)
-	fmt.Printf("%-20s %s\n", "Main.Version", metadata.BuildInfo.Main.Version)
-	fmt.Printf("%-20s %s\n", "Main.Sum", metadata.BuildInfo.Main.Sum)
-	fmt.Printf("%-20s %s\n", "Main.Path", metadata.BuildInfo.Main.Path)
-	for i, dep := range metadata.BuildInfo.Deps {
-		depPrefix := fmt.Sprintf("Dep%d.", i)
-		fmt.Printf("%-20s %s\n", depPrefix+"Path", dep.Path)
-		fmt.Printf("%-20s %s\n", depPrefix+"Version", dep.Version)
-		fmt.Printf("%-20s %s\n", depPrefix+"Sum", dep.Sum)
-	}
-
-	fmt.Println("\n  -BUILD SETTINGS-")
-	if len(metadata.BuildInfo.Settings) > 0 {
-		for _, setting := range metadata.BuildInfo.Settings {
-			fmt.Printf("  %-20s %s\n", "Setting."+setting.Key, setting.Value)
+		if detectors.runs("anti-analysis") {
+			antiAnalysisPhase := beginPhase("detecting anti-analysis")
+			antiAnalysis, err := detectAntiAnalysis(file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("anti-analysis", "detecting anti-analysis", err)
+			}
+			extractMetadata.AntiAnalysis = antiAnalysis
+			antiAnalysisPhase.end(fmt.Sprintf("%d findings", len(antiAnalysis)))
+			stats.record(antiAnalysisPhase, len(antiAnalysis), stats.FileSize)
 		}
-	} else {
-		fmt.Println("  <NO SETTINGS PRESENT>")
-	}
 
-	fmt.Println("\n-TYPE STRUCTURES-")
-	printedStruct := false
-	for _, typ := range metadata.Types {
-		if len(typ.Reconstructed) > 0 {
-			fmt.Printf("VA: 0x%x\n", typ.VA)
-			fmt.Printf("%s\n\n", typ.Reconstructed)
-			printedStruct = true
+		if detectors.runs("persistence") {
+			persistencePhase := beginPhase("detecting persistence")
+			persistence, err := detectPersistence(ctx, file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("persistence", "detecting persistence", err)
+			}
+			extractMetadata.Persistence = persistence
+			persistencePhase.end(fmt.Sprintf("%d mechanisms", len(persistence)))
+			stats.record(persistencePhase, len(persistence), 0)
+			if stoppedEarly(ctx, &extractMetadata, "detecting persistence") {
+				return extractMetadata, nil
+			}
 		}
-	}
-	if !printedStruct {
-		fmt.Println("<NO TYPE STRUCTURES EXTRACTED>")
-	}
 
-	fmt.Println("\n-INTERFACES-")
-	printedInterface := false
-	for _, typ := range metadata.Interfaces {
-		if len(typ.Reconstructed) > 0 {
-			fmt.Printf("%-20s 0x%x\n", "VA:", typ.VA)
-			fmt.Printf("%s\n\n", typ.Reconstructed)
-			printedInterface = true
+		if detectors.runs("syscalls") {
+			syscallsPhase := beginPhase("enumerating syscalls")
+			syscalls, err := enumerateSyscalls(ctx, file, finalTab.ParsedPclntab, extractMetadata.OS, extractMetadata.Version)
+			if err != nil {
+				extractMetadata.addError("syscalls", "enumerating syscalls", err)
+			}
+			extractMetadata.Syscalls = syscalls
+			syscallCount := 0
+			if syscalls != nil {
+				syscallCount = len(syscalls.Syscalls)
+			}
+			syscallsPhase.end(fmt.Sprintf("%d syscalls", syscallCount))
+			stats.record(syscallsPhase, syscallCount, 0)
+			if stoppedEarly(ctx, &extractMetadata, "enumerating syscalls") {
+				return extractMetadata, nil
+			}
 		}
-	}
-	if !printedInterface {
-		fmt.Println("<NO INTERFACES EXTRACTED>")
-	}
 
-	fmt.Println("\n-Files-")
-	if len(metadata.Files) > 0 {
-		for _, file := range metadata.Files {
-			fmt.Println(file)
+		if detectors.runs("routes") {
+			routesPhase := beginPhase("recovering HTTP routes")
+			routes, err := extractRoutes(ctx, file, finalTab.ParsedPclntab, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+			if err != nil {
+				extractMetadata.addError("routes", "recovering HTTP routes", err)
+			}
+			extractMetadata.Routes = routes
+			routesPhase.end(fmt.Sprintf("%d routes", len(routes)))
+			stats.record(routesPhase, len(routes), 0)
+			if stoppedEarly(ctx, &extractMetadata, "recovering HTTP routes") {
+				return extractMetadata, nil
+			}
 		}
-	} else {
-		fmt.Println("<NO FILES EXTRACTED>")
-	}
 
-	fmt.Println("\n-User Functions-")
-	if len(metadata.UserFunctions) > 0 {
-		for i, fn := range metadata.UserFunctions {
-			fnPrefix := fmt.Sprintf("UserFunc%d.", i)
-			fmt.Printf("%-20s 0x%x\n", fnPrefix+"StartVA:", fn.Start)
-			fmt.Printf("%-20s 0x%x\n", fnPrefix+"EndVA:", fn.End)
-			fmt.Printf("%-20s %s\n", fnPrefix+"Package:", fn.PackageName)
-			fmt.Printf("%-20s %s\n", fnPrefix+"Name:", strings.TrimLeft(strings.TrimLeft(fn.FullName, fn.PackageName), "."))
+		if detectors.runs("channels") {
+			channelsPhase := beginPhase("mapping channel operations")
+			channels, err := extractChannelUses(ctx, file, finalTab.ParsedPclntab, moduleData, extractMetadata.Version, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+			if err != nil {
+				extractMetadata.addError("channels", "mapping channel operations", err)
+			}
+			extractMetadata.Channels = channels
+			channelsPhase.end(fmt.Sprintf("%d functions", len(channels)))
+			stats.record(channelsPhase, len(channels), 0)
+			if stoppedEarly(ctx, &extractMetadata, "mapping channel operations") {
+				return extractMetadata, nil
+			}
 		}
-	} else {
-		fmt.Println("<NO USER FUNCTIONS EXTRACTED>")
-	}
 
-	fmt.Println("\n-Standard Functions-")
-	if len(metadata.StdFunctions) > 0 {
-		for i, fn := range metadata.StdFunctions {
-			fnPrefix := fmt.Sprintf("StdFunc%d.", i)
-			fmt.Printf("%-20s 0x%x\n", fnPrefix+"StartVA:", fn.Start)
-			fmt.Printf("%-20s 0x%x\n", fnPrefix+"EndVA:", fn.End)
-			fmt.Printf("%-20s %s\n", fnPrefix+"Name:", fn.FullName)
+		if devirtualizeCalls {
+			devirtualizePhase := beginPhase("devirtualizing interface calls")
+			devirtualized, err := devirtualize(ctx, file, finalTab.ParsedPclntab, moduleData, extractMetadata.Version, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+			if err != nil {
+				extractMetadata.addError("devirtualize", "devirtualizing interface calls", err)
+			}
+			extractMetadata.Devirtualized = devirtualized
+			sites := 0
+			if devirtualized != nil {
+				sites = len(devirtualized.CallSites)
+			}
+			devirtualizePhase.end(fmt.Sprintf("%d call sites", sites))
+			stats.record(devirtualizePhase, sites, 0)
+			if stoppedEarly(ctx, &extractMetadata, "devirtualizing interface calls") {
+				return extractMetadata, nil
+			}
 		}
-	} else {
-		fmt.Println("<NO STANDARD FUNCTIONS EXTRACTED>")
-	}
-}
 
-func DataToJson(data interface{}) string {
-	jsonBytes, err := json.MarshalIndent(data, "", "    ")
-	if err != nil {
-		return "{\"error\": \"failed to format output\"}"
-	}
-	return string(jsonBytes)
-}
+		if detectors.runs("regexes") {
+			regexesPhase := beginPhase("recovering regular expressions")
+			regexes, err := extractRegexes(ctx, file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("regexes", "recovering regular expressions", err)
+			}
+			extractMetadata.Regexes = regexes
+			regexesPhase.end(fmt.Sprintf("%d patterns", len(regexes)))
+			stats.record(regexesPhase, len(regexes), 0)
+			if stoppedEarly(ctx, &extractMetadata, "recovering regular expressions") {
+				return extractMetadata, nil
+			}
+		}
 
-func TextToJson(key string, text string) string {
-	return fmt.Sprintf("{\"%s\": \"%s\"}", key, text)
-}
+		if detectors.runs("environment") {
+			environmentPhase := beginPhase("recovering environment variables")
+			environment, err := extractEnvironment(ctx, file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("environment", "recovering environment variables", err)
+			}
+			extractMetadata.Environment = environment
+			environmentPhase.end(fmt.Sprintf("%d variables", len(environment)))
+			stats.record(environmentPhase, len(environment), 0)
+			if stoppedEarly(ctx, &extractMetadata, "recovering environment variables") {
+				return extractMetadata, nil
+			}
+		}
 
-var Version = "dev-local-build"
+		if detectors.runs("flags") {
+			flagsPhase := beginPhase("recovering command-line flags")
+			flags, err := extractFlags(ctx, file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("flags", "recovering command-line flags", err)
+			}
+			extractMetadata.Flags = flags
+			flagsPhase.end(fmt.Sprintf("%d flags", len(flags)))
+			stats.record(flagsPhase, len(flags), 0)
+			if stoppedEarly(ctx, &extractMetadata, "recovering command-line flags") {
+				return extractMetadata, nil
+			}
+		}
 
-func main() {
-	stdout := bufio.NewWriter(os.Stdout)
-	defer stdout.Flush()
+		if detectors.runs("telemetry") {
+			telemetryPhase := beginPhase("extracting telemetry names")
+			telemetry, err := extractTelemetry(ctx, file, finalTab.ParsedPclntab, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+			if err != nil {
+				extractMetadata.addError("telemetry", "extracting telemetry names", err)
+			}
+			extractMetadata.Telemetry = telemetry
+			names := 0
+			if telemetry != nil {
+				names = len(telemetry.Metrics) + len(telemetry.Spans)
+			}
+			telemetryPhase.end(fmt.Sprintf("%d names", names))
+			stats.record(telemetryPhase, names, 0)
+			if stoppedEarly(ctx, &extractMetadata, "extracting telemetry names") {
+				return extractMetadata, nil
+			}
+		}
 
-	log.SetFlags(0)
-	log.SetPrefix("GoReSym: ")
+		if detectors.runs("protobuf") {
+			protobufPhase := beginPhase("extracting protobuf descriptors")
+			protobuf, err := extractProtobuf(ctx, file)
+			if err != nil {
+				extractMetadata.addError("protobuf", "extracting protobuf descriptors", err)
+			}
+			extractMetadata.Protobuf = protobuf
+			protobufPhase.end(fmt.Sprintf("%d files", len(protobuf)))
+			stats.record(protobufPhase, len(protobuf), 0)
+			if stoppedEarly(ctx, &extractMetadata, "extracting protobuf descriptors") {
+				return extractMetadata, nil
+			}
+		}
 
-	about := flag.Bool("about", false, "Print license and author information")
-	printStdPkgs := flag.Bool("d", false, "Print Default Packages")
-	printFilePaths := flag.Bool("p", false, "Print File Paths")
-	printTypes := flag.Bool("t", false, "Print types automatically, enumerate typelinks and itablinks")
-	noPrintFunctions := flag.Bool("nofuncs", false, "Do not print user and standard function sections")
-	typeAddress := flag.Int("m", 0, "Manually parse the RTYPE at the provided virtual address, disables automated enumeration of moduledata typelinks itablinks")
-	versionOverride := flag.String("v", "", "Override the automated version detection, ex: 1.17. If this is wrong, parsing may fail or produce nonsense")
-	humanView := flag.Bool("human", false, "Human view, print information flat rather than json, some information is omitted for clarity")
-	flag.Parse()
+		if len(extractMetadata.BuildInfo.Settings) > 0 {
+			extractMetadata.Build = buildSettingsFromInfo(extractMetadata.BuildInfo.Settings)
+		} else {
+			extractMetadata.Build = inferBuildSettings(file, finalTab.ParsedPclntab, extractMetadata.Sections)
+		}
+		detectCryptoBackend(finalTab.ParsedPclntab, extractMetadata.Build)
+		extractMetadata.VCS = vcsMetadata(extractMetadata.BuildInfo)
 
-	if *about {
-		fmt.Printf("Version: %s\n", Version)
-		fmt.Println("GoReSym is a Golang symbol recovery tool by Google's Mandiant FLARE team. Maintained by Stephen Eckels.")
-		fmt.Println("LICENSE MIT: https://github.com/mandiant/GoReSym/blob/master/LICENSE")
-		fmt.Println("Dependencies:")
-		fmt.Println("orderedmap by elliotchance: https://github.com/elliotchance/orderedmap/blob/master/LICENSE")
-		fmt.Println("binaryregexp by rsc (The Go Authors): https://github.com/rsc/binaryregexp/blob/master/LICENSE")
-		fmt.Println("Go source code (The Go Authors): https://github.com/golang/go/blob/master/LICENSE")
-		os.Exit(0)
-	}
+		if detectors.runs("runtime-tuning") {
+			tuningPhase := beginPhase("recovering runtime tuning")
+			tuning, err := extractRuntimeTuning(ctx, file, finalTab.ParsedPclntab, extractMetadata.Build, extractMetadata.Version)
+			if err != nil {
+				extractMetadata.addError("runtime-tuning", "recovering runtime tuning", err)
+			}
+			extractMetadata.RuntimeTuning = tuning
+			tuningPhase.end(fmt.Sprintf("%d settings", len(tuning)))
+			stats.record(tuningPhase, len(tuning), 0)
+			if stoppedEarly(ctx, &extractMetadata, "recovering runtime tuning") {
+				return extractMetadata, nil
+			}
+		}
+		if detectors.runs("injected-strings") {
+			extractMetadata.InjectedStrings = extractInjectedStrings(file, extractMetadata.Build, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+		}
 
-	if flag.NArg() != 1 {
-		fmt.Println(TextToJson("error", "filepath must be provided as first argument"))
-		os.Exit(1)
-	}
+		if detectors.runs("modules") {
+			modulesPhase := beginPhase("building the module graph")
+			modules, err := buildModuleGraph(ctx, file, finalTab.ParsedPclntab, extractMetadata.BuildInfo)
+			if err != nil {
+				extractMetadata.addError("modules", "building the module graph", err)
+			}
+			extractMetadata.Modules = modules
+			if modules != nil {
+				modulesPhase.end(fmt.Sprintf("%d modules", len(modules.Modules)))
+				stats.record(modulesPhase, len(modules.Modules), 0)
+			} else {
+				modulesPhase.end("no modules")
+				stats.record(modulesPhase, 0, 0)
+			}
+			if stoppedEarly(ctx, &extractMetadata, "building the module graph") {
+				return extractMetadata, nil
+			}
+		}
 
-	metadata, err := main_impl(flag.Arg(0), *printStdPkgs, *printFilePaths, *printTypes, *noPrintFunctions, *typeAddress, *versionOverride)
-	if err != nil {
-		fmt.Println(TextToJson("error", fmt.Sprintf("Failed to parse file: %s", err)))
-		os.Exit(1)
-	} else {
-		if *humanView {
-			printForHuman(metadata)
-		} else {
-			fmt.Println(DataToJson((metadata)))
+		if detectors.runs("target") {
+			target, err := targetEnvironment(file, finalTab.ParsedPclntab, extractMetadata)
+			if err != nil {
+				extractMetadata.addError("target", "reading the linkage", err)
+			}
+			extractMetadata.Target = target
+		}
+
+		if detectors.runs("native-libraries") {
+			nativePhase := beginPhase("identifying native libraries")
+			if fileData, err := file.Data(); err != nil {
+				extractMetadata.addError("native-libraries", "identifying native libraries", err)
+			} else {
+				extractMetadata.NativeLibraries = detectNativeLibraries(fileData, extractMetadata.Build)
+			}
+			nativePhase.end(fmt.Sprintf("%d native libraries", len(extractMetadata.NativeLibraries)))
+			stats.record(nativePhase, len(extractMetadata.NativeLibraries), stats.FileSize)
+			if stoppedEarly(ctx, &extractMetadata, "identifying native libraries") {
+				return extractMetadata, nil
+			}
+		}
+
+		if detectors.runs("timestamps") {
+			timestamps, err := collectTimestamps(file, extractMetadata, time.Now())
+			if err != nil {
+				extractMetadata.addError("timestamps", "reading timestamps", err)
+			}
+			extractMetadata.Timestamps = timestamps
+		}
+
+		if detectors.runs("signature") {
+			signaturePhase := beginPhase("verifying code signature")
+			signature, err := verifyCodeSignature(file, extractMetadata.BuildId)
+			if err != nil {
+				extractMetadata.addError("signature", "verifying code signature", err)
+			}
+			extractMetadata.Signature = signature
+			signatureStatus := "no signature format"
+			if signature != nil {
+				signatureStatus = signature.Status
+			}
+			signaturePhase.end(signatureStatus)
+			stats.record(signaturePhase, 0, stats.FileSize)
+		}
+
+		if detectors.runs("resources") {
+			resources, err := extractResources(file, extractMetadata.Signature)
+			if err != nil {
+				extractMetadata.addError("resources", "parsing resources", err)
+			}
+			extractMetadata.Resources = resources
+		}
+
+		if detectors.runs("key-material") {
+			keyMaterialPhase := beginPhase("extracting key material")
+			keyMaterial, err := extractKeyMaterial(file)
+			if err != nil {
+				extractMetadata.addError("key-material", "extracting key material", err)
+			}
+			extractMetadata.KeyMaterial = keyMaterial
+			keyMaterialPhase.end(fmt.Sprintf("%d certificates and keys", len(keyMaterial)))
+			stats.record(keyMaterialPhase, len(keyMaterial), 0)
+		}
+
+		if detectors.runs("licenses") {
+			licensesPhase := beginPhase("detecting license texts")
+			licenses, err := extractLicenses(file, extractMetadata.BuildInfo)
+			if err != nil {
+				extractMetadata.addError("licenses", "detecting license texts", err)
+			}
+			extractMetadata.Licenses = licenses
+			licensesPhase.end(fmt.Sprintf("%d license texts", len(licenses)))
+			stats.record(licensesPhase, len(licenses), 0)
+		}
+
+		if detectors.runs("root-cas") {
+			publicRoots, err := mozillaRoots()
+			if err != nil {
+				extractMetadata.addError("root-cas", "loading the public roots", err)
+			}
+			rootCAs, err := analyzeRootCAs(file, finalTab.ParsedPclntab, extractMetadata.KeyMaterial, publicRoots)
+			if err != nil {
+				extractMetadata.addError("root-cas", "finding certificate pools", err)
+			}
+			extractMetadata.RootCAs = rootCAs
+		}
+		if detectors.runs("time-zones") {
+			extractMetadata.TimeZoneData = detectTimeZoneData(file, finalTab.ParsedPclntab)
+		}
+
+		if detectors.runs("cryptojacking") {
+			cryptojackingPhase := beginPhase("detecting cryptojacking")
+			cryptojacking, err := detectCryptojacking(ctx, file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("cryptojacking", "detecting cryptojacking", err)
+			}
+			extractMetadata.Cryptojacking = cryptojacking
+			cryptojackingPhase.end("")
+			stats.record(cryptojackingPhase, 0, 0)
+		}
+
+		if detectors.runs("crypto-constants") {
+			constantsPhase := beginPhase("finding crypto constants")
+			constants, err := findCryptoConstants(ctx, file, finalTab.ParsedPclntab)
+			if err != nil {
+				extractMetadata.addError("crypto-constants", "finding crypto constants", err)
+			}
+			extractMetadata.CryptoConstants = constants
+			constantsPhase.end(fmt.Sprintf("%d constants", len(constants)))
+			stats.record(constantsPhase, len(constants), 0)
 		}
 	}
+
+	// the scans above shared the section data, free it before the types and strings add their own
+	file.ReleaseSections()
+
+	for _, analyzer := range analysisOrder {
+		switch analyzer {
+		case "types":
+			if printTypes && manualTypeAddress == 0 {
+				typesPhase := beginPhase("parsing types")
+				budgetCtx, stopBudget := withMemoryBudget(ctx)
+				types, err := parsed.Types, error(nil)
+				if !parsedTypes {
+					types, err = file.ParseTypeLinks(budgetCtx, extractMetadata.Version, moduleData, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+				}
+				if err != nil && budgetCtx.Err() == nil {
+					extractMetadata.addError("types", "parsing types", err)
+				}
+				typesComplete := err == nil
+				degraded(budgetCtx, &extractMetadata, "types", "parsing types")
+				stopBudget()
+				// on timeout the types parsed so far are returned along with the error, keep them
+				extractMetadata.Types = types
+				typesPhase.end(fmt.Sprintf("%d types", len(extractMetadata.Types)))
+				stats.record(typesPhase, len(extractMetadata.Types), moduleData.ETypes-moduleData.Types)
+				if stoppedEarly(ctx, &extractMetadata, "parsing types") {
+					return extractMetadata, nil
+				}
+
+				// the ITabLinks did not always exist, older versions it will be NULL
+				interfacesPhase := beginPhase("parsing interfaces")
+				budgetCtx, stopBudget = withMemoryBudget(ctx)
+				interfaces, err := parsed.Interfaces, error(nil)
+				if !parsedTypes {
+					interfaces, err = file.ParseITabLinks(budgetCtx, extractMetadata.Version, moduleData, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+				}
+				if err != nil && budgetCtx.Err() == nil {
+					extractMetadata.addError("interfaces", "parsing interfaces", err)
+				}
+				degraded(budgetCtx, &extractMetadata, "interfaces", "parsing interfaces")
+				stopBudget()
+				// cut short, they're parsed again next time
+				if !parsedTypes && typesComplete && err == nil {
+					parsed.Types, parsed.Interfaces = nonNilTypes(types), nonNilTypes(interfaces)
+					storeParsed = true
+				}
+				extractMetadata.Interfaces = interfaces
+				interfacesPhase.end(fmt.Sprintf("%d interfaces", len(extractMetadata.Interfaces)))
+				stats.record(interfacesPhase, len(extractMetadata.Interfaces), 0)
+				if stoppedEarly(ctx, &extractMetadata, "parsing interfaces") {
+					return extractMetadata, nil
+				}
+			} else if manualTypeAddress != 0 {
+				typesPhase := beginPhase(fmt.Sprintf("parsing type at 0x%x", manualTypeAddress))
+				types, err := file.ParseType(ctx, extractMetadata.Version, moduleData, uint64(manualTypeAddress), extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+				if err == nil {
+					extractMetadata.Types = types
+				} else {
+					extractMetadata.addError("types", fmt.Sprintf("parsing type at 0x%x", manualTypeAddress), err)
+				}
+				typesPhase.end(fmt.Sprintf("%d types", len(extractMetadata.Types)))
+				stats.record(typesPhase, len(extractMetadata.Types), 0)
+				if stoppedEarly(ctx, &extractMetadata, "parsing types") {
+					return extractMetadata, nil
+				}
+			}
+		case "files":
+			if printFilePaths {
+				for k := range finalTab.ParsedPclntab.Files {
+					extractMetadata.Files = append(extractMetadata.Files, k)
+				}
+				extractMetadata.SourceTree = buildSourceTree(finalTab.ParsedPclntab)
+			}
+		case "functions":
+			if !noPrintFunctions {
+				functionsPhase := beginPhase("collecting functions")
+				for _, elem := range finalTab.ParsedPclntab.Funcs {
+					if isStdPackage(elem.PackageName()) {
+						if printStdPkgs {
+							extractMetadata.StdFunctions = append(extractMetadata.StdFunctions, FuncMetadata{
+								Start:       elem.Entry,
+								End:         elem.End,
+								PackageName: elem.PackageName(),
+								FullName:    elem.Name,
+							})
+						}
+					} else {
+						extractMetadata.UserFunctions = append(extractMetadata.UserFunctions, FuncMetadata{
+							Start:       elem.Entry,
+							End:         elem.End,
+							PackageName: elem.PackageName(),
+							FullName:    elem.Name,
+						})
+					}
+				}
+				functionsPhase.end(fmt.Sprintf("%d user, %d standard", len(extractMetadata.UserFunctions), len(extractMetadata.StdFunctions)))
+				stats.record(functionsPhase, len(finalTab.ParsedPclntab.Funcs), 0)
+			}
+		case "strings":
+			if printStrings {
+				stringsPhase := beginPhase("extracting strings")
+				// skipped when the types already used up the budget
+				budgetCtx, stopBudget := withMemoryBudget(ctx)
+				strs, scanned, err := extractStrings(budgetCtx, file, finalTab.ParsedPclntab, moduleData, extractMetadata.TabMeta.PointerSize == 8, extractMetadata.TabMeta.Endianess == "LittleEndian")
+				if err != nil && budgetCtx.Err() == nil {
+					extractMetadata.addError("strings", "extracting strings", err)
+				}
+				degraded(budgetCtx, &extractMetadata, "strings", "extracting strings")
+				stopBudget()
+				extractMetadata.Strings = strs
+				stringsPhase.end(fmt.Sprintf("%d strings", len(extractMetadata.Strings)))
+				stats.record(stringsPhase, len(extractMetadata.Strings), scanned)
+				if stoppedEarly(ctx, &extractMetadata, "extracting strings") {
+					return extractMetadata, nil
+				}
+			}
+		}
+	}
+
+	// every function and type recovered, for -origin and readers focusing on the main module
+	annotateOrigins(&extractMetadata, finalTab.ParsedPclntab)
+
+	// after the types and strings, which name the engines' types and hold their scripts
+	if onlyArtifacts == nil {
+		if detectors.runs("scripting") {
+			extractMetadata.Scripting = detectScriptEngines(finalTab.ParsedPclntab, extractMetadata.Types, extractMetadata.Strings)
+		}
+		if detectors.runs("c2-frameworks") {
+			extractMetadata.C2Frameworks = detectC2Frameworks(ctx, file, finalTab.ParsedPclntab, extractMetadata.Types, extractMetadata.Protobuf, extractMetadata.BuildInfo)
+		}
+		if detectors.runs("sql") {
+			extractMetadata.SQL = extractSQL(extractMetadata.Strings)
+		}
+	}
+
+	if parseCacheEntryPath != "" && storeParsed {
+		if err := storeParseCache(parseCacheEntryPath, parsed); err != nil {
+			logger.Warn("failed to write parse cache entry", "error", err)
+		}
+	}
+	return extractMetadata, nil
+}
+
+func printForHuman(w io.Writer, metadata ExtractMetadata) {
+	fmt.Fprintln(w, "----GoReSym----")
+	fmt.Fprintln(w, "Some information is omitted, for a full listing do not use human view")
+	fmt.Fprintf(w, "%-20s %s\n", "Version:", metadata.Version)
+	fmt.Fprintf(w, "%-20s %s\n", "Arch:", metadata.Arch)
+	fmt.Fprintf(w, "%-20s %s\n", "OS:", metadata.OS)
+	fmt.Fprintln(w, "\n-BUILD INFO-")
+	fmt.Fprintf(w, "%-20s %s\n", "GoVersion", metadata.BuildInfo.GoVersion)
+	fmt.Fprintf(w, "%-20s %s\n", "Path", metadata.BuildInfo.Path)
+	fmt.Fprintf(w, "%-20s %s\n", "Main.Path", metadata.BuildInfo.Main.Path)
+	fmt.Fprintf(w, "%-20s %s\n", "Main.Version", metadata.BuildInfo.Main.Version)
+	fmt.Fprintf(w, "%-20s %s\n", "Main.Sum", metadata.BuildInfo.Main.Sum)
+	fmt.Fprintf(w, "%-20s %s\n", "Main.Path", metadata.BuildInfo.Main.Path)
+	if metadata.Modules != nil {
+		printModuleTree(w, metadata.Modules)
+	} else {
+		for i, dep := range metadata.BuildInfo.Deps {
+			depPrefix := fmt.Sprintf("Dep%d.", i)
+			fmt.Fprintf(w, "%-20s %s\n", depPrefix+"Path", dep.Path)
+			fmt.Fprintf(w, "%-20s %s\n", depPrefix+"Version", dep.Version)
+			fmt.Fprintf(w, "%-20s %s\n", depPrefix+"Sum", dep.Sum)
+		}
+	}
+
+	fmt.Fprintln(w, "\n  -BUILD SETTINGS-")
+	if len(metadata.BuildInfo.Settings) > 0 {
+		for _, setting := range metadata.BuildInfo.Settings {
+			fmt.Fprintf(w, "  %-20s %s\n", "Setting."+setting.Key, setting.Value)
+		}
+	} else if metadata.Build != nil {
+		fmt.Fprintln(w, "  <NO SETTINGS PRESENT, INFERRED>")
+		if metadata.Build.CGOEnabled != nil {
+			fmt.Fprintf(w, "  %-20s %t\n", "CGOEnabled", *metadata.Build.CGOEnabled)
+		}
+		if metadata.Build.Trimpath != nil {
+			fmt.Fprintf(w, "  %-20s %t\n", "Trimpath", *metadata.Build.Trimpath)
+		}
+		if metadata.Build.Race {
+			fmt.Fprintf(w, "  %-20s %t\n", "Race", metadata.Build.Race)
+		}
+		if len(metadata.Build.Tags) > 0 {
+			fmt.Fprintf(w, "  %-20s %s\n", "Tags", strings.Join(metadata.Build.Tags, ","))
+		}
+		if metadata.Build.Ldflags != "" {
+			fmt.Fprintf(w, "  %-20s %s\n", "Ldflags", metadata.Build.Ldflags)
+		}
+		for _, evidence := range metadata.Build.Evidence {
+			fmt.Fprintf(w, "  %-20s %s\n", "Evidence", evidence)
+		}
+	} else {
+		fmt.Fprintln(w, "  <NO SETTINGS PRESENT>")
+	}
+	if metadata.Build != nil && metadata.Build.CryptoBackend != "" {
+		fmt.Fprintf(w, "  %-20s %s %s\n", "CryptoBackend", metadata.Build.CryptoBackend, metadata.Build.CryptoModule)
+		if metadata.Build.FIPSOnly {
+			fmt.Fprintf(w, "  %-20s %t\n", "FIPSOnly", metadata.Build.FIPSOnly)
+		}
+	}
+
+	if metadata.Target != nil {
+		fmt.Fprintln(w, "\n-TARGET-")
+		fmt.Fprintf(w, "%-20s %s/%s %s\n", "Platform", metadata.Target.OS, metadata.Target.Arch, metadata.Target.ArchLevel)
+		if metadata.Target.CGOEnabled != nil {
+			fmt.Fprintf(w, "%-20s %t\n", "CGOEnabled", *metadata.Target.CGOEnabled)
+		}
+		fmt.Fprintf(w, "%-20s %s %s\n", "Linking", metadata.Target.Linking, metadata.Target.Interpreter)
+		for _, library := range metadata.Target.Libraries {
+			fmt.Fprintf(w, "%-20s %s\n", "Library", library)
+		}
+		for _, evidence := range metadata.Target.Evidence {
+			fmt.Fprintf(w, "%-20s %s\n", "Evidence", evidence)
+		}
+	}
+
+	if metadata.VCS != nil {
+		fmt.Fprintln(w, "\n-VCS-")
+		fmt.Fprintf(w, "%-20s %s %s\n", "Revision", metadata.VCS.System, metadata.VCS.Revision)
+		if metadata.VCS.Time != "" {
+			fmt.Fprintf(w, "%-20s %s\n", "Time", metadata.VCS.Time)
+		}
+		if metadata.VCS.Modified != nil {
+			fmt.Fprintf(w, "%-20s %t\n", "Modified", *metadata.VCS.Modified)
+		}
+		if metadata.VCS.CommitURL != "" {
+			fmt.Fprintf(w, "%-20s %s\n", "Commit", metadata.VCS.CommitURL)
+		}
+		for _, inconsistency := range metadata.VCS.Inconsistencies {
+			fmt.Fprintf(w, "%-20s %s\n", "Inconsistent", inconsistency)
+		}
+	}
+
+	if metadata.Timestamps != nil {
+		fmt.Fprintln(w, "\n-TIMESTAMPS-")
+		for _, ts := range metadata.Timestamps.Timestamps {
+			fmt.Fprintf(w, "%-20s %-8s %s\n", ts.Time.Format(time.RFC3339), ts.Kind, ts.Source)
+		}
+		for _, inconsistency := range metadata.Timestamps.Inconsistencies {
+			fmt.Fprintf(w, "%-20s %s\n", "Inconsistent", inconsistency)
+		}
+	}
+
+	if metadata.Signature != nil {
+		fmt.Fprintln(w, "\n-SIGNATURE-")
+		fmt.Fprintf(w, "%-20s %s %s\n", "Status", metadata.Signature.Format, metadata.Signature.Status)
+		for _, problem := range metadata.Signature.Problems {
+			fmt.Fprintf(w, "%-20s %s\n", "Problem", problem)
+		}
+		if metadata.Signature.Identifier != "" {
+			fmt.Fprintf(w, "%-20s %s %s\n", "Identifier", metadata.Signature.Identifier, metadata.Signature.TeamID)
+		}
+		for _, signer := range metadata.Signature.Signers {
+			fmt.Fprintf(w, "%-20s %s (issuer %s, serial %s, %s to %s)\n", "Signer", signer.Subject, signer.Issuer, signer.SerialNumber, signer.NotBefore.Format("2006-01-02"), signer.NotAfter.Format("2006-01-02"))
+		}
+		if metadata.Signature.Status != "unsigned" {
+			fmt.Fprintf(w, "%-20s %t\n", "BuildIDCovered", metadata.Signature.BuildIDCovered)
+		}
+	}
+
+	if metadata.Resources != nil {
+		fmt.Fprintln(w, "\n-RESOURCES-")
+		for _, resource := range metadata.Resources.Resources {
+			fmt.Fprintf(w, "%-20s %-12s lang %-6d size 0x%-8x %s\n", resource.Type, resource.Name, resource.Language, resource.Size, resource.SHA256)
+		}
+		if info := metadata.Resources.VersionInfo; info != nil {
+			fmt.Fprintf(w, "%-20s %s\n", "FileVersion", info.FileVersion)
+			fmt.Fprintf(w, "%-20s %s\n", "ProductVersion", info.ProductVersion)
+			keys := make([]string, 0, len(info.Strings))
+			for key := range info.Strings {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(w, "%-20s %s\n", key, info.Strings[key])
+			}
+		}
+		if metadata.Resources.Impersonation != "" {
+			fmt.Fprintf(w, "%-20s %s\n", "Impersonation", metadata.Resources.Impersonation)
+		}
+	}
+
+	if len(metadata.NativeLibraries) > 0 {
+		fmt.Fprintln(w, "\n-NATIVE LIBRARIES-")
+		for _, library := range metadata.NativeLibraries {
+			fmt.Fprintf(w, "%-12s %-10s %q\n", library.Name, library.Version, library.Evidence)
+		}
+	}
+
+	fmt.Fprintln(w, "\n-SECTIONS-")
+	if len(metadata.Sections) > 0 {
+		for _, sec := range metadata.Sections {
+			fmt.Fprintf(w, "%-20s 0x%-12x size 0x%-10x file 0x%-10x %s entropy %.2f\n", sec.Name, sec.Address, sec.Size, sec.FileSize, sec.Permissions, sec.Entropy)
+		}
+	} else {
+		fmt.Fprintln(w, "<NO SECTIONS PRESENT>")
+	}
+
+	if len(metadata.FuzzyHashes) > 0 {
+		fmt.Fprintln(w, "\n-FUZZY HASHES-")
+		for _, hash := range metadata.FuzzyHashes {
+			fmt.Fprintf(w, "%-20s %s\n", hash.Source+" ssdeep", hash.SSDEEP)
+			if hash.TLSH != "" {
+				fmt.Fprintf(w, "%-20s %s\n", hash.Source+" tlsh", hash.TLSH)
+			}
+		}
+	}
+
+	if len(metadata.TLSCallbacks) > 0 {
+		fmt.Fprintln(w, "\n-TLS CALLBACKS-")
+		for _, callback := range metadata.TLSCallbacks {
+			fmt.Fprintf(w, "0x%x %s\n", callback.Address, callback.Function)
+		}
+	}
+
+	if len(metadata.Capabilities) > 0 {
+		fmt.Fprintln(w, "\n-CAPABILITIES-")
+		for _, capability := range metadata.Capabilities {
+			fmt.Fprintf(w, "%-20s %s\n", capability.Tag, strings.Join(capability.Techniques, ", "))
+			if len(capability.Packages) > 0 {
+				fmt.Fprintf(w, "    packages: %s\n", strings.Join(capability.Packages, ", "))
+			}
+			for _, callSite := range capability.CallSites {
+				fmt.Fprintf(w, "    %s\n", callSite)
+			}
+		}
+	}
+
+	if metadata.Stdlib != nil {
+		fmt.Fprintln(w, "\n-STANDARD LIBRARY-")
+		fmt.Fprintf(w, "%d packages, %d functions, %d bytes of code (%.0f%% of all code)\n", len(metadata.Stdlib.Packages), metadata.Stdlib.Functions, metadata.Stdlib.Size, metadata.Stdlib.Share*100)
+		for _, surface := range metadata.Stdlib.Surfaces {
+			fmt.Fprintf(w, "    %-16s %9d bytes  %s\n", surface.Name, surface.Size, strings.Join(surface.Packages, ", "))
+		}
+		for _, pkg := range metadata.Stdlib.Packages {
+			if pkg.Functions == 0 {
+				fmt.Fprintf(w, "%-50s %9s %6s  %s\n", pkg.Path, "inlined", "", pkg.Surface)
+				continue
+			}
+			fmt.Fprintf(w, "%-50s %9d %6d  %s\n", pkg.Path, pkg.Size, pkg.Functions, pkg.Surface)
+		}
+	}
+
+	if len(metadata.AntiAnalysis) > 0 {
+		fmt.Fprintln(w, "\n-ANTI-ANALYSIS-")
+		for _, finding := range metadata.AntiAnalysis {
+			fmt.Fprintf(w, "%-14s %-36s %s\n", finding.Tag, finding.Technique, finding.Evidence)
+		}
+	}
+
+	if len(metadata.Persistence) > 0 {
+		fmt.Fprintln(w, "\n-PERSISTENCE-")
+		for _, mechanism := range metadata.Persistence {
+			fmt.Fprintf(w, "%-16s %s\n", mechanism.Mechanism, mechanism.Technique)
+			for _, evidence := range mechanism.Evidence {
+				fmt.Fprintf(w, "    0x%x %s", evidence.Address, evidence.Value)
+				if evidence.Function != "" {
+					fmt.Fprintf(w, " called by %s", evidence.Function)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	}
+
+	if metadata.Syscalls != nil {
+		fmt.Fprintln(w, "\n-SYSCALLS-")
+		for _, usage := range metadata.Syscalls.Syscalls {
+			number := ""
+			if usage.Number != nil {
+				number = fmt.Sprint(*usage.Number)
+			}
+			fmt.Fprintf(w, "%-5s %-24s %s\n", number, usage.Name, strings.Join(usage.Callers, ", "))
+		}
+		if metadata.Syscalls.Unresolved > 0 {
+			fmt.Fprintf(w, "%d calls with a number that isn't constant\n", metadata.Syscalls.Unresolved)
+		}
+	}
+
+	if len(metadata.Routes) > 0 {
+		fmt.Fprintln(w, "\n-HTTP ROUTES-")
+		for _, route := range metadata.Routes {
+			fmt.Fprintf(w, "%-8s %-40s %-40s %s\n", route.Method, route.Path, route.Handler, route.Framework)
+		}
+	}
+
+	if len(metadata.Channels) > 0 {
+		fmt.Fprintln(w, "\n-CHANNELS-")
+		for _, use := range metadata.Channels {
+			fmt.Fprintf(w, "%s: %d sends, %d receives, %d selects, %d closes\n", use.Function, use.Sends, use.Receives, use.Selects, use.Closes)
+			for _, element := range use.Makes {
+				fmt.Fprintf(w, "    make chan %s\n", element)
+			}
+		}
+	}
+
+	if metadata.Devirtualized != nil {
+		fmt.Fprintln(w, "\n-DEVIRTUALIZED CALLS-")
+		for _, method := range metadata.Devirtualized.Methods {
+			fmt.Fprintf(w, "%s.%s -> %s\n", method.Interface, method.Method, strings.Join(method.Targets, ", "))
+		}
+		for _, site := range metadata.Devirtualized.CallSites {
+			if len(site.Targets) > 0 {
+				fmt.Fprintf(w, "0x%x %s: %s.%s -> %s\n", site.Address, site.Function, site.Interface, site.Method, strings.Join(site.Targets, ", "))
+			} else {
+				fmt.Fprintf(w, "0x%x %s: slot %d, %d candidates\n", site.Address, site.Function, site.Slot, site.Candidates)
+			}
+		}
+	}
+
+	if len(metadata.Regexes) > 0 {
+		fmt.Fprintln(w, "\n-REGEXES-")
+		for _, regex := range metadata.Regexes {
+			fmt.Fprintf(w, "%-14s %-50s %s\n", regex.Category, regex.Function, regex.Pattern)
+		}
+	}
+
+	if len(metadata.Environment) > 0 {
+		fmt.Fprintln(w, "\n-ENVIRONMENT-")
+		for _, variable := range metadata.Environment {
+			fmt.Fprintf(w, "%-32s", variable.Name)
+			if len(variable.Readers) > 0 {
+				fmt.Fprintf(w, " read by %s", strings.Join(variable.Readers, ", "))
+			}
+			if len(variable.Writers) > 0 {
+				fmt.Fprintf(w, " set by %s", strings.Join(variable.Writers, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if len(metadata.RuntimeTuning) > 0 {
+		fmt.Fprintln(w, "\n-RUNTIME TUNING-")
+		for _, setting := range metadata.RuntimeTuning {
+			value := setting.Value
+			if value == "" {
+				value = "<NOT CONSTANT>"
+			}
+			fmt.Fprintf(w, "%-24s %-16s %s", setting.Setting, value, setting.Source)
+			if len(setting.Callers) > 0 {
+				fmt.Fprintf(w, " in %s", strings.Join(setting.Callers, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if len(metadata.InjectedStrings) > 0 {
+		fmt.Fprintln(w, "\n-INJECTED STRINGS-")
+		for _, injected := range metadata.InjectedStrings {
+			fmt.Fprintf(w, "%-40s %-8s %q\n", injected.Variable, injected.Kind, injected.Value)
+		}
+	}
+
+	if len(metadata.Flags) > 0 {
+		fmt.Fprintln(w, "\n-FLAGS-")
+		for _, cliFlag := range metadata.Flags {
+			name := "--" + cliFlag.Name
+			if cliFlag.Library == "flag" {
+				name = "-" + cliFlag.Name
+			}
+			if cliFlag.Shorthand != "" {
+				name = "-" + cliFlag.Shorthand + ", " + name
+			}
+			fmt.Fprintf(w, "%-40s %-14s %s", name, cliFlag.Type, cliFlag.Usage)
+			if cliFlag.Default != "" {
+				fmt.Fprintf(w, " (default %q)", cliFlag.Default)
+			}
+			fmt.Fprintf(w, " [%s]\n", cliFlag.Function)
+		}
+	}
+
+	if metadata.Telemetry != nil {
+		fmt.Fprintf(w, "\n-TELEMETRY-\n%s\n", strings.Join(metadata.Telemetry.Frameworks, ", "))
+		for _, name := range append(metadata.Telemetry.Metrics, metadata.Telemetry.Spans...) {
+			fmt.Fprintf(w, "%-10s %-50s %s [%s]\n", name.Kind, name.Name, name.Help, name.Function)
+		}
+	}
+
+	if len(metadata.Protobuf) > 0 {
+		fmt.Fprintln(w, "\n-PROTOBUF-")
+		for _, descriptor := range metadata.Protobuf {
+			fmt.Fprintf(w, "0x%x %-60s %-40s %d messages, %d enums\n", descriptor.Address, descriptor.Name, descriptor.Package, len(descriptor.Messages), len(descriptor.Enums))
+			for _, service := range descriptor.Services {
+				fmt.Fprintf(w, "    service %s\n", service.Name)
+				for _, method := range service.Methods {
+					input, output := method.Input, method.Output
+					if method.ClientStreaming {
+						input = "stream " + input
+					}
+					if method.ServerStreaming {
+						output = "stream " + output
+					}
+					fmt.Fprintf(w, "        rpc %s(%s) returns (%s)\n", method.Name, input, output)
+				}
+			}
+		}
+	}
+
+	if len(metadata.C2Frameworks) > 0 {
+		fmt.Fprintln(w, "\n-C2 FRAMEWORKS-")
+		for _, framework := range metadata.C2Frameworks {
+			fmt.Fprintf(w, "%-14s %s", framework.Family, strings.Join(framework.Evidence, ", "))
+			if len(framework.Versions) > 0 {
+				fmt.Fprintf(w, " (%s)", strings.Join(framework.Versions, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if metadata.Scripting != nil {
+		fmt.Fprintln(w, "\n-SCRIPTING-")
+		for _, engine := range metadata.Scripting.Engines {
+			fmt.Fprintf(w, "%-12s %-12s %s\n", engine.Name, engine.Language, strings.Join(engine.Evidence, ", "))
+		}
+		for _, script := range metadata.Scripting.Scripts {
+			fmt.Fprintf(w, "0x%x %s script, %d bytes, %s\n", script.Address, script.Language, script.Size, script.SHA256)
+		}
+	}
+
+	if metadata.SQL != nil {
+		fmt.Fprintln(w, "\n-SQL-")
+		for _, group := range metadata.SQL.Queries {
+			function := group.Function
+			if function == "" {
+				function = "(no reference)"
+			}
+			fmt.Fprintln(w, function)
+			for _, statement := range group.Statements {
+				fmt.Fprintf(w, "    0x%x %s\n", statement.Address, strings.Join(strings.Fields(statement.Query), " "))
+			}
+		}
+		for _, table := range metadata.SQL.Schema {
+			var columns []string
+			for _, column := range table.Columns {
+				columns = append(columns, strings.TrimSpace(column.Name+" "+column.Type))
+			}
+			fmt.Fprintf(w, "table %s (%s)\n", table.Name, strings.Join(columns, ", "))
+		}
+	}
+
+	if len(metadata.KeyMaterial) > 0 {
+		fmt.Fprintln(w, "\n-KEY MATERIAL-")
+		for _, key := range metadata.KeyMaterial {
+			fmt.Fprintf(w, "0x%x %s %s %s %s\n", key.Address, key.Encoding, key.Kind, key.KeyType, key.Fingerprint)
+			if key.Subject != "" {
+				fmt.Fprintf(w, "    Subject: %s\n    Issuer: %s\n", key.Subject, key.Issuer)
+				fmt.Fprintf(w, "    Valid: %s to %s\n", key.NotBefore.Format(time.RFC3339), key.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+
+	if len(metadata.Licenses) > 0 {
+		fmt.Fprintln(w, "\n-LICENSES-")
+		for _, license := range metadata.Licenses {
+			fmt.Fprintf(w, "0x%x %-14s %s\n", license.Address, license.License, license.Copyright)
+			for _, module := range license.Modules {
+				fmt.Fprintf(w, "    %s\n", module)
+			}
+		}
+	}
+
+	if metadata.RootCAs != nil {
+		fmt.Fprintln(w, "\n-ROOT CAS-")
+		for _, bundle := range metadata.RootCAs.Bundles {
+			fmt.Fprintf(w, "%-20s %s\n", "Bundle", bundle)
+		}
+		for _, builder := range metadata.RootCAs.PoolBuilders {
+			fmt.Fprintf(w, "%-20s %s\n", "PoolBuilder", builder)
+		}
+		fmt.Fprintf(w, "%-20s %d (%d public)\n", "Certificates", metadata.RootCAs.Certificates, metadata.RootCAs.PublicRoots)
+		for _, custom := range metadata.RootCAs.Custom {
+			fmt.Fprintf(w, "%-20s 0x%x %s %s\n", "Custom", custom.Address, custom.Fingerprint, custom.Subject)
+		}
+	}
+	if metadata.TimeZoneData != nil {
+		fmt.Fprintf(w, "\n%-20s %s %d zones\n", "TimeZoneData", metadata.TimeZoneData.Package, metadata.TimeZoneData.Zones)
+	}
+
+	if metadata.Cryptojacking != nil {
+		fmt.Fprintln(w, "\n-CRYPTOJACKING-")
+		for _, wallet := range metadata.Cryptojacking.Wallets {
+			fmt.Fprintf(w, "0x%x %-4s %-10s %s\n", wallet.Address, wallet.Currency, wallet.Format, wallet.Value)
+		}
+		for _, pool := range metadata.Cryptojacking.Pools {
+			fmt.Fprintf(w, "0x%x pool %s\n", pool.Address, pool.Value)
+		}
+		for _, miner := range metadata.Cryptojacking.Miners {
+			fmt.Fprintf(w, "miner %s %s (%s)\n", miner.Name, miner.Version, miner.Evidence)
+		}
+	}
+
+	if len(metadata.CryptoConstants) > 0 {
+		fmt.Fprintln(w, "\n-CRYPTO CONSTANTS-")
+		for _, constant := range metadata.CryptoConstants {
+			fmt.Fprintf(w, "0x%x %-24s %s\n", constant.Address, constant.Name, strings.Join(constant.Functions, ", "))
+		}
+	}
+
+	if len(metadata.Configs) > 0 {
+		fmt.Fprintln(w, "\n-CONFIGS-")
+		for _, config := range metadata.Configs {
+			fmt.Fprintln(w, config.Family)
+			for _, value := range config.Values {
+				fmt.Fprintf(w, "    %-20s %s\n", value.Key, value.Value)
+			}
+		}
+	}
+
+	if len(metadata.IOCs) > 0 {
+		fmt.Fprintln(w, "\n-IOCS-")
+		for _, ioc := range metadata.IOCs {
+			fmt.Fprintf(w, "%-8s %s\n", ioc.Type, ioc.Value)
+		}
+	}
+
+	if metadata.GoRelease != nil {
+		fmt.Fprintln(w, "\n-GO RELEASE-")
+		fmt.Fprintf(w, "%-20s %s\n", "Release", metadata.GoRelease.Release)
+		fmt.Fprintf(w, "%-20s %s\n", "Status", metadata.GoRelease.Status)
+		if metadata.GoRelease.EndOfLife != "" {
+			fmt.Fprintf(w, "%-20s %s\n", "EndOfLife", metadata.GoRelease.EndOfLife)
+		}
+		for _, vuln := range metadata.GoRelease.Vulnerabilities {
+			fmt.Fprintf(w, "%-16s %-20s fixed in %-8s %s\n", vuln.CVE, vuln.Package, vuln.Fixed, vuln.Summary)
+		}
+	}
+
+	if len(metadata.Vulnerabilities) > 0 {
+		fmt.Fprintln(w, "\n-VULNERABILITIES-")
+		for _, vuln := range metadata.Vulnerabilities {
+			fmt.Fprintf(w, "%s %s@%s %s\n", vuln.ID, vuln.Module, vuln.Version, strings.Join(vuln.Aliases, ", "))
+			if vuln.Fixed != "" {
+				fmt.Fprintf(w, "    fixed in %s\n", vuln.Fixed)
+			}
+			if len(vuln.LinkedSymbols) > 0 {
+				fmt.Fprintf(w, "    linked: %s\n", strings.Join(vuln.LinkedSymbols, ", "))
+			}
+		}
+	}
+
+	if len(metadata.YaraMatches) > 0 {
+		fmt.Fprintln(w, "\n-YARA-")
+		for _, match := range metadata.YaraMatches {
+			fmt.Fprint(w, match.Rule)
+			if len(match.Tags) > 0 {
+				fmt.Fprintf(w, " : %s", strings.Join(match.Tags, " "))
+			}
+			fmt.Fprintln(w)
+			for _, str := range match.Strings {
+				fmt.Fprintf(w, "    %s x%d at %#x\n", str.Identifier, str.Count, str.Offsets[0])
+			}
+		}
+	}
+	if len(metadata.YaraSkipped) > 0 {
+		fmt.Fprintf(w, "\n%d YARA rules skipped, unsupported:\n", len(metadata.YaraSkipped))
+		for _, rule := range metadata.YaraSkipped {
+			fmt.Fprintf(w, "    %s (%s): %s\n", rule.Rule, rule.File, rule.Reason)
+		}
+	}
+
+	if len(metadata.Blocklisted) > 0 {
+		fmt.Fprintln(w, "\n-BLOCKLIST-")
+		for _, match := range metadata.Blocklisted {
+			fmt.Fprintf(w, "%-18s %s (%s %s)", match.Category, match.Matched, match.Source, match.Prefix)
+			if match.Description != "" {
+				fmt.Fprintf(w, " %s", match.Description)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if len(metadata.Typosquats) > 0 {
+		fmt.Fprintln(w, "\n-TYPOSQUATS-")
+		for _, match := range metadata.Typosquats {
+			fmt.Fprintf(w, "%-10s %s resembles %s (%s)", match.Kind, match.Matched, match.Popular, match.Source)
+			if match.Distance > 0 {
+				fmt.Fprintf(w, " %d edits", match.Distance)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if metadata.Obfuscation != nil {
+		fmt.Fprintln(w, "\n-OBFUSCATION-")
+		if metadata.Obfuscation.Obfuscator != "" {
+			fmt.Fprintf(w, "%-20s %s\n", "Obfuscator", metadata.Obfuscation.Obfuscator)
+		}
+		fmt.Fprintf(w, "%-20s %.2f\n", "Confidence", metadata.Obfuscation.Confidence)
+		for _, indicator := range metadata.Obfuscation.Indicators {
+			fmt.Fprintf(w, "%-20s %s\n", "Indicator", indicator)
+		}
+	}
+
+	if metadata.Packing != nil {
+		fmt.Fprintln(w, "\n-PACKING-")
+		fmt.Fprintf(w, "%-20s %t\n", "Packed", metadata.Packing.Packed)
+		if len(metadata.Packing.Protectors) > 0 {
+			fmt.Fprintf(w, "%-20s %s\n", "Protectors", strings.Join(metadata.Packing.Protectors, ", "))
+		}
+		for _, indicator := range metadata.Packing.Indicators {
+			fmt.Fprintf(w, "%-20s %s\n", "Indicator", indicator)
+		}
+	}
+
+	fmt.Fprintln(w, "\n-TYPE STRUCTURES-")
+	printedStruct := false
+	for _, typ := range metadata.Types {
+		if len(typ.Reconstructed) > 0 {
+			fmt.Fprintf(w, "VA: 0x%x\n", typ.VA)
+			fmt.Fprintf(w, "%s\n\n", typ.Reconstructed)
+			printedStruct = true
+		}
+	}
+	if !printedStruct {
+		fmt.Fprintln(w, "<NO TYPE STRUCTURES EXTRACTED>")
+	}
+
+	fmt.Fprintln(w, "\n-INTERFACES-")
+	printedInterface := false
+	for _, typ := range metadata.Interfaces {
+		if len(typ.Reconstructed) > 0 {
+			fmt.Fprintf(w, "%-20s 0x%x\n", "VA:", typ.VA)
+			fmt.Fprintf(w, "%s\n\n", typ.Reconstructed)
+			printedInterface = true
+		}
+	}
+	if !printedInterface {
+		fmt.Fprintln(w, "<NO INTERFACES EXTRACTED>")
+	}
+
+	fmt.Fprintln(w, "\n-Files-")
+	if len(metadata.Files) > 0 {
+		for _, file := range metadata.Files {
+			fmt.Fprintln(w, file)
+		}
+	} else {
+		fmt.Fprintln(w, "<NO FILES EXTRACTED>")
+	}
+
+	if metadata.SourceTree != nil {
+		fmt.Fprintln(w, "\n-Source Tree-")
+		if len(metadata.SourceTree.Users) > 0 {
+			fmt.Fprintf(w, "Users: %s\n", strings.Join(metadata.SourceTree.Users, ", "))
+		}
+		var printNodes func(nodes []SourceNode, depth int)
+		printNodes = func(nodes []SourceNode, depth int) {
+			for _, node := range nodes {
+				fmt.Fprintf(w, "%s%s (%d)\n", strings.Repeat("  ", depth), node.Name, node.Functions)
+				printNodes(node.Children, depth+1)
+			}
+		}
+		printNodes(metadata.SourceTree.Root, 0)
+	}
+
+	fmt.Fprintln(w, "\n-User Functions-")
+	if len(metadata.UserFunctions) > 0 {
+		for i, fn := range metadata.UserFunctions {
+			fnPrefix := fmt.Sprintf("UserFunc%d.", i)
+			fmt.Fprintf(w, "%-20s 0x%x\n", fnPrefix+"StartVA:", fn.Start)
+			fmt.Fprintf(w, "%-20s 0x%x\n", fnPrefix+"EndVA:", fn.End)
+			fmt.Fprintf(w, "%-20s %s\n", fnPrefix+"Package:", fn.PackageName)
+			fmt.Fprintf(w, "%-20s %s\n", fnPrefix+"Name:", strings.TrimLeft(strings.TrimLeft(fn.FullName, fn.PackageName), "."))
+			if fn.Origin != "" {
+				fmt.Fprintf(w, "%-20s %s\n", fnPrefix+"Origin:", fn.Origin)
+			}
+		}
+	} else {
+		fmt.Fprintln(w, "<NO USER FUNCTIONS EXTRACTED>")
+	}
+
+	fmt.Fprintln(w, "\n-Standard Functions-")
+	if len(metadata.StdFunctions) > 0 {
+		for i, fn := range metadata.StdFunctions {
+			fnPrefix := fmt.Sprintf("StdFunc%d.", i)
+			fmt.Fprintf(w, "%-20s 0x%x\n", fnPrefix+"StartVA:", fn.Start)
+			fmt.Fprintf(w, "%-20s 0x%x\n", fnPrefix+"EndVA:", fn.End)
+			fmt.Fprintf(w, "%-20s %s\n", fnPrefix+"Name:", fn.FullName)
+		}
+	} else {
+		fmt.Fprintln(w, "<NO STANDARD FUNCTIONS EXTRACTED>")
+	}
+}
+
+func DataToJson(data interface{}) string {
+	jsonBytes, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return "{\"error\": \"failed to format output\"}"
+	}
+	return string(jsonBytes)
+}
+
+// DataToJsonLine formats data on a single line, for outputs holding one JSON document per line
+func DataToJsonLine(data interface{}) string {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return "{\"error\": \"failed to format output\"}"
+	}
+	return string(jsonBytes)
+}
+
+func TextToJson(key string, text string) string {
+	return fmt.Sprintf("{\"%s\": \"%s\"}", key, text)
+}
+
+var Version = "dev-local-build"
+
+func main() {
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(diffMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		os.Exit(inspectMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		os.Exit(indexMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(verifyMain(os.Args[2:]))
+	}
+
+	about := flag.Bool("about", false, "Print license and author information")
+	printVersion := flag.Bool("version", false, "Print the GoReSym version, commit and the Go releases it supports")
+	printStdPkgs := flag.Bool("d", false, "Print Default Packages")
+	printFilePaths := flag.Bool("p", false, "Print File Paths")
+	printTypes := flag.Bool("t", false, "Print types automatically, enumerate typelinks and itablinks")
+	printStrings := flag.Bool("strings", false, "Print strings with the functions referencing them, Go strings are split at their exact boundaries where possible")
+	noPrintFunctions := flag.Bool("nofuncs", false, "Do not print user and standard function sections")
+	typeAddress := flag.Int("m", 0, "Manually parse the RTYPE at the provided virtual address, disables automated enumeration of moduledata typelinks itablinks")
+	versionOverride := flag.String("v", "", "Override the automated version detection, ex: 1.17. If this is wrong, parsing may fail or produce nonsense")
+	normalize := flag.String("normalize", "", "Normalize recovered names in all output, comma separated: typeparams strips type parameters, escapes decodes the · and %2e escapes, closures shortens anonymous function suffixes, ex: main.main$1, cpp formats names like C++ ones, ex: main::T::Method, or all")
+	hintsFile := flag.String("hints", "", "File of known names, one 'address name' or '/regex/ name' per line, that replace recovered names in all output")
+	filterPackage := flag.String("filter-package", "", "Exclude functions, types and strings of packages matching this regex, ex: ^(runtime|internal/.*)$")
+	filterOrigin := flag.String("origin", "", "Only keep the functions, types and strings of these comma separated origins: user, dependency, stdlib")
+	outputPath := flag.String("o", "", "Write the results to this file instead of stdout. It's replaced atomically once the run completes")
+	summary := flag.Bool("summary", false, "Only print counts and key metadata in one compact block, for bulk triage. Implies -d")
+	fields := flag.String("fields", "", "Only print these comma separated JSON fields, ex: strings.value,strings.address,functions.name")
+	browse := flag.Bool("tui", false, "Browse the results interactively: functions, the strings they reference and their xrefs. Implies -strings")
+	shell := flag.Bool("repl", false, "Load the file once and answer queries typed or piped on stdin, such as funcs matching crypto. Implies -d, -t and -strings")
+	sbomFormat := flag.String("sbom", "", "Print a software bill of materials of the binary instead of the results: cyclonedx or spdx, as JSON")
+	humanView := flag.Bool("human", false, "Human view, print information flat rather than json, some information is omitted for clarity")
+	verbose := flag.Bool("verbose", false, "Log analysis steps to stderr, same as -log-level info")
+	veryVerbose := flag.Bool("vv", false, "Log analysis steps and debugging details to stderr, same as -log-level debug")
+	logLevelName := flag.String("log-level", "", "Minimum level to log: debug, info, warn or error. Overrides -verbose and -vv")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	logFile := flag.String("log-file", "", "Append logs to this file instead of stderr")
+	workers := flag.Int("workers", runtime.NumCPU(), "Number of files analyzed concurrently when given several files or a directory")
+	maxMemoryMB := flag.Uint64("max-memory", 0, "Memory budget of the process in MB. Once crossed, type parsing and string extraction stop with what they recovered and the result is marked partial. 0 means no limit")
+	workerMemory := flag.Uint64("worker-memory", 0, "Memory budget per worker in MB when analyzing several files, larger files are skipped. 0 means no limit")
+	shardDir := flag.String("shard-dir", "", "Write the results of several files to numbered JSON lines files in this directory instead of stdout")
+	shardSize := flag.Int("shard-size", 10000, "Results per file with -shard-dir")
+	funcHash := flag.Bool("funchash", false, "Hash each function's instructions, ignoring registers and addresses, to match functions across samples")
+	flag.BoolVar(&devirtualizeCalls, "devirtualize", false, "Resolve interface method calls to the concrete methods they can reach, from the itabs")
+	detect := flag.String("detect", "", "Run these detections, comma separated, or all. None runs by default: "+strings.Join(detectorNames(), ", "))
+	extractConfig := flag.String("extract-config", "", "Extract the configuration of these malware families, comma separated, or all. Implies -strings")
+	iocs := flag.Bool("iocs", false, "Report the URLs, domains, IPs, onion and email addresses found in the strings. Implies -strings")
+	defang := flag.Bool("defang", false, "Defang the reported IOCs, ex: hxxp[://]example[.]com, to share reports safely")
+	osvPath := flag.String("osv", "", "OSV snapshot, the zip of the Go export or a directory of OSV JSON files, to report the known vulnerabilities of the dependencies and Go release")
+	yaraRules := flag.String("yara-rules", "", "YARA rules file, or directory of .yar and .yara files, to run against the input and report the matching rules")
+	blocklistFile := flag.String("blocklist", "", "File of module or package prefixes to flag, one 'prefix category [description]' per line, added to the bundled list")
+	typosquatFile := flag.String("typosquat-list", "", "File of module paths, one per line, added to the bundled popular modules the dependencies are checked for typosquats against")
+	reportStats := flag.Bool("stats", false, "Report the wall time, bytes processed and item counts of each analysis phase")
+	progress := flag.Bool("progress", false, "Show a progress indicator for each analysis phase on stderr")
+	timeout := flag.Duration("timeout", 0, "Stop analysis after this long, ex: 30s. Whatever was recovered until then is printed and marked partial")
+	cacheDir := flag.String("cache", "", "Directory to cache results in, keyed by the SHA-256 of the input and the flags used")
+	pipelineFile := flag.String("pipeline", "", "YAML file of the analyzers to run, their order and options. Flags given on the command line take precedence")
+	noCache := flag.Bool("no-cache", false, "Ignore cached results and analyze again, the fresh result still replaces the cached one")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile of the run to this file, for go tool pprof")
+	memProfile := flag.String("memprofile", "", "Write a heap profile to this file once the run completes, for go tool pprof")
+	tracePath := flag.String("trace", "", "Write an execution trace of the run to this file, for go tool trace")
+	only := flag.String("only", "", "Only compute these comma separated artifacts and what they depend on, skipping every other analysis: "+strings.Join(artifactNames(), ", "))
+	triage := flag.Bool("triage", false, "Only tell whether the file is Go and which version, stopping once the build info and a valid pclntab header are found, for bulk pre-filtering")
+	flag.Parse()
+
+	if *pipelineFile != "" {
+		pipeline, err := loadPipeline(*pipelineFile)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -pipeline: %s", err)))
+			os.Exit(exitError)
+		}
+
+		explicit := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if err := pipeline.apply(flag.Set, explicit); err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -pipeline: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	level := slog.LevelWarn
+	if *veryVerbose {
+		level = slog.LevelDebug
+	} else if *verbose {
+		level = slog.LevelInfo
+	}
+
+	if *logLevelName != "" {
+		var err error
+		level, err = parseLogLevel(*logLevelName)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -log-level: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	var logOutput io.Writer = os.Stderr
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to open log file: %s", err)))
+			os.Exit(exitError)
+		}
+		defer f.Close()
+		logOutput = f
+	}
+
+	if err := configureLogging(level, *logFormat, logOutput); err != nil {
+		fmt.Println(TextToJson("error", err.Error()))
+		os.Exit(exitError)
+	}
+	showProgress = *progress
+
+	if *printVersion {
+		info := currentToolInfo()
+		fmt.Printf("GoReSym %s\n", info.Version)
+		if info.Commit != "" {
+			modified := ""
+			if info.Modified {
+				modified = " (modified)"
+			}
+			fmt.Printf("%-20s %s%s\n", "Commit:", info.Commit, modified)
+		}
+		fmt.Printf("%-20s %s\n", "Built with:", info.BuiltWith)
+		fmt.Printf("%-20s %s\n", "Go releases:", info.SupportedGoVersions)
+		fmt.Printf("%-20s %s\n", "Types:", info.TypesGoVersions)
+		fmt.Printf("%-20s %s\n", "Pclntab layouts:", strings.Join(info.PclntabLayouts, ", "))
+		os.Exit(exitOK)
+	}
+
+	if *about {
+		fmt.Printf("Version: %s\n", Version)
+		fmt.Println("GoReSym is a Golang symbol recovery tool by Google's Mandiant FLARE team. Maintained by Stephen Eckels.")
+		fmt.Println("LICENSE MIT: https://github.com/mandiant/GoReSym/blob/master/LICENSE")
+		fmt.Println("Dependencies:")
+		fmt.Println("orderedmap by elliotchance: https://github.com/elliotchance/orderedmap/blob/master/LICENSE")
+		fmt.Println("binaryregexp by rsc (The Go Authors): https://github.com/rsc/binaryregexp/blob/master/LICENSE")
+		fmt.Println("yaml.v3 by the go-yaml authors: https://github.com/go-yaml/yaml/blob/v3/LICENSE")
+		fmt.Println("x/sys (The Go Authors): https://github.com/golang/sys/blob/master/LICENSE")
+		fmt.Println("x/term (The Go Authors): https://github.com/golang/term/blob/master/LICENSE")
+		fmt.Println("sqlite by the modernc.org authors: https://gitlab.com/cznic/sqlite/-/blob/master/LICENSE")
+		fmt.Println("Go source code (The Go Authors): https://github.com/golang/go/blob/master/LICENSE")
+		os.Exit(exitOK)
+	}
+
+	var selectedExtractors []configExtractor
+	if *extractConfig != "" {
+		var err error
+		selectedExtractors, err = parseConfigFamilies(*extractConfig)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -extract-config: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	if *browse || *iocs || *extractConfig != "" {
+		*printStrings = true
+	}
+
+	// queries cover every function, type and string
+	if *shell {
+		*printStdPkgs = true
+		*printTypes = true
+		*printStrings = true
+	}
+
+	// the summary counts the standard functions too, and shows the tags of the capabilities and the signature status
+	if *summary {
+		*printStdPkgs = true
+		*detect = strings.TrimPrefix(*detect+",capabilities,signature", ",")
+	}
+
+	// the bill of materials depends on the modules, native libraries and licenses found
+	if *sbomFormat != "" {
+		*detect = strings.TrimPrefix(*detect+",modules,native-libraries,licenses", ",")
+	}
+	// lists of their own are given to be checked against
+	if *blocklistFile != "" {
+		*detect = strings.TrimPrefix(*detect+",blocklist", ",")
+	}
+	if *typosquatFile != "" {
+		*detect = strings.TrimPrefix(*detect+",typosquats", ",")
+	}
+
+	if *triage {
+		if *only != "" || *browse || *iocs || *extractConfig != "" || *shell {
+			fmt.Println(TextToJson("error", "-triage can't be combined with -only, -tui, -iocs, -extract-config or -repl"))
+			os.Exit(exitError)
+		}
+		// the functions aren't parsed, only the header of the pclntab is read
+		*only = "pclntab"
+		fastTriage = true
+	}
+
+	if *only != "" {
+		names := *only
+		// the strings and types other flags need are computed as well
+		if *browse || *iocs || *extractConfig != "" || *shell {
+			names += ",strings"
+		}
+		if *shell {
+			names += ",types,functions"
+		}
+		var err error
+		onlyArtifacts, err = parseArtifacts(names)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -only: %s", err)))
+			os.Exit(exitError)
+		}
+		*noPrintFunctions = !onlyArtifacts.wants("functions")
+		*printFilePaths = onlyArtifacts.wants("files")
+		*printTypes = onlyArtifacts.wants("types")
+		*printStrings = onlyArtifacts.wants("strings")
+		if !*printTypes {
+			*typeAddress = 0
+		}
+	}
+
+	if *detect != "" {
+		var err error
+		enabledDetectors, err = parseDetectors(*detect, enabledDetectors)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -detect: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	var excludePackages *regexp.Regexp
+	if *filterPackage != "" {
+		var err error
+		excludePackages, err = regexp.Compile(*filterPackage)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -filter-package regex: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	var keepOrigins map[string]bool
+	if *filterOrigin != "" {
+		var err error
+		keepOrigins, err = parseOrigins(*filterOrigin)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -origin: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	var hints *symbolHints
+	if *hintsFile != "" {
+		var err error
+		hints, err = loadHints(*hintsFile)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -hints file: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	var normalizer *nameNormalizer
+	if *normalize != "" {
+		var err error
+		normalizer, err = parseNormalizer(*normalize)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -normalize: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	var osvDB osvDatabase
+	if *osvPath != "" {
+		var err error
+		osvDB, err = loadOSV(*osvPath)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -osv snapshot: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	var rules []*yaraRule
+	var skippedRules []YaraSkippedRule
+	if *yaraRules != "" {
+		var err error
+		rules, skippedRules, err = loadYaraRules(*yaraRules)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -yara-rules: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	blocklist, err := loadBlocklist(*blocklistFile)
+	if err != nil {
+		fmt.Println(TextToJson("error", fmt.Sprintf("invalid -blocklist file: %s", err)))
+		os.Exit(exitError)
+	}
+
+	popularModules, err := loadPopularModules(*typosquatFile)
+	if err != nil {
+		fmt.Println(TextToJson("error", fmt.Sprintf("invalid -typosquat-list file: %s", err)))
+		os.Exit(exitError)
+	}
+
+	goReleases, err := loadGoReleases()
+	if err != nil {
+		fmt.Println(TextToJson("error", fmt.Sprintf("invalid bundled Go release list: %s", err)))
+		os.Exit(exitError)
+	}
+
+	var selectedFields fieldTree
+	if *fields != "" {
+		var err error
+		selectedFields, err = parseFields(*fields)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -fields: %s", err)))
+			os.Exit(exitError)
+		}
+	}
+
+	if *sbomFormat != "" {
+		if !slices.Contains(sbomFormats, *sbomFormat) {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -sbom %s, expected one of %s", *sbomFormat, strings.Join(sbomFormats, ", "))))
+			os.Exit(exitError)
+		}
+		if *summary || *humanView || *browse || *shell || *fields != "" || *shardDir != "" {
+			fmt.Println(TextToJson("error", "-sbom can't be combined with -summary, -human, -tui, -repl, -fields or -shard-dir"))
+			os.Exit(exitError)
+		}
+	}
+
+	if flag.NArg() < 1 {
+		fmt.Println(TextToJson("error", "filepath must be provided as first argument"))
+		os.Exit(exitError)
+	}
+
+	// several files, or a directory, are analyzed in batch mode
+	files := flag.Args()
+	batch := len(files) > 1
+	if info, err := os.Stat(files[0]); err == nil && info.IsDir() {
+		batch = true
+	}
+
+	if batch {
+		var err error
+		files, err = collectBatchFiles(flag.Args())
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to list files: %s", err)))
+			os.Exit(exitError)
+		}
+
+		if *browse || *shell {
+			fmt.Println(TextToJson("error", "-tui and -repl explore a single file"))
+			os.Exit(exitError)
+		}
+
+		// the phase indicators of concurrent workers would garble each other, report per file instead
+		if *workers > 1 {
+			showProgress = false
+		}
+
+		if *workerMemory > 0 {
+			// make the collector work harder before the combined budget of all workers is exceeded, and have the
+			// phases give up past it unless -max-memory sets a budget of its own
+			rtdebug.SetMemoryLimit(int64(*workerMemory<<20) * int64(*workers))
+			if *maxMemoryMB == 0 {
+				maxMemory = (*workerMemory << 20) * uint64(*workers)
+			}
+		}
+	}
+
+	if *shardDir != "" && (!batch || *outputPath != "" || *summary || *humanView) {
+		fmt.Println(TextToJson("error", "-shard-dir splits the JSON results of several files and can't be combined with -o, -summary or -human"))
+		os.Exit(exitError)
+	}
+
+	if *maxMemoryMB > 0 {
+		maxMemory = *maxMemoryMB << 20
+		// the collector works harder as the budget nears, before the phases have to give up
+		if rtdebug.SetMemoryLimit(-1) > int64(maxMemory) {
+			rtdebug.SetMemoryLimit(int64(maxMemory))
+		}
+	}
+
+	parseCacheDir, parseCacheRefresh = *cacheDir, *noCache
+
+	analyze := func(fileName string) (ExtractMetadata, error) {
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		var cacheEntry string
+		if *cacheDir != "" {
+			fileHash, err := hashFile(fileName)
+			if err == nil {
+				cacheEntry = cachePath(*cacheDir, fileHash, cacheOptions{*printStdPkgs, *printFilePaths, *printTypes, *printStrings, *noPrintFunctions, *typeAddress, *versionOverride, minStringLength, *funcHash, *only, fastTriage, devirtualizeCalls, enabledDetectors.String()})
+				if !*noCache {
+					cachePhase := beginPhase("loading cached result")
+					metadata, cached := loadCachedResult(cacheEntry)
+					cachePhase.end("")
+					if cached {
+						logger.Info("using cached result", "path", cacheEntry)
+						metadata.Stats = &AnalysisStats{Seconds: cachePhase.elapsed.Seconds()}
+						metadata.Stats.record(cachePhase, 0, 0)
+						return metadata, nil
+					}
+				}
+			} else {
+				logger.Warn("cache disabled, failed to hash input", "error", err)
+			}
+		}
+
+		if batch {
+			if err := checkWorkerMemory(fileName, *workerMemory<<20); err != nil {
+				return ExtractMetadata{}, err
+			}
+		}
+
+		metadata, err := main_impl(ctx, fileName, *printStdPkgs, *printFilePaths, *printTypes, *printStrings, *noPrintFunctions, *typeAddress, *versionOverride)
+		if err != nil {
+			return ExtractMetadata{}, err
+		}
+
+		if *funcHash && !metadata.Partial {
+			hashPhase := beginPhase("hashing functions")
+			if err := hashFunctions(fileName, metadata.UserFunctions); err == nil {
+				err = hashFunctions(fileName, metadata.StdFunctions)
+			}
+			if err != nil {
+				metadata.addError("funchash", "hashing functions", err)
+			}
+			hashPhase.end(fmt.Sprintf("%d functions", len(metadata.UserFunctions)+len(metadata.StdFunctions)))
+			metadata.Stats.record(hashPhase, len(metadata.UserFunctions)+len(metadata.StdFunctions), 0)
+			metadata.Stats.Seconds += hashPhase.elapsed.Seconds()
+		}
+
+		if cacheEntry != "" {
+			if err := storeCachedResult(cacheEntry, metadata); err != nil {
+				logger.Warn("failed to write cache entry", "error", err)
+			}
+		}
+		return metadata, nil
+	}
+
+	var out io.Writer = os.Stdout
+	var outputFile *atomicFile
+	if *outputPath != "" {
+		if *browse || *shell {
+			fmt.Println(TextToJson("error", "-tui and -repl can't be combined with -o"))
+			os.Exit(exitError)
+		}
+
+		var err error
+		outputFile, err = createAtomicFile(*outputPath)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to create output file: %s", err)))
+			os.Exit(exitError)
+		}
+		out = outputFile
+
+		// an interrupted run leaves whatever was at the output path before untouched
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			outputFile.Abort()
+			os.Exit(exitError)
+		}()
+	}
+
+	var shards *shardWriter
+	if *shardDir != "" {
+		var err error
+		shards, err = newShardWriter(*shardDir, *shardSize)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("invalid -shard-dir: %s", err)))
+			os.Exit(exitError)
+		}
+		out = shards
+
+		// the complete shards stay, the one being written is dropped
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			shards.Abort()
+			os.Exit(exitError)
+		}()
+	}
+
+	stopProfiling, err := startProfiling(*cpuProfile, *memProfile, *tracePath)
+	if err != nil {
+		fmt.Println(TextToJson("error", fmt.Sprintf("failed to start profiling: %s", err)))
+		os.Exit(exitError)
+	}
+
+	finish := func(code int) {
+		stopProfiling()
+		if outputFile != nil {
+			if err := outputFile.Commit(); err != nil {
+				fmt.Println(TextToJson("error", fmt.Sprintf("failed to write output file: %s", err)))
+				os.Exit(exitError)
+			}
+		}
+		if shards != nil {
+			if err := shards.Close(); err != nil {
+				fmt.Println(TextToJson("error", fmt.Sprintf("failed to write shard: %s", err)))
+				os.Exit(exitError)
+			}
+		}
+		os.Exit(code)
+	}
+
+	var outputLock sync.Mutex
+	completed := 0
+	process := func(fileName string) int {
+		var metadata ExtractMetadata
+		var err error
+		if batch {
+			metadata, err = analyzeRecovering(fileName, analyze)
+		} else {
+			metadata, err = analyze(fileName)
+		}
+
+		// matched before filtering, excluding a package from the output shouldn't hide that it was linked in
+		if err == nil {
+			if enabledDetectors.runs("blocklist") {
+				metadata.Blocklisted = matchBlocklist(metadata, blocklist)
+			}
+			if enabledDetectors.runs("typosquats") {
+				metadata.Typosquats = matchTyposquats(metadata, popularModules)
+			}
+			if enabledDetectors.runs("go-release") {
+				metadata.GoRelease = goReleases.annotate(metadata.Version)
+			}
+		}
+
+		// hints and filters apply after caching, the cached result stays usable with any of them
+		filteredCount := 0
+		for _, postProcessor := range postProcessOrder {
+			if err != nil {
+				break
+			}
+
+			switch postProcessor {
+			case "hints":
+				if hints != nil {
+					applyHints(&metadata, hints)
+				}
+			case "filter-package":
+				if excludePackages != nil {
+					filteredCount = filterPackages(&metadata, excludePackages)
+				}
+			case "filter-origin":
+				if keepOrigins != nil {
+					filterOrigins(&metadata, keepOrigins)
+				}
+			}
+		}
+
+		// after the hints and filters, which match the names as the binary spells them
+		if err == nil && normalizer != nil {
+			normalizeNames(&metadata, normalizer)
+		}
+
+		if err == nil && selectedExtractors != nil {
+			metadata.Configs = extractConfigs(metadata, selectedExtractors)
+		}
+
+		if err == nil && *iocs {
+			metadata.IOCs = extractIOCs(metadata, *defang)
+		}
+
+		if err == nil && osvDB != nil {
+			metadata.Vulnerabilities = osvDB.match(metadata)
+		}
+
+		if err == nil && rules != nil {
+			if mapping, mapErr := objfile.MapFile(fileName); mapErr == nil {
+				metadata.YaraMatches = scanYara(rules, mapping.Data())
+				mapping.Close()
+			}
+			metadata.YaraSkipped = skippedRules
+		}
+
+		if err == nil && !*reportStats {
+			metadata.Stats = nil
+		}
+
+		outputLock.Lock()
+		defer outputLock.Unlock()
+
+		if batch && *progress {
+			completed++
+			fmt.Fprintf(os.Stderr, "GoReSym: [%d/%d] %s\n", completed, len(files), fileName)
+		}
+
+		if err != nil {
+			message := fmt.Sprintf("Failed to parse file: %s", err)
+			if batch && !*summary && !*humanView {
+				fmt.Fprintln(out, DataToJsonLine(batchResult{File: fileName, Error: message}))
+			} else if batch {
+				fmt.Fprintf(out, "%s: %s\n\n", fileName, message)
+			} else {
+				fmt.Fprintln(out, TextToJson("error", message))
+			}
+			return exitCodeForError(err)
+		}
+
+		if *summary {
+			printSummary(out, fileName, metadata, *printTypes || *typeAddress != 0, *printStrings)
+			printStats(out, metadata.Stats)
+			if batch {
+				fmt.Fprintln(out)
+			}
+		} else if *browse {
+			if err := browseResults(metadata); err != nil {
+				fmt.Fprintln(out, TextToJson("error", err.Error()))
+				return exitError
+			}
+		} else if *shell {
+			if err := queryResults(metadata, os.Stdin, out); err != nil {
+				fmt.Fprintln(out, TextToJson("error", err.Error()))
+				return exitError
+			}
+		} else if *sbomFormat != "" {
+			// the file hash identifies the binary the SBOM describes, it's left out if the file can't be read again
+			digest, _ := fileDigest(fileName)
+			document, err := sbomDocument(*sbomFormat, fileName, digest, metadata, time.Now())
+			if err != nil {
+				fmt.Fprintln(out, TextToJson("error", err.Error()))
+				return exitError
+			}
+			if batch {
+				fmt.Fprintln(out, DataToJsonLine(document))
+			} else {
+				fmt.Fprintln(out, DataToJson(document))
+			}
+		} else if *humanView {
+			if batch {
+				fmt.Fprintf(out, "==== %s ====\n", fileName)
+			}
+			printForHuman(out, metadata)
+			printStats(out, metadata.Stats)
+		} else {
+			var result interface{} = metadata
+			if selectedFields != nil {
+				result, err = selectFields(metadata, selectedFields)
+				if err != nil {
+					fmt.Fprintln(out, TextToJson("error", fmt.Sprintf("failed to select fields: %s", err)))
+					return exitError
+				}
+			}
+
+			if batch {
+				if err := writeJSONLine(out, batchResult{File: fileName, Result: result}); err != nil {
+					fmt.Fprintln(out, "\n"+DataToJsonLine(batchResult{File: fileName, Error: "failed to format output"}))
+					return exitError
+				}
+			} else if err := writeJSON(out, result); err != nil {
+				fmt.Fprintln(out, "\n"+TextToJson("error", "failed to format output"))
+				return exitError
+			} else {
+				fmt.Fprintln(out)
+			}
+		}
+
+		return resultExitCode(metadata, filteredCount)
+	}
+
+	if batch {
+		finish(runBatch(files, *workers, process))
+	}
+	finish(process(files[0]))
 }
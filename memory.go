@@ -0,0 +1,70 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"time"
+)
+
+// maxMemory is the -max-memory budget of the process in bytes, 0 means no limit. Crossing it doesn't stop the
+// analysis: the phases whose memory grows with the binary, the types and the strings, stop with what they recovered
+// and the result is marked partial, instead of the process being killed by the OS.
+var maxMemory uint64
+
+var errMemoryBudget = errors.New("stopped at the -max-memory budget")
+
+// how often the memory in use is sampled while a phase runs under the budget
+const memoryCheckInterval = 50 * time.Millisecond
+
+// memoryInUse is the memory the Go runtime holds from the OS, heap and stacks, less what it returned
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{{Name: "/memory/classes/total:bytes"}, {Name: "/memory/classes/heap/released:bytes"}}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// withMemoryBudget derives a context that is cancelled once the memory in use crosses the budget, already cancelled
+// if it's crossed when the phase starts. The returned function stops watching.
+func withMemoryBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	if maxMemory == 0 {
+		return ctx, func() {}
+	}
+
+	budgetCtx, cancel := context.WithCancelCause(ctx)
+	overBudget := func() bool {
+		if used := memoryInUse(); used > maxMemory {
+			cancel(fmt.Errorf("%w of %d MB, %d MB in use", errMemoryBudget, maxMemory>>20, used>>20))
+			return true
+		}
+		return false
+	}
+	if !overBudget() {
+		go func() {
+			ticker := time.NewTicker(memoryCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-budgetCtx.Done():
+					return
+				case <-ticker.C:
+					if overBudget() {
+						return
+					}
+				}
+			}
+		}()
+	}
+	return budgetCtx, func() { cancel(nil) }
+}
+
+// degraded marks the metadata as partial if the budget cut the phase short, the analysis carries on with the next one
+func degraded(budgetCtx context.Context, metadata *ExtractMetadata, analyzer string, stage string) {
+	if cause := context.Cause(budgetCtx); errors.Is(cause, errMemoryBudget) {
+		logger.Warn("analysis degraded", "stage", stage, "reason", cause)
+		metadata.addError(analyzer, stage, cause)
+		metadata.Partial = true
+	}
+}
@@ -0,0 +1,209 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+	"github.com/mandiant/GoReSym/runtime/debug"
+)
+
+// ModuleGraph is the module list of the build info as a graph. The build info only lists the modules linked in, the
+// edges come from the direct calls between the code of each module. Calls the compiler inlined aren't seen.
+type ModuleGraph struct {
+	Main    string
+	Modules []ModuleNode // the main module first, then the dependencies by path
+}
+
+// ModuleNode is a module and the modules its code calls into. A dependency is direct when the main module calls into
+// it, transitive when only other dependencies do, and left empty when no call into it was found.
+type ModuleNode struct {
+	Path       string
+	Version    string        `json:",omitempty"`
+	Sum        string        `json:",omitempty"`
+	Replace    *debug.Module `json:",omitempty"`
+	Dependency string        `json:",omitempty"`
+	Functions  int           // linked in from the module
+	Requires   []string      `json:",omitempty"`
+}
+
+// moduleOf returns the module of a function, the longest module path its package path starts with. Package main
+// belongs to the main module, the first of the graph. Dots in the last element of package paths are escaped as %2e
+// in symbol names.
+func moduleOf(modules map[string]int, function string) (int, bool) {
+	name := decodePercentEscapes(function)
+	if strings.HasPrefix(name, "main.") {
+		return 0, true
+	}
+	index, found := 0, false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '(' || c == '[' {
+			break
+		}
+		if c != '/' && c != '.' {
+			continue
+		}
+		if module, ok := modules[name[:i]]; ok {
+			index, found = module, true
+		}
+	}
+	return index, found
+}
+
+// buildModuleGraph attributes the functions to the modules of the build info, then scans the text once for the calls
+// into the dependencies. Architectures without a call scanner get the modules without their edges.
+func buildModuleGraph(ctx context.Context, file *objfile.File, tab *gosym.Table, info debug.BuildInfo) (*ModuleGraph, error) {
+	if info.Main.Path == "" && len(info.Deps) == 0 {
+		return nil, nil
+	}
+
+	graph := &ModuleGraph{Main: info.Main.Path}
+	graph.Modules = append(graph.Modules, ModuleNode{Path: info.Main.Path, Version: info.Main.Version, Sum: info.Main.Sum})
+	deps := make([]*debug.Module, 0, len(info.Deps))
+	for _, dep := range info.Deps {
+		if dep != nil {
+			deps = append(deps, dep)
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Path < deps[j].Path })
+	for _, dep := range deps {
+		graph.Modules = append(graph.Modules, ModuleNode{Path: dep.Path, Version: dep.Version, Sum: dep.Sum, Replace: dep.Replace})
+	}
+
+	modules := make(map[string]int, len(graph.Modules))
+	for i := len(graph.Modules) - 1; i >= 0; i-- {
+		if graph.Modules[i].Path != "" {
+			modules[graph.Modules[i].Path] = i
+		}
+	}
+
+	// the entries of the dependencies' functions are the targets, calls into the main module are callbacks
+	targets := make(map[uint64]bool)
+	targetModules := make(map[uint64]int)
+	for _, fn := range tab.Funcs {
+		module, ok := moduleOf(modules, fn.Name)
+		if !ok {
+			continue
+		}
+		graph.Modules[module].Functions++
+		if module != 0 {
+			targets[fn.Entry] = true
+			targetModules[fn.Entry] = module
+		}
+	}
+	if len(targets) == 0 {
+		return graph, nil
+	}
+
+	textStart, text, err := file.Text()
+	if err != nil {
+		return graph, err
+	}
+
+	requires := make([]map[int]bool, len(graph.Modules))
+	callerModules := make(map[uint64]int)
+	for _, call := range directCalls(file.GOARCH(), textStart, text, targets) {
+		if ctx.Err() != nil {
+			break
+		}
+		fn := tab.PCToFunc(call.Site)
+		if fn == nil {
+			continue
+		}
+		caller, ok := callerModules[fn.Entry]
+		if !ok {
+			caller = -1
+			if module, found := moduleOf(modules, fn.Name); found {
+				caller = module
+			}
+			callerModules[fn.Entry] = caller
+		}
+		callee := targetModules[call.Target]
+		if caller == -1 || caller == callee {
+			continue
+		}
+		if requires[caller] == nil {
+			requires[caller] = make(map[int]bool)
+		}
+		requires[caller][callee] = true
+	}
+
+	for caller, callees := range requires {
+		for callee := range callees {
+			graph.Modules[caller].Requires = append(graph.Modules[caller].Requires, graph.Modules[callee].Path)
+			switch {
+			case caller == 0:
+				graph.Modules[callee].Dependency = "direct"
+			case graph.Modules[callee].Dependency == "":
+				graph.Modules[callee].Dependency = "transitive"
+			}
+		}
+		sort.Strings(graph.Modules[caller].Requires)
+	}
+	return graph, ctx.Err()
+}
+
+// printModuleTree prints the modules the main module calls into, then the ones they call into, each once. The
+// dependencies no call was found into follow.
+func printModuleTree(w io.Writer, graph *ModuleGraph) {
+	byPath := make(map[string]*ModuleNode, len(graph.Modules))
+	for i := range graph.Modules {
+		byPath[graph.Modules[i].Path] = &graph.Modules[i]
+	}
+	describe := func(module *ModuleNode) string {
+		line := module.Path
+		if module.Version != "" {
+			line += " " + module.Version
+		}
+		if module.Replace != nil {
+			line += " => " + module.Replace.Path
+			if module.Replace.Version != "" {
+				line += " " + module.Replace.Version
+			}
+			if module.Replace.Sum != "" {
+				line += " " + module.Replace.Sum
+			}
+		} else if module.Sum != "" {
+			line += " " + module.Sum
+		}
+		return line
+	}
+
+	fmt.Fprintln(w, "\n  -MODULES-")
+	printed := make(map[string]bool)
+	var printModule func(module *ModuleNode, depth int)
+	printModule = func(module *ModuleNode, depth int) {
+		indent := strings.Repeat("  ", depth+1)
+		if printed[module.Path] {
+			fmt.Fprintf(w, "%s%s (see above)\n", indent, module.Path)
+			return
+		}
+		printed[module.Path] = true
+		fmt.Fprintf(w, "%s%s\n", indent, describe(module))
+		for _, path := range module.Requires {
+			if required, ok := byPath[path]; ok {
+				printModule(required, depth+1)
+			}
+		}
+	}
+	printModule(&graph.Modules[0], 0)
+
+	var uncalled []string
+	for i := range graph.Modules[1:] {
+		if module := &graph.Modules[i+1]; !printed[module.Path] {
+			uncalled = append(uncalled, describe(module))
+		}
+	}
+	if len(uncalled) > 0 {
+		fmt.Fprintln(w, "  <NO CALLS FOUND>")
+		for _, line := range uncalled {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+}
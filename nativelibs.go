@@ -0,0 +1,117 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// NativeLibrary is a C library linked into a cgo binary, found by the version string it embeds. Dynamically linked
+// libraries don't embed theirs, so only statically linked ones are found.
+type NativeLibrary struct {
+	Name     string // openssl, boringssl, libressl, mbedtls, sqlite, libcurl, zlib, libpng or libssh2
+	Version  string `json:",omitempty"` // probable, the libraries don't all embed an exact one
+	Evidence string
+}
+
+// The version strings the libraries compile in, the first group of the pattern is the version. The needle is a
+// literal found within window bytes of the version string, the pattern only runs around the needles found.
+var nativeLibrarySignatures = []struct {
+	name    string
+	needle  string
+	window  int
+	pattern *regexp.Regexp
+}{
+	// OPENSSL_VERSION_TEXT, BoringSSL's claims compatibility rather than a release
+	{"boringssl", "BoringSSL", maxNativeLibraryEvidence, regexp.MustCompile(`OpenSSL \d+\.\d+\.\d+ \(compatible; BoringSSL\)`)},
+	{"openssl", "OpenSSL ", maxNativeLibraryEvidence, regexp.MustCompile(`OpenSSL (\d+\.\d+\.\d+[a-z]?)(?:-[\w.]+)? +\d{1,2} [A-Z][a-z]{2} \d{4}`)},
+	{"libressl", "LibreSSL ", maxNativeLibraryEvidence, regexp.MustCompile(`LibreSSL (\d+\.\d+\.\d+)`)},
+	{"mbedtls", "bed TLS ", maxNativeLibraryEvidence, regexp.MustCompile(`[Mm]bed TLS (\d+\.\d+\.\d+)`)},
+	// sqlite3_sourceid(), the check-in date and hash. The amalgamation is a single translation unit, its string
+	// literals are laid out together with the magic of the database header.
+	{"sqlite", "SQLite format 3", 1 << 20, regexp.MustCompile(`(\d{4}-\d\d-\d\d) \d\d:\d\d:\d\d [0-9a-f]{40,64}`)},
+	{"libcurl", "libcurl/", maxNativeLibraryEvidence, regexp.MustCompile(`libcurl/(\d+\.\d+\.\d+)`)},
+	// the copyright strings of deflate.c and inflate.c, Go's compress/flate doesn't have them
+	{"zlib", "Jean-loup Gailly", maxNativeLibraryEvidence, regexp.MustCompile(`(?:de|in)flate (\d+\.\d+(?:\.\d+){0,2}) Copyright \d{4}-\d{4} Jean-loup Gailly`)},
+	{"libpng", "libpng version", maxNativeLibraryEvidence, regexp.MustCompile(`libpng version (\d+\.\d+\.\d+)`)},
+	{"libssh2", "libssh2_", maxNativeLibraryEvidence, regexp.MustCompile(`SSH-2\.0-libssh2_(\d+\.\d+\.\d+)`)},
+}
+
+// SQLite embeds the date of its source rather than the release, the releases are matched by the date they started.
+// Patch releases follow within the same series, so only the series is reported.
+var sqliteReleases = []struct {
+	date    string
+	version string
+}{
+	{"2017-08-01", "3.20"}, {"2017-10-24", "3.21"}, {"2018-01-22", "3.22"}, {"2018-04-02", "3.23"},
+	{"2018-06-04", "3.24"}, {"2018-09-15", "3.25"}, {"2018-12-01", "3.26"}, {"2019-02-07", "3.27"},
+	{"2019-04-16", "3.28"}, {"2019-07-10", "3.29"}, {"2019-10-04", "3.30"}, {"2020-01-22", "3.31"},
+	{"2020-05-22", "3.32"}, {"2020-08-14", "3.33"}, {"2020-12-01", "3.34"}, {"2021-03-12", "3.35"},
+	{"2021-06-18", "3.36"}, {"2021-11-27", "3.37"}, {"2022-02-22", "3.38"}, {"2022-06-25", "3.39"},
+	{"2022-11-16", "3.40"}, {"2023-02-21", "3.41"}, {"2023-05-16", "3.42"}, {"2023-08-24", "3.43"},
+	{"2023-11-01", "3.44"}, {"2024-01-15", "3.45"}, {"2024-05-23", "3.46"}, {"2024-10-21", "3.47"},
+	{"2025-01-14", "3.48"}, {"2025-02-06", "3.49"}, {"2025-05-29", "3.50"},
+}
+
+// the longest evidence reported, version strings are short but the patterns allow some slack
+const maxNativeLibraryEvidence = 80
+
+func sqliteVersion(sourceDate string) string {
+	version := ""
+	for _, release := range sqliteReleases {
+		if sourceDate >= release.date {
+			version = release.version + ".x"
+		}
+	}
+	if version == "" {
+		return "before " + sqliteReleases[0].version
+	}
+	return version
+}
+
+// detectNativeLibraries looks for the version strings of common C libraries. Builds known to be without cgo are
+// skipped, their strings would come from Go code quoting them.
+func detectNativeLibraries(fileData []byte, build *BuildSettings) []NativeLibrary {
+	if build != nil && build.CGOEnabled != nil && !*build.CGOEnabled {
+		return nil
+	}
+
+	var libraries []NativeLibrary
+	for _, signature := range nativeLibrarySignatures {
+		match := findNearNeedle(fileData, signature.needle, signature.window, signature.pattern)
+		if match == nil {
+			continue
+		}
+
+		library := NativeLibrary{Name: signature.name, Evidence: string(match[0][:min(len(match[0]), maxNativeLibraryEvidence)])}
+		if len(match) > 1 {
+			library.Version = string(match[1])
+		}
+		if signature.name == "sqlite" {
+			library.Version = sqliteVersion(library.Version)
+		}
+		libraries = append(libraries, library)
+	}
+	return libraries
+}
+
+// findNearNeedle runs pattern within window bytes of each occurrence of needle, the first match wins. Where the
+// occurrences are close, the windows only overlap by what a version string could straddle.
+func findNearNeedle(data []byte, needle string, window int, pattern *regexp.Regexp) [][]byte {
+	scanned := 0
+	for offset := 0; ; {
+		i := bytes.Index(data[offset:], []byte(needle))
+		if i < 0 {
+			return nil
+		}
+		i += offset
+		start, end := max(i-window, scanned-maxNativeLibraryEvidence, 0), min(i+len(needle)+window, len(data))
+		if start < end {
+			if match := pattern.FindSubmatch(data[start:end]); match != nil {
+				return match
+			}
+			scanned = end
+		}
+		offset = i + len(needle)
+	}
+}
@@ -0,0 +1,263 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// nameNormalizer rewrites recovered names for readers and tools that don't expect Go's symbol syntax, see -normalize.
+// It applies after the hints and filters, so those still match the names as the binary spells them.
+type nameNormalizer struct {
+	typeParams bool // main.(*List[go.shape.int]).Push -> main.(*List).Push
+	escapes    bool // gopkg.in/yaml%2ev3.Marshal -> gopkg.in/yaml.v3.Marshal, main·f -> main.f
+	closures   bool // main.main.func1.2 -> main.main$1$2, main.main.gowrap1 -> main.main$go1
+	cpp        bool // github.com/x/y.(*T).M -> github.com::x::y::T::M
+}
+
+var normalizeOptions = []string{"typeparams", "escapes", "closures", "cpp"}
+
+// The fields of the results holding function names, type names and package paths, wherever they appear
+var (
+	functionNameFields = map[string]bool{
+		"FullName": true, "Function": true, "Functions": true, "Caller": true, "Callers": true, "Handler": true,
+		"Readers": true, "Writers": true, "Targets": true, "PoolBuilders": true,
+	}
+	typeNameFields    = map[string]bool{"Str": true, "Interface": true}
+	packagePathFields = map[string]bool{"PackageName": true}
+	callSiteFields    = map[string]bool{"CallSites": true} // caller -> API
+)
+
+// What a name of the results is, for rewriteNames
+type nameKind int
+
+const (
+	functionNameKind nameKind = iota
+	typeNameKind
+	packagePathKind
+)
+
+var (
+	percentEscapeRegex = regexp.MustCompile(`%[0-9a-fA-F]{2}`)
+	closureSuffixRegex = regexp.MustCompile(`(\.func|\.gowrap|\.deferwrap|-range)(\d+)((?:\.\d+)*)`)
+	qualifierRegex     = regexp.MustCompile(`([A-Za-z0-9_])\.([A-Za-z_])`)
+)
+
+// parseNormalizer parses the comma separated options of -normalize, all enables every one
+func parseNormalizer(options string) (*nameNormalizer, error) {
+	n := &nameNormalizer{}
+	for _, option := range strings.Split(options, ",") {
+		switch strings.TrimSpace(option) {
+		case "all":
+			n.typeParams, n.escapes, n.closures, n.cpp = true, true, true, true
+		case "typeparams":
+			n.typeParams = true
+		case "escapes":
+			n.escapes = true
+		case "closures":
+			n.closures = true
+		case "cpp":
+			n.cpp = true
+		default:
+			return nil, fmt.Errorf("unknown option %s, expected %s or all", option, strings.Join(normalizeOptions, ", "))
+		}
+	}
+	return n, nil
+}
+
+// function normalizes a function name. The %2e escapes are decoded last, the package path ends at the first dot after
+// its last slash.
+func (n *nameNormalizer) function(name string) string {
+	if n.escapes {
+		name = assemblyEscapes.Replace(name)
+	}
+	if n.typeParams {
+		name = stripTypeParameters(name)
+	}
+	if n.closures {
+		name = closureSuffixRegex.ReplaceAllStringFunc(name, func(suffix string) string {
+			match := closureSuffixRegex.FindStringSubmatch(suffix)
+			prefix := map[string]string{".func": "$", ".gowrap": "$go", ".deferwrap": "$defer", "-range": "$range"}[match[1]]
+			return prefix + match[2] + strings.ReplaceAll(match[3], ".", "$")
+		})
+	}
+	if n.cpp {
+		name = cppFunctionName(name)
+	}
+	if n.escapes {
+		name = decodePercentEscapes(name)
+	}
+	return name
+}
+
+// typeName normalizes a type name, ex: *main.T. Types are named with the last element of their package path.
+func (n *nameNormalizer) typeName(name string) string {
+	if n.escapes {
+		name = decodeEscapes(name)
+	}
+	if n.typeParams {
+		name = stripTypeParameters(name)
+	}
+	if n.cpp {
+		name = qualifierRegex.ReplaceAllString(name, "$1::$2")
+	}
+	return name
+}
+
+// packagePath only decodes the escapes, package paths are matched by -filter-package and compared with the build info
+func (n *nameNormalizer) packagePath(pkg string) string {
+	if n.escapes {
+		return decodeEscapes(pkg)
+	}
+	return pkg
+}
+
+// The middle dot and division slash assembly writes for . and /
+var assemblyEscapes = strings.NewReplacer("·", ".", "∕", "/")
+
+// decodeEscapes decodes the characters escaped in symbol names
+func decodeEscapes(name string) string {
+	return decodePercentEscapes(assemblyEscapes.Replace(name))
+}
+
+// decodePercentEscapes decodes the characters the linker escapes in package paths, such as the dots of the last
+// element as %2e
+func decodePercentEscapes(name string) string {
+	if !strings.Contains(name, "%") {
+		return name
+	}
+	return percentEscapeRegex.ReplaceAllStringFunc(name, func(escape string) string {
+		value, _ := strconv.ParseUint(escape[1:], 16, 8)
+		return string(rune(value))
+	})
+}
+
+// stripTypeParameters drops the bracketed type arguments following a name, leaving arrays, slices and maps be
+func stripTypeParameters(name string) string {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '[' && depth > 0:
+			depth++
+		case c == '[' && i > 0 && isIdentifierByte(name[i-1]) && !strings.HasSuffix(name[:i], "map"):
+			depth = 1
+		case c == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// cppFunctionName formats pkg/path.(*T).M as pkg::path::T::M, the receiver loses its parentheses and pointer
+func cppFunctionName(name string) string {
+	// the package path ends at the first dot after its last slash, type arguments may hold slashes of their own
+	end := len(name)
+	if i := strings.IndexAny(name, "[("); i != -1 {
+		end = i
+	}
+	pathEnd := strings.LastIndex(name[:end], "/") + 1
+	dot := strings.Index(name[pathEnd:], ".")
+	if dot == -1 {
+		return name
+	}
+	pkg, rest := name[:pathEnd+dot], name[pathEnd+dot+1:]
+
+	if strings.HasPrefix(rest, "(") {
+		if closing := strings.Index(rest, ")"); closing != -1 {
+			rest = strings.TrimPrefix(rest[1:closing], "*") + rest[closing+1:]
+		}
+	}
+
+	// split the rest at the dots outside of type arguments
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				parts = append(parts, rest[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, rest[start:])
+	return strings.ReplaceAll(pkg, "/", "::") + "::" + strings.Join(parts, "::")
+}
+
+// normalizeNames rewrites the names in every part of the results, from the functions and types to the analyses
+// naming the functions they found something in
+func normalizeNames(metadata *ExtractMetadata, n *nameNormalizer) {
+	rewriteNames(reflect.ValueOf(metadata).Elem(), "", n.rewrite)
+}
+
+func (n *nameNormalizer) rewrite(kind nameKind, name string) string {
+	switch kind {
+	case functionNameKind:
+		return n.function(name)
+	case typeNameKind:
+		return n.typeName(name)
+	}
+	return n.packagePath(name)
+}
+
+// rewriteNames replaces every function name, type name and package path of the results with what rewrite returns for
+// it, wherever they appear
+func rewriteNames(value reflect.Value, field string, rewrite func(kind nameKind, name string) string) {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !value.IsNil() {
+			rewriteNames(value.Elem(), field, rewrite)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				rewriteNames(value.Field(i), value.Type().Field(i).Name, rewrite)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			rewriteNames(value.Index(i), field, rewrite)
+		}
+	case reflect.String:
+		if !value.CanSet() || value.String() == "" {
+			return
+		}
+		switch {
+		case functionNameFields[field]:
+			value.SetString(rewrite(functionNameKind, value.String()))
+		case typeNameFields[field]:
+			value.SetString(rewrite(typeNameKind, value.String()))
+		case packagePathFields[field]:
+			value.SetString(rewrite(packagePathKind, value.String()))
+		case callSiteFields[field]:
+			if caller, api, ok := strings.Cut(value.String(), " -> "); ok {
+				value.SetString(rewrite(functionNameKind, caller) + " -> " + rewrite(functionNameKind, api))
+			}
+		}
+	}
+}
+
+// diffReport normalizes the names of a diff, once the functions and types were matched
+func (n *nameNormalizer) diffReport(report *DiffReport) {
+	for _, items := range [][]DiffItem{report.Added, report.Removed, report.Changed, report.Renamed} {
+		for i := range items {
+			switch items[i].Kind {
+			case "function":
+				items[i].Name, items[i].OldName = n.function(items[i].Name), n.function(items[i].OldName)
+			case "type":
+				items[i].Name, items[i].OldName = n.typeName(items[i].Name), n.typeName(items[i].OldName)
+			}
+		}
+	}
+}
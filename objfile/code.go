@@ -0,0 +1,240 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package objfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/arch/arm64/arm64asm"
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// An Instruction is a decoded machine instruction reduced to what the code analyses need:
+// the mnemonic, the addresses it references, any immediate values, and the call target if it's a direct call.
+type Instruction struct {
+	PC    uint64
+	Len   int
+	Op    string
+	Shape string   // mnemonic plus operand kinds with registers and constants removed, stable across recompilation
+	Refs  []uint64 // absolute addresses referenced via pc relative, absolute memory or materialized addresses
+	Imms  []int64  // immediate operands
+	Call  uint64   // target of a direct call, 0 otherwise
+	Dest  string   // the first operand, usually the destination: a register, or SP+offset for a stack slot
+	Base  string   // the base register of a memory operand addressed relative to one, ex: CX for 0x18(CX)
+	Disp  int64    // and its displacement
+}
+
+// Decode disassembles [start, end) and calls f for each instruction until f returns false.
+// Bytes that don't decode are skipped by the minimum instruction size of the architecture.
+func (f *File) Decode(start uint64, end uint64, fn func(inst Instruction) bool) error {
+	return f.entries[0].Decode(start, end, fn)
+}
+
+func (e *Entry) Decode(start uint64, end uint64, fn func(inst Instruction) bool) error {
+	if end <= start {
+		return nil
+	}
+
+	code, err := e.raw.read_memory(start, end-start)
+	if err != nil {
+		return err
+	}
+
+	switch goarch := e.GOARCH(); goarch {
+	case "amd64":
+		decodeX86(code, start, 64, fn)
+	case "386":
+		decodeX86(code, start, 32, fn)
+	case "arm64":
+		decodeARM64(code, start, fn)
+	default:
+		return fmt.Errorf("code analysis not supported for architecture %q", goarch)
+	}
+	return nil
+}
+
+func decodeX86(code []byte, pc uint64, mode int, fn func(inst Instruction) bool) {
+	for len(code) > 0 {
+		inst, err := x86asm.Decode(code, mode)
+		if err != nil || inst.Len == 0 {
+			code = code[1:]
+			pc++
+			continue
+		}
+
+		decoded := Instruction{PC: pc, Len: inst.Len, Op: inst.Op.String()}
+		next := pc + uint64(inst.Len)
+
+		var shape strings.Builder
+		shape.WriteString(decoded.Op)
+		for i, arg := range inst.Args {
+			if arg == nil {
+				break
+			}
+
+			if i == 0 {
+				shape.WriteByte(' ')
+			} else {
+				shape.WriteByte(',')
+			}
+
+			switch a := arg.(type) {
+			case x86asm.Reg:
+				shape.WriteByte('r')
+				if i == 0 {
+					decoded.Dest = a.String()
+				}
+			case x86asm.Mem:
+				shape.WriteByte('m')
+				if i == 0 && (a.Base == x86asm.RSP || a.Base == x86asm.ESP) && a.Index == 0 {
+					decoded.Dest = fmt.Sprintf("SP+%d", a.Disp)
+				}
+				if a.Base != 0 && a.Base != x86asm.RIP && a.Index == 0 && decoded.Base == "" {
+					decoded.Base, decoded.Disp = a.Base.String(), a.Disp
+				}
+				if a.Base == x86asm.RIP {
+					decoded.Refs = append(decoded.Refs, uint64(int64(next)+a.Disp))
+				} else if mode == 32 && a.Base == 0 && a.Index == 0 && a.Segment == 0 {
+					// absolute addressing, 386 has no pc relative data access
+					decoded.Refs = append(decoded.Refs, uint64(uint32(a.Disp)))
+				}
+			case x86asm.Imm:
+				shape.WriteByte('i')
+				decoded.Imms = append(decoded.Imms, int64(a))
+			case x86asm.Rel:
+				shape.WriteByte('l')
+				target := uint64(int64(next) + int64(a))
+				if inst.Op == x86asm.CALL {
+					decoded.Call = target
+				} else {
+					decoded.Refs = append(decoded.Refs, target)
+				}
+			}
+		}
+		decoded.Shape = shape.String()
+
+		if !fn(decoded) {
+			return
+		}
+		code = code[inst.Len:]
+		pc = next
+	}
+}
+
+func decodeARM64(code []byte, pc uint64, fn func(inst Instruction) bool) {
+	// ADRP loads the 4KB page of an address, the following ADD or LDR supplies the low bits.
+	// Remember the page each register holds so the full address can be formed.
+	pages := make(map[arm64asm.Reg]uint64)
+
+	for ; len(code) >= 4; code, pc = code[4:], pc+4 {
+		inst, err := arm64asm.Decode(code)
+		if err != nil {
+			continue
+		}
+
+		decoded := Instruction{PC: pc, Len: 4, Op: inst.Op.String()}
+		enc := binary.LittleEndian.Uint32(code)
+
+		var shape strings.Builder
+		shape.WriteString(decoded.Op)
+		for i, arg := range inst.Args {
+			if arg == nil {
+				break
+			}
+
+			if i == 0 {
+				shape.WriteByte(' ')
+			} else {
+				shape.WriteByte(',')
+			}
+
+			switch a := arg.(type) {
+			case arm64asm.Reg, arm64asm.RegSP:
+				shape.WriteByte('r')
+				if i == 0 {
+					decoded.Dest = a.String()
+				}
+			case arm64asm.MemImmediate:
+				shape.WriteByte('m')
+				var base int
+				var offset int64
+				if _, err := fmt.Sscanf(a.String(), "[X%d,#%d]", &base, &offset); err == nil {
+					decoded.Base, decoded.Disp = fmt.Sprintf("X%d", base), offset
+				} else if _, err := fmt.Sscanf(a.String(), "[X%d]", &base); err == nil {
+					decoded.Base = fmt.Sprintf("X%d", base)
+				}
+			case arm64asm.MemExtend:
+				shape.WriteByte('m')
+			case arm64asm.Imm:
+				shape.WriteByte('i')
+				decoded.Imms = append(decoded.Imms, int64(a.Imm))
+			case arm64asm.Imm64:
+				shape.WriteByte('i')
+				decoded.Imms = append(decoded.Imms, int64(a.Imm))
+			case arm64asm.ImmShift:
+				shape.WriteByte('i')
+			case arm64asm.PCRel:
+				shape.WriteByte('l')
+				switch inst.Op {
+				case arm64asm.ADRP:
+					pages[destReg(inst)] = (pc &^ 0xfff) + uint64(a)
+				case arm64asm.BL:
+					decoded.Call = pc + uint64(a)
+				default:
+					decoded.Refs = append(decoded.Refs, pc+uint64(a))
+				}
+			default:
+				shape.WriteByte('?')
+			}
+		}
+		decoded.Shape = shape.String()
+
+		switch inst.Op {
+		case arm64asm.ADD:
+			// ADD (immediate), sf|0|0|100010|sh|imm12|Rn|Rd. The decoder keeps the immediate private, so decode it here
+			if enc&0x7f800000 == 0x11000000 {
+				rn := arm64asm.Reg(arm64asm.X0) + arm64asm.Reg((enc>>5)&0x1f)
+				if page, ok := pages[rn]; ok {
+					imm := uint64((enc >> 10) & 0xfff)
+					if (enc>>22)&1 == 1 {
+						imm <<= 12
+					}
+					decoded.Refs = append(decoded.Refs, page+imm)
+				}
+			}
+		case arm64asm.LDR, arm64asm.LDRB, arm64asm.LDRH, arm64asm.STR:
+			if len(inst.Args) > 1 {
+				if mem, ok := inst.Args[1].(arm64asm.MemImmediate); ok {
+					if page, ok := pages[arm64asm.Reg(mem.Base)]; ok {
+						// the low bits live in the (scaled) imm12 field, recover them from the printed operand
+						var offset int64
+						if _, err := fmt.Sscanf(mem.String(), "[X%d,#%d]", new(int), &offset); err == nil {
+							decoded.Refs = append(decoded.Refs, uint64(int64(page)+offset))
+						} else {
+							decoded.Refs = append(decoded.Refs, page)
+						}
+					}
+				}
+			}
+		}
+
+		if !fn(decoded) {
+			return
+		}
+	}
+}
+
+// destReg returns the 64 bit register written by an instruction whose first operand is its destination
+func destReg(inst arm64asm.Inst) arm64asm.Reg {
+	switch r := inst.Args[0].(type) {
+	case arm64asm.Reg:
+		if r >= arm64asm.W0 && r <= arm64asm.WZR {
+			return arm64asm.X0 + (r - arm64asm.W0)
+		}
+		return r
+	case arm64asm.RegSP:
+		return arm64asm.Reg(r)
+	}
+	return 0
+}
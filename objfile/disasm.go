@@ -9,6 +9,7 @@ package objfile
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"container/list"
 	"encoding/binary"
 	"fmt"
@@ -48,7 +49,11 @@ func (e *Entry) Disasm() (*Disasm, error) {
 		return nil, err
 	}
 
-	ch_pclns, err := e.PCLineTable("", 0, 0)
+	// only the first candidate is used, stop the scan after that
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch_pclns, err := e.PCLineTable(ctx, "", 0, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -10,6 +10,7 @@ package objfile
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -86,7 +87,7 @@ func (f *elfFile) symbols() ([]Sym, error) {
 	return syms, nil
 }
 
-func (f *elfFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
+func (f *elfFile) pcln_scan(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
 	// 1) Locate pclntab via symbols (standard way)
 	foundpcln := false
 	var pclntab []byte
@@ -121,12 +122,20 @@ func (f *elfFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
 
 	ch_tab := make(chan PclntabCandidate)
 
+	// the consumer stops reading once it finds a good candidate or gives up, the context unblocks us when that happens
 	send_tab := func(candidate *PclntabCandidate) {
 		if symtab_err != nil {
 			candidate.Symtab = symtab
-			ch_tab <- *candidate
+			select {
+			case ch_tab <- *candidate:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case ch_tab <- *candidate:
+		case <-ctx.Done():
 		}
-		ch_tab <- *candidate
 	}
 
 	// for any candidate, patch out the magic, and send all possible magics to parse too
@@ -199,6 +208,10 @@ func (f *elfFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
 		defer close(ch_tab)
 
 		for _, sec := range f.elf.Sections {
+			if ctx.Err() != nil {
+				return
+			}
+
 			// first section is all zeros, skip
 			if sec.Type == elf.SHT_NULL {
 				continue
@@ -289,8 +302,8 @@ func (f *elfFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
 	return ch_tab, nil
 }
 
-func (f *elfFile) pcln() (candidates <-chan PclntabCandidate, err error) {
-	candidates, err = f.pcln_scan()
+func (f *elfFile) pcln(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
+	candidates, err = f.pcln_scan(ctx)
 	if err != nil {
 		return nil, err
 	}
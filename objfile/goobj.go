@@ -9,6 +9,7 @@
 package objfile
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -74,7 +75,7 @@ L:
 		}
 		return nil, fmt.Errorf("open %s: unrecognized archive member %s", f.Name(), e.Name)
 	}
-	return &File{f, entries}, nil
+	return &File{r: f, entries: entries}, nil
 }
 
 func goobjName(name string, ver int) string {
@@ -227,11 +228,11 @@ func (f *goobjFile) symbols() ([]Sym, error) {
 	return syms, nil
 }
 
-func (f *goobjFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
+func (f *goobjFile) pcln_scan(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
 	return nil, fmt.Errorf("pcln not available in go object file")
 }
 
-func (f *goobjFile) pcln() (candidates <-chan PclntabCandidate, err error) {
+func (f *goobjFile) pcln(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
 	// Should never be called. We implement Liner below, callers
 	// should use that instead.
 	return nil, fmt.Errorf("pcln not available in go object file")
@@ -0,0 +1,430 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package objfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/elf"
+	"github.com/mandiant/GoReSym/debug/macho"
+	"github.com/mandiant/GoReSym/debug/pe"
+)
+
+// EntryPoint returns the virtual address execution starts at
+func (f *File) EntryPoint() (uint64, error) {
+	return f.entries[0].raw.entryPoint()
+}
+
+// ImportedSymbols returns the names of the symbols resolved from shared libraries at load time
+func (f *File) ImportedSymbols() ([]string, error) {
+	return f.entries[0].raw.importedSymbols()
+}
+
+// Segments returns what the loader maps into memory: ELF program headers, Mach-O segments, and the sections of PE
+// files, which the loader maps directly. Packers often strip the section headers and only leave segments behind.
+func (f *File) Segments() ([]Section, error) {
+	return f.entries[0].raw.segments()
+}
+
+func (f *elfFile) entryPoint() (uint64, error) {
+	return f.elf.Entry, nil
+}
+
+func (f *elfFile) importedSymbols() ([]string, error) {
+	symbols, err := f.elf.ImportedSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, sym := range symbols {
+		names = append(names, sym.Name)
+	}
+	return names, nil
+}
+
+func (f *elfFile) segments() ([]Section, error) {
+	var segments []Section
+	for i, prog := range f.elf.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+
+		prog := prog
+		segments = append(segments, Section{
+			Name:       fmt.Sprintf("LOAD%d", i),
+			Addr:       prog.Vaddr,
+			Size:       prog.Memsz,
+			Offset:     prog.Off,
+			FileSize:   prog.Filesz,
+			Readable:   prog.Flags&elf.PF_R != 0,
+			Writable:   prog.Flags&elf.PF_W != 0,
+			Executable: prog.Flags&elf.PF_X != 0,
+			data: func() ([]byte, error) {
+				data := make([]byte, prog.Filesz)
+				n, err := prog.ReadAt(data, 0)
+				if err == io.EOF {
+					err = nil
+				}
+				return data[:n], err
+			},
+		})
+	}
+	return segments, nil
+}
+
+func (f *peFile) entryPoint() (uint64, error) {
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(oh.ImageBase) + uint64(oh.AddressOfEntryPoint), nil
+	case *pe.OptionalHeader64:
+		return oh.ImageBase + uint64(oh.AddressOfEntryPoint), nil
+	}
+	return 0, fmt.Errorf("pe file format not recognized")
+}
+
+func (f *peFile) importedSymbols() ([]string, error) {
+	return f.pe.ImportedSymbols()
+}
+
+func (f *peFile) segments() ([]Section, error) {
+	return f.sections()
+}
+
+func (f *machoFile) entryPoint() (uint64, error) {
+	const (
+		LC_UNIXTHREAD = 0x5
+		LC_MAIN       = 0x80000028
+
+		x86_THREAD_STATE64 = 4
+		ARM_THREAD_STATE64 = 6
+	)
+
+	var textBase uint64
+	for _, load := range f.macho.Loads {
+		if seg, ok := load.(*macho.Segment); ok && seg.Name == "__TEXT" {
+			textBase = seg.Addr
+		}
+	}
+
+	bo := f.macho.ByteOrder
+	for _, load := range f.macho.Loads {
+		raw := load.Raw()
+		if len(raw) < 16 {
+			continue
+		}
+
+		switch bo.Uint32(raw) {
+		case LC_MAIN:
+			// entryoff is relative to the __TEXT segment
+			return textBase + bo.Uint64(raw[8:]), nil
+		case LC_UNIXTHREAD:
+			// the initial register state, the entry point is the program counter
+			var pcOffset int
+			switch bo.Uint32(raw[8:]) {
+			case x86_THREAD_STATE64:
+				pcOffset = 16 + 16*8 // rip follows 16 general purpose registers
+			case ARM_THREAD_STATE64:
+				pcOffset = 16 + 32*8 // pc follows x0-x28, fp, lr and sp
+			default:
+				continue
+			}
+			if len(raw) >= pcOffset+8 {
+				return bo.Uint64(raw[pcOffset:]), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no entry point load command")
+}
+
+func (f *machoFile) importedSymbols() ([]string, error) {
+	return f.macho.ImportedSymbols()
+}
+
+func (f *machoFile) segments() ([]Section, error) {
+	const (
+		VM_PROT_READ    = 0x1
+		VM_PROT_WRITE   = 0x2
+		VM_PROT_EXECUTE = 0x4
+	)
+
+	var segments []Section
+	for _, load := range f.macho.Loads {
+		seg, ok := load.(*macho.Segment)
+		if !ok {
+			continue
+		}
+
+		segments = append(segments, Section{
+			Name:       seg.Name,
+			Addr:       seg.Addr,
+			Size:       seg.Memsz,
+			Offset:     seg.Offset,
+			FileSize:   seg.Filesz,
+			Readable:   seg.Prot&VM_PROT_READ != 0,
+			Writable:   seg.Prot&VM_PROT_WRITE != 0,
+			Executable: seg.Prot&VM_PROT_EXECUTE != 0,
+			data:       seg.Data,
+		})
+	}
+	return segments, nil
+}
+
+func (f *goobjFile) entryPoint() (uint64, error) {
+	return 0, fmt.Errorf("entry point not available in go object file")
+}
+
+func (f *goobjFile) importedSymbols() ([]string, error) {
+	return nil, fmt.Errorf("imports not available in go object file")
+}
+
+func (f *goobjFile) segments() ([]Section, error) {
+	return nil, fmt.Errorf("segments not available in go object file")
+}
+
+// TLSCallbacks returns the addresses of the callbacks in the PE TLS directory, the loader runs them before the entry
+// point. Other formats have no TLS callbacks.
+func (f *File) TLSCallbacks() ([]uint64, error) {
+	return f.entries[0].raw.tlsCallbacks()
+}
+
+func (f *elfFile) tlsCallbacks() ([]uint64, error) {
+	return nil, nil
+}
+
+func (f *peFile) tlsCallbacks() ([]uint64, error) {
+	// the callbacks are a zero terminated array, a bound keeps a corrupt one from being read forever
+	const maxCallbacks = 1024
+
+	var directory pe.DataDirectory
+	var imageBase uint64
+	var ptrSize uint64
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		directory = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_TLS]
+		imageBase = uint64(oh.ImageBase)
+		ptrSize = 4
+	case *pe.OptionalHeader64:
+		directory = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_TLS]
+		imageBase = oh.ImageBase
+		ptrSize = 8
+	default:
+		return nil, fmt.Errorf("pe file format not recognized")
+	}
+
+	if directory.VirtualAddress == 0 {
+		return nil, nil
+	}
+
+	readPtr := func(va uint64) (uint64, error) {
+		data, err := f.read_memory(va, ptrSize)
+		if err != nil {
+			return 0, err
+		}
+		if uint64(len(data)) < ptrSize {
+			return 0, fmt.Errorf("TLS directory truncated")
+		}
+		if ptrSize == 4 {
+			return uint64(binary.LittleEndian.Uint32(data)), nil
+		}
+		return binary.LittleEndian.Uint64(data), nil
+	}
+
+	// StartAddressOfRawData, EndAddressOfRawData and AddressOfIndex precede AddressOfCallBacks
+	callbacksVA, err := readPtr(imageBase + uint64(directory.VirtualAddress) + 3*ptrSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading TLS directory: %w", err)
+	}
+	if callbacksVA == 0 {
+		return nil, nil
+	}
+
+	var callbacks []uint64
+	for i := uint64(0); i < maxCallbacks; i++ {
+		callback, err := readPtr(callbacksVA + i*ptrSize)
+		if err != nil {
+			return callbacks, fmt.Errorf("reading TLS callbacks: %w", err)
+		}
+		if callback == 0 {
+			break
+		}
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks, nil
+}
+
+func (f *machoFile) tlsCallbacks() ([]uint64, error) {
+	return nil, nil
+}
+
+func (f *goobjFile) tlsCallbacks() ([]uint64, error) {
+	return nil, fmt.Errorf("TLS callbacks not available in go object file")
+}
+
+// HeaderTimestamp is a time the linker or a later tool wrote into the headers, in seconds since the Unix epoch
+type HeaderTimestamp struct {
+	Name  string
+	Value uint32
+}
+
+// Timestamps returns the non-zero timestamps of the headers: the PE file header and the debug, export and resource
+// directories, and the Mach-O dylib load commands. ELF files have none.
+func (f *File) Timestamps() ([]HeaderTimestamp, error) {
+	return f.entries[0].raw.timestamps()
+}
+
+func (f *elfFile) timestamps() ([]HeaderTimestamp, error) {
+	return nil, nil
+}
+
+func (f *peFile) timestamps() ([]HeaderTimestamp, error) {
+	var timestamps []HeaderTimestamp
+	add := func(name string, value uint32) {
+		if value != 0 {
+			timestamps = append(timestamps, HeaderTimestamp{Name: name, Value: value})
+		}
+	}
+	add("pe header", f.pe.FileHeader.TimeDateStamp)
+
+	var directories []pe.DataDirectory
+	var imageBase uint64
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		directories = oh.DataDirectory[:min(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+		imageBase = uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		directories = oh.DataDirectory[:min(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+		imageBase = oh.ImageBase
+	default:
+		return timestamps, fmt.Errorf("pe file format not recognized")
+	}
+
+	// the export and resource directories, and each entry of the debug directory, have their TimeDateStamp at offset 4
+	readStamp := func(rva uint32) (uint32, error) {
+		data, err := f.read_memory(imageBase+uint64(rva)+4, 4)
+		if err != nil {
+			return 0, err
+		}
+		if len(data) < 4 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return binary.LittleEndian.Uint32(data), nil
+	}
+
+	for _, d := range []struct {
+		index int
+		name  string
+	}{{pe.IMAGE_DIRECTORY_ENTRY_EXPORT, "export directory"}, {pe.IMAGE_DIRECTORY_ENTRY_RESOURCE, "resource directory"}} {
+		if d.index >= len(directories) || directories[d.index].VirtualAddress == 0 {
+			continue
+		}
+		stamp, err := readStamp(directories[d.index].VirtualAddress)
+		if err != nil {
+			return timestamps, fmt.Errorf("reading %s: %w", d.name, err)
+		}
+		add(d.name, stamp)
+	}
+
+	const debugDirectoryEntrySize = 28
+	if pe.IMAGE_DIRECTORY_ENTRY_DEBUG < len(directories) {
+		debugDirectory := directories[pe.IMAGE_DIRECTORY_ENTRY_DEBUG]
+		for offset := uint32(0); debugDirectory.VirtualAddress != 0 && offset+debugDirectoryEntrySize <= debugDirectory.Size; offset += debugDirectoryEntrySize {
+			stamp, err := readStamp(debugDirectory.VirtualAddress + offset)
+			if err != nil {
+				return timestamps, fmt.Errorf("reading debug directory: %w", err)
+			}
+			add("debug directory", stamp)
+		}
+	}
+	return timestamps, nil
+}
+
+func (f *machoFile) timestamps() ([]HeaderTimestamp, error) {
+	var timestamps []HeaderTimestamp
+	for _, load := range f.macho.Loads {
+		if dylib, ok := load.(*macho.Dylib); ok && dylib.Time != 0 {
+			timestamps = append(timestamps, HeaderTimestamp{Name: "dylib " + dylib.Name, Value: dylib.Time})
+		}
+	}
+	return timestamps, nil
+}
+
+func (f *goobjFile) timestamps() ([]HeaderTimestamp, error) {
+	return nil, fmt.Errorf("timestamps not available in go object file")
+}
+
+// Linkage is how the executable is linked at load time: the dynamic loader it names and the shared libraries it needs
+type Linkage struct {
+	Interpreter string
+	Libraries   []string
+}
+
+// Linkage returns the ELF interpreter and DT_NEEDED libraries, the Mach-O dynamic linker and dylibs, or the DLLs of
+// the PE import directory
+func (f *File) Linkage() (*Linkage, error) {
+	return f.entries[0].raw.linkage()
+}
+
+func (f *elfFile) linkage() (*Linkage, error) {
+	link := &Linkage{}
+	for _, prog := range f.elf.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		interp := make([]byte, prog.Filesz)
+		n, err := prog.ReadAt(interp, 0)
+		if err != nil && err != io.EOF {
+			return link, err
+		}
+		link.Interpreter = strings.TrimRight(string(interp[:n]), "\x00")
+	}
+
+	libraries, err := f.elf.ImportedLibraries()
+	link.Libraries = libraries
+	return link, err
+}
+
+func (f *peFile) linkage() (*Linkage, error) {
+	symbols, err := f.pe.ImportedSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &Linkage{}
+	seen := make(map[string]bool)
+	for _, symbol := range symbols {
+		_, dll, ok := strings.Cut(symbol, ":")
+		if ok && !seen[strings.ToLower(dll)] {
+			seen[strings.ToLower(dll)] = true
+			link.Libraries = append(link.Libraries, dll)
+		}
+	}
+	return link, nil
+}
+
+func (f *machoFile) linkage() (*Linkage, error) {
+	const LC_LOAD_DYLINKER = 0xe
+
+	link := &Linkage{}
+	bo := f.macho.ByteOrder
+	for _, load := range f.macho.Loads {
+		// the dylinker_command holds the offset of the path after the command and its size
+		raw := load.Raw()
+		if len(raw) < 12 || bo.Uint32(raw) != LC_LOAD_DYLINKER {
+			continue
+		}
+		if offset := bo.Uint32(raw[8:]); offset < uint32(len(raw)) {
+			link.Interpreter = strings.TrimRight(string(raw[offset:]), "\x00")
+		}
+	}
+
+	libraries, err := f.macho.ImportedLibraries()
+	link.Libraries = libraries
+	return link, err
+}
+
+func (f *goobjFile) linkage() (*Linkage, error) {
+	return nil, fmt.Errorf("linkage not available in go object file")
+}
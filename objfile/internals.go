@@ -1284,6 +1284,7 @@ type Type struct {
 	Kind           string
 	Reconstructed  string `json:",omitempty"` // for Some types we can reconstruct the original definition back to Go code
 	CReconstructed string `json:",omitempty"` // for Some types we can reconstruct the original definition back to C code
+	Origin         string `json:",omitempty"` // user, dependency or stdlib, from the packages sharing the type's qualifier
 
 	// rtypes change between runtime versions. Depending on the 'Kind' additional data follows the 'base' rtype.
 	// We store the size so that this base type can be skipped past, and the additional data read directly in a version independant way.
@@ -10,6 +10,7 @@ package objfile
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -108,7 +109,7 @@ func (f *machoFile) symbols() ([]Sym, error) {
 	return syms, nil
 }
 
-func (f *machoFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
+func (f *machoFile) pcln_scan(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
 	// 1) Locate pclntab via symbols (standard way)
 	foundpcln := false
 	var pclntab []byte
@@ -142,12 +143,20 @@ func (f *machoFile) pcln_scan() (candidates <-chan PclntabCandidate, err error)
 	pclntab_sigs := append(pclntab_sigs_le, pclntab_sigs_be...)
 	ch_tab := make(chan PclntabCandidate)
 
+	// the consumer stops reading once it finds a good candidate or gives up, the context unblocks us when that happens
 	send_tab := func(candidate *PclntabCandidate) {
 		if symtab_err != nil {
 			candidate.Symtab = symtab
-			ch_tab <- *candidate
+			select {
+			case ch_tab <- *candidate:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case ch_tab <- *candidate:
+		case <-ctx.Done():
 		}
-		ch_tab <- *candidate
 	}
 
 	send_patched_magic_candidates := func(candidate *PclntabCandidate) {
@@ -220,6 +229,10 @@ func (f *machoFile) pcln_scan() (candidates <-chan PclntabCandidate, err error)
 	go func() {
 		defer close(ch_tab)
 		for _, sec := range f.macho.Sections {
+			if ctx.Err() != nil {
+				return
+			}
+
 			// malware can split the pclntab across multiple sections, re-merge
 			data := f.macho.DataAfterSection(sec)
 
@@ -305,8 +318,8 @@ func (f *machoFile) pcln_scan() (candidates <-chan PclntabCandidate, err error)
 	return ch_tab, nil
 }
 
-func (f *machoFile) pcln() (candidates <-chan PclntabCandidate, err error) {
-	candidates, err = f.pcln_scan()
+func (f *machoFile) pcln(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
+	candidates, err = f.pcln_scan(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,69 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package objfile
+
+import (
+	"io"
+	"math"
+	"os"
+)
+
+// A Mapping is the content of a file, mapped into memory where the OS supports it so that multi-GB inputs, such as
+// core dumps, are paged in as they are scanned instead of being copied into memory. Elsewhere the file is read whole.
+type Mapping struct {
+	data   []byte
+	mapped bool
+}
+
+// MapFile opens the named file and maps it read only. The data is only valid until Close.
+func MapFile(name string) (*Mapping, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if m := mapFile(f); m != nil {
+		return m, nil
+	}
+	return readMapping(f)
+}
+
+// mapFile maps the file, nil when mmap is unavailable or fails, ex: for an empty file
+func mapFile(f *os.File) *Mapping {
+	info, err := f.Stat()
+	if err != nil || info.Size() <= 0 || info.Size() > math.MaxInt {
+		return nil
+	}
+	data, err := mmap(f, int(info.Size()))
+	if err != nil {
+		return nil
+	}
+	return &Mapping{data: data, mapped: true}
+}
+
+// readMapping is the fallback where the file can't be mapped
+func readMapping(r io.ReaderAt) (*Mapping, error) {
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	return &Mapping{data: data}, nil
+}
+
+// Data is the whole content of the file
+func (m *Mapping) Data() []byte {
+	return m.data
+}
+
+// Mapped tells whether the data is mapped, or was read
+func (m *Mapping) Mapped() bool {
+	return m.mapped
+}
+
+func (m *Mapping) Close() error {
+	data := m.data
+	m.data = nil
+	if !m.mapped || data == nil {
+		return nil
+	}
+	return munmap(data)
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+
+package objfile
+
+import (
+	"errors"
+	"os"
+)
+
+func mmap(f *os.File, size int) ([]byte, error) {
+	return nil, errors.New("mmap isn't supported on this OS")
+}
+
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+
+package objfile
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func mmap(f *os.File, size int) ([]byte, error) {
+	handle, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READONLY, uint32(uint64(size)>>32), uint32(size), nil)
+	if err != nil {
+		return nil, err
+	}
+	// the view keeps the mapping object alive
+	defer windows.CloseHandle(handle)
+	addr, err := windows.MapViewOfFile(handle, windows.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, err
+	}
+	// the view is outside the Go heap and stays put until munmap, so the address can be converted like cmd/go's mmap
+	// does, vet's uintptr check doesn't know that
+	return unsafe.Slice((*byte)(unsafe.Pointer(addr)), size), nil
+}
+
+func munmap(data []byte) error {
+	return windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&data[0])))
+}
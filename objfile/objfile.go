@@ -9,14 +9,17 @@ package objfile
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"math/rand"
 	"os"
 	"sort"
 	"strconv"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/elliotchance/orderedmap"
@@ -47,10 +50,19 @@ type ModuleDataCandidate struct {
 
 type rawFile interface {
 	symbols() (syms []Sym, err error)
-	pcln() (candidates <-chan PclntabCandidate, err error)
-	pcln_scan() (candidates <-chan PclntabCandidate, err error)
+	pcln(ctx context.Context) (candidates <-chan PclntabCandidate, err error)
+	pcln_scan(ctx context.Context) (candidates <-chan PclntabCandidate, err error)
 	moduledata_scan(pclntabVA uint64, is64bit bool, littleendian bool, ignorelist []uint64) (candidate *ModuleDataCandidate, err error)
 	read_memory(VA uint64, size uint64) (data []byte, err error)
+	sections() ([]Section, error)
+	segments() ([]Section, error)
+	entryPoint() (uint64, error)
+	importedSymbols() ([]string, error)
+	tlsCallbacks() ([]uint64, error)
+	timestamps() ([]HeaderTimestamp, error)
+	linkage() (*Linkage, error)
+	codeSignature(r io.ReaderAt) (*CodeSignature, error)
+	resources() ([]Resource, error)
 	text() (textStart uint64, text []byte, err error)
 	goarch() string
 	loadAddress() (uint64, error)
@@ -61,11 +73,17 @@ type rawFile interface {
 type File struct {
 	r       *os.File
 	entries []*Entry
+
+	mapOnce sync.Once
+	mapping *Mapping
+	mapErr  error
 }
 
 type Entry struct {
-	name string
-	raw  rawFile
+	name     string
+	raw      rawFile
+	sections sectionCache
+	file     *File // the file the section offsets are relative to, nil for the members of archives
 }
 
 // A Sym is a symbol defined in an executable file.
@@ -108,7 +126,9 @@ func Open(name string) (*File, error) {
 	}
 	for _, try := range openers {
 		if raw, err := try(r); err == nil {
-			return &File{r, []*Entry{{raw: raw}}}, nil
+			f := &File{r: r}
+			f.entries = []*Entry{{raw: raw, file: f}}
+			return f, nil
 		}
 	}
 	r.Close()
@@ -116,9 +136,27 @@ func Open(name string) (*File, error) {
 }
 
 func (f *File) Close() error {
+	f.ReleaseSections()
+	if f.mapping != nil {
+		f.mapping.Close()
+	}
 	return f.r.Close()
 }
 
+// Data is the whole content of the file, mapped on first use where the OS supports it and read otherwise. It is
+// only valid until Close, what outlives the file has to be copied.
+func (f *File) Data() ([]byte, error) {
+	f.mapOnce.Do(func() {
+		if f.mapping = mapFile(f.r); f.mapping == nil {
+			f.mapping, f.mapErr = readMapping(f.r)
+		}
+	})
+	if f.mapErr != nil {
+		return nil, f.mapErr
+	}
+	return f.mapping.Data(), nil
+}
+
 func (f *File) Entries() []*Entry {
 	return f.entries
 }
@@ -128,24 +166,28 @@ func (f *File) Symbols() ([]Sym, error) {
 }
 
 // previously : func (f *File) PCLineTable() (Liner, error) {
-func (f *File) PCLineTable(versionOverride string, knownPclntabVA uint64, knownGoTextBase uint64) (<-chan PclntabCandidate, error) {
-	return f.entries[0].PCLineTable(versionOverride, knownPclntabVA, knownGoTextBase)
+func (f *File) PCLineTable(ctx context.Context, versionOverride string, knownPclntabVA uint64, knownGoTextBase uint64) (<-chan PclntabCandidate, error) {
+	return f.entries[0].PCLineTable(ctx, versionOverride, knownPclntabVA, knownGoTextBase)
 }
 
-func (f *File) ModuleDataTable(pclntabVA uint64, runtimeVersion string, version string, is64bit bool, littleendian bool) (secStart uint64, moduleData *ModuleData, err error) {
-	return f.entries[0].ModuleDataTable(pclntabVA, runtimeVersion, version, is64bit, littleendian)
+func (f *File) ModuleDataTable(ctx context.Context, pclntabVA uint64, runtimeVersion string, version string, is64bit bool, littleendian bool) (secStart uint64, moduleData *ModuleData, err error) {
+	return f.entries[0].ModuleDataTable(ctx, pclntabVA, runtimeVersion, version, is64bit, littleendian)
 }
 
-func (f *File) ParseType(runtimeVersion string, moduleData *ModuleData, typeAddress uint64, is64bit bool, littleendian bool) (types []Type, err error) {
-	return f.entries[0].ParseType(runtimeVersion, moduleData, typeAddress, is64bit, littleendian)
+func (f *File) ParseType(ctx context.Context, runtimeVersion string, moduleData *ModuleData, typeAddress uint64, is64bit bool, littleendian bool) (types []Type, err error) {
+	return f.entries[0].ParseType(ctx, runtimeVersion, moduleData, typeAddress, is64bit, littleendian)
 }
 
-func (f *File) ParseTypeLinks(runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
-	return f.entries[0].ParseTypeLinks(runtimeVersion, moduleData, is64bit, littleendian)
+func (f *File) ParseTypeLinks(ctx context.Context, runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
+	return f.entries[0].ParseTypeLinks(ctx, runtimeVersion, moduleData, is64bit, littleendian)
 }
 
-func (f *File) ParseITabLinks(runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
-	return f.entries[0].ParseITabLinks(runtimeVersion, moduleData, is64bit, littleendian)
+func (f *File) ParseITabLinks(ctx context.Context, runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
+	return f.entries[0].ParseITabLinks(ctx, runtimeVersion, moduleData, is64bit, littleendian)
+}
+
+func (f *File) ReadPointerSizeMem(addr uint64, is64bit bool, littleendian bool) (uint64, error) {
+	return f.entries[0].ReadPointerSizeMem(addr, is64bit, littleendian)
 }
 
 func (f *File) Text() (uint64, []byte, error) {
@@ -210,7 +252,8 @@ func findAllOccurrences(data []byte, searches [][]byte) []int {
 }
 
 // previously: func (e *Entry) PCLineTable() (Liner, error)
-func (e *Entry) PCLineTable(versionOverride string, knownPclntabVA uint64, knownGoTextBase uint64) (<-chan PclntabCandidate, error) {
+// Candidates are produced until they run out or ctx is done. Callers that stop reading early must cancel ctx to release the scanners.
+func (e *Entry) PCLineTable(ctx context.Context, versionOverride string, knownPclntabVA uint64, knownGoTextBase uint64) (<-chan PclntabCandidate, error) {
 	// If the raw file implements Liner directly, use that.
 	// Currently, only Go intermediate objects and archives (goobj) use this path.
 
@@ -222,7 +265,7 @@ func (e *Entry) PCLineTable(versionOverride string, knownPclntabVA uint64, known
 	// Otherwise, read the pcln tables and build a Liner out of that.
 	// https://github.com/golang/go/blob/89f687d6dbc11613f715d1644b4983905293dd33/src/debug/gosym/pclntab.go#L169
 	// https://github.com/golang/go/issues/42954
-	ch_tab, err := e.raw.pcln()
+	ch_tab, err := e.raw.pcln(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -255,13 +298,83 @@ func (e *Entry) PCLineTable(versionOverride string, knownPclntabVA uint64, known
 
 			// the first good one happens to be correct more often than the last
 			candidate.ParsedPclntab = parsedTable
-			ch <- candidate
+			select {
+			case ch <- candidate:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	return ch, nil
 }
 
-func (e *Entry) ModuleDataTable(pclntabVA uint64, runtimeVersion string, version string, is64bit bool, littleendian bool) (secStart uint64, moduleData *ModuleData, err error) {
+// PclntabAt parses the pclntab of a previous search again, from where it was found and with the text base its
+// moduledata gave, without searching. Pclntabs read through a symtab aren't supported.
+func (f *File) PclntabAt(pclntabVA uint64, size uint64, textBase uint64, versionOverride string) (*PclntabCandidate, error) {
+	// the search may have handed out the data up to the end of the file, the table itself ends with its segment
+	pclntab, err := f.entries[0].raw.read_memory(pclntabVA, size)
+	if err != nil {
+		return nil, err
+	}
+	parsedTable, err := gosym.NewTable(nil, gosym.NewLineTable(pclntab, textBase), versionOverride)
+	if err != nil {
+		return nil, err
+	}
+	if parsedTable.Go12line == nil {
+		return nil, fmt.Errorf("no pclntab at 0x%x", pclntabVA)
+	}
+	return &PclntabCandidate{SecStart: textBase, PclntabVA: pclntabVA, Pclntab: pclntab, ParsedPclntab: parsedTable}, nil
+}
+
+// PclntabHeader returns the first pclntab candidate with a valid header, without parsing its functions. It tells a Go
+// binary and its pclntab layout as quickly as possible, but only the moduledata confirms the candidate is the one.
+func (f *File) PclntabHeader(ctx context.Context, versionOverride string) (*PclntabCandidate, error) {
+	// the section the linker names is checked first, that's a view of the file instead of a search through it
+	if sections, err := f.Sections(); err == nil {
+		for _, sec := range sections {
+			if sec.Name != ".gopclntab" && sec.Name != "__gopclntab" {
+				continue
+			}
+			if data, err := sec.Data(); err == nil {
+				lineTable := gosym.NewLineTable(data, sec.Addr)
+				if lineTable.IsGo12(versionOverride) {
+					return &PclntabCandidate{SecStart: sec.Addr, PclntabVA: sec.Addr, Pclntab: data, ParsedPclntab: &gosym.Table{Go12line: lineTable}}, nil
+				}
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch_tab, err := f.entries[0].raw.pcln(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for candidate := range ch_tab {
+		// the search also hands out copies with each magic patched in for stomped headers, only the header as found
+		// in the file tells the layout
+		if candidate.StompMagicCandidateMeta != nil || len(candidate.Pclntab) < 8 {
+			continue
+		}
+		header, err := f.entries[0].raw.read_memory(candidate.PclntabVA, 8)
+		if err != nil || !bytes.Equal(header, candidate.Pclntab[:8]) {
+			continue
+		}
+
+		lineTable := gosym.NewLineTable(candidate.Pclntab, candidate.SecStart)
+		if lineTable.IsGo12(versionOverride) {
+			candidate.ParsedPclntab = &gosym.Table{Go12line: lineTable}
+			return &candidate, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no pclntab found")
+}
+
+func (e *Entry) ModuleDataTable(ctx context.Context, pclntabVA uint64, runtimeVersion string, version string, is64bit bool, littleendian bool) (secStart uint64, moduleData *ModuleData, err error) {
 	moduleData = &ModuleData{}
 	// Major version only, 1.15.5 -> 1.15
 	parts := strings.Split(runtimeVersion, ".")
@@ -274,6 +387,10 @@ func (e *Entry) ModuleDataTable(pclntabVA uint64, runtimeVersion string, version
 	const maxattempts = 5
 	var ignorelist []uint64
 	for i := 0; i < maxattempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return 0, nil, err
+		}
+
 		// we're trying again, ignore the previous candidate
 		if moduleDataCandidate != nil {
 			ignorelist = append(ignorelist, moduleDataCandidate.ModuledataVA)
@@ -1131,8 +1248,14 @@ func typename_to_c(typename string) string {
 	return result
 }
 
-// not exhaustive, just the likely ones to be in Go
-func replace_cpp_keywords(fieldname string) string {
+// CTypeName names a Go type the way the C reconstructions do, ex: _ptr_main_T for *main.T
+func CTypeName(typename string) string {
+	return typename_to_c(typename)
+}
+
+// not exhaustive, just the likely ones to be in Go. Blank fields are named after their position, so the definitions
+// are the same from one run to the next.
+func replace_cpp_keywords(fieldname string, index int) string {
 	switch fieldname {
 	case "private":
 		fallthrough
@@ -1163,18 +1286,23 @@ func replace_cpp_keywords(fieldname string) string {
 	case "class":
 		return "_" + fieldname
 	case "_":
-		return "_anon" + fmt.Sprint(rand.Intn(1000))
+		return "_anon" + fmt.Sprint(index)
 	}
 	return fieldname
 }
 
-func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, typeAddress uint64, is64bit bool, littleendian bool, parsedTypesIn *orderedmap.OrderedMap) (*orderedmap.OrderedMap, error) {
+func (e *Entry) ParseType_impl(ctx context.Context, runtimeVersion string, moduleData *ModuleData, typeAddress uint64, is64bit bool, littleendian bool, parsedTypesIn *orderedmap.OrderedMap) (*orderedmap.OrderedMap, error) {
 	// all return paths must return the original map, even if there's an error. An empty map rather than a nil simplifies recursion and allows tail calls.
 	// exit condition: type address seen before
 	if _, exists := parsedTypesIn.Get(typeAddress); exists {
 		return parsedTypesIn, nil
 	}
 
+	// adversarial type tables can recurse for a very long time, stop when the caller gives up
+	if err := ctx.Err(); err != nil {
+		return parsedTypesIn, err
+	}
+
 	var _type *Type = nil
 
 	switch runtimeVersion {
@@ -1441,14 +1569,14 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 			return parsedTypesIn, fmt.Errorf("Failed to read Kind Array's len")
 		}
 
-		parsed, _ := e.ParseType_impl(runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
+		parsed, _ := e.ParseType_impl(ctx, runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
 		elemType, found := parsedTypesIn.Get(elemTypeAddress)
 		if found {
 			(*_type).Reconstructed = (*_type).Str // ends up being the same for an array
 			(*_type).CReconstructed = "typedef " + elemType.(Type).CStr + " " + (*_type).CStr + "[" + strconv.Itoa(int(arrayLen)) + "];"
 			parsed.Set(typeAddress, *_type)
 		}
-		return e.ParseType_impl(runtimeVersion, moduleData, sliceTypeAddress, is64bit, littleendian, parsed)
+		return e.ParseType_impl(ctx, runtimeVersion, moduleData, sliceTypeAddress, is64bit, littleendian, parsed)
 	case Chan:
 		// type chantype struct {
 		// 	typ  _type
@@ -1481,7 +1609,7 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 		// _type.Str += " Direction: (" + dir + ")"
 		// }
 
-		parsedTypesIn, err = e.ParseType_impl(runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
+		parsedTypesIn, err = e.ParseType_impl(ctx, runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
 		if err != nil {
 			return parsedTypesIn, err
 		}
@@ -1504,7 +1632,7 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 			return parsedTypesIn, fmt.Errorf("Failed to read Kind Slice's elem")
 		}
 
-		parsedTypesIn, err = e.ParseType_impl(runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
+		parsedTypesIn, err = e.ParseType_impl(ctx, runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
 		if err != nil {
 			return parsedTypesIn, err
 		}
@@ -1525,7 +1653,7 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 			return parsedTypesIn, fmt.Errorf("Failed to read Kind Pointer's elem")
 		}
 
-		parsedTypesIn, err = e.ParseType_impl(runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
+		parsedTypesIn, err = e.ParseType_impl(ctx, runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsedTypesIn)
 		if err != nil {
 			return parsedTypesIn, err
 		}
@@ -1573,9 +1701,9 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 		(*_type).CReconstructed = fmt.Sprintf("typedef void* %s", _type.CStr)
 		parsedTypesIn.Set(typeAddress, *_type)
 
-		parsed, _ := e.ParseType_impl(runtimeVersion, moduleData, keyTypeAddress, is64bit, littleendian, parsedTypesIn)
-		parsed2, _ := e.ParseType_impl(runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsed)
-		return e.ParseType_impl(runtimeVersion, moduleData, bucketTypeAddress, is64bit, littleendian, parsed2)
+		parsed, _ := e.ParseType_impl(ctx, runtimeVersion, moduleData, keyTypeAddress, is64bit, littleendian, parsedTypesIn)
+		parsed2, _ := e.ParseType_impl(ctx, runtimeVersion, moduleData, elemTypeAddress, is64bit, littleendian, parsed)
+		return e.ParseType_impl(ctx, runtimeVersion, moduleData, bucketTypeAddress, is64bit, littleendian, parsed2)
 	case Interface:
 		// type interfaceType struct {
 		// 	rtype
@@ -1614,8 +1742,9 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				methods.Capacity = uint64(tmp.Capacity)
 			}
 
-			interfaceDef := fmt.Sprintf("type %s interface {", _type.Str)
-			cinterfaceDef := fmt.Sprintf("struct %s {\n", _type.CStr)
+			interfaceDef, cinterfaceDef := getDefBuffer(), getDefBuffer()
+			fmt.Fprintf(interfaceDef, "type %s interface {", _type.Str)
+			fmt.Fprintf(cinterfaceDef, "struct %s {\n", _type.CStr)
 
 			// type imethod struct {
 			// 	name    *string // name of method
@@ -1630,7 +1759,7 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				}
 
 				typeAddr := decodePtrSizeBytes(imethoddata[ptrSize*2:ptrSize*3], is64bit, littleendian)
-				parsedTypesIn, _ = e.ParseType_impl(runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
+				parsedTypesIn, _ = e.ParseType_impl(ctx, runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
 
 				name_ptr := decodePtrSizeBytes(imethoddata[0:ptrSize], is64bit, littleendian)
 				name, err := e.readRTypeName(runtimeVersion, 0, name_ptr, is64bit, littleendian)
@@ -1640,14 +1769,15 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 
 				methodfunc, found := parsedTypesIn.Get(typeAddr)
 				if found {
-					interfaceDef += strings.Replace(methodfunc.(Type).Str, "func", name, 1) + "\n"
-					cinterfaceDef += methodfunc.(Type).CStr + " " + name + ";\n"
+					interfaceDef.WriteString(strings.Replace(methodfunc.(Type).Str, "func", name, 1))
+					interfaceDef.WriteString("\n")
+					fmt.Fprintf(cinterfaceDef, "%s %s;\n", methodfunc.(Type).CStr, name)
 				}
 			}
-			interfaceDef += "\n}"
-			cinterfaceDef += "}"
-			(*_type).Reconstructed = interfaceDef
-			(*_type).CReconstructed = cinterfaceDef
+			interfaceDef.WriteString("\n}")
+			cinterfaceDef.WriteString("}")
+			(*_type).Reconstructed = putDefBuffer(interfaceDef)
+			(*_type).CReconstructed = putDefBuffer(cinterfaceDef)
 			parsedTypesIn.Set(typeAddress, *_type)
 			return parsedTypesIn, nil
 		case "1.7":
@@ -1707,11 +1837,13 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				methods.Capacity = uint64(tmp.Capacity)
 			}
 
-			interfaceDef := "type interface {"
-			cinterfaceDef := "struct interface {\n"
+			interfaceDef, cinterfaceDef := getDefBuffer(), getDefBuffer()
 			if _type.flags&tflagNamed != 0 {
-				interfaceDef = fmt.Sprintf("type %s interface {", _type.Str)
-				cinterfaceDef = fmt.Sprintf("struct %s {\n", _type.CStr)
+				fmt.Fprintf(interfaceDef, "type %s interface {", _type.Str)
+				fmt.Fprintf(cinterfaceDef, "struct %s {\n", _type.CStr)
+			} else {
+				interfaceDef.WriteString("type interface {")
+				cinterfaceDef.WriteString("struct interface {\n")
 			}
 
 			// type imethod struct {
@@ -1732,7 +1864,7 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				}
 
 				typeAddr := moduleData.Types + uint64(method.Typ)
-				parsedTypesIn, _ = e.ParseType_impl(runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
+				parsedTypesIn, _ = e.ParseType_impl(ctx, runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
 
 				name_ptr := moduleData.Types + uint64(method.Name)
 				name, err := e.readRTypeName(runtimeVersion, 0, name_ptr, is64bit, littleendian)
@@ -1742,14 +1874,15 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 
 				methodfunc, found := parsedTypesIn.Get(typeAddr)
 				if found {
-					interfaceDef += strings.Replace(methodfunc.(Type).Str, "func", name, 1) + "\n"
-					cinterfaceDef += methodfunc.(Type).CStr + " " + name + ";\n"
+					interfaceDef.WriteString(strings.Replace(methodfunc.(Type).Str, "func", name, 1))
+					interfaceDef.WriteString("\n")
+					fmt.Fprintf(cinterfaceDef, "%s %s;\n", methodfunc.(Type).CStr, name)
 				}
 			}
-			interfaceDef += "\n}"
-			cinterfaceDef += "}"
-			(*_type).Reconstructed = interfaceDef
-			(*_type).CReconstructed = cinterfaceDef
+			interfaceDef.WriteString("\n}")
+			cinterfaceDef.WriteString("}")
+			(*_type).Reconstructed = putDefBuffer(interfaceDef)
+			(*_type).CReconstructed = putDefBuffer(cinterfaceDef)
 			parsedTypesIn.Set(typeAddress, *_type)
 			return parsedTypesIn, nil
 		}
@@ -1784,8 +1917,9 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				fields.Capacity = uint64(tmp.Capacity)
 			}
 
-			structDef := fmt.Sprintf("type %s struct {", _type.Str)
-			cstructDef := fmt.Sprintf("struct %s {\n", _type.CStr)
+			structDef, cstructDef := getDefBuffer(), getDefBuffer()
+			fmt.Fprintf(structDef, "type %s struct {", _type.Str)
+			fmt.Fprintf(cstructDef, "struct %s {\n", _type.CStr)
 
 			// type structField struct {
 			// 	name    *string // nil for embedded fields
@@ -1802,21 +1936,21 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				}
 
 				typeAddr := decodePtrSizeBytes(data[ptrSize*2:ptrSize*3], is64bit, littleendian)
-				parsedTypesIn, _ = e.ParseType_impl(runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
+				parsedTypesIn, _ = e.ParseType_impl(ctx, runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
 				field, found := parsedTypesIn.Get(typeAddr)
 				if found {
 					typeNameAddr := decodePtrSizeBytes(data[0:ptrSize], is64bit, littleendian)
 					typeName, err := e.readRTypeName(runtimeVersion, 0, typeNameAddr, is64bit, littleendian)
 					if err == nil {
-						structDef += fmt.Sprintf("\n    %-10s %s", typeName, field.(Type).Str)
-						cstructDef += fmt.Sprintf("    %-10s %s;\n", field.(Type).CStr, replace_cpp_keywords(typeName))
+						fmt.Fprintf(structDef, "\n    %-10s %s", typeName, field.(Type).Str)
+						fmt.Fprintf(cstructDef, "    %-10s %s;\n", field.(Type).CStr, replace_cpp_keywords(typeName, i))
 					}
 				}
 			}
-			structDef += "\n}"
-			cstructDef += "}"
-			(*_type).Reconstructed = structDef
-			(*_type).CReconstructed = cstructDef
+			structDef.WriteString("\n}")
+			cstructDef.WriteString("}")
+			(*_type).Reconstructed = putDefBuffer(structDef)
+			(*_type).CReconstructed = putDefBuffer(cstructDef)
 			parsedTypesIn.Set(typeAddress, *_type)
 			return parsedTypesIn, nil
 		case "1.7":
@@ -1881,11 +2015,13 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				fields.Capacity = uint64(tmp.Capacity)
 			}
 
-			structDef := "type struct {"
-			cstructDef := "struct {\n"
+			structDef, cstructDef := getDefBuffer(), getDefBuffer()
 			if _type.flags&tflagNamed != 0 {
-				structDef = fmt.Sprintf("type %s struct {", _type.Str)
-				cstructDef = fmt.Sprintf("struct %s {\n", _type.CStr)
+				fmt.Fprintf(structDef, "type %s struct {", _type.Str)
+				fmt.Fprintf(cstructDef, "struct %s {\n", _type.CStr)
+			} else {
+				structDef.WriteString("type struct {")
+				cstructDef.WriteString("struct {\n")
 			}
 
 			// type structField struct {
@@ -1902,22 +2038,22 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 				}
 
 				typeAddr := decodePtrSizeBytes(data[ptrSize:ptrSize*2], is64bit, littleendian)
-				parsedTypesIn, _ = e.ParseType_impl(runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
+				parsedTypesIn, _ = e.ParseType_impl(ctx, runtimeVersion, moduleData, typeAddr, is64bit, littleendian, parsedTypesIn)
 
 				field, found := parsedTypesIn.Get(typeAddr)
 				if found {
 					typeNameAddr := decodePtrSizeBytes(data[0:ptrSize], is64bit, littleendian)
 					typeName, err := e.readRTypeName(runtimeVersion, 0, typeNameAddr, is64bit, littleendian)
 					if err == nil {
-						structDef += fmt.Sprintf("\n    %-10s %s", typeName, field.(Type).Str)
-						cstructDef += fmt.Sprintf("    %-10s %s;\n", field.(Type).CStr, replace_cpp_keywords(typeName))
+						fmt.Fprintf(structDef, "\n    %-10s %s", typeName, field.(Type).Str)
+						fmt.Fprintf(cstructDef, "    %-10s %s;\n", field.(Type).CStr, replace_cpp_keywords(typeName, i))
 					}
 				}
 			}
-			structDef += "\n}"
-			cstructDef += "}"
-			(*_type).Reconstructed = structDef
-			(*_type).CReconstructed = cstructDef
+			structDef.WriteString("\n}")
+			cstructDef.WriteString("}")
+			(*_type).Reconstructed = putDefBuffer(structDef)
+			(*_type).CReconstructed = putDefBuffer(cstructDef)
 			parsedTypesIn.Set(typeAddress, *_type)
 			return parsedTypesIn, nil
 		}
@@ -1991,7 +2127,7 @@ func (e *Entry) ParseType_impl(runtimeVersion string, moduleData *ModuleData, ty
 	return parsedTypesIn, nil
 }
 
-func (e *Entry) ParseType(runtimeVersion string, moduleData *ModuleData, typeAddress uint64, is64bit bool, littleendian bool) (_type []Type, err error) {
+func (e *Entry) ParseType(ctx context.Context, runtimeVersion string, moduleData *ModuleData, typeAddress uint64, is64bit bool, littleendian bool) (_type []Type, err error) {
 	// Major version only, 1.15.5 -> 1.15
 	parts := strings.Split(runtimeVersion, ".")
 	if len(parts) >= 2 {
@@ -2000,7 +2136,7 @@ func (e *Entry) ParseType(runtimeVersion string, moduleData *ModuleData, typeAdd
 
 	m := orderedmap.NewOrderedMap()
 
-	parsedTypes, err := e.ParseType_impl(runtimeVersion, moduleData, typeAddress, is64bit, littleendian, m)
+	parsedTypes, err := e.ParseType_impl(ctx, runtimeVersion, moduleData, typeAddress, is64bit, littleendian, m)
 	if err != nil {
 		return nil, err
 	}
@@ -2015,7 +2151,7 @@ func (e *Entry) ParseType(runtimeVersion string, moduleData *ModuleData, typeAdd
 	return values, nil
 }
 
-func (e *Entry) ParseTypeLinks(runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
+func (e *Entry) ParseTypeLinks(ctx context.Context, runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
 	// Major version only, 1.15.5 -> 1.15
 	parts := strings.Split(runtimeVersion, ".")
 	if len(parts) >= 2 {
@@ -2031,26 +2167,23 @@ func (e *Entry) ParseTypeLinks(runtimeVersion string, moduleData *ModuleData, is
 
 	// Handle legacy layout first (1.5, 1.6). The typelinks is a pointer array
 	if moduleData.LegacyTypes.Data != 0 && moduleData.LegacyTypes.Len != 0 {
-		for i := 0; i < int(moduleData.LegacyTypes.Len); i++ {
+		return parseConcurrently(ctx, int(moduleData.LegacyTypes.Len), func(i int) []Type {
 			typeAddress, err := e.ReadPointerSizeMem(uint64(moduleData.LegacyTypes.Data)+ptrSize*uint64(i), is64bit, littleendian)
 			if err != nil {
-				continue
+				return nil
 			}
 
-			parsed, err := e.ParseType(runtimeVersion, moduleData, typeAddress, is64bit, littleendian)
-			if err == nil {
-				types = append(types, parsed...)
-			}
-		}
-		return types, nil
+			parsed, _ := e.ParseType(ctx, runtimeVersion, moduleData, typeAddress, is64bit, littleendian)
+			return parsed
+		})
 	}
 
 	// Modern layout, the typelinks is an array of offsets
-	for i := 0; i < int(moduleData.Typelinks.Len); i++ {
+	return parseConcurrently(ctx, int(moduleData.Typelinks.Len), func(i int) []Type {
 		// array of int32 offsets into moduleData.Types
 		offset, err := e.raw.read_memory(uint64(moduleData.Typelinks.Data)+uint64(i)*4, 4)
 		if err != nil {
-			continue
+			return nil
 		}
 
 		var typeAddress uint64 = 0
@@ -2062,15 +2195,90 @@ func (e *Entry) ParseTypeLinks(runtimeVersion string, moduleData *ModuleData, is
 			typeAddress = uint64(int64(moduleData.Types) + int64(offset_signed))
 		}
 
-		parsed, err := e.ParseType(runtimeVersion, moduleData, typeAddress, is64bit, littleendian)
-		if err == nil {
+		parsed, _ := e.ParseType(ctx, runtimeVersion, moduleData, typeAddress, is64bit, littleendian)
+		return parsed
+	})
+}
+
+// The definitions of structs and interfaces are written a field or method at a time, for hundreds of thousands of
+// types in a large binary. They're built in buffers reused across types rather than by concatenation, which
+// allocated a new string per field.
+var defBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+func getDefBuffer() *bytes.Buffer {
+	return defBuffers.Get().(*bytes.Buffer)
+}
+
+// putDefBuffer returns the definition written to the buffer, which goes back to the pool
+func putDefBuffer(b *bytes.Buffer) string {
+	def := b.String()
+	b.Reset()
+	defBuffers.Put(b)
+	return def
+}
+
+// parseConcurrently runs parse for each of the n entries of a typelinks or itablinks table on all CPUs. Each entry
+// is walked with its own visited set, as when walked one after the other, and the results are merged in the order of
+// the table so the output doesn't depend on scheduling. Whatever was parsed before the caller gave up is still
+// returned, in order, along with the context's error. An entry whose parse panics is left out, and the first such
+// panic is returned as the error.
+func parseConcurrently(ctx context.Context, n int, parse func(i int) []Type) ([]Type, error) {
+	results := make([][]Type, n)
+	errs := make([]error, n)
+	done := make([]bool, n)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n || ctx.Err() != nil {
+					return
+				}
+				results[i], errs[i] = parseRecovering(parse, i)
+				done[i] = ctx.Err() == nil && errs[i] == nil
+			}
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	for i, parsed := range results {
+		if done[i] {
+			count += len(parsed)
+		}
+	}
+	var types []Type
+	if count > 0 {
+		types = make([]Type, 0, count)
+	}
+	for i, parsed := range results {
+		if done[i] {
 			types = append(types, parsed...)
 		}
 	}
-	return types, nil
+	for _, err := range errs {
+		if err != nil {
+			return types, err
+		}
+	}
+	return types, ctx.Err()
+}
+
+// parseRecovering runs parse for entry i. A panic on a malformed entry becomes its error, nothing up the stack could
+// recover it from a worker goroutine.
+func parseRecovering(parse func(i int) []Type, i int) (types []Type, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			types, err = nil, fmt.Errorf("parsing entry %d panicked: %v", i, r)
+		}
+	}()
+	return parse(i), nil
 }
 
-func (e *Entry) ParseITabLinks(runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
+func (e *Entry) ParseITabLinks(ctx context.Context, runtimeVersion string, moduleData *ModuleData, is64bit bool, littleendian bool) (types []Type, err error) {
 	// Major version only, 1.15.5 -> 1.15
 	parts := strings.Split(runtimeVersion, ".")
 	if len(parts) >= 2 {
@@ -2084,20 +2292,20 @@ func (e *Entry) ParseITabLinks(runtimeVersion string, moduleData *ModuleData, is
 		ptrSize = 4
 	}
 
-	for i := 0; i < int(moduleData.ITablinks.Len); i++ {
+	return parseConcurrently(ctx, int(moduleData.ITablinks.Len), func(i int) (types []Type) {
 		itabAddr, err := e.ReadPointerSizeMem(uint64(moduleData.ITablinks.Data)+ptrSize*uint64(i), is64bit, littleendian)
 		if err != nil {
-			continue
+			return nil
 		}
 
 		interfaceAddr, err := e.ReadPointerSizeMem(itabAddr, is64bit, littleendian)
 		if err != nil {
-			continue
+			return nil
 		}
 
 		typeAddr, err := e.ReadPointerSizeMem(itabAddr+ptrSize, is64bit, littleendian)
 		if err != nil {
-			continue
+			return nil
 		}
 
 		// type itab struct {
@@ -2107,12 +2315,12 @@ func (e *Entry) ParseITabLinks(runtimeVersion string, moduleData *ModuleData, is
 		// 	_     [4]byte
 		// 	fun   [1]uintptr // variable sized. fun[0]==0 means _type does not implement inter.
 		// }
-		parsed, err := e.ParseType(runtimeVersion, moduleData, interfaceAddr, is64bit, littleendian)
+		parsed, err := e.ParseType(ctx, runtimeVersion, moduleData, interfaceAddr, is64bit, littleendian)
 		if err == nil {
 			types = append(types, parsed...)
 		}
 
-		parsed2, err2 := e.ParseType(runtimeVersion, moduleData, typeAddr, is64bit, littleendian)
+		parsed2, err2 := e.ParseType(ctx, runtimeVersion, moduleData, typeAddr, is64bit, littleendian)
 		if err2 == nil {
 			types = append(types, parsed2...)
 		}
@@ -2123,12 +2331,24 @@ func (e *Entry) ParseITabLinks(runtimeVersion string, moduleData *ModuleData, is
 			implementerName := parsed2[0].Str
 			types = append(types, Type{VA: itabAddr, Str: fmt.Sprintf("interface_%s_impl_%s", interfaceName, implementerName), Kind: Interface.String()})
 		}
-	}
-	return types, nil
+		return types
+	})
 }
 
 func (e *Entry) Text() (uint64, []byte, error) {
-	return e.raw.text()
+	// the text section, whichever the format names it
+	return e.sections.load(sectionKey{offset: ^uint64(0)}, func() (uint64, []byte, error) {
+		sections, _ := e.raw.sections()
+		for i := range sections {
+			if name := sections[i].Name; name == ".text" || name == "__text" {
+				if view, ok := e.view(&sections[i]); ok {
+					return sections[i].Addr, view, nil
+				}
+				break
+			}
+		}
+		return e.raw.text()
+	})
 }
 
 func (e *Entry) GOARCH() string {
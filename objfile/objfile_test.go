@@ -0,0 +1,62 @@
+package objfile
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// a panic in one of the parse workers comes back as the error, the other entries are still parsed in order
+func TestParseConcurrentlyPanic(t *testing.T) {
+	types, err := parseConcurrently(context.Background(), 100, func(i int) []Type {
+		if i == 42 {
+			panic("malformed type")
+		}
+		return []Type{{VA: uint64(i)}}
+	})
+	if err == nil || !strings.Contains(err.Error(), "entry 42") || !strings.Contains(err.Error(), "malformed type") {
+		t.Errorf("expected the panic of entry 42 as the error, got %v", err)
+	}
+	if len(types) != 99 {
+		t.Fatalf("expected the 99 other entries, got %d", len(types))
+	}
+	for i, typ := range types {
+		expected := uint64(i)
+		if i >= 42 {
+			expected++
+		}
+		if typ.VA != expected {
+			t.Fatalf("expected entry %d at %d, got %d", expected, i, typ.VA)
+		}
+	}
+
+	types, err = parseConcurrently(context.Background(), 3, func(i int) []Type { return []Type{{VA: uint64(i)}} })
+	if err != nil || len(types) != 3 {
+		t.Errorf("expected the 3 entries without an error, got %d: %v", len(types), err)
+	}
+}
+
+// a definition outlives its buffer, which the next type reuses
+func TestDefBuffers(t *testing.T) {
+	b := getDefBuffer()
+	fmt.Fprintf(b, "type %s struct {", "main.T")
+	b.WriteString("\n}")
+	def := putDefBuffer(b)
+
+	reused := getDefBuffer()
+	if reused.Len() != 0 {
+		t.Errorf("expected an empty buffer from the pool, got %q", reused.String())
+	}
+	reused.WriteString("struct main_U {\n}")
+	putDefBuffer(reused)
+	if def != "type main.T struct {\n}" {
+		t.Errorf("expected the definition to be kept, got %q", def)
+	}
+
+	// the merged results are allocated once
+	types, err := parseConcurrently(context.Background(), 10, func(i int) []Type { return make([]Type, i) })
+	if err != nil || len(types) != 45 || cap(types) != 45 {
+		t.Errorf("expected 45 types in a slice of that size, got %d of %d: %v", len(types), cap(types), err)
+	}
+}
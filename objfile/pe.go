@@ -10,6 +10,7 @@ package objfile
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -127,7 +128,7 @@ func (f *peFile) symbols() ([]Sym, error) {
 	return syms, nil
 }
 
-func (f *peFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
+func (f *peFile) pcln_scan(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
 	var imageBase uint64
 	switch oh := f.pe.OptionalHeader.(type) {
 	case *pe.OptionalHeader32:
@@ -176,12 +177,20 @@ func (f *peFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
 	pclntab_sigs := append(pclntab_sigs_le, pclntab_sigs_be...)
 	ch_tab := make(chan PclntabCandidate)
 
+	// the consumer stops reading once it finds a good candidate or gives up, the context unblocks us when that happens
 	send_tab := func(candidate *PclntabCandidate) {
 		if symtab_err != nil {
 			candidate.Symtab = symtab
-			ch_tab <- *candidate
+			select {
+			case ch_tab <- *candidate:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case ch_tab <- *candidate:
+		case <-ctx.Done():
 		}
-		ch_tab <- *candidate
 	}
 
 	send_patched_magic_candidates := func(candidate *PclntabCandidate) {
@@ -259,6 +268,10 @@ func (f *peFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
 
 		// 2) if not found, byte scan for it
 		for _, sec := range f.pe.Sections {
+			if ctx.Err() != nil {
+				return
+			}
+
 			// malware can split the pclntab across multiple sections, re-merge
 			data := f.pe.DataAfterSection(sec)
 
@@ -345,8 +358,8 @@ func (f *peFile) pcln_scan() (candidates <-chan PclntabCandidate, err error) {
 	return ch_tab, nil
 }
 
-func (f *peFile) pcln() (candidates <-chan PclntabCandidate, err error) {
-	candidates, err = f.pcln_scan()
+func (f *peFile) pcln(ctx context.Context) (candidates <-chan PclntabCandidate, err error) {
+	candidates, err = f.pcln_scan(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,161 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package objfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/mandiant/GoReSym/debug/pe"
+)
+
+// Resource is a leaf of the PE resource tree. Types and names are either numeric IDs or strings, IDs are kept in
+// decimal so both read the same.
+type Resource struct {
+	Type     string
+	Name     string
+	Language uint32
+	Data     []byte
+}
+
+const (
+	// a bound on the entries walked, a corrupt tree can reference itself
+	maxResources = 4096
+
+	// resources larger than this are listed without their data
+	maxResourceSize = 16 << 20
+)
+
+// Resources walks the type, name and language levels of the PE resource directory. Other formats have no resources.
+func (f *File) Resources() ([]Resource, error) {
+	return f.entries[0].raw.resources()
+}
+
+func (f *elfFile) resources() ([]Resource, error) {
+	return nil, nil
+}
+
+func (f *peFile) resources() ([]Resource, error) {
+	var directory pe.DataDirectory
+	var imageBase uint64
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			directory = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+		imageBase = uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			directory = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+		imageBase = oh.ImageBase
+	default:
+		return nil, fmt.Errorf("pe file format not recognized")
+	}
+	if directory.VirtualAddress == 0 || directory.Size == 0 {
+		return nil, nil
+	}
+
+	// offsets within the tree are relative to its start, the data entries hold RVAs
+	tree, err := f.read_memory(imageBase+uint64(directory.VirtualAddress), uint64(directory.Size))
+	if err != nil {
+		return nil, fmt.Errorf("reading resource directory: %w", err)
+	}
+
+	// entries with the high bit set in their name point to a length prefixed UTF-16 string
+	entryName := func(value uint32) string {
+		if value&0x80000000 == 0 {
+			return strconv.FormatUint(uint64(value), 10)
+		}
+		offset := uint64(value &^ 0x80000000)
+		if offset+2 > uint64(len(tree)) {
+			return ""
+		}
+		length := uint64(binary.LittleEndian.Uint16(tree[offset:]))
+		if offset+2+2*length > uint64(len(tree)) {
+			return ""
+		}
+		chars := make([]uint16, length)
+		for i := range chars {
+			chars[i] = binary.LittleEndian.Uint16(tree[offset+2+2*uint64(i):])
+		}
+		return string(utf16.Decode(chars))
+	}
+
+	// entries returns the name and offset of the entries of the directory at offset, the high bit of the offset set
+	// for subdirectories
+	type entry struct {
+		name   uint32
+		offset uint32
+	}
+	entries := func(offset uint32) ([]entry, error) {
+		if uint64(offset)+16 > uint64(len(tree)) {
+			return nil, fmt.Errorf("resource directory at 0x%x is truncated", offset)
+		}
+		count := uint64(binary.LittleEndian.Uint16(tree[offset+12:])) + uint64(binary.LittleEndian.Uint16(tree[offset+14:]))
+		if uint64(offset)+16+8*count > uint64(len(tree)) {
+			return nil, fmt.Errorf("resource directory at 0x%x is truncated", offset)
+		}
+		var found []entry
+		for i := uint64(0); i < count; i++ {
+			at := uint64(offset) + 16 + 8*i
+			found = append(found, entry{binary.LittleEndian.Uint32(tree[at:]), binary.LittleEndian.Uint32(tree[at+4:])})
+		}
+		return found, nil
+	}
+
+	var resources []Resource
+	types, err := entries(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, typ := range types {
+		if typ.offset&0x80000000 == 0 {
+			continue
+		}
+		names, err := entries(typ.offset &^ 0x80000000)
+		if err != nil {
+			return resources, err
+		}
+		for _, name := range names {
+			if name.offset&0x80000000 == 0 {
+				continue
+			}
+			languages, err := entries(name.offset &^ 0x80000000)
+			if err != nil {
+				return resources, err
+			}
+			for _, language := range languages {
+				if len(resources) >= maxResources {
+					return resources, fmt.Errorf("more than %d resources", maxResources)
+				}
+				// IMAGE_RESOURCE_DATA_ENTRY: OffsetToData, Size, CodePage and Reserved
+				if language.offset&0x80000000 != 0 || uint64(language.offset)+16 > uint64(len(tree)) {
+					continue
+				}
+				rva := binary.LittleEndian.Uint32(tree[language.offset:])
+				size := binary.LittleEndian.Uint32(tree[language.offset+4:])
+
+				resource := Resource{Type: entryName(typ.name), Name: entryName(name.name), Language: language.name}
+				if size <= maxResourceSize {
+					data, err := f.read_memory(imageBase+uint64(rva), uint64(size))
+					if err != nil {
+						return resources, fmt.Errorf("reading resource %s/%s: %w", resource.Type, resource.Name, err)
+					}
+					resource.Data = data
+				}
+				resources = append(resources, resource)
+			}
+		}
+	}
+	return resources, nil
+}
+
+func (f *machoFile) resources() ([]Resource, error) {
+	return nil, nil
+}
+
+func (f *goobjFile) resources() ([]Resource, error) {
+	return nil, fmt.Errorf("resources not available in go object file")
+}
@@ -0,0 +1,274 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package objfile
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mandiant/GoReSym/debug/elf"
+	"github.com/mandiant/GoReSym/debug/macho"
+	"github.com/mandiant/GoReSym/debug/pe"
+)
+
+// A Section is a format independent view of a section header. The data is only read when asked for.
+type Section struct {
+	Name       string
+	Addr       uint64 // virtual address
+	Size       uint64 // size once mapped into memory
+	Offset     uint64 // file offset of the section data
+	FileSize   uint64 // bytes backed by the file, 0 for bss-like sections
+	Readable   bool
+	Writable   bool
+	Executable bool
+
+	data   func() ([]byte, error)
+	reader io.ReaderAt // nil when the data has to be decoded, such as compressed ELF sections
+}
+
+func (s *Section) Data() ([]byte, error) {
+	if s.FileSize == 0 || s.data == nil {
+		return nil, fmt.Errorf("section %s has no data in the file", s.Name)
+	}
+	return s.data()
+}
+
+// ReadAt reads the section data at the offset without the rest of the section, for scanning large sections a
+// piece at a time. Sections that can't be read in place are read whole.
+func (s *Section) ReadAt(p []byte, off int64) (int, error) {
+	if s.FileSize == 0 || s.data == nil {
+		return 0, fmt.Errorf("section %s has no data in the file", s.Name)
+	}
+	if s.reader != nil {
+		return s.reader.ReadAt(p, off)
+	}
+
+	data, err := s.data()
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 || off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Contains reports if the virtual address is within the file backed part of the section
+func (s *Section) Contains(VA uint64) bool {
+	return VA >= s.Addr && VA-s.Addr < s.FileSize
+}
+
+func (f *File) Sections() ([]Section, error) {
+	return f.entries[0].Sections()
+}
+
+func (f *File) ReadMemory(VA uint64, size uint64) ([]byte, error) {
+	return f.entries[0].ReadMemory(VA, size)
+}
+
+func (e *Entry) Sections() ([]Section, error) {
+	sections, err := e.raw.sections()
+	for i := range sections {
+		if view, ok := e.view(&sections[i]); ok {
+			sections[i].data = func() ([]byte, error) { return view, nil }
+		} else if read := sections[i].data; read != nil {
+			key := sectionKey{name: sections[i].Name, offset: sections[i].Offset}
+			sections[i].data = func() ([]byte, error) {
+				_, data, err := e.sections.load(key, func() (uint64, []byte, error) {
+					data, err := read()
+					return 0, data, err
+				})
+				return data, err
+			}
+		}
+	}
+	return sections, err
+}
+
+// view returns the section data as a read-only slice of the mapped file, so every analyzer reading the section
+// shares the same pages instead of a copy. It is false for sections that are decoded, such as compressed ELF
+// sections, and for the members of archives, those are read and cached. The view is only valid until Close.
+func (e *Entry) view(s *Section) ([]byte, bool) {
+	if e.file == nil || s.reader == nil || s.FileSize == 0 {
+		return nil, false
+	}
+	data, err := e.file.Data()
+	end := s.Offset + s.FileSize
+	if err != nil || end < s.Offset || end > uint64(len(data)) {
+		return nil, false
+	}
+	return data[s.Offset:end:end], true
+}
+
+// sectionCache holds the section data the analyzers asked for. Nothing is read until requested, then the data is
+// shared by the analyzers scanning the same sections, such as .text and .rodata, until released. It must not be
+// modified.
+type sectionCache struct {
+	lock  sync.Mutex
+	datas map[sectionKey]sectionData
+}
+
+type sectionKey struct {
+	name   string
+	offset uint64
+}
+
+type sectionData struct {
+	addr uint64
+	data []byte
+}
+
+func (c *sectionCache) load(key sectionKey, read func() (uint64, []byte, error)) (uint64, []byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cached, ok := c.datas[key]; ok {
+		return cached.addr, cached.data, nil
+	}
+	addr, data, err := read()
+	if err != nil {
+		return addr, data, err
+	}
+	if c.datas == nil {
+		c.datas = make(map[sectionKey]sectionData)
+	}
+	c.datas[key] = sectionData{addr: addr, data: data}
+	return addr, data, nil
+}
+
+// release drops the data read so far, for the garbage collector to free once the analyzers holding it are done.
+// Later requests read it again.
+func (c *sectionCache) release() {
+	c.lock.Lock()
+	c.datas = nil
+	c.lock.Unlock()
+}
+
+// ReleaseSections drops the section data read so far, see sectionCache
+func (f *File) ReleaseSections() {
+	for _, e := range f.entries {
+		e.sections.release()
+	}
+}
+
+// ReadMemory reads up to size bytes at the virtual address, the result is shorter if the containing section ends first
+func (e *Entry) ReadMemory(VA uint64, size uint64) ([]byte, error) {
+	return e.raw.read_memory(VA, size)
+}
+
+func (f *elfFile) sections() ([]Section, error) {
+	var sections []Section
+	for _, sec := range f.elf.Sections {
+		if sec.Type == elf.SHT_NULL {
+			continue
+		}
+
+		s := Section{
+			Name:       sec.Name,
+			Addr:       sec.Addr,
+			Size:       sec.Size,
+			Offset:     sec.Offset,
+			FileSize:   sec.Size,
+			Readable:   sec.Flags&elf.SHF_ALLOC != 0,
+			Writable:   sec.Flags&elf.SHF_WRITE != 0,
+			Executable: sec.Flags&elf.SHF_EXECINSTR != 0,
+			data:       sec.Data,
+			reader:     sec.ReaderAt,
+		}
+		if sec.Type == elf.SHT_NOBITS {
+			s.FileSize = 0
+		}
+		sections = append(sections, s)
+	}
+	return sections, nil
+}
+
+func (f *peFile) sections() ([]Section, error) {
+	var imageBase uint64
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase = uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		imageBase = oh.ImageBase
+	default:
+		return nil, fmt.Errorf("pe file format not recognized")
+	}
+
+	const (
+		IMAGE_SCN_MEM_EXECUTE = 0x20000000
+		IMAGE_SCN_MEM_READ    = 0x40000000
+		IMAGE_SCN_MEM_WRITE   = 0x80000000
+	)
+
+	var sections []Section
+	for _, sec := range f.pe.Sections {
+		sections = append(sections, Section{
+			Name:       sec.Name,
+			Addr:       imageBase + uint64(sec.VirtualAddress),
+			Size:       uint64(sec.VirtualSize),
+			Offset:     uint64(sec.Offset),
+			FileSize:   uint64(sec.Size),
+			Readable:   sec.Characteristics&IMAGE_SCN_MEM_READ != 0,
+			Writable:   sec.Characteristics&IMAGE_SCN_MEM_WRITE != 0,
+			Executable: sec.Characteristics&IMAGE_SCN_MEM_EXECUTE != 0,
+			data:       sec.Data,
+			reader:     sec.ReaderAt,
+		})
+	}
+	return sections, nil
+}
+
+func (f *machoFile) sections() ([]Section, error) {
+	const (
+		VM_PROT_READ    = 0x1
+		VM_PROT_WRITE   = 0x2
+		VM_PROT_EXECUTE = 0x4
+
+		S_ZEROFILL              = 0x1
+		S_GB_ZEROFILL           = 0xc
+		S_THREAD_LOCAL_ZEROFILL = 0x12
+
+		S_ATTR_PURE_INSTRUCTIONS = 0x80000000
+		S_ATTR_SOME_INSTRUCTIONS = 0x400
+	)
+
+	// sections don't carry permissions, their segment does
+	segmentProt := make(map[string]uint32)
+	for _, load := range f.macho.Loads {
+		if seg, ok := load.(*macho.Segment); ok {
+			segmentProt[seg.Name] = seg.Prot
+		}
+	}
+
+	var sections []Section
+	for _, sec := range f.macho.Sections {
+		prot := segmentProt[sec.Seg]
+		s := Section{
+			Name:       sec.Name,
+			Addr:       sec.Addr,
+			Size:       sec.Size,
+			Offset:     uint64(sec.Offset),
+			FileSize:   sec.Size,
+			Readable:   prot&VM_PROT_READ != 0,
+			Writable:   prot&VM_PROT_WRITE != 0,
+			// __TEXT holds read-only data like __rodata too, only sections flagged as code are executable
+			Executable: prot&VM_PROT_EXECUTE != 0 && sec.Flags&(S_ATTR_PURE_INSTRUCTIONS|S_ATTR_SOME_INSTRUCTIONS) != 0,
+			data:       sec.Data,
+			reader:     sec.ReaderAt,
+		}
+
+		switch sec.Flags & 0xff {
+		case S_ZEROFILL, S_GB_ZEROFILL, S_THREAD_LOCAL_ZEROFILL:
+			s.FileSize = 0
+		}
+		sections = append(sections, s)
+	}
+	return sections, nil
+}
+
+func (f *goobjFile) sections() ([]Section, error) {
+	return nil, fmt.Errorf("sections not available in go object file")
+}
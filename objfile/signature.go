@@ -0,0 +1,137 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package objfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/mandiant/GoReSym/debug/pe"
+)
+
+// CodeSignature is the signature embedded in a PE or Mach-O file, Data is nil when the file is unsigned
+type CodeSignature struct {
+	Format string // authenticode or codesign
+	Data   []byte // the PKCS#7 SignedData of an authenticode signature, the SuperBlob of a Mach-O one
+
+	// authenticode only, the file ranges the hash skips: the checksum, the certificate table entry of the data
+	// directory and the certificate table itself
+	Excluded []FileRange
+}
+
+type FileRange struct {
+	Offset uint64
+	Size   uint64
+}
+
+// the largest signature read, real ones are a few KB, or a few hundred KB for Mach-O files with many pages
+const maxSignatureSize = 64 << 20
+
+// CodeSignature returns the Authenticode signature of PE files and the code signature of Mach-O files. ELF files have
+// no standard signature and return nil.
+func (f *File) CodeSignature() (*CodeSignature, error) {
+	return f.entries[0].raw.codeSignature(f.r)
+}
+
+func (f *elfFile) codeSignature(r io.ReaderAt) (*CodeSignature, error) {
+	return nil, nil
+}
+
+func (f *peFile) codeSignature(r io.ReaderAt) (*CodeSignature, error) {
+	const (
+		WIN_CERT_TYPE_PKCS_SIGNED_DATA = 2
+
+		checksumOffset   = 64  // in the optional header
+		dataDirOffset32  = 96  // in the optional header of PE32
+		dataDirOffset64  = 112 // in the optional header of PE32+
+		fileHeaderSize   = 20
+		dataDirEntrySize = 8
+	)
+
+	signature := &CodeSignature{Format: "authenticode"}
+
+	var directories []pe.DataDirectory
+	var dataDirOffset uint64
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		directories = oh.DataDirectory[:min(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+		dataDirOffset = dataDirOffset32
+	case *pe.OptionalHeader64:
+		directories = oh.DataDirectory[:min(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+		dataDirOffset = dataDirOffset64
+	default:
+		return nil, fmt.Errorf("pe file format not recognized")
+	}
+	if pe.IMAGE_DIRECTORY_ENTRY_SECURITY >= len(directories) {
+		return signature, nil
+	}
+
+	// the certificate table is the one directory whose address is a file offset rather than an RVA
+	table := directories[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+	if table.VirtualAddress == 0 || table.Size == 0 {
+		return signature, nil
+	}
+	if table.Size > maxSignatureSize {
+		return signature, fmt.Errorf("certificate table of %d bytes is too large", table.Size)
+	}
+
+	var lfanew [4]byte
+	if _, err := r.ReadAt(lfanew[:], 0x3c); err != nil {
+		return signature, fmt.Errorf("reading DOS header: %w", err)
+	}
+	optionalHeader := uint64(binary.LittleEndian.Uint32(lfanew[:])) + 4 + fileHeaderSize
+	signature.Excluded = []FileRange{
+		{optionalHeader + checksumOffset, 4},
+		{optionalHeader + dataDirOffset + pe.IMAGE_DIRECTORY_ENTRY_SECURITY*dataDirEntrySize, dataDirEntrySize},
+		{uint64(table.VirtualAddress), uint64(table.Size)},
+	}
+
+	data := make([]byte, table.Size)
+	if _, err := r.ReadAt(data, int64(table.VirtualAddress)); err != nil {
+		return signature, fmt.Errorf("reading certificate table: %w", err)
+	}
+
+	// WIN_CERTIFICATE entries are 8 byte aligned, the signature is the first holding PKCS#7 SignedData
+	for len(data) >= 8 {
+		length := binary.LittleEndian.Uint32(data)
+		certificateType := binary.LittleEndian.Uint16(data[6:])
+		if length < 8 || uint64(length) > uint64(len(data)) {
+			return signature, fmt.Errorf("certificate table entry of %d bytes is malformed", length)
+		}
+		if certificateType == WIN_CERT_TYPE_PKCS_SIGNED_DATA {
+			signature.Data = data[8:length]
+			return signature, nil
+		}
+		data = data[min(uint64(len(data)), (uint64(length)+7)&^7):]
+	}
+	return signature, nil
+}
+
+func (f *machoFile) codeSignature(r io.ReaderAt) (*CodeSignature, error) {
+	const LC_CODE_SIGNATURE = 0x1d
+
+	signature := &CodeSignature{Format: "codesign"}
+	bo := f.macho.ByteOrder
+	for _, load := range f.macho.Loads {
+		raw := load.Raw()
+		if len(raw) < 16 || bo.Uint32(raw) != LC_CODE_SIGNATURE {
+			continue
+		}
+
+		offset, size := bo.Uint32(raw[8:]), bo.Uint32(raw[12:])
+		if size > maxSignatureSize {
+			return signature, fmt.Errorf("code signature of %d bytes is too large", size)
+		}
+		signature.Data = make([]byte, size)
+		if _, err := r.ReadAt(signature.Data, int64(offset)); err != nil {
+			signature.Data = nil
+			return signature, fmt.Errorf("reading code signature: %w", err)
+		}
+		return signature, nil
+	}
+	return signature, nil
+}
+
+func (f *goobjFile) codeSignature(r io.ReaderAt) (*CodeSignature, error) {
+	return nil, fmt.Errorf("code signature not available in go object file")
+}
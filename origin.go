@@ -0,0 +1,182 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+	"github.com/mandiant/GoReSym/runtime/debug"
+)
+
+// Where the code of a function or type comes from, -origin keeps the listed ones
+const (
+	originUser       = "user"       // the main module
+	originDependency = "dependency" // third-party modules, vendored or not
+	originStdlib     = "stdlib"     // the standard library and the code the toolchain generates
+)
+
+var origins = []string{originUser, originDependency, originStdlib}
+
+// The types every package can name without a qualifier
+var predeclaredTypes = map[string]bool{
+	"bool": true, "byte": true, "complex64": true, "complex128": true, "error": true, "float32": true, "float64": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true, "rune": true, "string": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true, "unsafe.Pointer": true,
+}
+
+// originClassifier tells the packages of the main module from the dependencies and the standard library
+type originClassifier struct {
+	main string // the main module path, or the project inferred from the source path of main.main
+	deps []string
+}
+
+// newOriginClassifier takes the modules from the build info. Binaries built without modules have none, the project
+// is then the GOPATH directory of main.main: the repository for code hosts, ex: github.com/docker/libnetwork for
+// /go/src/github.com/docker/libnetwork/cmd/proxy/main.go.
+func newOriginClassifier(info debug.BuildInfo, tab *gosym.Table) originClassifier {
+	classifier := originClassifier{main: info.Main.Path}
+	for _, dep := range info.Deps {
+		if dep != nil {
+			classifier.deps = append(classifier.deps, dep.Path)
+		}
+	}
+	if classifier.main != "" || tab == nil {
+		return classifier
+	}
+
+	fn := tab.LookupFunc("main.main")
+	if fn == nil {
+		return classifier
+	}
+	file, _, _ := tab.PCToLine(fn.Entry)
+	file = strings.ReplaceAll(file, `\`, "/")
+	i := strings.LastIndex(file, "/src/")
+	if i == -1 {
+		return classifier
+	}
+	dir := file[i+len("/src/"):]
+	dir = dir[:max(strings.LastIndex(dir, "/"), 0)]
+	parts := strings.Split(dir, "/")
+	if len(parts) >= 3 && (parts[0] == "github.com" || parts[0] == "gitlab.com" || parts[0] == "bitbucket.org") {
+		dir = strings.Join(parts[:3], "/")
+	}
+	if dir != "" && !isStdlibPath(dir) {
+		classifier.main = dir
+	}
+	return classifier
+}
+
+// packageOrigin classifies a package path: the longest module path it belongs to decides between the main module and
+// a dependency nested in it, vendored packages are dependencies, and packages outside every module are standard when
+// their first element has no dot, like isStdlibPath, or dependencies when it names a host.
+func (c originClassifier) packageOrigin(pkg string) string {
+	switch {
+	case pkg == "":
+		// generated code without a package, such as type..eq functions, and Go 1.18 go. packages
+		return originStdlib
+	case pkg == "main":
+		return originUser
+	case strings.HasPrefix(pkg, "vendor/"):
+		// the standard library's copy of golang.org/x
+		return originStdlib
+	case strings.Contains(pkg, "/vendor/"):
+		return originDependency
+	}
+
+	origin, longest := "", -1
+	if c.main != "" && packageMatches(pkg, c.main) {
+		origin, longest = originUser, len(c.main)
+	}
+	for _, dep := range c.deps {
+		if len(dep) > longest && packageMatches(pkg, dep) {
+			origin, longest = originDependency, len(dep)
+		}
+	}
+	switch {
+	case origin != "":
+		return origin
+	case isStdlibPath(pkg):
+		return originStdlib
+	case strings.Contains(strings.SplitN(pkg, "/", 2)[0], "."):
+		return originDependency
+	}
+	// a module or GOPATH project without a host, ex: tool/internal/config
+	return originUser
+}
+
+// typeOrigin classifies a type by the packages ending with its qualifier, since type names only hold the last
+// element of their package path. It's left empty when those packages disagree, and for unnamed composite types.
+func typeOrigin(name string, qualifiers map[string]string) string {
+	if predeclaredTypes[strings.TrimLeft(name, "*[]0123456789")] {
+		return originStdlib
+	}
+	qualifier := typePackage(name)
+	if qualifier == "" {
+		return ""
+	}
+	return qualifiers[qualifier]
+}
+
+// annotateOrigins sets the Origin of every function and type. Qualifiers map the last element of each package path
+// to its origin, ambiguous ones to nothing.
+func annotateOrigins(metadata *ExtractMetadata, tab *gosym.Table) {
+	classifier := newOriginClassifier(metadata.BuildInfo, tab)
+
+	packages := make(map[string]string)
+	qualifiers := make(map[string]string)
+	classify := func(pkg string) string {
+		origin, ok := packages[pkg]
+		if !ok {
+			origin = classifier.packageOrigin(pkg)
+			packages[pkg] = origin
+			if pkg != "" {
+				qualifier := decodePercentEscapes(pkg[strings.LastIndex(pkg, "/")+1:])
+				if previous, seen := qualifiers[qualifier]; !seen {
+					qualifiers[qualifier] = origin
+				} else if previous != origin {
+					qualifiers[qualifier] = ""
+				}
+			}
+		}
+		return origin
+	}
+
+	if tab != nil {
+		for _, fn := range tab.Funcs {
+			classify(fn.PackageName())
+		}
+	}
+	for i := range metadata.UserFunctions {
+		metadata.UserFunctions[i].Origin = classify(metadata.UserFunctions[i].PackageName)
+	}
+	for i := range metadata.StdFunctions {
+		metadata.StdFunctions[i].Origin = classify(metadata.StdFunctions[i].PackageName)
+	}
+	// main is always the user's, whatever other packages named main are
+	qualifiers["main"] = originUser
+
+	for _, types := range [][]objfile.Type{metadata.Types, metadata.Interfaces} {
+		for i := range types {
+			types[i].Origin = typeOrigin(types[i].Str, qualifiers)
+		}
+	}
+}
+
+// parseOrigins reads the comma separated origins of -origin
+func parseOrigins(list string) (map[string]bool, error) {
+	keep := make(map[string]bool)
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimSpace(origin)
+		valid := false
+		for _, known := range origins {
+			valid = valid || origin == known
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown origin %s, expected %s", origin, strings.Join(origins, ", "))
+		}
+		keep[origin] = true
+	}
+	return keep, nil
+}
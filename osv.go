@@ -0,0 +1,309 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Vulnerability is a known vulnerability of a module version the binary was built from, or of its Go release
+type Vulnerability struct {
+	ID            string
+	Aliases       []string `json:",omitempty"` // CVE and GHSA identifiers
+	Summary       string   `json:",omitempty"`
+	Module        string   // stdlib for the Go release itself
+	Version       string
+	Fixed         string   `json:",omitempty"` // the first version fixing it, if any
+	LinkedSymbols []string `json:",omitempty"` // the affected functions found among the recovered functions
+}
+
+// The parts of the OSV schema used for matching, see https://ossf.github.io/osv-schema/
+type osvEntry struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases"`
+	Summary   string   `json:"summary"`
+	Withdrawn string   `json:"withdrawn"`
+	Affected  []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced   string `json:"introduced"`
+				Fixed        string `json:"fixed"`
+				LastAffected string `json:"last_affected"`
+			} `json:"events"`
+		} `json:"ranges"`
+		Versions          []string `json:"versions"`
+		EcosystemSpecific struct {
+			Imports []struct {
+				Path    string   `json:"path"`
+				Symbols []string `json:"symbols"`
+			} `json:"imports"`
+		} `json:"ecosystem_specific"`
+	} `json:"affected"`
+}
+
+// osvDatabase holds the Go entries of an OSV snapshot by module path
+type osvDatabase map[string][]*osvEntry
+
+// loadOSV reads an OSV snapshot, either the zip of an ecosystem export such as
+// https://osv-vulnerabilities.storage.googleapis.com/Go/all.zip or a directory of OSV JSON files
+func loadOSV(path string) (osvDatabase, error) {
+	db := make(osvDatabase)
+	add := func(name string, r io.Reader) error {
+		var entry osvEntry
+		if err := json.NewDecoder(r).Decode(&entry); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if entry.Withdrawn != "" {
+			return nil
+		}
+
+		modules := make(map[string]bool)
+		for _, affected := range entry.Affected {
+			if affected.Package.Ecosystem == "Go" && !modules[affected.Package.Name] {
+				modules[affected.Package.Name] = true
+				db[affected.Package.Name] = append(db[affected.Package.Name], &entry)
+			}
+		}
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(name) != ".json" {
+				return err
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return add(name, f)
+		})
+		return db, err
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if filepath.Ext(file.Name) != ".json" {
+			continue
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = add(file.Name, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// match reports the vulnerabilities of every dependency version and of the Go release the binary was built with.
+// Replaced modules are matched with the module and version that replaced them, which is the code that was built.
+func (db osvDatabase) match(metadata ExtractMetadata) []Vulnerability {
+	functions := make(map[string]bool)
+	for _, fn := range append(metadata.UserFunctions, metadata.StdFunctions...) {
+		functions[fn.FullName] = true
+	}
+
+	var vulns []Vulnerability
+	check := func(module string, version string) {
+		if version == "" || version == "(devel)" {
+			return
+		}
+		for _, entry := range db[module] {
+			if vuln, ok := entry.affects(module, version, functions); ok {
+				vulns = append(vulns, vuln)
+			}
+		}
+	}
+
+	if goVersion := goSemver(metadata.Version); goVersion != "" {
+		check("stdlib", goVersion)
+	}
+	check(metadata.BuildInfo.Main.Path, metadata.BuildInfo.Main.Version)
+	for _, dep := range metadata.BuildInfo.Deps {
+		if dep.Replace != nil {
+			check(dep.Replace.Path, dep.Replace.Version)
+		} else {
+			check(dep.Path, dep.Version)
+		}
+	}
+
+	sort.SliceStable(vulns, func(i, j int) bool {
+		if vulns[i].Module != vulns[j].Module {
+			return vulns[i].Module < vulns[j].Module
+		}
+		return vulns[i].ID < vulns[j].ID
+	})
+	return vulns
+}
+
+// goSemver turns a Go release such as go1.21.3 or go1.22rc1 into the semantic version OSV uses, 1.22.0-rc.1
+func goSemver(version string) string {
+	version, _, _ = strings.Cut(strings.TrimPrefix(version, "go"), " ")
+	for _, pre := range []string{"rc", "beta"} {
+		if release, n, found := strings.Cut(version, pre); found {
+			if strings.Count(release, ".") == 1 {
+				release += ".0"
+			}
+			return release + "-" + pre + "." + n
+		}
+	}
+	return version
+}
+
+func (entry *osvEntry) affects(module string, version string, functions map[string]bool) (Vulnerability, bool) {
+	vuln := Vulnerability{ID: entry.ID, Aliases: entry.Aliases, Summary: entry.Summary, Module: module, Version: version}
+
+	affected := false
+	for _, a := range entry.Affected {
+		if a.Package.Ecosystem != "Go" || a.Package.Name != module {
+			continue
+		}
+
+		for _, v := range a.Versions {
+			if compareSemver(v, version) == 0 {
+				affected = true
+			}
+		}
+
+		// events are sorted, each introduced version opens a range that the next fixed or last_affected closes
+		for _, r := range a.Ranges {
+			if r.Type != "SEMVER" {
+				continue
+			}
+			inRange := false
+			for _, event := range r.Events {
+				switch {
+				case event.Introduced != "":
+					inRange = event.Introduced == "0" || compareSemver(version, event.Introduced) >= 0
+				case event.Fixed != "" && inRange:
+					if compareSemver(version, event.Fixed) < 0 {
+						affected = true
+						vuln.Fixed = event.Fixed
+					}
+					inRange = false
+				case event.LastAffected != "" && inRange:
+					if compareSemver(version, event.LastAffected) <= 0 {
+						affected = true
+					}
+					inRange = false
+				}
+			}
+			if inRange {
+				affected = true
+			}
+		}
+
+		for _, imp := range a.EcosystemSpecific.Imports {
+			for _, symbol := range imp.Symbols {
+				// methods are listed as Type.Method, the pclntab names pointer receivers (*Type).Method
+				names := []string{imp.Path + "." + symbol}
+				if typeName, method, isMethod := strings.Cut(symbol, "."); isMethod {
+					names = append(names, imp.Path+".(*"+typeName+")."+method)
+				}
+				for _, name := range names {
+					if functions[name] {
+						vuln.LinkedSymbols = append(vuln.LinkedSymbols, name)
+					}
+				}
+			}
+		}
+	}
+	return vuln, affected
+}
+
+// compareSemver orders semantic versions with or without the leading v, including Go pseudo-versions, which are
+// pre-releases. Returns -1, 0 or 1.
+func compareSemver(a string, b string) int {
+	parse := func(v string) (core []int, pre []string) {
+		v = strings.TrimPrefix(v, "v")
+		v, _, _ = strings.Cut(v, "+")
+		v, prerelease, hasPre := strings.Cut(v, "-")
+		for _, part := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(part)
+			core = append(core, n)
+		}
+		for len(core) < 3 {
+			core = append(core, 0)
+		}
+		if hasPre {
+			pre = strings.Split(prerelease, ".")
+		}
+		return core, pre
+	}
+
+	coreA, preA := parse(a)
+	coreB, preB := parse(b)
+	for i := 0; i < 3; i++ {
+		if coreA[i] != coreB[i] {
+			return sign(coreA[i] - coreB[i])
+		}
+	}
+
+	// a release is newer than its pre-releases
+	switch {
+	case preA == nil && preB == nil:
+		return 0
+	case preA == nil:
+		return 1
+	case preB == nil:
+		return -1
+	}
+
+	for i := 0; i < len(preA) && i < len(preB); i++ {
+		numA, errA := strconv.Atoi(preA[i])
+		numB, errB := strconv.Atoi(preB[i])
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				return sign(numA - numB)
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(preA[i], preB[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(preA) - len(preB))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
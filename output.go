@@ -0,0 +1,233 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// An atomicFile collects output in a temporary file next to its destination and only renames it into place
+// once everything was written. Readers of the destination never see a half written file, even if GoReSym is
+// interrupted or crashes, they see either the previous file or the complete new one.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func createAtomicFile(path string) (*atomicFile, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: tmpFile, path: path}, nil
+}
+
+// Commit moves the written data into place
+func (f *atomicFile) Commit() error {
+	if err := f.File.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	// CreateTemp makes the file readable by the owner only, match what os.Create would have done
+	os.Chmod(f.File.Name(), 0644)
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort discards the written data, the destination is left untouched
+func (f *atomicFile) Abort() {
+	f.File.Close()
+	os.Remove(f.File.Name())
+}
+
+// writeJSON writes data indented like DataToJson, without holding the whole encoding in memory: the fields of
+// structs and the elements of slices are encoded one at a time, so the largest piece held is a single function,
+// type or string rather than all of them.
+func writeJSON(w io.Writer, data interface{}) error {
+	buffered := bufio.NewWriter(w)
+	if err := streamJSON(buffered, reflect.ValueOf(data), "", false); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// writeJSONLine writes data on one line like DataToJsonLine, streamed like writeJSON
+func writeJSONLine(w io.Writer, data interface{}) error {
+	buffered := bufio.NewWriter(w)
+	if err := streamJSON(buffered, reflect.ValueOf(data), "", true); err != nil {
+		return err
+	}
+	buffered.WriteByte('\n')
+	return buffered.Flush()
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// streamJSON writes v indented, or on one line when compact
+func streamJSON(w *bufio.Writer, v reflect.Value, indent string, compact bool) error {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) && !v.IsNil() && !hasJSONMarshaler(v.Type()) {
+		v = v.Elem()
+	}
+	if !v.IsValid() || hasJSONMarshaler(v.Type()) {
+		return marshalJSON(w, v, indent, compact)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() || v.Len() == 0 || v.Type().Elem().Kind() == reflect.Uint8 {
+			return marshalJSON(w, v, indent, compact)
+		}
+		w.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			jsonNewline(w, indent+"    ", compact)
+			if err := streamJSON(w, v.Index(i), indent+"    ", compact); err != nil {
+				return err
+			}
+		}
+		jsonNewline(w, indent, compact)
+		w.WriteByte(']')
+		return nil
+	case reflect.Struct:
+		fields, ok := jsonFields(v)
+		if !ok {
+			return marshalJSON(w, v, indent, compact)
+		}
+		if len(fields) == 0 {
+			w.WriteString("{}")
+			return nil
+		}
+		w.WriteByte('{')
+		for i, field := range fields {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			jsonNewline(w, indent+"    ", compact)
+			key, _ := json.Marshal(field.name)
+			w.Write(key)
+			if compact {
+				w.WriteByte(':')
+			} else {
+				w.WriteString(": ")
+			}
+			if err := streamJSON(w, field.value, indent+"    ", compact); err != nil {
+				return err
+			}
+		}
+		jsonNewline(w, indent, compact)
+		w.WriteByte('}')
+		return nil
+	}
+	return marshalJSON(w, v, indent, compact)
+}
+
+// jsonNewline starts an indented line, compact output has none
+func jsonNewline(w *bufio.Writer, indent string, compact bool) {
+	if !compact {
+		w.WriteByte('\n')
+		w.WriteString(indent)
+	}
+}
+
+// marshalJSON encodes the values streamJSON doesn't walk, which are small or encode themselves
+func marshalJSON(w *bufio.Writer, v reflect.Value, indent string, compact bool) error {
+	var data interface{}
+	if v.IsValid() {
+		data = v.Interface()
+		// encoding/json calls the methods with a pointer receiver on addressable values, such as slice elements
+		if v.CanAddr() {
+			data = v.Addr().Interface()
+		}
+	}
+	var encoded []byte
+	var err error
+	if compact {
+		encoded, err = json.Marshal(data)
+	} else {
+		encoded, err = json.MarshalIndent(data, indent, "    ")
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+func hasJSONMarshaler(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		t.Kind() != reflect.Pointer && (reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType))
+}
+
+type jsonField struct {
+	name  string
+	value reflect.Value
+}
+
+// jsonFields lists the fields encoding/json would write. Structs with embedded fields or tag options other than
+// omitempty aren't walked, their rules are left to encoding/json.
+func jsonFields(v reflect.Value) ([]jsonField, bool) {
+	var fields []jsonField
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous {
+			return nil, false
+		}
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if options != "" && options != "omitempty" {
+			return nil, false
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if options == "omitempty" && isEmptyJSONValue(v.Field(i)) {
+			continue
+		}
+		fields = append(fields, jsonField{name: name, value: v.Field(i)})
+	}
+	return fields, true
+}
+
+// isEmptyJSONValue follows the omitempty rule of encoding/json
+func isEmptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// PackingMetadata reports the signs that the binary was packed or protected. Packers compress or encrypt the original
+// program and unpack it at runtime, which hides the pclntab, so a packed Go binary usually yields no symbols.
+type PackingMetadata struct {
+	Packed     bool     // enough indicators were found to consider the binary packed
+	Protectors []string `json:",omitempty"` // packers and protectors identified by their signatures
+	Indicators []string `json:",omitempty"` // the heuristics that matched
+}
+
+// Section names left behind by known packers and protectors
+var packerSectionNames = map[string]string{
+	"UPX0":      "UPX",
+	"UPX1":      "UPX",
+	"UPX2":      "UPX",
+	".aspack":   "ASPack",
+	".adata":    "ASPack",
+	".MPRESS1":  "MPRESS",
+	".MPRESS2":  "MPRESS",
+	".vmp0":     "VMProtect",
+	".vmp1":     "VMProtect",
+	".vmp2":     "VMProtect",
+	".themida":  "Themida",
+	".winlice":  "WinLicense",
+	".enigma1":  "Enigma Protector",
+	".enigma2":  "Enigma Protector",
+	".petite":   "Petite",
+	".nsp0":     "NsPack",
+	".nsp1":     "NsPack",
+	".nsp2":     "NsPack",
+	"PEC2":      "PECompact",
+	"pec1":      "PECompact",
+	".packed":   "RLPack",
+	".RLPack":   "RLPack",
+	".perplex":  "Perplex",
+	"MEW":       "MEW",
+	".kkrunchy": "kkrunchy",
+	".Upack":    "Upack",
+	".ByDwing":  "Upack",
+	".svkp":     "SVKP",
+	".yP":       "Y0da Protector",
+	".y0da":     "Y0da Protector",
+	"BitArts":   "Crunch",
+	"ProCrypt":  "ProCrypt",
+}
+
+// Byte signatures of packers, searched for near the start of the file
+var packerSignatures = []struct {
+	protector string
+	signature []byte
+}{
+	{"UPX", []byte("UPX!")},
+	{"UPX", []byte("$Info: This file is packed with the UPX")},
+	{"MPRESS", []byte("MPRESS")},
+	{"Themida", []byte("Themida")},
+	{"VMProtect", []byte("VMProtect")},
+}
+
+const (
+	// how far into the file packerSignatures are searched
+	packerSignatureWindow = 0x10000
+
+	// entropy above which code or data is most likely compressed or encrypted
+	packedEntropy = 7.2
+
+	// Go binaries import at least a few dozen functions on Windows, packers only keep what the stub needs
+	minPEImports = 10
+
+	// heuristics that have to match before a binary without a known signature is considered packed
+	minPackingIndicators = 2
+)
+
+// detectPacking applies the packing heuristics to the file. A protector signature alone is enough to consider the
+// binary packed, the other heuristics also match some unpacked binaries and only count together.
+func detectPacking(fileName string, file *objfile.File, sections []SectionMetadata) (*PackingMetadata, error) {
+	packing := &PackingMetadata{}
+	protectors := make(map[string]bool)
+	indicate := func(format string, args ...any) {
+		packing.Indicators = append(packing.Indicators, fmt.Sprintf(format, args...))
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, packerSignatureWindow)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	for _, sig := range packerSignatures {
+		if bytes.Contains(head, sig.signature) {
+			protectors[sig.protector] = true
+			indicate("%s signature %q", sig.protector, sig.signature)
+		}
+	}
+
+	isPE := bytes.HasPrefix(head, []byte("MZ"))
+	isELF := bytes.HasPrefix(head, []byte("\x7fELF"))
+
+	if isELF && len(sections) == 0 {
+		indicate("no section headers")
+	}
+
+	for _, sec := range sections {
+		name := strings.TrimRight(sec.Name, "\x00")
+		if protector, ok := packerSectionNames[name]; ok {
+			protectors[protector] = true
+			indicate("section %q of %s", name, protector)
+		} else if name == "" || !isPrintable(name) {
+			indicate("section with unusual name %q", name)
+		}
+
+		if strings.HasSuffix(sec.Permissions, "wx") {
+			indicate("section %q is writable and executable", name)
+		}
+		if strings.HasSuffix(sec.Permissions, "x") && sec.Entropy >= packedEntropy {
+			indicate("section %q is executable with entropy %.2f", name, sec.Entropy)
+		}
+		if strings.HasSuffix(sec.Permissions, "x") && sec.FileSize == 0 && sec.Size > 0 {
+			indicate("section %q is executable but empty in the file", name)
+		}
+	}
+
+	// the sections of PE files are what the loader maps, anything else is checked again with its segments
+	if !isPE {
+		if segments, err := file.Segments(); err == nil {
+			for _, seg := range segments {
+				if seg.Writable && seg.Executable {
+					indicate("segment %q is writable and executable", seg.Name)
+				}
+			}
+		}
+	}
+
+	if isPE {
+		if imports, err := file.ImportedSymbols(); err == nil && len(imports) < minPEImports {
+			indicate("only %d imports", len(imports))
+		}
+	}
+
+	if entry, err := file.EntryPoint(); err == nil && entry != 0 && len(sections) > 0 {
+		var entrySection *SectionMetadata
+		for i := range sections {
+			if entry >= sections[i].Address && entry < sections[i].Address+sections[i].Size {
+				entrySection = &sections[i]
+				break
+			}
+		}
+
+		if entrySection == nil {
+			indicate("entry point 0x%x is outside of all sections", entry)
+		} else if !strings.HasSuffix(entrySection.Permissions, "x") {
+			indicate("entry point 0x%x is in non executable section %q", entry, entrySection.Name)
+		} else if name := entrySection.Name; name != ".text" && name != "__text" {
+			indicate("entry point 0x%x is in section %q instead of the code section", entry, name)
+		}
+	}
+
+	for protector := range protectors {
+		packing.Protectors = append(packing.Protectors, protector)
+	}
+	sort.Strings(packing.Protectors)
+	packing.Packed = len(packing.Protectors) > 0 || len(packing.Indicators) >= minPackingIndicators
+	return packing, nil
+}
+
+func isPrintable(name string) bool {
+	for _, c := range name {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func packingSummary(packing *PackingMetadata) string {
+	if len(packing.Protectors) > 0 {
+		return strings.Join(packing.Protectors, ", ")
+	}
+	return strings.Join(packing.Indicators, ", ")
+}
@@ -0,0 +1,137 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// PersistenceMethod is a way the program may survive a reboot, with the strings and calls that indicate it. Like
+// the other findings, it shows the program contains the means, not that it uses them.
+type PersistenceMethod struct {
+	Mechanism string // windows-run-key, windows-service, scheduled-task, winlogon, launchd, systemd, cron or xdg-autostart
+	Technique string // ATT&CK technique ID
+	Evidence  []PersistenceEvidence
+}
+
+type PersistenceEvidence struct {
+	Value    string // the string, or the API called
+	Address  uint64 // of the string or the call
+	Function string `json:",omitempty"` // the caller, for calls
+}
+
+// Mechanisms by the strings their setup writes or runs and the APIs only they call. The strings are matched as is,
+// registry paths by the part whose case doesn't vary.
+var persistenceSignatures = []struct {
+	mechanism string
+	technique string
+	strings   []string
+	apis      []string
+}{
+	{"windows-run-key", "T1547.001", []string{`CurrentVersion\Run`, `CurrentVersion\\Run`, `Start Menu\Programs\Startup`, `Start Menu\\Programs\\Startup`}, nil},
+	{"windows-service", "T1543.003", []string{"sc create ", "sc.exe create ", "New-Service "}, []string{"golang.org/x/sys/windows/svc/mgr.(*Mgr).CreateService"}},
+	{"scheduled-task", "T1053.005", []string{"schtasks /create", "schtasks.exe /create", "schtasks /Create", "Register-ScheduledTask"}, nil},
+	{"winlogon", "T1547.004", []string{`Windows NT\CurrentVersion\Winlogon`, `Windows NT\\CurrentVersion\\Winlogon`}, nil},
+	{"launchd", "T1543.001", []string{"Library/LaunchAgents", "Library/LaunchDaemons", "<key>RunAtLoad</key>", "launchctl load"}, nil},
+	{"systemd", "T1543.002", []string{"/etc/systemd/system", ".config/systemd/user", "WantedBy=multi-user.target", "systemctl enable"}, []string{"github.com/coreos/go-systemd/dbus.(*Conn).EnableUnitFiles", "github.com/coreos/go-systemd/v22/dbus.(*Conn).EnableUnitFiles"}},
+	{"cron", "T1053.003", []string{"/etc/crontab", "/var/spool/cron", "/etc/cron.d", "crontab -", "@reboot "}, nil},
+	{"xdg-autostart", "T1547.013", []string{".config/autostart", "X-GNOME-Autostart-enabled"}, nil},
+}
+
+// occurrences reported per mechanism
+const maxPersistenceEvidence = 10
+
+// detectPersistence looks for the strings in the sections and for calls to the APIs from outside the standard
+// library
+func detectPersistence(ctx context.Context, file *objfile.File, tab *gosym.Table) ([]PersistenceMethod, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make(map[uint64]string)
+	targets := make(map[uint64]bool)
+	wanted := make(map[string]bool)
+	for _, signature := range persistenceSignatures {
+		for _, api := range signature.apis {
+			wanted[api] = true
+		}
+	}
+	for _, fn := range tab.Funcs {
+		if wanted[fn.Name] {
+			apis[fn.Entry] = fn.Name
+			targets[fn.Entry] = true
+		}
+	}
+	calls := make(map[string][]PersistenceEvidence)
+	if len(targets) > 0 {
+		textStart, text, err := file.Text()
+		if err != nil {
+			return nil, err
+		}
+		for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+			fn := tab.PCToFunc(pc)
+			if fn == nil || isStdPackage(fn.PackageName()) {
+				continue
+			}
+			// the call site is the first instruction decoded
+			file.Decode(pc, fn.End, func(inst objfile.Instruction) bool {
+				if api, ok := apis[inst.Call]; ok {
+					calls[api] = append(calls[api], PersistenceEvidence{Value: api, Address: pc, Function: fn.Name})
+				}
+				return false
+			})
+		}
+	}
+
+	evidence := make([][]PersistenceEvidence, len(persistenceSignatures))
+	for i, signature := range persistenceSignatures {
+		for _, api := range signature.apis {
+			evidence[i] = append(evidence[i], calls[api]...)
+		}
+	}
+	for _, sec := range sections {
+		if ctx.Err() != nil {
+			break
+		}
+		if sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		scanPersistenceStrings(data, sec.Addr, evidence)
+	}
+
+	var mechanisms []PersistenceMethod
+	for i, signature := range persistenceSignatures {
+		if len(evidence[i]) > maxPersistenceEvidence {
+			evidence[i] = evidence[i][:maxPersistenceEvidence]
+		}
+		if len(evidence[i]) > 0 {
+			mechanisms = append(mechanisms, PersistenceMethod{Mechanism: signature.mechanism, Technique: signature.technique, Evidence: evidence[i]})
+		}
+	}
+	return mechanisms, nil
+}
+
+// scanPersistenceStrings adds the occurrences of each signature's strings to its evidence, indexed like
+// persistenceSignatures
+func scanPersistenceStrings(data []byte, addr uint64, evidence [][]PersistenceEvidence) {
+	for i, signature := range persistenceSignatures {
+		for _, needle := range signature.strings {
+			for offset := 0; len(evidence[i]) < maxPersistenceEvidence; {
+				j := bytes.Index(data[offset:], []byte(needle))
+				if j < 0 {
+					break
+				}
+				evidence[i] = append(evidence[i], PersistenceEvidence{Value: needle, Address: addr + uint64(offset+j)})
+				offset += j + len(needle)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A pipeline file describes an analysis profile, such as a fast triage or a deep dive: which analyzers run, in which
+// order and with which options. The pclntab, moduledata and build info are always located first, everything else
+// depends on them. Analyzers that aren't listed don't run, the detections of detectorOrder included. Those run in
+// that order wherever they're listed, since some read what others found.
+//
+//	timeout: 30s
+//	analyzers:
+//	  - name: functions
+//	    std: true
+//	  - name: routes
+//	  - name: strings
+//	    min-length: 8
+//	  - name: filter-package
+//	    exclude: ^(runtime|internal/.*)$
+//	  - name: filter-origin
+//	    keep: user
+type pipelineConfig struct {
+	Timeout   time.Duration      `yaml:"timeout"`
+	Analyzers []pipelineAnalyzer `yaml:"analyzers"`
+}
+
+type pipelineAnalyzer struct {
+	Name      string `yaml:"name"`
+	Std       bool   `yaml:"std"`        // functions: also list functions of standard packages
+	Address   uint64 `yaml:"address"`    // types: only parse the type at this address
+	MinLength int    `yaml:"min-length"` // strings: shortest string reported
+	File      string `yaml:"file"`       // hints: the hints file
+	Exclude   string `yaml:"exclude"`    // filter-package: regex of the packages to drop
+	Keep      string `yaml:"keep"`       // filter-origin: comma separated origins to keep
+}
+
+// The analyzers that run once the moduledata was located, in the order they run without a pipeline.
+// On timeout, the analyzers that already ran keep their results.
+var analysisOrder = []string{"types", "files", "functions", "strings"}
+
+// The analyzers that rewrite the results, in the order they run without a pipeline
+var postProcessOrder = []string{"hints", "filter-package", "filter-origin"}
+
+func loadPipeline(path string) (*pipelineConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := &pipelineConfig{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, analyzer := range config.Analyzers {
+		if seen[analyzer.Name] {
+			return nil, fmt.Errorf("%s: analyzer %q is listed twice", path, analyzer.Name)
+		}
+		seen[analyzer.Name] = true
+
+		if err := analyzer.validate(); err != nil {
+			return nil, fmt.Errorf("%s: analyzer %q: %w", path, analyzer.Name, err)
+		}
+	}
+	return config, nil
+}
+
+func (a pipelineAnalyzer) validate() error {
+	// options of one analyzer given to another are most likely a mistake in the profile
+	allowed := map[string]bool{
+		"std":        a.Name == "functions",
+		"address":    a.Name == "types",
+		"min-length": a.Name == "strings",
+		"file":       a.Name == "hints",
+		"exclude":    a.Name == "filter-package",
+		"keep":       a.Name == "filter-origin",
+	}
+	given := map[string]bool{
+		"std":        a.Std,
+		"address":    a.Address != 0,
+		"min-length": a.MinLength != 0,
+		"file":       a.File != "",
+		"exclude":    a.Exclude != "",
+		"keep":       a.Keep != "",
+	}
+	for option, isGiven := range given {
+		if isGiven && !allowed[option] {
+			return fmt.Errorf("unexpected option %q", option)
+		}
+	}
+
+	switch a.Name {
+	case "types", "files", "functions":
+	case "strings":
+		if a.MinLength < 0 {
+			return fmt.Errorf("min-length must be positive")
+		}
+	case "hints":
+		if a.File == "" {
+			return fmt.Errorf("file is required")
+		}
+	case "filter-package":
+		if _, err := regexp.Compile(a.Exclude); a.Exclude == "" || err != nil {
+			return fmt.Errorf("exclude must be a valid regex")
+		}
+	case "filter-origin":
+		if _, err := parseOrigins(a.Keep); a.Keep == "" || err != nil {
+			return fmt.Errorf("keep must list user, dependency or stdlib")
+		}
+	default:
+		if !isDetector(a.Name) {
+			return fmt.Errorf("unknown analyzer")
+		}
+	}
+	return nil
+}
+
+// flags translates the pipeline into the command line flags it stands for
+func (p *pipelineConfig) flags() map[string]string {
+	flags := map[string]string{
+		"nofuncs": "true",
+		"d":       "false",
+		"p":       "false",
+		"t":       "false",
+		"strings": "false",
+	}
+	if p.Timeout > 0 {
+		flags["timeout"] = p.Timeout.String()
+	}
+
+	for _, analyzer := range p.Analyzers {
+		switch analyzer.Name {
+		case "functions":
+			flags["nofuncs"] = "false"
+			flags["d"] = strconv.FormatBool(analyzer.Std)
+		case "files":
+			flags["p"] = "true"
+		case "types":
+			if analyzer.Address != 0 {
+				flags["m"] = strconv.FormatUint(analyzer.Address, 10)
+			} else {
+				flags["t"] = "true"
+			}
+		case "strings":
+			flags["strings"] = "true"
+		case "hints":
+			flags["hints"] = analyzer.File
+		case "filter-package":
+			flags["filter-package"] = analyzer.Exclude
+		case "filter-origin":
+			flags["origin"] = analyzer.Keep
+		}
+	}
+	return flags
+}
+
+// order returns the listed analyzers of the given group in pipeline order, followed by the group's unlisted ones
+func (p *pipelineConfig) order(group []string) []string {
+	inGroup := make(map[string]bool)
+	for _, name := range group {
+		inGroup[name] = true
+	}
+
+	var ordered []string
+	listed := make(map[string]bool)
+	for _, analyzer := range p.Analyzers {
+		if inGroup[analyzer.Name] {
+			ordered = append(ordered, analyzer.Name)
+			listed[analyzer.Name] = true
+		}
+	}
+	for _, name := range group {
+		if !listed[name] {
+			ordered = append(ordered, name)
+		}
+	}
+	return ordered
+}
+
+// apply configures the analysis with the pipeline. Flags given on the command line take precedence over it.
+func (p *pipelineConfig) apply(setFlag func(name string, value string) error, explicit map[string]bool) error {
+	for name, value := range p.flags() {
+		if explicit[name] {
+			continue
+		}
+		if err := setFlag(name, value); err != nil {
+			return fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+
+	// only the listed detections run, -detect adds to them
+	enabledDetectors = make(detectorSet)
+	for _, analyzer := range p.Analyzers {
+		if analyzer.Name == "strings" && analyzer.MinLength > 0 {
+			minStringLength = analyzer.MinLength
+		}
+		if isDetector(analyzer.Name) {
+			enabledDetectors.add(analyzer.Name)
+		}
+	}
+
+	analysisOrder = p.order(analysisOrder)
+	postProcessOrder = p.order(postProcessOrder)
+	return nil
+}
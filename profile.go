@@ -0,0 +1,70 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// startProfiling starts the CPU profile and the execution trace asked for. The returned function stops them and
+// writes the heap profile, it has to run before exiting as os.Exit skips deferred calls. The files are read with
+// go tool pprof and go tool trace.
+func startProfiling(cpuProfile string, memProfile string, tracePath string) (func(), error) {
+	var cpuFile, traceFile *os.File
+	stop := func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if traceFile != nil {
+			trace.Stop()
+			traceFile.Close()
+		}
+		if memProfile != "" {
+			if err := writeHeapProfile(memProfile); err != nil {
+				logger.Error("failed to write the memory profile", "file", memProfile, "error", err)
+			}
+		}
+	}
+
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("-cpuprofile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("-cpuprofile: %w", err)
+		}
+		cpuFile = f
+	}
+
+	if tracePath != "" {
+		f, err := os.Create(tracePath)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("-trace: %w", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			stop()
+			return nil, fmt.Errorf("-trace: %w", err)
+		}
+		traceFile = f
+	}
+	return stop, nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// up to date statistics, the profile otherwise reflects the last garbage collection
+	runtime.GC()
+	return pprof.WriteHeapProfile(f)
+}
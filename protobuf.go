@@ -0,0 +1,427 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// ProtobufFile is a .proto file whose serialized FileDescriptorProto the generated code registers. Its messages and
+// services are the schema of the protocol the program speaks, such as the one of its C2.
+type ProtobufFile struct {
+	Name         string
+	Package      string            `json:",omitempty"`
+	Syntax       string            `json:",omitempty"` // proto2, proto3 or editions
+	Dependencies []string          `json:",omitempty"`
+	Messages     []ProtobufMessage `json:",omitempty"` // nested messages follow their parent, named Parent.Nested
+	Enums        []ProtobufEnum    `json:",omitempty"`
+	Services     []ProtobufService `json:",omitempty"`
+	Address      uint64
+	Section      string
+	Compressed   bool `json:",omitempty"` // gzipped, as registered by github.com/golang/protobuf
+}
+
+type ProtobufMessage struct {
+	Name   string
+	Fields []ProtobufField `json:",omitempty"`
+}
+
+type ProtobufField struct {
+	Name   string
+	Number int32
+	Type   string // the scalar type, or the name of the message or enum
+	Label  string `json:",omitempty"` // repeated or required
+}
+
+type ProtobufEnum struct {
+	Name   string
+	Values []ProtobufEnumValue
+}
+
+type ProtobufEnumValue struct {
+	Name   string
+	Number int32
+}
+
+type ProtobufService struct {
+	Name    string
+	Methods []ProtobufMethod
+}
+
+type ProtobufMethod struct {
+	Name            string
+	Input           string
+	Output          string
+	ClientStreaming bool `json:",omitempty"`
+	ServerStreaming bool `json:",omitempty"`
+}
+
+// The names of FieldDescriptorProto.Type, indexed by its value
+var protobufScalarTypes = []string{"", "double", "float", "int64", "uint64", "int32", "fixed64", "fixed32", "bool",
+	"string", "group", "message", "bytes", "uint32", "enum", "sfixed32", "sfixed64", "sint32", "sint64"}
+
+// the header github.com/golang/protobuf gzips the descriptors with
+var protobufGzipHeader = []byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff}
+
+const (
+	maxProtobufNameLength     = 1024
+	maxProtobufDescriptorSize = 16 << 20
+)
+
+// extractProtobuf finds the descriptors in every section. protoc-gen-go stores them serialized, and the name of
+// the file comes first, so each ".proto" preceded by the tag and the length of a name starts a candidate. The
+// descriptor ends where its fields stop being valid.
+func extractProtobuf(ctx context.Context, file *objfile.File) ([]ProtobufFile, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ProtobufFile
+	seen := make(map[string]bool)
+	add := func(descriptor ProtobufFile) {
+		if !seen[descriptor.Name] {
+			seen[descriptor.Name] = true
+			files = append(files, descriptor)
+		}
+	}
+	for _, sec := range sections {
+		if ctx.Err() != nil {
+			break
+		}
+		if sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+
+		for offset := 0; ; {
+			i := bytes.Index(data[offset:], []byte(".proto"))
+			if i < 0 {
+				break
+			}
+			end := offset + i + len(".proto")
+			offset = end
+			if start, ok := protobufNameStart(data, end); ok {
+				if descriptor, ok := parseFileDescriptor(data[start:]); ok {
+					descriptor.Address, descriptor.Section = sec.Addr+uint64(start), sec.Name
+					add(descriptor)
+				}
+			}
+		}
+
+		for offset := 0; ; {
+			i := bytes.Index(data[offset:], protobufGzipHeader)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			offset = start + len(protobufGzipHeader)
+			reader, err := gzip.NewReader(bytes.NewReader(data[start:]))
+			if err != nil {
+				continue
+			}
+			reader.Multistream(false)
+			decompressed, err := io.ReadAll(io.LimitReader(reader, maxProtobufDescriptorSize))
+			if err != nil {
+				continue
+			}
+			if descriptor, ok := parseFileDescriptor(decompressed); ok {
+				descriptor.Address, descriptor.Section, descriptor.Compressed = sec.Addr+uint64(start), sec.Name, true
+				add(descriptor)
+			}
+		}
+	}
+	return files, nil
+}
+
+// protobufNameStart finds the tag of the name field ending at end, the name being a path of printable characters
+func protobufNameStart(data []byte, end int) (int, bool) {
+	first := end
+	for first > 0 && end-first < maxProtobufNameLength && isProtobufNameChar(data[first-1]) {
+		first--
+	}
+	for nameStart := first; nameStart < end-len(".proto"); nameStart++ {
+		length := uint64(end - nameStart)
+		var header [binary.MaxVarintLen64 + 1]byte
+		header[0] = 0x0a
+		n := 1 + binary.PutUvarint(header[1:], length)
+		if nameStart >= n && bytes.Equal(data[nameStart-n:nameStart], header[:n]) {
+			return nameStart - n, true
+		}
+	}
+	return 0, false
+}
+
+func isProtobufNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.' || c == '/'
+}
+
+// protobufFields visits the fields of a message, returning false if it isn't valid. The value of a field is in
+// varint, or in data for the length delimited ones.
+func protobufFields(data []byte, visit func(number int, varint uint64, data []byte) bool) bool {
+	for len(data) > 0 {
+		number, _, varint, value, n := readProtobufField(data)
+		if n == 0 || !visit(number, varint, value) {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
+
+// readProtobufField reads the field starting data, returning its size, 0 if it isn't valid. Groups are
+// deprecated and not read.
+func readProtobufField(data []byte) (number int, wire int, varint uint64, value []byte, n int) {
+	tag, tagLength := binary.Uvarint(data)
+	if tagLength <= 0 || tag>>3 == 0 || tag>>3 > 1<<29 {
+		return 0, 0, 0, nil, 0
+	}
+	number, wire, n = int(tag>>3), int(tag&7), tagLength
+	switch wire {
+	case 0:
+		v, length := binary.Uvarint(data[n:])
+		if length <= 0 {
+			return 0, 0, 0, nil, 0
+		}
+		varint, n = v, n+length
+	case 1:
+		if len(data) < n+8 {
+			return 0, 0, 0, nil, 0
+		}
+		varint, n = binary.LittleEndian.Uint64(data[n:]), n+8
+	case 2:
+		length, lengthLength := binary.Uvarint(data[n:])
+		if lengthLength <= 0 || length > uint64(len(data)-n-lengthLength) {
+			return 0, 0, 0, nil, 0
+		}
+		n += lengthLength
+		value, n = data[n:n+int(length)], n+int(length)
+	case 5:
+		if len(data) < n+4 {
+			return 0, 0, 0, nil, 0
+		}
+		varint, n = uint64(binary.LittleEndian.Uint32(data[n:])), n+4
+	default:
+		return 0, 0, 0, nil, 0
+	}
+	return number, wire, varint, value, n
+}
+
+// parseFileDescriptor decodes the FileDescriptorProto starting data. The generated code serializes the fields in
+// the order of their numbers, so the descriptor ends before a field that is out of order or invalid.
+func parseFileDescriptor(data []byte) (ProtobufFile, bool) {
+	var descriptor ProtobufFile
+	last := 0
+	for len(data) > 0 {
+		number, wire, _, value, n := readProtobufField(data)
+		if n == 0 || number < last || (number == last && number <= 2) {
+			break
+		}
+		valid := true
+		switch number {
+		case 1, 2, 3, 12:
+			valid = wire == 2 && isProtobufName(string(value))
+			if !valid {
+				break
+			}
+			switch number {
+			case 1:
+				descriptor.Name = string(value)
+			case 2:
+				descriptor.Package = string(value)
+			case 3:
+				descriptor.Dependencies = append(descriptor.Dependencies, string(value))
+			case 12:
+				descriptor.Syntax = string(value)
+			}
+		case 4:
+			messages, enums := len(descriptor.Messages), len(descriptor.Enums)
+			valid = wire == 2 && parseMessageDescriptor(value, "", &descriptor)
+			if !valid {
+				descriptor.Messages, descriptor.Enums = descriptor.Messages[:messages], descriptor.Enums[:enums]
+			}
+		case 5:
+			var enum ProtobufEnum
+			if valid = wire == 2 && parseEnumDescriptor(value, "", &enum); valid {
+				descriptor.Enums = append(descriptor.Enums, enum)
+			}
+		case 6:
+			var service ProtobufService
+			if valid = wire == 2 && parseServiceDescriptor(value, &service); valid {
+				descriptor.Services = append(descriptor.Services, service)
+			}
+		case 7, 8, 9, 13:
+			valid = wire == 2
+		case 10, 11, 14:
+			valid = wire == 0 || wire == 2
+		default:
+			valid = false
+		}
+		if !valid {
+			break
+		}
+		last = number
+		data = data[n:]
+	}
+	if last == 0 || !strings.HasSuffix(descriptor.Name, ".proto") {
+		return ProtobufFile{}, false
+	}
+	return descriptor, true
+}
+
+// parseMessageDescriptor decodes a DescriptorProto, adding it and its nested messages and enums to the file
+func parseMessageDescriptor(data []byte, parent string, descriptor *ProtobufFile) bool {
+	message := ProtobufMessage{}
+	index := len(descriptor.Messages)
+	descriptor.Messages = append(descriptor.Messages, message)
+	var nested [][]byte
+	var enums [][]byte
+	valid := protobufFields(data, func(number int, _ uint64, value []byte) bool {
+		switch number {
+		case 1:
+			message.Name = string(value)
+		case 2:
+			field, ok := parseFieldDescriptor(value)
+			if !ok {
+				return false
+			}
+			message.Fields = append(message.Fields, field)
+		case 3:
+			nested = append(nested, value)
+		case 4:
+			enums = append(enums, value)
+		}
+		return true
+	})
+	if !valid || !isProtobufName(message.Name) {
+		return false
+	}
+	if parent != "" {
+		message.Name = parent + "." + message.Name
+	}
+	descriptor.Messages[index] = message
+	for _, value := range nested {
+		if !parseMessageDescriptor(value, message.Name, descriptor) {
+			return false
+		}
+	}
+	for _, value := range enums {
+		var enum ProtobufEnum
+		if !parseEnumDescriptor(value, message.Name, &enum) {
+			return false
+		}
+		descriptor.Enums = append(descriptor.Enums, enum)
+	}
+	return true
+}
+
+func parseFieldDescriptor(data []byte) (ProtobufField, bool) {
+	var field ProtobufField
+	var typeName string
+	valid := protobufFields(data, func(number int, varint uint64, value []byte) bool {
+		switch number {
+		case 1:
+			field.Name = string(value)
+		case 3:
+			field.Number = int32(varint)
+		case 4:
+			switch varint {
+			case 2:
+				field.Label = "required"
+			case 3:
+				field.Label = "repeated"
+			}
+		case 5:
+			if varint < uint64(len(protobufScalarTypes)) {
+				field.Type = protobufScalarTypes[varint]
+			}
+		case 6:
+			typeName = strings.TrimPrefix(string(value), ".")
+		}
+		return true
+	})
+	if typeName != "" {
+		field.Type = typeName
+	}
+	return field, valid && isProtobufName(field.Name)
+}
+
+func parseEnumDescriptor(data []byte, parent string, enum *ProtobufEnum) bool {
+	valid := protobufFields(data, func(number int, _ uint64, value []byte) bool {
+		switch number {
+		case 1:
+			enum.Name = string(value)
+		case 2:
+			var enumValue ProtobufEnumValue
+			if !protobufFields(value, func(number int, varint uint64, value []byte) bool {
+				switch number {
+				case 1:
+					enumValue.Name = string(value)
+				case 2:
+					enumValue.Number = int32(varint)
+				}
+				return true
+			}) {
+				return false
+			}
+			enum.Values = append(enum.Values, enumValue)
+		}
+		return true
+	})
+	if parent != "" {
+		enum.Name = parent + "." + enum.Name
+	}
+	return valid && isProtobufName(enum.Name)
+}
+
+func parseServiceDescriptor(data []byte, service *ProtobufService) bool {
+	valid := protobufFields(data, func(number int, _ uint64, value []byte) bool {
+		switch number {
+		case 1:
+			service.Name = string(value)
+		case 2:
+			var method ProtobufMethod
+			if !protobufFields(value, func(number int, varint uint64, value []byte) bool {
+				switch number {
+				case 1:
+					method.Name = string(value)
+				case 2:
+					method.Input = strings.TrimPrefix(string(value), ".")
+				case 3:
+					method.Output = strings.TrimPrefix(string(value), ".")
+				case 5:
+					method.ClientStreaming = varint != 0
+				case 6:
+					method.ServerStreaming = varint != 0
+				}
+				return true
+			}) {
+				return false
+			}
+			service.Methods = append(service.Methods, method)
+		}
+		return true
+	})
+	return valid && isProtobufName(service.Name)
+}
+
+func isProtobufName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isProtobufNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
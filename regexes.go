@@ -0,0 +1,138 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// RegexPattern is a regular expression the program compiles, recovered from the string constant passed to the
+// compiling call. Malware filters the files, credentials and hosts it is after with them.
+type RegexPattern struct {
+	Pattern  string
+	Function string // the function compiling it
+	Address  uint64 // of the call
+	Category string `json:",omitempty"` // file-types, credentials, crypto-wallets or network, guessed from the pattern
+}
+
+// The functions taking the pattern as their first argument
+var regexpAPIs = map[string]bool{
+	"regexp.MustCompile": true, "regexp.Compile": true, "regexp.MustCompilePOSIX": true, "regexp.CompilePOSIX": true,
+	"regexp.MatchString": true, "regexp.Match": true, "regexp.MatchReader": true,
+	"github.com/dlclark/regexp2.MustCompile": true, "github.com/dlclark/regexp2.Compile": true,
+	"rsc.io/binaryregexp.MustCompile": true, "rsc.io/binaryregexp.Compile": true,
+}
+
+// What the patterns look for, the first category matching a pattern is reported
+var regexCategories = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"credentials", regexp.MustCompile(`(?i)passw|passwd|pwd|token|secret|api.?key|bearer|AKIA|ghp_|xox\[?[abp]|PRIVATE KEY|cookie|session`)},
+	{"crypto-wallets", regexp.MustCompile(`(?i)bc1|\[13\]|0x\[a-f|0x\[0-9a-f|\b(?:btc|eth|xmr|wallet|seed|mnemonic)\b`)},
+	{"file-types", regexp.MustCompile(`(?i)\\\.\(?(?:\?:)?[a-z0-9]{2,5}\??(?:\|[a-z0-9]{2,5}\??)+\)?|\\\.(?:docx?|xlsx?|pdf|txt|zip|rar|7z|kdbx|wallet|dat|sqlite|db|jpe?g|png|exe|dll|ps1|bat)\b`)},
+	{"network", regexp.MustCompile(`(?i)https?|ftp|\\d\{1,3\}\\\.|@|\.onion|\b(?:host|url|domain|ip)\b`)},
+}
+
+// extractRegexes decodes the functions calling the compiling functions and takes the last string loaded before
+// each call as its pattern
+func extractRegexes(ctx context.Context, file *objfile.File, tab *gosym.Table) ([]RegexPattern, error) {
+	apis := make(map[uint64]bool)
+	for _, fn := range tab.Funcs {
+		if regexpAPIs[fn.Name] {
+			apis[fn.Entry] = true
+		}
+	}
+	if len(apis) == 0 {
+		return nil, nil
+	}
+
+	sections, err := loadStringSections(file)
+	if err != nil {
+		return nil, err
+	}
+	textStart, text, err := file.Text()
+	if err != nil {
+		return nil, err
+	}
+
+	var callers []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range directCallSites(file.GOARCH(), textStart, text, apis) {
+		fn := tab.PCToFunc(pc)
+		if fn == nil || decoded[fn.Entry] || regexpAPIs[fn.Name] {
+			continue
+		}
+		decoded[fn.Entry] = true
+		callers = append(callers, fn)
+	}
+
+	var patterns []RegexPattern
+	for _, fn := range callers {
+		if ctx.Err() != nil {
+			break
+		}
+		caller := fn.Name
+		callStringArguments(file, sections, fn, apis, func(pc uint64, _ uint64, strs []string) {
+			if len(strs) > 0 {
+				pattern := strs[len(strs)-1]
+				patterns = append(patterns, RegexPattern{Pattern: pattern, Function: caller, Address: pc, Category: regexCategory(pattern)})
+			}
+		})
+	}
+	return patterns, nil
+}
+
+// callStringArguments decodes the function and hands the strings loaded since the previous call to visit at each
+// call to one of the targets, or at every call when targets is nil. The length of a string follows its address within
+// a few instructions.
+func callStringArguments(file *objfile.File, sections []stringSection, fn *gosym.Func, targets map[uint64]bool, visit func(pc uint64, target uint64, strs []string)) {
+	var strs []string
+	var pending []uint64
+	window := 0
+	file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+		if window > 0 {
+			window--
+			for _, imm := range inst.Imms {
+				for _, ref := range pending {
+					if value, _, ok := readText(sections, ref, uint64(imm)); ok {
+						strs = append(strs, value)
+						pending = nil
+						window = 0
+						break
+					}
+				}
+			}
+			if window == 0 {
+				pending = nil
+			}
+		}
+
+		for _, ref := range inst.Refs {
+			if findStringSection(sections, ref) != nil {
+				pending = append(pending, ref)
+				window = stringLengthWindow
+			}
+		}
+
+		if inst.Call != 0 {
+			if targets == nil || targets[inst.Call] {
+				visit(inst.PC, inst.Call, strs)
+			}
+			strs, pending, window = nil, nil, 0
+		}
+		return true
+	})
+}
+
+func regexCategory(pattern string) string {
+	for _, category := range regexCategories {
+		if category.pattern.MatchString(pattern) {
+			return category.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,292 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mandiant/GoReSym/objfile"
+	"golang.org/x/term"
+)
+
+// The query shell keeps the parsed results in memory and answers one query per line, so exploring a large binary
+// costs a single analysis. It reads from stdin, queries can be piped in as well as typed.
+type queryShell struct {
+	metadata  ExtractMetadata
+	functions []FuncMetadata // sorted by address
+	types     []objfile.Type
+	out       io.Writer
+}
+
+const queryShellHelp = `funcs [matching <regex>]      list functions
+func <name|address>           show a function and the strings it references
+strings [matching <regex>]    list strings
+strings xref <address>        functions referencing the string at the address, or strings referenced by the function containing it
+types [matching <regex>]      list types and interfaces
+type <name|address>           show a type's reconstructed definition
+info                          show the binary's metadata
+help                          show this help
+quit                          leave the shell`
+
+func newQueryShell(metadata ExtractMetadata, out io.Writer) *queryShell {
+	s := &queryShell{metadata: metadata, out: out}
+	s.functions = append(s.functions, metadata.UserFunctions...)
+	s.functions = append(s.functions, metadata.StdFunctions...)
+	sort.Slice(s.functions, func(i, j int) bool { return s.functions[i].Start < s.functions[j].Start })
+
+	s.types = append(s.types, metadata.Types...)
+	s.types = append(s.types, metadata.Interfaces...)
+	return s
+}
+
+// queryResults reads queries until quit or the end of the input
+func queryResults(metadata ExtractMetadata, in io.Reader, out io.Writer) error {
+	s := newQueryShell(metadata, out)
+	interactive := in == os.Stdin && term.IsTerminal(int(os.Stdin.Fd()))
+	if interactive {
+		fmt.Fprintf(out, "%d functions, %d strings, %d types loaded. Type help for the list of queries\n", len(s.functions), len(metadata.Strings), len(s.types))
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		if interactive {
+			fmt.Fprint(out, "goresym> ")
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+
+		if !s.query(scanner.Text()) {
+			return nil
+		}
+	}
+}
+
+// query runs one query and returns false when the shell should exit
+func (s *queryShell) query(line string) bool {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return true
+	}
+
+	var err error
+	switch args[0] {
+	case "funcs":
+		err = s.listFunctions(args[1:])
+	case "func":
+		err = s.showFunction(args[1:])
+	case "strings":
+		err = s.listStrings(args[1:])
+	case "types":
+		err = s.listTypes(args[1:])
+	case "type":
+		err = s.showType(args[1:])
+	case "info":
+		s.showInfo()
+	case "help", "?":
+		fmt.Fprintln(s.out, queryShellHelp)
+	case "quit", "exit":
+		return false
+	default:
+		err = fmt.Errorf("unknown query %q, type help for the list of queries", args[0])
+	}
+
+	if err != nil {
+		fmt.Fprintf(s.out, "error: %s\n", err)
+	}
+	return true
+}
+
+// parseMatching accepts no arguments, which matches everything, or "matching <regex>"
+func parseMatching(args []string) (*regexp.Regexp, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if len(args) != 2 || args[0] != "matching" {
+		return nil, fmt.Errorf("expected matching <regex>")
+	}
+	return regexp.Compile(args[1])
+}
+
+func parseQueryAddress(arg string) (uint64, bool) {
+	address, err := strconv.ParseUint(arg, 0, 64)
+	return address, err == nil
+}
+
+// functionAt returns the function containing the address
+func (s *queryShell) functionAt(address uint64) (FuncMetadata, bool) {
+	i := sort.Search(len(s.functions), func(i int) bool { return s.functions[i].End > address })
+	if i < len(s.functions) && s.functions[i].Start <= address {
+		return s.functions[i], true
+	}
+	return FuncMetadata{}, false
+}
+
+func (s *queryShell) listFunctions(args []string) error {
+	re, err := parseMatching(args)
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range s.functions {
+		if re == nil || re.MatchString(fn.FullName) {
+			fmt.Fprintf(s.out, "0x%x 0x%x %s\n", fn.Start, fn.End, fn.FullName)
+		}
+	}
+	return nil
+}
+
+func (s *queryShell) showFunction(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected func <name|address>")
+	}
+
+	fn, found := FuncMetadata{}, false
+	if address, ok := parseQueryAddress(args[0]); ok {
+		fn, found = s.functionAt(address)
+	} else {
+		for _, candidate := range s.functions {
+			if candidate.FullName == args[0] {
+				fn, found = candidate, true
+				break
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("no function %s", args[0])
+	}
+
+	fmt.Fprintf(s.out, "%s\n", fn.FullName)
+	fmt.Fprintf(s.out, "  %-10s %s\n", "package", fn.PackageName)
+	fmt.Fprintf(s.out, "  %-10s 0x%x-0x%x (%d bytes)\n", "range", fn.Start, fn.End, fn.End-fn.Start)
+	for _, str := range s.stringsOfFunction(fn.FullName) {
+		fmt.Fprintf(s.out, "  %-10s 0x%x %q\n", "string", str.Address, str.Value)
+	}
+	return nil
+}
+
+func (s *queryShell) stringsOfFunction(name string) []StringMetadata {
+	var result []StringMetadata
+	for _, str := range s.metadata.Strings {
+		for _, fn := range str.Functions {
+			if fn == name {
+				result = append(result, str)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (s *queryShell) listStrings(args []string) error {
+	if len(args) > 0 && args[0] == "xref" {
+		return s.stringXrefs(args[1:])
+	}
+
+	re, err := parseMatching(args)
+	if err != nil {
+		return err
+	}
+
+	for _, str := range s.metadata.Strings {
+		if re == nil || re.MatchString(str.Value) {
+			fmt.Fprintf(s.out, "0x%x %q\n", str.Address, str.Value)
+		}
+	}
+	return nil
+}
+
+func (s *queryShell) stringXrefs(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected strings xref <address>")
+	}
+	address, ok := parseQueryAddress(args[0])
+	if !ok {
+		return fmt.Errorf("invalid address %q", args[0])
+	}
+
+	for _, str := range s.metadata.Strings {
+		if str.Address != address {
+			continue
+		}
+
+		fmt.Fprintf(s.out, "0x%x %q\n", str.Address, str.Value)
+		for _, xref := range str.Xrefs {
+			if fn, found := s.functionAt(xref); found {
+				fmt.Fprintf(s.out, "  0x%x %s\n", xref, fn.FullName)
+			} else {
+				fmt.Fprintf(s.out, "  0x%x\n", xref)
+			}
+		}
+		return nil
+	}
+
+	fn, found := s.functionAt(address)
+	if !found {
+		return fmt.Errorf("no string or function at 0x%x", address)
+	}
+
+	fmt.Fprintf(s.out, "%s\n", fn.FullName)
+	for _, str := range s.stringsOfFunction(fn.FullName) {
+		fmt.Fprintf(s.out, "  0x%x %q\n", str.Address, str.Value)
+	}
+	return nil
+}
+
+func (s *queryShell) listTypes(args []string) error {
+	re, err := parseMatching(args)
+	if err != nil {
+		return err
+	}
+
+	for _, typ := range s.types {
+		if re == nil || re.MatchString(typ.Str) {
+			fmt.Fprintf(s.out, "0x%x %-10s %s\n", typ.VA, typ.Kind, typ.Str)
+		}
+	}
+	return nil
+}
+
+func (s *queryShell) showType(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected type <name|address>")
+	}
+
+	// type names such as "map[string] int" may contain spaces
+	name := strings.Join(args, " ")
+	address, byAddress := parseQueryAddress(name)
+	for _, typ := range s.types {
+		if (byAddress && typ.VA == address) || typ.Str == name {
+			fmt.Fprintf(s.out, "0x%x %s %s\n", typ.VA, typ.Kind, typ.Str)
+			if typ.Reconstructed != "" {
+				fmt.Fprintln(s.out, typ.Reconstructed)
+			}
+			return nil
+		}
+	}
+
+	if len(s.types) == 0 {
+		return fmt.Errorf("no types were recovered")
+	}
+	return fmt.Errorf("no type %s", name)
+}
+
+func (s *queryShell) showInfo() {
+	fmt.Fprintf(s.out, "%-12s %s\n", "Go:", s.metadata.Version)
+	fmt.Fprintf(s.out, "%-12s %s/%s\n", "Platform:", s.metadata.OS, s.metadata.Arch)
+	if s.metadata.BuildInfo.Main.Path != "" {
+		fmt.Fprintf(s.out, "%-12s %s %s\n", "Module:", s.metadata.BuildInfo.Main.Path, s.metadata.BuildInfo.Main.Version)
+	}
+	if s.metadata.BuildId != "" {
+		fmt.Fprintf(s.out, "%-12s %s\n", "BuildID:", s.metadata.BuildId)
+	}
+	fmt.Fprintf(s.out, "%-12s 0x%x\n", "Pclntab:", s.metadata.TabMeta.VA)
+	fmt.Fprintf(s.out, "%-12s 0x%x\n", "Moduledata:", s.metadata.ModuleMeta.VA)
+	fmt.Fprintf(s.out, "%-12s %d functions, %d strings, %d types\n", "Loaded:", len(s.functions), len(s.metadata.Strings), len(s.types))
+}
@@ -0,0 +1,195 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// ResourcesMetadata reports the PE resources, which Go programs get from a .syso object built with tools like rsrc or
+// goversioninfo. Malware often copies the version information and icon of legitimate software to pass for it.
+type ResourcesMetadata struct {
+	Resources   []ResourceMetadata
+	VersionInfo *VersionInfo `json:",omitempty"`
+	Manifest    string       `json:",omitempty"`
+
+	// the version information claims a vendor the signature doesn't back
+	Impersonation string `json:",omitempty"`
+}
+
+type ResourceMetadata struct {
+	Type     string // RT_ICON, RT_VERSION, ... for the predefined types, otherwise the name or ID
+	Name     string
+	Language uint32
+	Size     int
+	SHA256   string `json:",omitempty"` // of the data, icons with the same hash are the same icon
+}
+
+// VersionInfo is the VS_VERSIONINFO resource, the properties Windows Explorer shows
+type VersionInfo struct {
+	FileVersion    string            `json:",omitempty"` // of the fixed file info
+	ProductVersion string            `json:",omitempty"`
+	Strings        map[string]string // CompanyName, FileDescription, OriginalFilename, ... of the first string table
+}
+
+var resourceTypes = map[string]string{
+	"1": "RT_CURSOR", "2": "RT_BITMAP", "3": "RT_ICON", "4": "RT_MENU", "5": "RT_DIALOG", "6": "RT_STRING",
+	"7": "RT_FONTDIR", "8": "RT_FONT", "9": "RT_ACCELERATOR", "10": "RT_RCDATA", "11": "RT_MESSAGETABLE",
+	"12": "RT_GROUP_CURSOR", "14": "RT_GROUP_ICON", "16": "RT_VERSION", "17": "RT_DLGINCLUDE", "19": "RT_PLUGPLAY",
+	"20": "RT_VXD", "21": "RT_ANICURSOR", "22": "RT_ANIICON", "23": "RT_HTML", "24": "RT_MANIFEST",
+}
+
+// Vendors whose names malware borrows for its version information, matched in CompanyName. Their software is signed,
+// so a claim without a valid signature by them is suspicious.
+var impersonatedVendors = []string{"Microsoft", "Google", "Mozilla", "Adobe", "Apple", "Oracle", "Intel", "NVIDIA", "Cisco", "VMware", "Citrix", "Zoom", "Dropbox", "Slack", "Cloudflare"}
+
+// extractResources lists the resources and decodes the version information and manifest
+func extractResources(file *objfile.File, signature *SignatureMetadata) (*ResourcesMetadata, error) {
+	resources, err := file.Resources()
+	if len(resources) == 0 {
+		return nil, err
+	}
+
+	report := &ResourcesMetadata{}
+	for _, resource := range resources {
+		typ := resource.Type
+		if predefined, ok := resourceTypes[typ]; ok {
+			typ = predefined
+		}
+		entry := ResourceMetadata{Type: typ, Name: resource.Name, Language: resource.Language, Size: len(resource.Data)}
+		if resource.Data != nil {
+			entry.SHA256 = sha256Hex(resource.Data)
+		}
+		report.Resources = append(report.Resources, entry)
+
+		switch typ {
+		case "RT_VERSION":
+			if report.VersionInfo == nil {
+				report.VersionInfo = parseVersionInfo(resource.Data)
+			}
+		case "RT_MANIFEST":
+			if report.Manifest == "" {
+				report.Manifest = strings.TrimSpace(strings.TrimPrefix(string(resource.Data), "\xef\xbb\xbf"))
+			}
+		}
+	}
+
+	if report.VersionInfo != nil {
+		company := report.VersionInfo.Strings["CompanyName"]
+		for _, vendor := range impersonatedVendors {
+			if !strings.Contains(strings.ToLower(company), strings.ToLower(vendor)) {
+				continue
+			}
+
+			signedByVendor := false
+			if signature != nil && signature.Status == "valid" && len(signature.Signers) > 0 {
+				signedByVendor = strings.Contains(strings.ToLower(signature.Signers[0].Subject), strings.ToLower(vendor))
+			}
+			if !signedByVendor {
+				status := "unsigned"
+				if signature != nil {
+					status = signature.Status
+				}
+				report.Impersonation = fmt.Sprintf("CompanyName %q, but the signature is %s and not by %s", company, status, vendor)
+			}
+			break
+		}
+	}
+	return report, err
+}
+
+// versionNode is a node of VS_VERSIONINFO: a key, a value and children, all of them aligned to 4 bytes
+type versionNode struct {
+	key      string
+	value    []byte
+	text     bool // the value is a string rather than binary
+	children []versionNode
+}
+
+// parseVersionNode parses the node at the start of data, returning it and its length
+func parseVersionNode(data []byte, depth int) (versionNode, int, bool) {
+	if len(data) < 6 || depth > 4 {
+		return versionNode{}, 0, false
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	valueLength := int(binary.LittleEndian.Uint16(data[2:]))
+	node := versionNode{text: binary.LittleEndian.Uint16(data[4:]) == 1}
+	if length < 6 || length > len(data) {
+		return versionNode{}, 0, false
+	}
+	data = data[:length]
+
+	// the key is a zero terminated UTF-16 string
+	offset := 6
+	var key []uint16
+	for ; offset+2 <= len(data); offset += 2 {
+		c := binary.LittleEndian.Uint16(data[offset:])
+		if c == 0 {
+			offset += 2
+			break
+		}
+		key = append(key, c)
+	}
+	node.key = string(utf16.Decode(key))
+	offset = (offset + 3) &^ 3
+
+	// string values count their length in characters
+	if node.text {
+		valueLength *= 2
+	}
+	if offset+valueLength > len(data) {
+		valueLength = max(0, len(data)-offset)
+	}
+	node.value = data[min(offset, len(data)) : min(offset, len(data))+valueLength]
+	offset = (offset + valueLength + 3) &^ 3
+
+	for offset < len(data) {
+		child, childLength, ok := parseVersionNode(data[offset:], depth+1)
+		if !ok {
+			break
+		}
+		node.children = append(node.children, child)
+		offset = (offset + childLength + 3) &^ 3
+	}
+	return node, length, true
+}
+
+// parseVersionInfo reads the fixed file info and the strings of VS_VERSIONINFO
+func parseVersionInfo(data []byte) *VersionInfo {
+	const VS_FFI_SIGNATURE = 0xfeef04bd
+
+	root, _, ok := parseVersionNode(data, 0)
+	if !ok || root.key != "VS_VERSION_INFO" {
+		return nil
+	}
+
+	info := &VersionInfo{Strings: make(map[string]string)}
+	if len(root.value) >= 24 && binary.LittleEndian.Uint32(root.value) == VS_FFI_SIGNATURE {
+		version := func(offset int) string {
+			ms, ls := binary.LittleEndian.Uint32(root.value[offset:]), binary.LittleEndian.Uint32(root.value[offset+4:])
+			return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+		}
+		info.FileVersion = version(8)
+		info.ProductVersion = version(16)
+	}
+
+	// StringFileInfo holds a string table per language and code page, the first is reported
+	for _, fileInfo := range root.children {
+		if fileInfo.key != "StringFileInfo" || len(fileInfo.children) == 0 {
+			continue
+		}
+		for _, str := range fileInfo.children[0].children {
+			chars := make([]uint16, 0, len(str.value)/2)
+			for i := 0; i+2 <= len(str.value); i += 2 {
+				chars = append(chars, binary.LittleEndian.Uint16(str.value[i:]))
+			}
+			info.Strings[str.key] = strings.TrimRight(string(utf16.Decode(chars)), "\x00")
+		}
+		break
+	}
+	return info
+}
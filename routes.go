@@ -0,0 +1,292 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// HTTPRoute is a route registered with net/http or a web framework, recovered from the call registering it: the
+// path is the string constant passed along, the handler the function value. Prefixes of gin, echo and chi groups or
+// gorilla path prefixes are reported as GROUP routes, and aren't joined with the routes registered under them.
+type HTTPRoute struct {
+	Framework string // net/http, gin, echo, chi or gorilla
+	Method    string // GET, POST, ..., ANY when the route accepts any method, GROUP for a prefix
+	Path      string // empty when it isn't a constant
+	Handler   string `json:",omitempty"`
+	Caller    string // the function registering the route
+}
+
+type routeAPI struct {
+	framework string
+	method    string // empty when the pattern or a later call names it
+	methodArg bool   // the method is a string argument, like gin's Handle
+}
+
+var httpMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "HEAD": true, "OPTIONS": true, "CONNECT": true, "TRACE": true}
+
+// the packages of the frameworks, whose own calls to their registration functions aren't routes
+var routeFrameworkPackages = []string{"github.com/gin-gonic/gin", "github.com/labstack/echo", "github.com/go-chi/chi", "github.com/gorilla/mux"}
+
+// gorilla sets the methods of a route with a call on the route HandleFunc returns
+const gorillaMethods = "github.com/gorilla/mux.(*Route).Methods"
+
+// The functions registering routes, by name
+var routeAPIs = func() map[string]routeAPI {
+	apis := map[string]routeAPI{
+		"net/http.HandleFunc":                         {"net/http", "", false},
+		"net/http.Handle":                             {"net/http", "", false},
+		"net/http.(*ServeMux).HandleFunc":             {"net/http", "", false},
+		"net/http.(*ServeMux).Handle":                 {"net/http", "", false},
+		"github.com/gorilla/mux.(*Router).HandleFunc": {"gorilla", "", false},
+		"github.com/gorilla/mux.(*Router).Handle":     {"gorilla", "", false},
+		"github.com/gorilla/mux.(*Router).PathPrefix": {"gorilla", "GROUP", false},
+	}
+	upper := []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+	for _, receiver := range []string{"github.com/gin-gonic/gin.(*RouterGroup).", "github.com/gin-gonic/gin.(*Engine)."} {
+		for _, method := range upper {
+			apis[receiver+method] = routeAPI{"gin", method, false}
+		}
+		apis[receiver+"Any"] = routeAPI{"gin", "ANY", false}
+		apis[receiver+"Handle"] = routeAPI{"gin", "", true}
+		apis[receiver+"Group"] = routeAPI{"gin", "GROUP", false}
+	}
+
+	for _, module := range []string{"github.com/labstack/echo", "github.com/labstack/echo/v4"} {
+		for _, receiver := range []string{".(*Echo).", ".(*Group)."} {
+			for _, method := range append(upper, "CONNECT", "TRACE") {
+				apis[module+receiver+method] = routeAPI{"echo", method, false}
+			}
+			apis[module+receiver+"Any"] = routeAPI{"echo", "ANY", false}
+			apis[module+receiver+"Add"] = routeAPI{"echo", "", true}
+			apis[module+receiver+"Group"] = routeAPI{"echo", "GROUP", false}
+		}
+	}
+
+	for _, module := range []string{"github.com/go-chi/chi", "github.com/go-chi/chi/v5"} {
+		receiver := module + ".(*Mux)."
+		for _, method := range append(upper, "CONNECT", "TRACE") {
+			apis[receiver+method[:1]+strings.ToLower(method[1:])] = routeAPI{"chi", method, false}
+		}
+		apis[receiver+"Handle"] = routeAPI{"chi", "ANY", false}
+		apis[receiver+"HandleFunc"] = routeAPI{"chi", "ANY", false}
+		apis[receiver+"Method"] = routeAPI{"chi", "", true}
+		apis[receiver+"MethodFunc"] = routeAPI{"chi", "", true}
+		apis[receiver+"Route"] = routeAPI{"chi", "GROUP", false}
+		apis[receiver+"Mount"] = routeAPI{"chi", "GROUP", false}
+	}
+	return apis
+}()
+
+// extractRoutes decodes the functions outside of the standard library and the frameworks for calls registering
+// routes, and reads the strings and function values loaded since the previous call as their arguments
+func extractRoutes(ctx context.Context, file *objfile.File, tab *gosym.Table, is64bit bool, littleendian bool) ([]HTTPRoute, error) {
+	apis := make(map[uint64]routeAPI)
+	var methodsEntry uint64
+	for _, fn := range tab.Funcs {
+		if api, ok := routeAPIs[fn.Name]; ok {
+			apis[fn.Entry] = api
+		}
+		if fn.Name == gorillaMethods {
+			methodsEntry = fn.Entry
+		}
+	}
+	if len(apis) == 0 {
+		return nil, nil
+	}
+
+	sections, err := loadStringSections(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if !littleendian {
+		byteOrder = binary.BigEndian
+	}
+	pointerSize := uint64(4)
+	if is64bit {
+		pointerSize = 8
+	}
+	readPointer := func(VA uint64) uint64 {
+		data, err := file.ReadMemory(VA, pointerSize)
+		if err != nil || uint64(len(data)) < pointerSize {
+			return 0
+		}
+		if pointerSize == 8 {
+			return byteOrder.Uint64(data)
+		}
+		return uint64(byteOrder.Uint32(data))
+	}
+
+	// a handler is loaded as the function itself for method values, a funcval pointing to it for functions and
+	// closures, or the itab of a http.Handler whose first method is ServeHTTP
+	handlerAt := func(ref uint64) string {
+		entry := func(pc uint64) *gosym.Func {
+			if fn := tab.PCToFunc(pc); fn != nil && fn.Entry == pc {
+				return fn
+			}
+			return nil
+		}
+		if fn := entry(ref); fn != nil {
+			return strings.TrimSuffix(fn.Name, "-fm")
+		}
+		if fn := entry(readPointer(ref)); fn != nil {
+			return strings.TrimSuffix(fn.Name, "-fm")
+		}
+		if fn := entry(readPointer(ref + 2*pointerSize + 8)); fn != nil && strings.HasSuffix(fn.Name, ".ServeHTTP") {
+			return fn.Name
+		}
+		return ""
+	}
+
+	// only the functions calling a registration function are decoded
+	textStart, text, err := file.Text()
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[uint64]bool, len(apis))
+	for entry := range apis {
+		targets[entry] = true
+	}
+	var callers []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+		fn := tab.PCToFunc(pc)
+		if fn == nil || decoded[fn.Entry] || isStdPackage(fn.PackageName()) || isRouteFrameworkPackage(fn.PackageName()) {
+			continue
+		}
+		decoded[fn.Entry] = true
+		callers = append(callers, fn)
+	}
+
+	var routes []HTTPRoute
+	for _, fn := range callers {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var strs, handlers []string
+		var pending []uint64
+		window := 0
+		lastRoute := -1
+		caller := fn.Name
+		file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			// the length of a string follows its address within a few instructions
+			if window > 0 {
+				window--
+				for _, imm := range inst.Imms {
+					for _, ref := range pending {
+						if value, _, ok := readText(sections, ref, uint64(imm)); ok {
+							strs = append(strs, value)
+							pending = nil
+							window = 0
+							break
+						}
+					}
+				}
+				if window == 0 {
+					pending = nil
+				}
+			}
+
+			for _, ref := range inst.Refs {
+				if handler := handlerAt(ref); handler != "" {
+					handlers = append(handlers, handler)
+				} else if findStringSection(sections, ref) != nil {
+					pending = append(pending, ref)
+					window = stringLengthWindow
+				}
+			}
+
+			if inst.Call == 0 {
+				return true
+			}
+			if api, ok := apis[inst.Call]; ok {
+				routes = append(routes, newHTTPRoute(api, strs, handlers, caller))
+				lastRoute = len(routes) - 1
+			} else if inst.Call == methodsEntry && lastRoute >= 0 && routes[lastRoute].Framework == "gorilla" {
+				var methods []string
+				for _, str := range strs {
+					if httpMethods[str] {
+						methods = append(methods, str)
+					}
+				}
+				if len(methods) > 0 {
+					routes[lastRoute].Method = strings.Join(methods, ",")
+				}
+			}
+			strs, handlers, pending, window = nil, nil, nil, 0
+			return true
+		})
+	}
+	return routes, nil
+}
+
+func isRouteFrameworkPackage(pkg string) bool {
+	for _, prefix := range routeFrameworkPackages {
+		if packageMatches(pkg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHTTPRoute picks the method, path and handler out of the arguments of a registration
+func newHTTPRoute(api routeAPI, strs []string, handlers []string, caller string) HTTPRoute {
+	route := HTTPRoute{Framework: api.framework, Method: api.method, Caller: caller}
+
+	var rest []string
+	for _, str := range strs {
+		if api.methodArg && route.Method == "" && httpMethods[str] {
+			route.Method = str
+		} else {
+			rest = append(rest, str)
+		}
+	}
+
+	// paths start with a slash, or a method and a slash for net/http patterns since Go 1.22, or a host
+	for _, str := range rest {
+		method, path, found := strings.Cut(str, " ")
+		if found && httpMethods[method] && strings.HasPrefix(path, "/") && route.Method == "" {
+			route.Method, route.Path = method, path
+			break
+		}
+		if strings.HasPrefix(str, "/") {
+			route.Path = str
+			break
+		}
+	}
+	if route.Path == "" {
+		for _, str := range rest {
+			if strings.Contains(str, "/") && !strings.ContainsAny(str, " \t\n") {
+				route.Path = str
+				break
+			}
+		}
+	}
+	if route.Method == "" {
+		route.Method = "ANY"
+	}
+
+	// middleware comes first, and handlers of the program are preferred over ones of the standard library. The
+	// HandlerFunc adapter only says the handler is a function value that isn't known statically.
+	for _, handler := range handlers {
+		if handler == "net/http.HandlerFunc.ServeHTTP" {
+			continue
+		}
+		if route.Handler == "" || !isStdPackage(handlerPackage(handler)) {
+			route.Handler = handler
+		}
+	}
+	return route
+}
+
+func handlerPackage(name string) string {
+	return (&gosym.Sym{Name: name}).PackageName()
+}
@@ -0,0 +1,383 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mandiant/GoReSym/runtime/debug"
+)
+
+// The SBOM formats -sbom writes, as JSON
+var sbomFormats = []string{"cyclonedx", "spdx"}
+
+// sbomComponent is a piece of software linked into the binary, the common ground of both formats
+type sbomComponent struct {
+	ref      string // unique within the document, the purl
+	name     string
+	version  string
+	purl     string
+	sum      string   // the go.sum hash of modules
+	licenses []string // SPDX identifiers of the license texts attributed to the module
+	kind     string   // application or library, CycloneDX component types
+}
+
+// goPurl returns the package URL of a Go module, each element of the path escaped
+func goPurl(path string, version string) string {
+	elements := strings.Split(path, "/")
+	for i, element := range elements {
+		elements[i] = url.PathEscape(element)
+	}
+	purl := "pkg:golang/" + strings.Join(elements, "/")
+	if version != "" && version != "(devel)" {
+		purl += "@" + url.PathEscape(version)
+	}
+	return purl
+}
+
+// sbomUUID returns a random version 4 UUID, both formats want each document named uniquely
+func sbomUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// sbomComponents returns the main module first, then the dependencies as linked, replacements in place of the modules
+// they replace, the standard library of the toolchain and the native libraries. Edges map a component to the ones it
+// depends on, from the calls between the modules when the module graph was built. The main module depends on the rest.
+func sbomComponents(fileName string, metadata ExtractMetadata) ([]sbomComponent, map[string][]string) {
+	licenses := make(map[string][]string)
+	for _, license := range metadata.Licenses {
+		for _, module := range license.Modules {
+			licenses[module] = append(licenses[module], license.License)
+		}
+	}
+
+	info := metadata.BuildInfo
+	application := sbomComponent{name: info.Main.Path, version: info.Main.Version, sum: info.Main.Sum, kind: "application"}
+	if application.name == "" {
+		application.name = info.Path
+	}
+	if application.name == "" {
+		application.name = filepath.Base(fileName)
+		application.purl = "pkg:generic/" + url.PathEscape(application.name)
+	} else {
+		application.purl = goPurl(application.name, application.version)
+	}
+	application.ref = application.purl
+	application.licenses = dedupLicenses(licenses[info.Main.Path])
+	components := []sbomComponent{application}
+
+	refs := map[string]string{info.Main.Path: application.ref}
+	deps := make([]*debug.Module, 0, len(info.Deps))
+	for _, dep := range info.Deps {
+		if dep != nil {
+			deps = append(deps, dep)
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Path < deps[j].Path })
+	for _, dep := range deps {
+		linked := dep
+		if dep.Replace != nil {
+			linked = dep.Replace
+		}
+		// a directory replacement has no purl of its own, it's the module at an unknown version
+		if strings.HasPrefix(linked.Path, ".") || strings.HasPrefix(linked.Path, "/") {
+			linked = &debug.Module{Path: dep.Path}
+		}
+		component := sbomComponent{name: linked.Path, version: linked.Version, sum: linked.Sum, kind: "library"}
+		component.purl = goPurl(linked.Path, linked.Version)
+		component.ref = component.purl
+		component.licenses = dedupLicenses(append(licenses[dep.Path], licenses[linked.Path]...))
+		// modules replaced by the same one are a single component
+		if _, seen := refs[linked.Path+" "+linked.Version]; !seen {
+			components = append(components, component)
+		}
+		refs[dep.Path] = component.ref
+		refs[linked.Path+" "+linked.Version] = component.ref
+	}
+
+	// modules no call was found into still belong to the application
+	edges := make(map[string][]string)
+	required := make(map[string]bool)
+	if metadata.Modules != nil {
+		for _, module := range metadata.Modules.Modules {
+			from, ok := refs[module.Path]
+			if !ok {
+				continue
+			}
+			for _, path := range module.Requires {
+				if to, ok := refs[path]; ok && to != from {
+					edges[from] = append(edges[from], to)
+					required[to] = true
+				}
+			}
+		}
+	}
+	for _, component := range components[1:] {
+		if !required[component.ref] {
+			edges[application.ref] = append(edges[application.ref], component.ref)
+		}
+	}
+
+	// the standard library is versioned like a module, v1.18.3 for go1.18.3
+	if version := goSemver(metadata.Version); strings.HasPrefix(version, "1.") {
+		stdlib := sbomComponent{name: "stdlib", version: "go" + strings.TrimPrefix(metadata.Version, "go"), purl: goPurl("stdlib", "v"+version), kind: "library"}
+		stdlib.ref = stdlib.purl
+		components = append(components, stdlib)
+		edges[application.ref] = append(edges[application.ref], stdlib.ref)
+	}
+
+	for _, library := range metadata.NativeLibraries {
+		native := sbomComponent{name: library.Name, version: library.Version, purl: "pkg:generic/" + url.PathEscape(library.Name), kind: "library"}
+		if library.Version != "" {
+			native.purl += "@" + url.PathEscape(library.Version)
+		}
+		native.ref = native.purl
+		components = append(components, native)
+		edges[application.ref] = append(edges[application.ref], native.ref)
+	}
+	for ref := range edges {
+		sort.Strings(edges[ref])
+	}
+	return components, edges
+}
+
+func dedupLicenses(licenses []string) []string {
+	sort.Strings(licenses)
+	var unique []string
+	for i, license := range licenses {
+		if i == 0 || license != licenses[i-1] {
+			unique = append(unique, license)
+		}
+	}
+	return unique
+}
+
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components,omitempty"`
+	Dependencies []cycloneDXDependency `json:"dependencies,omitempty"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Licenses   []cycloneDXLicense  `json:"licenses,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// cycloneDXLicense is either a license or an expression, such as the MIT OR Apache-2.0 of SPDX tags
+type cycloneDXLicense struct {
+	License *struct {
+		ID string `json:"id"`
+	} `json:"license,omitempty"`
+	Expression string `json:"expression,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+func (c sbomComponent) cycloneDX() cycloneDXComponent {
+	component := cycloneDXComponent{BOMRef: c.ref, Type: c.kind, Name: c.name, Version: c.version, PURL: c.purl}
+	for _, id := range c.licenses {
+		var license cycloneDXLicense
+		if strings.Contains(id, " ") {
+			license.Expression = id
+		} else {
+			license.License = &struct {
+				ID string `json:"id"`
+			}{id}
+		}
+		component.Licenses = append(component.Licenses, license)
+	}
+	// the go.sum hash is of the module's files, not of an artifact, so it's no CycloneDX hash
+	if c.sum != "" {
+		component.Properties = append(component.Properties, cycloneDXProperty{Name: "goresym:go.sum", Value: c.sum})
+	}
+	return component
+}
+
+// cycloneDXSBOM describes the binary as a CycloneDX 1.5 document, the binary is the metadata component
+func cycloneDXSBOM(fileName string, digest []byte, metadata ExtractMetadata, now time.Time) cycloneDXDocument {
+	components, edges := sbomComponents(fileName, metadata)
+	doc := cycloneDXDocument{BOMFormat: "CycloneDX", SpecVersion: "1.5", SerialNumber: "urn:uuid:" + sbomUUID(), Version: 1}
+	doc.Metadata.Timestamp = now.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: "GoReSym", Version: Version}}
+	doc.Metadata.Component = components[0].cycloneDX()
+	if digest != nil {
+		doc.Metadata.Component.Hashes = []cycloneDXHash{{Alg: "SHA-256", Content: hex.EncodeToString(digest)}}
+	}
+	for _, key := range []struct{ name, value string }{{"goresym:os", metadata.OS}, {"goresym:arch", metadata.Arch}, {"goresym:file", filepath.Base(fileName)}} {
+		if key.value != "" {
+			doc.Metadata.Component.Properties = append(doc.Metadata.Component.Properties, cycloneDXProperty{Name: key.name, Value: key.value})
+		}
+	}
+
+	for _, component := range components[1:] {
+		doc.Components = append(doc.Components, component.cycloneDX())
+	}
+	for _, component := range components {
+		doc.Dependencies = append(doc.Dependencies, cycloneDXDependency{Ref: component.ref, DependsOn: edges[component.ref]})
+	}
+	return doc
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	PackageFileName  string            `json:"packageFileName,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxID turns a purl into an SPDX identifier, letters, digits, dots and dashes only
+func spdxID(ref string) string {
+	return "SPDXRef-" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, ref)
+}
+
+// spdxSBOM describes the binary as an SPDX 2.3 document, the document describes the main package. The licenses are
+// declared from the license texts found in the binary, nothing is concluded.
+func spdxSBOM(fileName string, digest []byte, metadata ExtractMetadata, now time.Time) spdxDocument {
+	components, edges := sbomComponents(fileName, metadata)
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              filepath.Base(fileName),
+		DocumentNamespace: "https://spdx.org/spdxdocs/goresym/" + url.PathEscape(filepath.Base(fileName)) + "-" + sbomUUID(),
+		CreationInfo:      spdxCreationInfo{Created: now.UTC().Format(time.RFC3339), Creators: []string{"Tool: GoReSym-" + Version}},
+	}
+
+	for i, component := range components {
+		pkg := spdxPackage{
+			Name:             component.name,
+			SPDXID:           spdxID(component.ref),
+			VersionInfo:      component.version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs:     []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: component.purl}},
+		}
+		if len(component.licenses) > 0 {
+			var declared []string
+			for _, license := range component.licenses {
+				if strings.Contains(license, " ") && len(component.licenses) > 1 {
+					license = "(" + license + ")"
+				}
+				declared = append(declared, license)
+			}
+			pkg.LicenseDeclared = strings.Join(declared, " AND ")
+		}
+		if i == 0 {
+			pkg.PackageFileName = filepath.Base(fileName)
+			pkg.PrimaryPurpose = "APPLICATION"
+			if digest != nil {
+				pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: hex.EncodeToString(digest)}}
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSPDXElement: pkg.SPDXID})
+		}
+		doc.Packages = append(doc.Packages, pkg)
+	}
+	for _, component := range components {
+		for _, to := range edges[component.ref] {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: spdxID(component.ref), RelationshipType: "DEPENDS_ON", RelatedSPDXElement: spdxID(to)})
+		}
+	}
+	return doc
+}
+
+// sbomDocument returns the SBOM of the binary in the given format
+func sbomDocument(format string, fileName string, digest []byte, metadata ExtractMetadata, now time.Time) (interface{}, error) {
+	switch format {
+	case "cyclonedx":
+		return cycloneDXSBOM(fileName, digest, metadata, now), nil
+	case "spdx":
+		return spdxSBOM(fileName, digest, metadata, now), nil
+	}
+	return nil, fmt.Errorf("unknown SBOM format %s, expected one of %s", format, strings.Join(sbomFormats, ", "))
+}
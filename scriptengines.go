@@ -0,0 +1,151 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// ScriptingMetadata reports the interpreters embedded in the program. Malware embeds them to run scripts that
+// are easy to swap without rebuilding, so the scripts found in the strings are reported with them.
+type ScriptingMetadata struct {
+	Engines []ScriptEngine
+	Scripts []EmbeddedScript `json:",omitempty"` // only found with -strings
+}
+
+type ScriptEngine struct {
+	Name     string
+	Language string
+	Evidence []string // the packages, or types with -t, that matched
+}
+
+type EmbeddedScript struct {
+	Language string
+	Address  uint64
+	Size     int
+	SHA256   string
+	Source   string
+}
+
+// Interpreters by the packages they live in and the types a program holding one references
+var scriptEngineSignatures = []struct {
+	name     string
+	language string
+	packages []string // a package matches itself and every package below it
+	types    []string
+}{
+	{"yaegi", "go", []string{"github.com/traefik/yaegi"}, []string{"*interp.Interpreter"}},
+	{"goja", "javascript", []string{"github.com/dop251/goja"}, []string{"*goja.Runtime"}},
+	{"otto", "javascript", []string{"github.com/robertkrimen/otto"}, []string{"*otto.Otto"}},
+	{"v8go", "javascript", []string{"rogchap.com/v8go"}, []string{"*v8go.Isolate"}},
+	{"quickjs", "javascript", []string{"github.com/buke/quickjs-go", "modernc.org/quickjs"}, nil},
+	{"gopher-lua", "lua", []string{"github.com/yuin/gopher-lua"}, []string{"*lua.LState"}},
+	{"go-lua", "lua", []string{"github.com/Shopify/go-lua", "github.com/aarzilli/golua"}, nil},
+	{"starlark", "starlark", []string{"go.starlark.net"}, []string{"*starlark.Thread"}},
+	{"tengo", "tengo", []string{"github.com/d5/tengo"}, []string{"*tengo.Script"}},
+	{"anko", "anko", []string{"github.com/mattn/anko"}, nil},
+	{"gpython", "python", []string{"github.com/go-python/gpython"}, nil},
+	{"expr", "expression", []string{"github.com/expr-lang/expr", "github.com/antonmedv/expr"}, nil},
+	{"cel-go", "expression", []string{"github.com/google/cel-go"}, nil},
+	{"govaluate", "expression", []string{"github.com/Knetic/govaluate"}, nil},
+}
+
+// The constructs of each language, a string with enough of them is taken for a script. Expressions are too short
+// to tell from other strings, so their scripts aren't looked for.
+var scriptLanguageKeywords = map[string][]*regexp.Regexp{
+	"javascript": regexpList(`\bfunction\s*\w*\s*\(`, `\bvar\s+\w`, `\blet\s+\w`, `\bconst\s+\w`, `=>`, `\breturn\b`, `\bthis\.`, `\bconsole\.\w+\(`, `\bnew\s+[A-Z]\w*\(`, `===|!==`, `\brequire\(`),
+	"lua":        regexpList(`\blocal\s+\w`, `\bfunction\b`, `\bend\b`, `\bthen\b`, `\belseif\b`, `~=`, `\bnil\b`, `\bi?pairs\(`, `\brequire\s*\(?["']`),
+	"go":         regexpList(`^\s*(//[^\n]*\n\s*)*package\s+\w+`, `\bfunc\s+\w*\(`, `\bimport\s+[("]`, `:=`),
+	"starlark":   regexpList(`\bdef\s+\w+\(`, `\bload\(`, `\breturn\b`, `\bfor\s+\w+\s+in\b`, `\bNone\b`),
+	"python":     regexpList(`\bdef\s+\w+\(`, `\bimport\s+\w`, `\breturn\b`, `\bfor\s+\w+\s+in\b`, `\bNone\b`, `\bself\.`),
+	"tengo":      regexpList(`\bimport\("`, `:=`, `\bfunc\(`, `\breturn\b`),
+	"anko":       regexpList(`\bfunc\s*\w*\(`, `\bvar\s+\w`, `\breturn\b`, `\bimport\(`),
+}
+
+// a script is at least this long and holds this many of its language's constructs
+const (
+	minScriptLength   = 64
+	minScriptKeywords = 3
+)
+
+func regexpList(patterns ...string) []*regexp.Regexp {
+	var list []*regexp.Regexp
+	for _, pattern := range patterns {
+		list = append(list, regexp.MustCompile(pattern))
+	}
+	return list
+}
+
+// detectScriptEngines matches the packages of the functions and the parsed types, then looks for scripts in the
+// languages of the engines found
+func detectScriptEngines(tab *gosym.Table, types []objfile.Type, strs []StringMetadata) *ScriptingMetadata {
+	packages := make(map[string]bool)
+	for _, fn := range tab.Funcs {
+		packages[fn.PackageName()] = true
+	}
+	typeNames := make(map[string]bool)
+	for _, typ := range types {
+		typeNames[typ.Str] = true
+	}
+
+	scripting := &ScriptingMetadata{}
+	languages := make(map[string]bool)
+	for _, signature := range scriptEngineSignatures {
+		engine := ScriptEngine{Name: signature.name, Language: signature.language}
+		for _, prefix := range signature.packages {
+			for pkg := range packages {
+				if packageMatches(pkg, prefix) {
+					engine.Evidence = append(engine.Evidence, "package "+prefix)
+					break
+				}
+			}
+		}
+		for _, name := range signature.types {
+			if typeNames[name] {
+				engine.Evidence = append(engine.Evidence, "type "+name)
+			}
+		}
+		if len(engine.Evidence) > 0 {
+			scripting.Engines = append(scripting.Engines, engine)
+			languages[signature.language] = true
+		}
+	}
+	if len(scripting.Engines) == 0 {
+		return nil
+	}
+
+	for _, str := range strs {
+		if language := scriptLanguage(str.Value, languages); language != "" {
+			scripting.Scripts = append(scripting.Scripts, EmbeddedScript{Language: language, Address: str.Address, Size: len(str.Value), SHA256: sha256Hex([]byte(str.Value)), Source: str.Value})
+		}
+	}
+	sort.SliceStable(scripting.Scripts, func(i, j int) bool {
+		return scripting.Scripts[i].Address < scripting.Scripts[j].Address
+	})
+	return scripting
+}
+
+// scriptLanguage returns the language of the engines whose constructs the text holds the most of, if it's a script
+func scriptLanguage(text string, languages map[string]bool) string {
+	if len(text) < minScriptLength || !strings.ContainsAny(text, "\n;") {
+		return ""
+	}
+
+	best, bestCount := "", 0
+	for language := range languages {
+		count := 0
+		for _, keyword := range scriptLanguageKeywords[language] {
+			if keyword.MatchString(text) {
+				count++
+			}
+		}
+		if count >= minScriptKeywords && (count > bestCount || (count == bestCount && language < best)) {
+			best, bestCount = language, count
+		}
+	}
+	return best
+}
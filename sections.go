@@ -0,0 +1,84 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"math"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// SectionMetadata describes a section as laid out in the file and in memory. Packed binaries typically show up as
+// code or data with an entropy close to 8, or as sections that are much larger in memory than in the file.
+type SectionMetadata struct {
+	Name        string
+	Address     uint64
+	Size        uint64 // in memory
+	Offset      uint64
+	FileSize    uint64
+	Permissions string  // rwx, with - for the ones not set
+	Entropy     float64 // bits per byte of the file data, from 0 to 8
+}
+
+// shannonEntropy returns the bits per byte needed to encode the data, 8 for random or compressed data
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(data))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// sectionMetadata also returns how many bytes of section data it read
+func sectionMetadata(file *objfile.File) ([]SectionMetadata, uint64, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var result []SectionMetadata
+	scanned := uint64(0)
+	for _, sec := range sections {
+		permissions := []byte("---")
+		if sec.Readable {
+			permissions[0] = 'r'
+		}
+		if sec.Writable {
+			permissions[1] = 'w'
+		}
+		if sec.Executable {
+			permissions[2] = 'x'
+		}
+
+		metadata := SectionMetadata{
+			Name:        sec.Name,
+			Address:     sec.Addr,
+			Size:        sec.Size,
+			Offset:      sec.Offset,
+			FileSize:    sec.FileSize,
+			Permissions: string(permissions),
+		}
+
+		if data, err := sec.Data(); err == nil {
+			if uint64(len(data)) > sec.FileSize {
+				data = data[:sec.FileSize]
+			}
+			scanned += uint64(len(data))
+			metadata.Entropy = math.Round(shannonEntropy(data)*1000) / 1000
+		}
+		result = append(result, metadata)
+	}
+	return result, scanned, nil
+}
@@ -0,0 +1,588 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1" // registers the hashes signatures may use
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// SignatureMetadata reports the code signature of a PE or Mach-O file. Unsigned and invalidly signed samples are worth
+// a closer look, legitimate software for Windows and macOS is usually signed.
+type SignatureMetadata struct {
+	Format          string              // authenticode or codesign
+	Status          string              // unsigned, valid, ad-hoc (Mach-O signed without an identity) or invalid
+	Problems        []string            `json:",omitempty"` // why the signature is invalid
+	DigestAlgorithm string              `json:",omitempty"`
+	Identifier      string              `json:",omitempty"` // codesign only
+	TeamID          string              `json:",omitempty"` // codesign only
+	Signers         []SignerCertificate `json:",omitempty"` // the signing certificate first, then the ones it chains to
+	BuildIDCovered  bool                // the signature was verified and covers the Go build ID
+}
+
+// SignerCertificate is a certificate of the signer's chain. The chain is verified among the certificates the
+// signature carries, whether its root is trusted is left to the analyst.
+type SignerCertificate struct {
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	Fingerprint  string // SHA256 of the DER encoding
+}
+
+var (
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type digestAlgorithm struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+	rsa  x509.SignatureAlgorithm // the signature algorithms of the digest by the signer's key type
+	ec   x509.SignatureAlgorithm
+}
+
+var digestAlgorithms = []digestAlgorithm{
+	{oidSHA1, crypto.SHA1, x509.SHA1WithRSA, x509.ECDSAWithSHA1},
+	{oidSHA256, crypto.SHA256, x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+	{oidSHA384, crypto.SHA384, x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+	{oidSHA512, crypto.SHA512, x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+}
+
+// PKCS#7 as RFC 2315 defines it, down to what verifying a signer takes
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// the content Authenticode signs, the digest of the file
+type spcIndirectDataContent struct {
+	Data          asn1.RawValue
+	MessageDigest struct {
+		DigestAlgorithm pkix.AlgorithmIdentifier
+		Digest          []byte
+	}
+}
+
+// verifyCodeSignature verifies the signature against the file it's embedded in. Returns nil for ELF files.
+func verifyCodeSignature(file *objfile.File, buildId string) (*SignatureMetadata, error) {
+	signature, err := file.CodeSignature()
+	if signature == nil {
+		return nil, err
+	}
+	report := &SignatureMetadata{Format: signature.Format, Status: "unsigned"}
+	if signature.Data == nil {
+		return report, err
+	}
+
+	fileData, err := file.Data()
+	if err != nil {
+		return report, err
+	}
+
+	buildIdOffset := -1
+	if buildId != "" {
+		buildIdOffset = bytes.Index(fileData, []byte("Go build ID: \""+buildId))
+	}
+
+	problem := func(format string, args ...any) {
+		report.Problems = append(report.Problems, fmt.Sprintf(format, args...))
+	}
+	switch signature.Format {
+	case "authenticode":
+		verifyAuthenticode(report, signature, fileData, problem)
+		if buildIdOffset != -1 {
+			report.BuildIDCovered = true
+			for _, excluded := range signature.Excluded {
+				if uint64(buildIdOffset) >= excluded.Offset && uint64(buildIdOffset) < excluded.Offset+excluded.Size {
+					report.BuildIDCovered = false
+				}
+			}
+		}
+	case "codesign":
+		codeLimit := verifyCodesign(report, signature, fileData, problem)
+		report.BuildIDCovered = buildIdOffset != -1 && uint64(buildIdOffset+len(buildId)) < codeLimit
+	}
+
+	if len(report.Problems) > 0 {
+		report.Status = "invalid"
+		report.BuildIDCovered = false
+	} else if len(report.Signers) == 0 {
+		report.Status = "ad-hoc"
+	} else {
+		report.Status = "valid"
+	}
+	return report, nil
+}
+
+// verifyAuthenticode checks the digest of the file against the signed one, then the signer
+func verifyAuthenticode(report *SignatureMetadata, signature *objfile.CodeSignature, fileData []byte, problem func(string, ...any)) {
+	signedData, err := parseSignedData(signature.Data)
+	if err != nil {
+		problem("malformed PKCS#7: %s", err)
+		return
+	}
+
+	// the explicitly tagged content holds the SpcIndirectDataContent, the signer signs it without its tag and length
+	var content spcIndirectDataContent
+	var signedContent asn1.RawValue
+	if _, err := asn1.Unmarshal(signedData.ContentInfo.Content.Bytes, &content); err != nil {
+		problem("malformed SpcIndirectDataContent: %s", err)
+		return
+	}
+	asn1.Unmarshal(signedData.ContentInfo.Content.Bytes, &signedContent)
+	algorithm, ok := digestAlgorithmByOID(content.MessageDigest.DigestAlgorithm.Algorithm)
+	if !ok {
+		problem("unsupported digest algorithm %s", content.MessageDigest.DigestAlgorithm.Algorithm)
+		return
+	}
+	hash := algorithm.hash
+	report.DigestAlgorithm = hash.String()
+
+	// the file in order, minus the excluded ranges, which are sorted by offset
+	digest := hash.New()
+	position := uint64(0)
+	for _, excluded := range signature.Excluded {
+		if excluded.Offset+excluded.Size > uint64(len(fileData)) || excluded.Offset < position {
+			problem("excluded range 0x%x+0x%x is outside the file", excluded.Offset, excluded.Size)
+			return
+		}
+		digest.Write(fileData[position:excluded.Offset])
+		position = excluded.Offset + excluded.Size
+	}
+	digest.Write(fileData[position:])
+	if !bytes.Equal(digest.Sum(nil), content.MessageDigest.Digest) {
+		problem("the file digest doesn't match the signed one, the file was modified after signing")
+	}
+
+	report.Signers = verifySigner(signedData, signedContent.Bytes, problem)
+}
+
+// verifyCodesign checks the hashes of the CodeDirectory against the pages and the blobs they cover, then the signer
+// of the CMS blob if there is one. Returns the offset up to which the code is covered.
+func verifyCodesign(report *SignatureMetadata, signature *objfile.CodeSignature, fileData []byte, problem func(string, ...any)) uint64 {
+	const (
+		CSMAGIC_EMBEDDED_SIGNATURE = 0xfade0cc0
+		CSMAGIC_CODEDIRECTORY      = 0xfade0c02
+		CSMAGIC_BLOBWRAPPER        = 0xfade0b01
+
+		CSSLOT_CODEDIRECTORY = 0
+		CSSLOT_SIGNATURESLOT = 0x10000
+
+		CS_ADHOC = 0x2
+	)
+
+	// the blobs are big endian, whatever the architecture
+	data := signature.Data
+	if len(data) < 12 || binary.BigEndian.Uint32(data) != CSMAGIC_EMBEDDED_SIGNATURE {
+		problem("code signature is not an embedded signature SuperBlob")
+		return 0
+	}
+	blobs := make(map[uint32][]byte)
+	count := binary.BigEndian.Uint32(data[8:])
+	for i := uint32(0); i < count && 12+8*i+8 <= uint32(len(data)); i++ {
+		slot := binary.BigEndian.Uint32(data[12+8*i:])
+		offset := binary.BigEndian.Uint32(data[12+8*i+4:])
+		if uint64(offset)+8 > uint64(len(data)) {
+			problem("blob %d is outside the code signature", slot)
+			continue
+		}
+		length := binary.BigEndian.Uint32(data[offset+4:])
+		if length < 8 || uint64(offset)+uint64(length) > uint64(len(data)) {
+			problem("blob %d is truncated", slot)
+			continue
+		}
+		blobs[slot] = data[offset : offset+length]
+	}
+
+	codeDirectory := blobs[CSSLOT_CODEDIRECTORY]
+	if len(codeDirectory) < 44 || binary.BigEndian.Uint32(codeDirectory) != CSMAGIC_CODEDIRECTORY {
+		problem("no CodeDirectory")
+		return 0
+	}
+	version := binary.BigEndian.Uint32(codeDirectory[8:])
+	flags := binary.BigEndian.Uint32(codeDirectory[12:])
+	hashOffset := binary.BigEndian.Uint32(codeDirectory[16:])
+	identOffset := binary.BigEndian.Uint32(codeDirectory[20:])
+	specialSlots := binary.BigEndian.Uint32(codeDirectory[24:])
+	codeSlots := binary.BigEndian.Uint32(codeDirectory[28:])
+	codeLimit := uint64(binary.BigEndian.Uint32(codeDirectory[32:]))
+	hashSize := uint32(codeDirectory[36])
+	hashType := codeDirectory[37]
+	pageShift := codeDirectory[39]
+
+	report.Identifier = cString(codeDirectory, identOffset)
+	if version >= 0x20200 && len(codeDirectory) >= 52 {
+		if teamOffset := binary.BigEndian.Uint32(codeDirectory[48:]); teamOffset != 0 {
+			report.TeamID = cString(codeDirectory, teamOffset)
+		}
+	}
+	if version >= 0x20300 && len(codeDirectory) >= 64 {
+		if codeLimit64 := binary.BigEndian.Uint64(codeDirectory[56:]); codeLimit64 != 0 {
+			codeLimit = codeLimit64
+		}
+	}
+
+	// CS_HASHTYPE_SHA1, SHA256, SHA256 truncated to 20 bytes and SHA384
+	hashes := map[byte]crypto.Hash{1: crypto.SHA1, 2: crypto.SHA256, 3: crypto.SHA256, 4: crypto.SHA384}
+	hash, ok := hashes[hashType]
+	if !ok || hashSize == 0 || int(hashSize) > hash.Size() {
+		problem("unsupported hash type %d of %d bytes", hashType, hashSize)
+		return 0
+	}
+	report.DigestAlgorithm = hash.String()
+	slotHash := func(index int64) []byte {
+		start := int64(hashOffset) + index*int64(hashSize)
+		if start < 0 || start+int64(hashSize) > int64(len(codeDirectory)) {
+			return nil
+		}
+		return codeDirectory[start : start+int64(hashSize)]
+	}
+	matches := func(index int64, data []byte) bool {
+		digest := hash.New()
+		digest.Write(data)
+		return bytes.Equal(digest.Sum(nil)[:hashSize], slotHash(index))
+	}
+
+	if codeLimit > uint64(len(fileData)) {
+		problem("the code limit 0x%x is past the end of the file", codeLimit)
+		return 0
+	}
+	pageSize := codeLimit
+	if pageShift != 0 {
+		pageSize = uint64(1) << pageShift
+	}
+	for i := uint64(0); i < uint64(codeSlots); i++ {
+		start := i * pageSize
+		if start >= codeLimit {
+			problem("%d code slots for a code limit of 0x%x", codeSlots, codeLimit)
+			break
+		}
+		if !matches(int64(i), fileData[start:min(start+pageSize, codeLimit)]) {
+			problem("the page at 0x%x doesn't match its hash, the file was modified after signing", start)
+			break
+		}
+	}
+
+	// special slots count down from -1 and hash the blobs of the same type, such as the requirements and entitlements
+	for slot, blob := range blobs {
+		if slot >= 1 && slot <= specialSlots && !matches(-int64(slot), blob) {
+			problem("blob %d doesn't match its hash in the CodeDirectory", slot)
+		}
+	}
+
+	// ad-hoc signatures, which the Go linker writes for darwin/arm64, have an empty CMS blob or none at all
+	cms := blobs[CSSLOT_SIGNATURESLOT]
+	if flags&CS_ADHOC != 0 || len(cms) <= 8 {
+		return codeLimit
+	}
+	if binary.BigEndian.Uint32(cms) != CSMAGIC_BLOBWRAPPER {
+		problem("the signature blob is not a CMS blob")
+		return codeLimit
+	}
+	signedData, err := parseSignedData(cms[8:])
+	if err != nil {
+		problem("malformed CMS: %s", err)
+		return codeLimit
+	}
+
+	// the signature is detached, it signs the CodeDirectory
+	report.Signers = verifySigner(signedData, codeDirectory, problem)
+	return codeLimit
+}
+
+func parseSignedData(data []byte) (*pkcs7SignedData, error) {
+	// Apple encodes the CMS of code signatures in BER, with indefinite lengths encoding/asn1 refuses
+	data, _, err := berToDER(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentInfo pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(data, &contentInfo); err != nil {
+		return nil, err
+	}
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %s is not SignedData", contentInfo.ContentType)
+	}
+	var signedData pkcs7SignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, err
+	}
+	if len(signedData.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%d signers, expected one", len(signedData.SignerInfos))
+	}
+	return &signedData, nil
+}
+
+// verifySigner checks the signer's signature over the digest of the content, and its chain among the certificates
+// the signature carries. Returns the chain.
+func verifySigner(signedData *pkcs7SignedData, content []byte, problem func(string, ...any)) []SignerCertificate {
+	certificates, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil {
+		problem("malformed certificates: %s", err)
+		return nil
+	}
+
+	signer := signedData.SignerInfos[0]
+	var signerCertificate *x509.Certificate
+	for _, certificate := range certificates {
+		if bytes.Equal(certificate.RawIssuer, signer.IssuerAndSerialNumber.Issuer.FullBytes) && certificate.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 {
+			signerCertificate = certificate
+		}
+	}
+	if signerCertificate == nil {
+		problem("the signing certificate is not included")
+		return nil
+	}
+	chain := signerChain(signerCertificate, certificates, problem)
+
+	algorithm, ok := digestAlgorithmByOID(signer.DigestAlgorithm.Algorithm)
+	if !ok {
+		problem("unsupported signer digest algorithm %s", signer.DigestAlgorithm.Algorithm)
+		return chain
+	}
+
+	// with authenticated attributes, the signature is over them and their message digest is the content's
+	signed := content
+	if len(signer.AuthenticatedAttributes.FullBytes) > 0 {
+		messageDigest, err := attributeMessageDigest(signer.AuthenticatedAttributes.Bytes)
+		if err != nil {
+			problem("%s", err)
+			return chain
+		}
+		digest := algorithm.hash.New()
+		digest.Write(content)
+		if !bytes.Equal(digest.Sum(nil), messageDigest) {
+			problem("the signed message digest doesn't match the content")
+		}
+
+		// they're signed as the SET OF they are, not the implicitly tagged field they're encoded as
+		signed = append([]byte{0x31}, signer.AuthenticatedAttributes.FullBytes[1:]...)
+	}
+
+	signatureAlgorithm := algorithm.rsa
+	if signerCertificate.PublicKeyAlgorithm == x509.ECDSA {
+		signatureAlgorithm = algorithm.ec
+	}
+	if err := signerCertificate.CheckSignature(signatureAlgorithm, signed, signer.EncryptedDigest); err != nil {
+		problem("the signer's signature doesn't verify: %s", err)
+	}
+	return chain
+}
+
+// signerChain follows the issuers of the signing certificate among the certificates
+func signerChain(signer *x509.Certificate, certificates []*x509.Certificate, problem func(string, ...any)) []SignerCertificate {
+	var chain []SignerCertificate
+	for current := signer; current != nil && len(chain) <= len(certificates); {
+		chain = append(chain, SignerCertificate{
+			Subject:      current.Subject.String(),
+			Issuer:       current.Issuer.String(),
+			SerialNumber: current.SerialNumber.Text(16),
+			NotBefore:    current.NotBefore.UTC(),
+			NotAfter:     current.NotAfter.UTC(),
+			Fingerprint:  sha256Hex(current.Raw),
+		})
+		if bytes.Equal(current.RawIssuer, current.RawSubject) {
+			break
+		}
+
+		var issuer *x509.Certificate
+		for _, candidate := range certificates {
+			if bytes.Equal(candidate.RawSubject, current.RawIssuer) && candidate != current {
+				issuer = candidate
+			}
+		}
+		// CheckSignatureFrom refuses SHA-1, which older code signing chains still use
+		if issuer != nil {
+			if err := issuer.CheckSignature(current.SignatureAlgorithm, current.RawTBSCertificate, current.Signature); err != nil {
+				problem("%s is not signed by its issuer: %s", current.Subject, err)
+			}
+		}
+		current = issuer
+	}
+	return chain
+}
+
+// berToDER re-encodes the first element of data with definite lengths, returning it and the bytes it took. Elements
+// with definite lengths are copied as they are, which keeps the signed attributes exactly as they were signed.
+func berToDER(data []byte) ([]byte, int, error) {
+	// the tag, with its subsequent octets for high tag numbers
+	header := 1
+	if len(data) < 2 {
+		return nil, 0, errors.New("BER element truncated")
+	}
+	if data[0]&0x1f == 0x1f {
+		for header < len(data) && data[header]&0x80 != 0 {
+			header++
+		}
+		header++
+	}
+	if header >= len(data) {
+		return nil, 0, errors.New("BER tag truncated")
+	}
+	tag := data[:header]
+
+	lengthByte := data[header]
+	header++
+	if lengthByte != 0x80 {
+		length := int(lengthByte)
+		if lengthByte&0x80 != 0 {
+			octets := int(lengthByte & 0x7f)
+			if octets > 4 || header+octets > len(data) {
+				return nil, 0, errors.New("BER length truncated")
+			}
+			length = 0
+			for _, b := range data[header : header+octets] {
+				length = length<<8 | int(b)
+			}
+			header += octets
+		}
+		if length < 0 || header+length > len(data) {
+			return nil, 0, errors.New("BER element truncated")
+		}
+		if tag[0]&0x20 == 0 {
+			return data[:header+length], header + length, nil
+		}
+
+		// constructed elements may hold indefinite lengths themselves
+		contents, err := berContentsToDER(data[header : header+length])
+		if err != nil {
+			return nil, 0, err
+		}
+		return derElement(tag, contents), header + length, nil
+	}
+
+	// indefinite, the contents end with two zero octets
+	var contents []byte
+	position := header
+	for {
+		if position+2 > len(data) {
+			return nil, 0, errors.New("BER end of contents missing")
+		}
+		if data[position] == 0 && data[position+1] == 0 {
+			return derElement(tag, contents), position + 2, nil
+		}
+		element, size, err := berToDER(data[position:])
+		if err != nil {
+			return nil, 0, err
+		}
+		contents = append(contents, element...)
+		position += size
+	}
+}
+
+func berContentsToDER(data []byte) ([]byte, error) {
+	var contents []byte
+	for len(data) > 0 {
+		element, size, err := berToDER(data)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, element...)
+		data = data[size:]
+	}
+	return contents, nil
+}
+
+func derElement(tag []byte, contents []byte) []byte {
+	element := append([]byte{}, tag...)
+	switch length := len(contents); {
+	case length < 0x80:
+		element = append(element, byte(length))
+	default:
+		var octets []byte
+		for ; length > 0; length >>= 8 {
+			octets = append([]byte{byte(length)}, octets...)
+		}
+		element = append(element, 0x80|byte(len(octets)))
+		element = append(element, octets...)
+	}
+	return append(element, contents...)
+}
+
+func attributeMessageDigest(attributes []byte) ([]byte, error) {
+	for len(attributes) > 0 {
+		var attribute pkcs7Attribute
+		rest, err := asn1.Unmarshal(attributes, &attribute)
+		if err != nil {
+			return nil, fmt.Errorf("malformed authenticated attributes: %w", err)
+		}
+		attributes = rest
+
+		if attribute.Type.Equal(oidMessageDigest) {
+			var digest []byte
+			if _, err := asn1.Unmarshal(attribute.Values.Bytes, &digest); err != nil {
+				return nil, fmt.Errorf("malformed message digest: %w", err)
+			}
+			return digest, nil
+		}
+	}
+	return nil, errors.New("no message digest among the authenticated attributes")
+}
+
+func digestAlgorithmByOID(oid asn1.ObjectIdentifier) (digestAlgorithm, bool) {
+	for _, known := range digestAlgorithms {
+		if known.oid.Equal(oid) {
+			return known, true
+		}
+	}
+	return digestAlgorithm{}, false
+}
+
+func cString(data []byte, offset uint32) string {
+	if uint64(offset) >= uint64(len(data)) {
+		return ""
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end == -1 {
+		return ""
+	}
+	return string(data[offset : uint32(end)+offset])
+}
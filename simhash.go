@@ -0,0 +1,65 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+)
+
+// The symbol SimHash is a locality sensitive hash of the function and package names in the pclntab. Builds of the
+// same program share most of their names, so their hashes differ in few bits even when the file hashes have nothing
+// in common. Comparing the number of differing bits clusters related samples without comparing their symbol lists.
+func symbolSimHash(funcs []gosym.Func) string {
+	if len(funcs) == 0 {
+		return ""
+	}
+
+	var weights [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	packages := make(map[string]bool)
+	for _, fn := range funcs {
+		add(fn.Name)
+		packages[fn.PackageName()] = true
+	}
+	// packages are far more stable between versions than individual functions, count each once more
+	for pkg := range packages {
+		add("package " + pkg)
+	}
+
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// simHashDistance is the number of differing bits, 0 for the same symbol set and around 32 for unrelated ones
+func simHashDistance(a string, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SimHash %q", a)
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SimHash %q", b)
+	}
+	return bits.OnesCount64(x ^ y), nil
+}
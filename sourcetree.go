@@ -0,0 +1,128 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+)
+
+// SourceTree is the directory layout of the project as it was on the build machine, rebuilt from the paths of the
+// files defining functions outside the standard library. Absolute paths give away the developer's home directory.
+type SourceTree struct {
+	Root  []SourceNode
+	Users []string `json:",omitempty"` // from the home directories in any source path, ex: /home/alice or C:/Users/alice
+}
+
+// SourceNode is a directory or a source file. Directories holding a single directory are merged into it, ex: home/alice.
+type SourceNode struct {
+	Name      string
+	Functions int          // defined in the file, or in the files below the directory
+	Children  []SourceNode `json:",omitempty"` // empty for files
+}
+
+var homeDirectoryRegex = regexp.MustCompile(`^(?:/home/|/Users/|[A-Za-z]:/Users/|[A-Za-z]:/Documents and Settings/)([^/]+)/|^(/root)/`)
+
+// buildSourceTree counts the functions of each file by the file of their entry
+func buildSourceTree(tab *gosym.Table) *SourceTree {
+	users := make(map[string]bool)
+	for path := range tab.Files {
+		if match := homeDirectoryRegex.FindStringSubmatch(strings.ReplaceAll(path, `\`, "/")); match != nil {
+			if match[1] != "" {
+				users[match[1]] = true
+			} else {
+				users["root"] = true
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, fn := range tab.Funcs {
+		if isStdPackage(fn.PackageName()) {
+			continue
+		}
+		if path, _, _ := tab.PCToLine(fn.Entry); strings.Contains(path, "/") || strings.Contains(path, `\`) {
+			counts[strings.ReplaceAll(path, `\`, "/")]++
+		}
+	}
+	if len(counts) == 0 && len(users) == 0 {
+		return nil
+	}
+
+	type directory struct {
+		children map[string]*directory
+		files    map[string]int
+	}
+	newDirectory := func() *directory {
+		return &directory{children: make(map[string]*directory), files: make(map[string]int)}
+	}
+	root := newDirectory()
+	for path, count := range counts {
+		// absolute paths keep their leading / as the name of the first directory
+		parts := strings.Split(path, "/")
+		if parts[0] == "" {
+			parts[0] = "/"
+		}
+		current := root
+		for _, part := range parts[:len(parts)-1] {
+			if part == "" {
+				continue
+			}
+			if current.children[part] == nil {
+				current.children[part] = newDirectory()
+			}
+			current = current.children[part]
+		}
+		current.files[parts[len(parts)-1]] += count
+	}
+
+	var convert func(name string, dir *directory) SourceNode
+	convert = func(name string, dir *directory) SourceNode {
+		// merge the directories holding a single directory and no files
+		for len(dir.files) == 0 && len(dir.children) == 1 {
+			for child, next := range dir.children {
+				name = strings.TrimSuffix(name, "/") + "/" + child
+				dir = next
+			}
+		}
+
+		node := SourceNode{Name: name}
+		for child, next := range dir.children {
+			node.Children = append(node.Children, convert(child, next))
+		}
+		for file, count := range dir.files {
+			node.Children = append(node.Children, SourceNode{Name: file, Functions: count})
+		}
+		for _, child := range node.Children {
+			node.Functions += child.Functions
+		}
+		sortSourceNodes(node.Children)
+		return node
+	}
+
+	tree := &SourceTree{}
+	for name, dir := range root.children {
+		tree.Root = append(tree.Root, convert(name, dir))
+	}
+	for file, count := range root.files {
+		tree.Root = append(tree.Root, SourceNode{Name: file, Functions: count})
+	}
+	sortSourceNodes(tree.Root)
+	for user := range users {
+		tree.Users = append(tree.Users, user)
+	}
+	sort.Strings(tree.Users)
+	return tree
+}
+
+// sortSourceNodes lists the directories before the files, each by name
+func sortSourceNodes(nodes []SourceNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if (len(nodes[i].Children) > 0) != (len(nodes[j].Children) > 0) {
+			return len(nodes[i].Children) > 0
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+}
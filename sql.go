@@ -0,0 +1,262 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SQLMetadata lists the SQL statements among the strings, grouped by the functions referencing them, and the schema
+// of the tables the program creates. Stealers embed SQLite to query the databases of browsers and to keep what they
+// collect in a local one.
+type SQLMetadata struct {
+	Queries []SQLQueryGroup
+	Schema  []SQLTable `json:",omitempty"` // the tables of the CREATE TABLE statements
+}
+
+type SQLQueryGroup struct {
+	Function   string `json:",omitempty"` // empty for the statements found without a reference from the code
+	Statements []SQLStatement
+}
+
+type SQLStatement struct {
+	Kind    string // SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, ALTER, PRAGMA, ...
+	Query   string
+	Address uint64
+	Tables  []string `json:",omitempty"` // the tables read or written
+}
+
+type SQLTable struct {
+	Name    string
+	Columns []SQLColumn
+}
+
+type SQLColumn struct {
+	Name string
+	Type string `json:",omitempty"` // SQLite doesn't require one
+}
+
+var (
+	sqlStatementRegex = regexp.MustCompile(`(?is)^\s*(?:` +
+		`(SELECT)\s.+?\sFROM\s|` +
+		`(INSERT|REPLACE)\s+(?:OR\s+\w+\s+)?INTO\s|` +
+		`(UPDATE)\s+\S+\s+SET\s|` +
+		`(DELETE)\s+FROM\s|` +
+		`(CREATE)\s+(?:TEMP\s+|TEMPORARY\s+|UNIQUE\s+|VIRTUAL\s+)?(?:TABLE|INDEX|VIEW|TRIGGER)\s+\S|` +
+		`(DROP)\s+(?:TABLE|INDEX|VIEW|TRIGGER)\s+\S|` +
+		`(ALTER)\s+TABLE\s|` +
+		`(PRAGMA)\s+\w+|` +
+		`(ATTACH)\s+(?:DATABASE\s+)?\S|` +
+		`(WITH)\s+(?:RECURSIVE\s+)?\w+\s+AS\s*\()`)
+
+	// signs of a query rather than a sentence starting with "select ... from"
+	sqlQuerySignRegex = regexp.MustCompile(`(?i)[*,=?;]|\bWHERE\b|\bLIMIT\b|\bORDER\s+BY\b|\bGROUP\s+BY\b|\bJOIN\b`)
+
+	sqlTableRegex       = regexp.MustCompile(`(?i)\b(?:FROM|JOIN|INTO|UPDATE|TABLE(?:\s+IF\s+(?:NOT\s+)?EXISTS)?)\s+([\w.]+|"[^"]+"|\x60[^\x60]+\x60|\[[^\]]+\])`)
+	sqlCreateTableRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w.]+|"[^"]+"|\x60[^\x60]+\x60|\[[^\]]+\])\s*\((.*)\)`)
+)
+
+// the words of a column definition ending its type
+var sqlColumnConstraints = map[string]bool{
+	"NOT": true, "NULL": true, "PRIMARY": true, "DEFAULT": true, "UNIQUE": true, "REFERENCES": true, "CHECK": true,
+	"COLLATE": true, "AUTOINCREMENT": true, "GENERATED": true, "CONSTRAINT": true, "AS": true,
+}
+
+// the table constraints of a CREATE TABLE, which aren't columns
+var sqlTableConstraints = []string{"PRIMARY ", "UNIQUE", "FOREIGN ", "CHECK", "CONSTRAINT "}
+
+// The drivers and query builders, whose own statements aren't the program's. SQLite's C code formats its statements
+// with directives of its own printf, and declares its virtual tables as a table named x.
+var (
+	sqlLibraryPackages = []string{
+		"github.com/mattn/go-sqlite3", "modernc.org/sqlite", "github.com/glebarez/go-sqlite", "github.com/go-sql-driver/mysql",
+		"github.com/lib/pq", "github.com/jackc/pgx", "github.com/denisenkom/go-mssqldb", "github.com/microsoft/go-mssqldb",
+		"gorm.io", "github.com/jinzhu/gorm", "github.com/jmoiron/sqlx", "github.com/golang-migrate/migrate",
+		"github.com/Masterminds/squirrel", "xorm.io",
+	}
+	sqliteDirectives    = []string{"%Q", "%q", "%w", "%T", "%z", "#%d"}
+	sqliteVirtualTables = regexp.MustCompile(`^CREATE TABLE x\b`)
+)
+
+// extractSQL finds the statements among the recovered strings. The schema is read from the statements the
+// program's own functions reference.
+func extractSQL(strs []StringMetadata) *SQLMetadata {
+	groups := make(map[string]*SQLQueryGroup)
+	seen := make(map[string]bool)
+	tables := make(map[string]bool)
+	metadata := &SQLMetadata{}
+	for _, str := range strs {
+		kind := sqlStatementKind(str.Value)
+		if kind == "" || isSQLiteInternal(str.Value) {
+			continue
+		}
+		statement := SQLStatement{Kind: kind, Query: str.Value, Address: str.Address, Tables: sqlTables(str.Value)}
+
+		var functions []string
+		for _, function := range str.Functions {
+			if pkg := handlerPackage(function); !isStdPackage(pkg) && !isSQLLibraryPackage(pkg) {
+				functions = append(functions, function)
+			}
+		}
+		if len(functions) == 0 && len(str.Functions) > 0 {
+			continue
+		}
+		if len(functions) > 0 {
+			if table := parseCreateTable(str.Value); table != nil && !tables[table.Name] {
+				tables[table.Name] = true
+				metadata.Schema = append(metadata.Schema, *table)
+			}
+		} else {
+			functions = []string{""}
+		}
+		for _, function := range functions {
+			if seen[function+"\x00"+str.Value] {
+				continue
+			}
+			seen[function+"\x00"+str.Value] = true
+			group, ok := groups[function]
+			if !ok {
+				group = &SQLQueryGroup{Function: function}
+				groups[function] = group
+			}
+			group.Statements = append(group.Statements, statement)
+		}
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	for _, group := range groups {
+		metadata.Queries = append(metadata.Queries, *group)
+	}
+	// the statements without a reference come last
+	sort.Slice(metadata.Queries, func(i, j int) bool {
+		if (metadata.Queries[i].Function == "") != (metadata.Queries[j].Function == "") {
+			return metadata.Queries[j].Function == ""
+		}
+		return metadata.Queries[i].Function < metadata.Queries[j].Function
+	})
+	return metadata
+}
+
+// sqlStatementKind returns the keyword starting the statement, or an empty string if the text isn't one. Keywords
+// in upper case are taken as SQL, a select in another case needs something only a query has.
+func sqlStatementKind(text string) string {
+	match := sqlStatementRegex.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	kind := ""
+	for _, group := range match[1:] {
+		if group != "" {
+			kind = group
+			break
+		}
+	}
+	if kind != strings.ToUpper(kind) && !sqlQuerySignRegex.MatchString(text) {
+		return ""
+	}
+	return strings.ToUpper(kind)
+}
+
+func isSQLiteInternal(query string) bool {
+	if sqliteVirtualTables.MatchString(query) {
+		return true
+	}
+	for _, directive := range sqliteDirectives {
+		if strings.Contains(query, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSQLLibraryPackage(pkg string) bool {
+	for _, prefix := range sqlLibraryPackages {
+		if packageMatches(pkg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func sqlTables(query string) []string {
+	var tables []string
+	for _, match := range sqlTableRegex.FindAllStringSubmatch(query, -1) {
+		name := unquoteSQLName(match[1])
+		if name != "" && !strings.EqualFold(name, "SELECT") && !containsFold(tables, name) {
+			tables = append(tables, name)
+		}
+	}
+	return tables
+}
+
+// parseCreateTable reads the name and the columns of a CREATE TABLE statement
+func parseCreateTable(query string) *SQLTable {
+	match := sqlCreateTableRegex.FindStringSubmatch(query)
+	if match == nil {
+		return nil
+	}
+	table := &SQLTable{Name: unquoteSQLName(match[1])}
+
+	// the definitions are separated by the commas outside of parentheses, such as those of DECIMAL(10, 2)
+	var definitions []string
+	depth, start := 0, 0
+	body := match[2]
+	for i, c := range body {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				definitions = append(definitions, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	definitions = append(definitions, body[start:])
+
+	for _, definition := range definitions {
+		definition = strings.TrimSpace(definition)
+		upper := strings.ToUpper(definition)
+		isConstraint := definition == ""
+		for _, prefix := range sqlTableConstraints {
+			isConstraint = isConstraint || strings.HasPrefix(upper, prefix)
+		}
+		if isConstraint {
+			continue
+		}
+
+		words := strings.Fields(definition)
+		column := SQLColumn{Name: unquoteSQLName(words[0])}
+		var typeWords []string
+		for _, word := range words[1:] {
+			if sqlColumnConstraints[strings.ToUpper(word)] {
+				break
+			}
+			typeWords = append(typeWords, word)
+		}
+		column.Type = strings.Join(typeWords, " ")
+		table.Columns = append(table.Columns, column)
+	}
+	return table
+}
+
+func unquoteSQLName(name string) string {
+	if len(name) >= 2 && (name[0] == '"' || name[0] == '`' || name[0] == '[') {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// AnalysisStats shows where the time of an analysis went, so flags can be tuned for large binaries.
+// They're collected for every analysis but only reported with -stats.
+type AnalysisStats struct {
+	FileSize uint64
+	Seconds  float64
+	Phases   []PhaseStats
+}
+
+type PhaseStats struct {
+	Phase   string
+	Seconds float64
+	Bytes   uint64 `json:",omitempty"` // bytes of the input the phase processed
+	Items   int    `json:",omitempty"` // candidates, types, functions or strings, depending on the phase
+}
+
+// record adds an ended phase
+func (s *AnalysisStats) record(p *phase, items int, bytes uint64) {
+	s.Phases = append(s.Phases, PhaseStats{Phase: p.name, Seconds: p.elapsed.Seconds(), Bytes: bytes, Items: items})
+}
+
+func printStats(w io.Writer, stats *AnalysisStats) {
+	if stats == nil {
+		return
+	}
+
+	fmt.Fprintln(w, "\n-STATS-")
+	// the columns fit the longest phase name
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Phase\tSeconds\tBytes\tItems")
+	for _, p := range stats.Phases {
+		fmt.Fprintf(tw, "%s\t%.3f\t%d\t%d\n", p.Phase, p.Seconds, p.Bytes, p.Items)
+	}
+	fmt.Fprintf(tw, "total\t%.3f\t%d\t\n", stats.Seconds, stats.FileSize)
+	tw.Flush()
+}
@@ -0,0 +1,150 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+)
+
+// StdlibLinkage is the standard library of a static binary, package by package: how much code each one brought in
+// and what part of the attack surface it belongs to.
+type StdlibLinkage struct {
+	Packages  []StdPackage // by size, largest first
+	Surfaces  []StdSurface `json:",omitempty"`
+	Functions int
+	Size      uint64  // bytes of code of the standard library functions
+	Share     float64 // of the code of all functions, from 0 to 1
+}
+
+// StdPackage is a standard package linked in. Packages whose every function was inlined have no functions left,
+// they're found from the source files of the inlined code.
+type StdPackage struct {
+	Path      string
+	Functions int    `json:",omitempty"`
+	Size      uint64 `json:",omitempty"` // bytes of code
+	Surface   string `json:",omitempty"`
+}
+
+// StdSurface totals the packages of an attack surface
+type StdSurface struct {
+	Name     string
+	Packages []string
+	Size     uint64
+}
+
+// The attack surface of standard packages, the longest matching prefix wins
+var stdSurfaces = map[string]string{
+	"net": "network", "crypto/tls": "network", "crypto/x509": "crypto", "vendor/golang.org/x/net": "network",
+	"os/exec": "process", "os/signal": "process", "syscall": "syscall", "internal/syscall": "syscall",
+	"os": "filesystem", "io/fs": "filesystem", "path/filepath": "filesystem", "io/ioutil": "filesystem", "embed": "filesystem",
+	"archive": "parsing", "compress": "parsing", "encoding": "parsing", "image": "parsing", "debug": "parsing",
+	"mime": "parsing", "go": "parsing", "regexp": "parsing", "html": "parsing", "text/scanner": "parsing",
+	"text/template": "templates", "html/template": "templates",
+	"crypto": "crypto", "vendor/golang.org/x/crypto": "crypto", "hash": "crypto",
+	"reflect": "reflection", "plugin": "dynamic loading", "runtime/cgo": "cgo", "database/sql": "database",
+	"net/http/pprof": "debugging", "runtime/pprof": "debugging", "expvar": "debugging", "runtime/trace": "debugging",
+}
+
+// stdSurface returns the attack surface of a standard package, empty for the runtime and plain helpers
+func stdSurface(pkg string) string {
+	surface, longest := "", -1
+	for prefix, name := range stdSurfaces {
+		if packageMatches(pkg, prefix) && len(prefix) > longest {
+			surface, longest = name, len(prefix)
+		}
+	}
+	return surface
+}
+
+// isStdlibPath is isStdPackage without the empty package name, and without the modules the list of standard packages
+// holds, such as golang.org/x/crypto. Standard package paths have no dot in their first element.
+func isStdlibPath(pkg string) bool {
+	first, _, _ := strings.Cut(pkg, "/")
+	return pkg != "" && !strings.Contains(first, ".") && isStdPackage(pkg)
+}
+
+// stdlibLinkage sums the code of the functions of each standard package, then adds the packages only known from the
+// source files of inlined code. Standard files are under GOROOT/src, or relative paths with -trimpath.
+func stdlibLinkage(tab *gosym.Table) *StdlibLinkage {
+	report := &StdlibLinkage{}
+	packages := make(map[string]*StdPackage)
+	var total uint64
+	for _, fn := range tab.Funcs {
+		size := fn.End - fn.Entry
+		total += size
+		// generated functions and assembly without a package name can't be told apart from Go 1.18 go. packages
+		pkg := fn.PackageName()
+		if !isStdlibPath(pkg) {
+			continue
+		}
+		if packages[pkg] == nil {
+			packages[pkg] = &StdPackage{Path: pkg}
+		}
+		packages[pkg].Functions++
+		packages[pkg].Size += size
+		report.Functions++
+		report.Size += size
+	}
+	if len(packages) == 0 {
+		return nil
+	}
+
+	goroot := ""
+	for file := range tab.Files {
+		file = strings.ReplaceAll(file, `\`, "/")
+		if i := strings.Index(file, "/src/runtime/"); i != -1 {
+			goroot = file[:i+len("/src/")]
+			break
+		}
+	}
+	for file := range tab.Files {
+		file = strings.ReplaceAll(file, `\`, "/")
+		rest, ok := strings.CutPrefix(file, goroot)
+		if goroot == "" && (strings.HasPrefix(file, "/") || strings.Contains(file, ":")) {
+			ok = false
+		}
+		if !ok {
+			continue
+		}
+		if pkg := path.Dir(rest); pkg != "." && packages[pkg] == nil && isStdlibPath(pkg) {
+			packages[pkg] = &StdPackage{Path: pkg}
+		}
+	}
+
+	surfaces := make(map[string]*StdSurface)
+	for _, pkg := range packages {
+		pkg.Surface = stdSurface(pkg.Path)
+		report.Packages = append(report.Packages, *pkg)
+		if pkg.Surface == "" {
+			continue
+		}
+		if surfaces[pkg.Surface] == nil {
+			surfaces[pkg.Surface] = &StdSurface{Name: pkg.Surface}
+		}
+		surfaces[pkg.Surface].Packages = append(surfaces[pkg.Surface].Packages, pkg.Path)
+		surfaces[pkg.Surface].Size += pkg.Size
+	}
+	sort.Slice(report.Packages, func(i, j int) bool {
+		if report.Packages[i].Size != report.Packages[j].Size {
+			return report.Packages[i].Size > report.Packages[j].Size
+		}
+		return report.Packages[i].Path < report.Packages[j].Path
+	})
+	for _, surface := range surfaces {
+		sort.Strings(surface.Packages)
+		report.Surfaces = append(report.Surfaces, *surface)
+	}
+	sort.Slice(report.Surfaces, func(i, j int) bool {
+		if report.Surfaces[i].Size != report.Surfaces[j].Size {
+			return report.Surfaces[i].Size > report.Surfaces[j].Size
+		}
+		return report.Surfaces[i].Name < report.Surfaces[j].Name
+	})
+	if total > 0 {
+		report.Share = float64(report.Size) / float64(total)
+	}
+	return report
+}
@@ -0,0 +1,488 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// Go strings are not NUL terminated. The compiler packs string data back to back in read-only data and refers to it by
+// pointer and length, so a plain printable-run scan glues neighbouring strings together. Exact boundaries are only known
+// where a pointer and a length appear together: in the instructions that load a string, and in static string headers.
+// Text outside of those is still recovered by scanning for printable runs in the gaps between the exact strings.
+type StringMetadata struct {
+	Address   uint64
+	Value     string
+	Section   string
+	Xrefs     []uint64 `json:",omitempty"` // addresses of the instructions referencing the string
+	Functions []string `json:",omitempty"` // functions containing those instructions
+}
+
+// shortest string reported, pipelines can raise it to cut noise
+var minStringLength = 4
+
+const maxStringLength = 1 << 16
+
+// how many instructions after a string address is loaded to look for its length
+const stringLengthWindow = 4
+
+// Sections are read stringChunkSize bytes at a time so memory stays flat however large they are. The lookups of
+// string data keep the last stringChunkCache chunks of each section they touched.
+const (
+	stringChunkSize  = 1 << 20
+	stringChunkCache = 16
+)
+
+type stringSection struct {
+	objfile.Section
+	size   uint64
+	chunks *sectionChunks
+}
+
+// sectionChunks holds the chunks of a section read for lookups, by index, evicting the oldest first
+type sectionChunks struct {
+	data  map[uint64][]byte
+	order []uint64
+}
+
+// loadStringSections lists every section that may hold string data. Code, uninitialized data and the runtime
+// tables GoReSym already reports on are left out. Nothing is read until scanned or looked up.
+func loadStringSections(file *objfile.File) ([]stringSection, error) {
+	sections, err := file.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []stringSection
+	for _, sec := range sections {
+		if !sec.Readable || sec.Executable || sec.FileSize == 0 {
+			continue
+		}
+
+		name := strings.ToLower(sec.Name)
+		if strings.Contains(name, "pclntab") || strings.Contains(name, "symtab") || strings.Contains(name, "typelink") || strings.Contains(name, "itablink") || strings.Contains(name, "debug") {
+			continue
+		}
+		result = append(result, stringSection{Section: sec, size: sec.FileSize, chunks: &sectionChunks{data: make(map[uint64][]byte)}})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Addr < result[j].Addr })
+	return result, nil
+}
+
+// read returns the size bytes at the offset into the section, in buf when it has room. A short read ends the
+// section early, later reads past that point fail.
+func (sec *stringSection) read(offset uint64, size uint64, buf []byte) ([]byte, error) {
+	if uint64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	n, err := sec.ReadAt(buf, int64(offset))
+	if uint64(n) < size {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		sec.size = offset + uint64(n)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// bytes returns [offset, offset+length) of the section from its cached chunks, reading the chunk if needed. The
+// result must not be modified or kept.
+func (sec *stringSection) bytes(offset uint64, length uint64) ([]byte, bool) {
+	index := offset / stringChunkSize
+	if (offset+length-1)/stringChunkSize != index {
+		// spans two chunks, rare enough to read on its own
+		data, err := sec.read(offset, length, nil)
+		return data, err == nil
+	}
+
+	chunk, ok := sec.chunks.data[index]
+	if !ok {
+		start := index * stringChunkSize
+		size := sec.size - start
+		if size > stringChunkSize {
+			size = stringChunkSize
+		}
+
+		var err error
+		if chunk, err = sec.read(start, size, nil); err != nil {
+			return nil, false
+		}
+		if len(sec.chunks.order) == stringChunkCache {
+			delete(sec.chunks.data, sec.chunks.order[0])
+			sec.chunks.order = sec.chunks.order[1:]
+		}
+		sec.chunks.data[index] = chunk
+		sec.chunks.order = append(sec.chunks.order, index)
+	}
+
+	offset -= index * stringChunkSize
+	if offset+length > uint64(len(chunk)) {
+		return nil, false
+	}
+	return chunk[offset : offset+length], true
+}
+
+func findStringSection(sections []stringSection, VA uint64) *stringSection {
+	i := sort.Search(len(sections), func(i int) bool { return sections[i].Addr+sections[i].size > VA })
+	if i < len(sections) && VA >= sections[i].Addr {
+		return &sections[i]
+	}
+	return nil
+}
+
+// readString returns the bytes of [VA, VA+length) if they form printable text
+func readString(sections []stringSection, VA uint64, length uint64) (string, *stringSection, bool) {
+	if length < uint64(minStringLength) {
+		return "", nil, false
+	}
+	return readText(sections, VA, length)
+}
+
+// readText is readString without the minimum length, for analyses that want short strings such as "/"
+func readText(sections []stringSection, VA uint64, length uint64) (string, *stringSection, bool) {
+	if length == 0 || length > maxStringLength {
+		return "", nil, false
+	}
+
+	sec := findStringSection(sections, VA)
+	if sec == nil || sec.Writable {
+		return "", nil, false
+	}
+
+	offset := VA - sec.Addr
+	if offset+length > sec.size {
+		return "", nil, false
+	}
+
+	value, ok := sec.bytes(offset, length)
+	if !ok || !isPrintableString(value) {
+		return "", nil, false
+	}
+	return string(value), sec, true
+}
+
+func isPrintableString(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// extractCodeStrings finds string loads in function bodies. Every architecture materializes the data address
+// (LEA, or ADRP+ADD) and then moves the length into the next register or stack slot shortly after.
+func extractCodeStrings(ctx context.Context, file *objfile.File, sections []stringSection, funcs []gosym.Func) []StringMetadata {
+	var result []StringMetadata
+	for _, fn := range funcs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var pending []uint64
+		var pendingAt []uint64
+		window := 0
+		file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			if window > 0 {
+				window--
+				for _, imm := range inst.Imms {
+					for i, ref := range pending {
+						if value, sec, ok := readString(sections, ref, uint64(imm)); ok {
+							result = append(result, StringMetadata{Address: ref, Value: value, Section: sec.Name, Xrefs: []uint64{pendingAt[i]}, Functions: []string{fn.Name}})
+							pending = nil
+							pendingAt = nil
+							window = 0
+							break
+						}
+					}
+				}
+
+				if window == 0 || inst.Call != 0 {
+					pending = nil
+					pendingAt = nil
+					window = 0
+				}
+			}
+
+			for _, ref := range inst.Refs {
+				if findStringSection(sections, ref) != nil {
+					pending = append(pending, ref)
+					pendingAt = append(pendingAt, inst.PC)
+					window = stringLengthWindow
+				}
+			}
+			return true
+		})
+	}
+	return result
+}
+
+// extractHeaderStrings finds string headers, a pointer followed by a length, in initialized data such as
+// the backing arrays of []string literals and struct fields
+func extractHeaderStrings(sections []stringSection, is64bit bool, littleendian bool) []StringMetadata {
+	var byteOrder binary.ByteOrder = binary.BigEndian
+	if littleendian {
+		byteOrder = binary.LittleEndian
+	}
+
+	ptrSize := 4
+	readPtr := func(b []byte) uint64 { return uint64(byteOrder.Uint32(b)) }
+	if is64bit {
+		ptrSize = 8
+		readPtr = byteOrder.Uint64
+	}
+
+	var result []StringMetadata
+	var buf []byte
+	for i := range sections {
+		sec := &sections[i]
+
+		// each chunk is followed by a pointer of the next, for the header that starts at its end. off carries over
+		// the chunks when a header was found there.
+		off := 0
+		for start := uint64(0); start < sec.size; start += stringChunkSize {
+			size := sec.size - start
+			if size > stringChunkSize+uint64(ptrSize) {
+				size = stringChunkSize + uint64(ptrSize)
+			}
+
+			chunk, err := sec.read(start, size, buf)
+			if err != nil {
+				break
+			}
+			buf = chunk
+
+			for ; off < stringChunkSize && off+2*ptrSize <= len(chunk); off += ptrSize {
+				ptr := readPtr(chunk[off:])
+				if ptr == 0 {
+					continue
+				}
+
+				length := readPtr(chunk[off+ptrSize:])
+				if value, strSec, ok := readString(sections, ptr, length); ok {
+					result = append(result, StringMetadata{Address: ptr, Value: value, Section: strSec.Name})
+					off += ptrSize
+				}
+			}
+			off -= stringChunkSize
+		}
+	}
+	return result
+}
+
+// asciiPrintable classifies each byte value as part of a printable run or not
+var asciiPrintable = func() (table [256]bool) {
+	for b := 0x20; b < 0x7f; b++ {
+		table[b] = true
+	}
+	table['\t'] = true
+	return table
+}()
+
+// extractASCIIStrings returns the printable ASCII runs of at least minLength bytes, like the strings utility does.
+// Runs are found by skipping to the next printable byte and then to the next unprintable one, a word at a time
+// where possible, instead of branching on the value of every byte.
+func extractASCIIStrings(data []byte, base uint64, section string, minLength int) []StringMetadata {
+	var result []StringMetadata
+	for i := 0; i < len(data); {
+		for i < len(data) && !asciiPrintable[data[i]] {
+			i++
+		}
+		start := i
+
+		// most of a run is printable, look at eight bytes at a time until it ends
+		for i+8 <= len(data) && printableWord(binary.LittleEndian.Uint64(data[i:])) {
+			i += 8
+		}
+		for i < len(data) && asciiPrintable[data[i]] {
+			i++
+		}
+
+		if i-start >= minLength && i > start {
+			result = append(result, StringMetadata{Address: base + uint64(start), Value: string(data[start:i]), Section: section})
+		}
+	}
+	return result
+}
+
+// printableWord tells whether all eight bytes of the word are printable and none a tab, which is left to the table
+func printableWord(w uint64) bool {
+	const ones, highs = 0x0101010101010101, 0x8080808080808080
+	below := (w - 0x20*ones) &^ w & highs                      // a byte below 0x20
+	del := ((w ^ 0x7f*ones) - ones) &^ (w ^ 0x7f*ones) & highs // a byte equal to 0x7f
+	return (below|del)|(w&highs) == 0
+}
+
+// extractChunkStrings runs extractASCIIStrings over [start, end) of the section a chunk at a time. A chunk ends after
+// its last unprintable byte within maxStringLength of its end, so the next chunk overlaps it by up to
+// maxStringLength bytes and scans whole the string running over. Longer runs are split at the chunk boundary.
+func extractChunkStrings(sec *stringSection, start uint64, end uint64, buf []byte, visit func(s StringMetadata)) []byte {
+	for start < end {
+		size := end - start
+		if size > stringChunkSize {
+			size = stringChunkSize
+		}
+
+		chunk, err := sec.read(start, size, buf)
+		if err != nil {
+			break
+		}
+		buf = chunk
+
+		if start+size < end {
+			for i := len(chunk) - 1; i >= len(chunk)-maxStringLength; i-- {
+				if !asciiPrintable[chunk[i]] {
+					chunk = chunk[:i+1]
+					break
+				}
+			}
+		}
+
+		for _, s := range extractASCIIStrings(chunk, sec.Addr+start, sec.Name, minStringLength) {
+			visit(s)
+		}
+		start += uint64(len(chunk))
+	}
+	return buf
+}
+
+// extractGapStrings scans the bytes of each section that aren't covered by an exactly known string. Regions holding
+// runtime metadata, whose names are reported elsewhere, are skipped along with the names of functions and files.
+func extractGapStrings(sections []stringSection, known []StringMetadata, skip [][2]uint64, names map[string]bool) []StringMetadata {
+	type span struct{ start, end uint64 }
+	covered := make([]span, 0, len(known)+len(skip))
+	for _, s := range known {
+		covered = append(covered, span{s.Address, s.Address + uint64(len(s.Value))})
+	}
+	for _, s := range skip {
+		if s[1] > s[0] {
+			covered = append(covered, span{s[0], s[1]})
+		}
+	}
+	sort.Slice(covered, func(i, j int) bool { return covered[i].start < covered[j].start })
+
+	var result []StringMetadata
+	var buf []byte
+	for j := range sections {
+		sec := &sections[j]
+		end := sec.Addr + sec.size
+		cursor := sec.Addr
+		i := sort.Search(len(covered), func(i int) bool { return covered[i].end > sec.Addr })
+
+		for cursor < end {
+			gapEnd := end
+			for ; i < len(covered) && covered[i].start <= cursor; i++ {
+				if covered[i].end > cursor {
+					cursor = covered[i].end
+				}
+			}
+			if cursor >= end {
+				break
+			}
+			if i < len(covered) && covered[i].start < end {
+				gapEnd = covered[i].start
+			}
+
+			buf = extractChunkStrings(sec, cursor-sec.Addr, gapEnd-sec.Addr, buf, func(s StringMetadata) {
+				if !names[s.Value] {
+					result = append(result, s)
+				}
+			})
+			cursor = gapEnd
+		}
+	}
+	return result
+}
+
+// deduplicateStrings merges strings with the same value in the same section, combining their references. Strings are
+// found by a hash of both rather than by a key built from them, a large dump holding millions. Colliding strings take
+// the next free hash.
+func deduplicateStrings(strs []StringMetadata) []StringMetadata {
+	seen := make(map[uint64]int, len(strs))
+	result := make([]StringMetadata, 0, len(strs))
+	var h maphash.Hash
+	for _, s := range strs {
+		h.Reset()
+		h.WriteString(s.Section)
+		h.WriteByte(0)
+		h.WriteString(s.Value)
+		key := h.Sum64()
+
+		idx, ok := seen[key]
+		for ok && (result[idx].Section != s.Section || result[idx].Value != s.Value) {
+			key++
+			idx, ok = seen[key]
+		}
+		if ok {
+			existing := &result[idx]
+			if s.Address < existing.Address {
+				existing.Address = s.Address
+			}
+			existing.Xrefs = append(existing.Xrefs, s.Xrefs...)
+			for _, fn := range s.Functions {
+				found := false
+				for _, have := range existing.Functions {
+					if have == fn {
+						found = true
+						break
+					}
+				}
+				if !found {
+					existing.Functions = append(existing.Functions, fn)
+				}
+			}
+			continue
+		}
+
+		seen[key] = len(result)
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Address < result[j].Address })
+	return result
+}
+
+// extractStrings also returns how many bytes of code and data it scanned
+func extractStrings(ctx context.Context, file *objfile.File, tab *gosym.Table, moduleData *objfile.ModuleData, is64bit bool, littleendian bool) ([]StringMetadata, uint64, error) {
+	sections, err := loadStringSections(file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scanned := uint64(0)
+	for _, sec := range sections {
+		scanned += sec.size
+	}
+
+	exact := extractCodeStrings(ctx, file, sections, tab.Funcs)
+	exact = append(exact, extractHeaderStrings(sections, is64bit, littleendian)...)
+
+	names := make(map[string]bool)
+	for _, fn := range tab.Funcs {
+		names[fn.Name] = true
+		scanned += fn.End - fn.Entry
+	}
+	for name := range tab.Files {
+		names[name] = true
+	}
+
+	skip := [][2]uint64{{moduleData.Types, moduleData.ETypes}}
+	all := append(exact, extractGapStrings(sections, exact, skip, names)...)
+	return deduplicateStrings(all), scanned, ctx.Err()
+}
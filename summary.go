@@ -0,0 +1,57 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// printSummary prints one compact block per file with counts instead of listings, for triaging many samples at once
+func printSummary(w io.Writer, fileName string, metadata ExtractMetadata, typesCollected bool, stringsCollected bool) {
+	packages := make(map[string]bool)
+	for _, fn := range metadata.UserFunctions {
+		packages[fn.PackageName] = true
+	}
+	for _, fn := range metadata.StdFunctions {
+		packages[fn.PackageName] = true
+	}
+
+	fmt.Fprintf(w, "%-12s %s\n", "File:", fileName)
+	fmt.Fprintf(w, "%-12s %s\n", "Go:", metadata.Version)
+	fmt.Fprintf(w, "%-12s %s/%s\n", "Platform:", metadata.OS, metadata.Arch)
+	if metadata.BuildInfo.Main.Path != "" {
+		fmt.Fprintf(w, "%-12s %s %s\n", "Module:", metadata.BuildInfo.Main.Path, metadata.BuildInfo.Main.Version)
+	}
+	if metadata.BuildId != "" {
+		fmt.Fprintf(w, "%-12s %s\n", "BuildID:", metadata.BuildId)
+	}
+	fmt.Fprintf(w, "%-12s %d user, %d standard in %d packages\n", "Functions:", len(metadata.UserFunctions), len(metadata.StdFunctions), len(packages))
+
+	if typesCollected {
+		fmt.Fprintf(w, "%-12s %d, %d interfaces\n", "Types:", len(metadata.Types), len(metadata.Interfaces))
+	} else {
+		fmt.Fprintf(w, "%-12s not collected, use -t\n", "Types:")
+	}
+
+	if stringsCollected {
+		fmt.Fprintf(w, "%-12s %d\n", "Strings:", len(metadata.Strings))
+	} else {
+		fmt.Fprintf(w, "%-12s not collected, use -strings\n", "Strings:")
+	}
+
+	tags := capabilityTags(metadata.Capabilities)
+	if len(tags) == 0 {
+		fmt.Fprintf(w, "%-12s <NONE>\n", "Tags:")
+	} else {
+		fmt.Fprintf(w, "%-12s %s\n", "Tags:", strings.Join(tags, ", "))
+	}
+
+	if metadata.Signature != nil {
+		fmt.Fprintf(w, "%-12s %s\n", "Signature:", metadata.Signature.Status)
+	}
+
+	if metadata.Partial {
+		fmt.Fprintf(w, "%-12s analysis stopped early, counts are incomplete\n", "Partial:")
+	}
+}
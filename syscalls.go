@@ -0,0 +1,292 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// SyscallMetadata lists the system calls the program can make. On Linux they're found in the code: the syscall
+// instructions and the calls to the syscall package's wrappers, with the number loaded right before them. On macOS
+// Go calls the C library through a trampoline per function, and the linked trampolines name the calls.
+type SyscallMetadata struct {
+	Syscalls []SyscallUsage
+
+	// wrapper calls whose number isn't a constant at the call site, such as a number passed through from a caller
+	Unresolved int `json:",omitempty"`
+}
+
+type SyscallUsage struct {
+	Name    string
+	Number  *int64   `json:",omitempty"` // Linux only
+	Callers []string `json:",omitempty"` // the first few functions making the call
+}
+
+// Functions that take the syscall number as their first argument
+var syscallWrappers = map[string]bool{
+	"syscall.Syscall": true, "syscall.Syscall6": true, "syscall.Syscall9": true,
+	"syscall.RawSyscall": true, "syscall.RawSyscall6": true, "syscall.rawSyscallNoError": true,
+	"syscall.rawVforkSyscall": true, "syscall.AllThreadsSyscall": true, "syscall.AllThreadsSyscall6": true,
+	"golang.org/x/sys/unix.Syscall": true, "golang.org/x/sys/unix.Syscall6": true,
+	"golang.org/x/sys/unix.RawSyscall": true, "golang.org/x/sys/unix.RawSyscall6": true,
+	"golang.org/x/sys/unix.SyscallNoError": true, "golang.org/x/sys/unix.RawSyscallNoError": true,
+	"runtime/internal/syscall.Syscall6": true, "internal/runtime/syscall.Syscall6": true,
+	"internal/runtime/syscall/linux.Syscall6": true,
+}
+
+// callers listed per syscall, the runtime makes the common ones from many places
+const maxSyscallCallers = 5
+
+// enumerateSyscalls finds the system calls of Linux binaries on architectures with a decoder, and of macOS binaries
+func enumerateSyscalls(ctx context.Context, file *objfile.File, tab *gosym.Table, goos string, version string) (*SyscallMetadata, error) {
+	switch goos {
+	case "darwin", "ios":
+		return libcSyscalls(tab), nil
+	case "linux", "android":
+	default:
+		return nil, nil
+	}
+
+	arch := file.GOARCH()
+	names, ok := linuxSyscallNames[arch]
+	if !ok {
+		return nil, nil
+	}
+
+	wrappers := make(map[uint64]bool)
+	for _, fn := range tab.Funcs {
+		if syscallWrappers[fn.Name] {
+			wrappers[fn.Entry] = true
+		}
+	}
+
+	textStart, text, err := file.Text()
+	if err != nil {
+		return nil, err
+	}
+
+	// only the functions holding a syscall instruction or a call to a wrapper are decoded
+	var functions []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range syscallSites(arch, textStart, text, wrappers) {
+		fn := tab.PCToFunc(pc)
+		if fn == nil || decoded[fn.Entry] || syscallWrappers[fn.Name] {
+			continue
+		}
+		decoded[fn.Entry] = true
+		functions = append(functions, fn)
+	}
+
+	// where the number is: the syscall instruction reads it from a register, the wrappers take it as their first
+	// argument, in a register with the register ABI or on the stack before it
+	numberRegister := "AX"
+	argument := "SP+0"
+	if arch == "arm64" {
+		numberRegister = "R8"
+	}
+	if registerABI(version, arch) {
+		argument = "AX"
+		if arch == "arm64" {
+			argument = "R0"
+		}
+	}
+
+	metadata := &SyscallMetadata{}
+	usages := make(map[int64]*SyscallUsage)
+	record := func(number int64, caller string) {
+		usage, ok := usages[number]
+		if !ok {
+			name, known := names[number]
+			if !known {
+				name = strconv.FormatInt(number, 10)
+			}
+			usage = &SyscallUsage{Name: name, Number: &number}
+			usages[number] = usage
+		}
+		if len(usage.Callers) < maxSyscallCallers && (len(usage.Callers) == 0 || usage.Callers[len(usage.Callers)-1] != caller) {
+			usage.Callers = append(usage.Callers, caller)
+		}
+	}
+
+	for _, fn := range functions {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// the constants held by registers and stack slots, forgotten when anything else writes them
+		constants := make(map[string]int64)
+		err := file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			switch {
+			case inst.Op == "SYSCALL" || inst.Op == "SYSENTER" || inst.Op == "SVC" || (inst.Op == "INT" && len(inst.Imms) == 1 && inst.Imms[0] == 0x80):
+				if number, ok := constants[numberRegister]; ok {
+					record(number, fn.Name)
+				}
+			case inst.Call != 0:
+				if wrappers[inst.Call] {
+					if number, ok := constants[argument]; ok {
+						record(number, fn.Name)
+					} else {
+						metadata.Unresolved++
+					}
+				}
+				constants = make(map[string]int64)
+			}
+
+			if inst.Dest != "" {
+				dest := canonicalRegister(inst.Dest)
+				if (inst.Op == "MOV" || inst.Op == "MOVZ") && len(inst.Imms) == 1 {
+					constants[dest] = inst.Imms[0]
+				} else {
+					delete(constants, dest)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, usage := range usages {
+		metadata.Syscalls = append(metadata.Syscalls, *usage)
+	}
+	sort.Slice(metadata.Syscalls, func(i, j int) bool {
+		return *metadata.Syscalls[i].Number < *metadata.Syscalls[j].Number
+	})
+	if len(metadata.Syscalls) == 0 && metadata.Unresolved == 0 {
+		return nil, nil
+	}
+	return metadata, nil
+}
+
+// syscallSites scans the code for the encodings of the syscall instructions and of direct calls to the wrappers,
+// decoding every function would take seconds on large binaries
+func syscallSites(arch string, textStart uint64, text []byte, wrappers map[uint64]bool) []uint64 {
+	sites := directCallSites(arch, textStart, text, wrappers)
+	switch arch {
+	case "amd64", "386":
+		for i := 0; i+1 < len(text); i++ {
+			if text[i] == 0x0f && (text[i+1] == 0x05 || text[i+1] == 0x34) || // SYSCALL, SYSENTER
+				text[i] == 0xcd && text[i+1] == 0x80 { // INT 0x80
+				sites = append(sites, textStart+uint64(i))
+			}
+		}
+	case "arm64":
+		for i := 0; i+4 <= len(text); i += 4 {
+			if binary.LittleEndian.Uint32(text[i:]) == 0xd4000001 { // SVC #0
+				sites = append(sites, textStart+uint64(i))
+			}
+		}
+	}
+	return sites
+}
+
+// directCall is a call found by directCalls, Site is the address of the call instruction
+type directCall struct {
+	Site   uint64
+	Target uint64
+}
+
+// directCallSites finds the encodings of direct calls to the targets without decoding the code. Bytes that only
+// look like a call are harmless, the functions holding them are decoded properly afterwards.
+func directCallSites(arch string, textStart uint64, text []byte, targets map[uint64]bool) []uint64 {
+	var sites []uint64
+	for _, call := range directCalls(arch, textStart, text, targets) {
+		sites = append(sites, call.Site)
+	}
+	return sites
+}
+
+// directCalls is directCallSites keeping the target of each call
+func directCalls(arch string, textStart uint64, text []byte, targets map[uint64]bool) []directCall {
+	var calls []directCall
+	switch arch {
+	case "amd64", "386":
+		for i := 0; i+5 <= len(text); i++ {
+			if text[i] != 0xe8 { // CALL rel32
+				continue
+			}
+			target := textStart + uint64(i+5) + uint64(int64(int32(binary.LittleEndian.Uint32(text[i+1:]))))
+			if arch == "386" {
+				target = uint64(uint32(target))
+			}
+			if targets[target] {
+				calls = append(calls, directCall{textStart + uint64(i), target})
+			}
+		}
+	case "arm64":
+		for i := 0; i+4 <= len(text); i += 4 {
+			word := binary.LittleEndian.Uint32(text[i:])
+			if word>>26 != 0x25 { // BL, a signed 26 bit word offset
+				continue
+			}
+			target := textStart + uint64(int64(i)+int64(int32(word<<6)>>6)*4)
+			if targets[target] {
+				calls = append(calls, directCall{textStart + uint64(i), target})
+			}
+		}
+	}
+	return calls
+}
+
+// canonicalRegister names a register the same whatever width the instruction accessed it with: AX for RAX and EAX,
+// R8 for X8 and W8
+func canonicalRegister(register string) string {
+	if len(register) == 3 && (register[0] == 'R' || register[0] == 'E') && register[1] >= 'A' && register[1] <= 'Z' {
+		return register[1:]
+	}
+	if len(register) >= 2 && (register[0] == 'X' || register[0] == 'W') && register[1] >= '0' && register[1] <= '9' {
+		return "R" + register[1:]
+	}
+	return register
+}
+
+// registerABI tells whether the Go release passes arguments in registers on the architecture
+func registerABI(version string, arch string) bool {
+	minor, err := strconv.Atoi(strings.TrimPrefix(goMinorVersion(version), "1."))
+	if err != nil {
+		// unknown versions are more likely recent ones
+		return arch == "amd64" || arch == "arm64"
+	}
+	switch arch {
+	case "amd64":
+		return minor >= 17
+	case "arm64":
+		return minor >= 18
+	}
+	return false
+}
+
+// libcSyscalls lists the C library functions behind the trampolines of the syscall, golang.org/x/sys/unix and
+// runtime packages, named libc_open_trampoline or open_trampoline
+func libcSyscalls(tab *gosym.Table) *SyscallMetadata {
+	seen := make(map[string]bool)
+	metadata := &SyscallMetadata{}
+	for _, fn := range tab.Funcs {
+		if !strings.HasSuffix(fn.Name, "_trampoline") {
+			continue
+		}
+		name := strings.TrimSuffix(fn.Name[strings.LastIndex(fn.Name, ".")+1:], "_trampoline")
+		name = strings.TrimPrefix(name, "libc_")
+
+		// the runtime's syscall, syscall6, syscallX, ... trampolines call whatever function they're passed
+		if strings.HasPrefix(name, "syscall") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		metadata.Syscalls = append(metadata.Syscalls, SyscallUsage{Name: name})
+	}
+	if len(metadata.Syscalls) == 0 {
+		return nil
+	}
+	sort.Slice(metadata.Syscalls, func(i, j int) bool {
+		return metadata.Syscalls[i].Name < metadata.Syscalls[j].Name
+	})
+	return metadata
+}
@@ -0,0 +1,125 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// TargetEnvironment is the platform the binary was built for, in one place: GOOS and GOARCH, the microarchitecture
+// level, whether cgo was used and how the binary is linked. What the build info doesn't record is inferred from the
+// file, with the reasons listed as Evidence.
+type TargetEnvironment struct {
+	OS          string
+	Arch        string
+	ArchLevel   string   `json:",omitempty"` // ex: GOAMD64=v3, GOARM=7 or GO386=softfloat
+	CGOEnabled  *bool    `json:",omitempty"`
+	Linking     string   // static, or dynamic when the loader resolves shared libraries
+	Interpreter string   `json:",omitempty"` // the dynamic loader, ex: /lib64/ld-linux-x86-64.so.2
+	Libraries   []string `json:",omitempty"` // the shared libraries loaded with the binary
+	Evidence    []string `json:",omitempty"`
+}
+
+// GOAMD64=v2 and later programs check the CPU at startup and print this when it falls short
+var amd64LevelRegex = regexp.MustCompile(`AMD64 processors with (v[2-4]) microarchitecture support`)
+
+// targetEnvironment merges the build settings with what the headers and the runtime tell
+func targetEnvironment(file *objfile.File, tab *gosym.Table, metadata ExtractMetadata) (*TargetEnvironment, error) {
+	target := &TargetEnvironment{OS: metadata.OS, Arch: metadata.Arch}
+	evidence := func(reason string) {
+		target.Evidence = append(target.Evidence, reason)
+	}
+
+	recorded := make(map[string]bool)
+	for _, setting := range metadata.BuildInfo.Settings {
+		recorded[setting.Key] = true
+	}
+	if !recorded["GOOS"] && target.OS != "" {
+		evidence("GOOS: from the runtime source file names")
+	}
+	if !recorded["GOARCH"] && target.Arch != "" {
+		evidence("GOARCH: from the file header")
+	}
+
+	if metadata.Build != nil {
+		target.ArchLevel = metadata.Build.ArchLevel
+		target.CGOEnabled = metadata.Build.CGOEnabled
+		if metadata.Build.Source == "heuristics" {
+			for _, reason := range metadata.Build.Evidence {
+				if strings.HasPrefix(reason, "cgo:") {
+					evidence(reason)
+				}
+			}
+		}
+	}
+	if target.ArchLevel == "" && tab != nil {
+		if level, reason := inferArchLevel(file, tab, target.Arch, metadata.Version); level != "" {
+			target.ArchLevel = level
+			evidence(reason)
+		}
+	}
+
+	link, err := file.Linkage()
+	if link == nil {
+		return target, err
+	}
+	target.Interpreter = link.Interpreter
+	target.Libraries = link.Libraries
+	target.Linking = "static"
+	if link.Interpreter != "" || len(link.Libraries) > 0 {
+		target.Linking = "dynamic"
+	}
+	return target, err
+}
+
+// inferArchLevel recovers the microarchitecture level of a binary without build settings from the runtime
+func inferArchLevel(file *objfile.File, tab *gosym.Table, arch string, version string) (string, string) {
+	semver := goSemver(version)
+	since := func(release string) bool {
+		return semver != "" && semver != "unknown" && compareSemver(semver, release) >= 0
+	}
+
+	switch arch {
+	case "amd64":
+		// GOAMD64 arrived with Go 1.18, v1 programs don't check the CPU
+		if !since("1.18") {
+			return "", ""
+		}
+		data, err := file.Data()
+		if err != nil {
+			return "", ""
+		}
+		if match := amd64LevelRegex.FindSubmatch(data); match != nil {
+			return "GOAMD64=" + string(match[1]), "GOAMD64: the runtime checks for " + string(match[1]) + " support"
+		}
+		return "GOAMD64=v1", "GOAMD64: the runtime doesn't check the microarchitecture level"
+	case "386":
+		// the compiler calls the runtime for floating point instead of using SSE2, GO386=387 was removed in Go 1.16
+		if !since("1.16") {
+			return "", ""
+		}
+		if tab.LookupFunc("runtime.fadd64") != nil {
+			return "GO386=softfloat", "GO386: function runtime.fadd64"
+		}
+		return "GO386=sse2", "GO386: no softfloat functions"
+	case "arm":
+		// the linker writes GOARM into a variable, only found with the symbol table
+		symbols, err := file.Symbols()
+		if err != nil {
+			return "", ""
+		}
+		for _, sym := range symbols {
+			if sym.Name != "runtime.goarm" {
+				continue
+			}
+			if data, err := file.ReadMemory(sym.Addr, 1); err == nil && len(data) == 1 {
+				return fmt.Sprintf("GOARM=%d", data[0]), "GOARM: variable runtime.goarm"
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,275 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// TelemetryMetadata is the metrics and tracing instrumentation of the program. The names it registers survive
+// stripping and often spell out the internal components and what the operators watch, ex: implant_beacons_total.
+type TelemetryMetadata struct {
+	Frameworks []string        // ex: Prometheus, OpenTelemetry or expvar
+	Metrics    []TelemetryName `json:",omitempty"`
+	Spans      []TelemetryName `json:",omitempty"` // span names and the instrumentation scopes of tracers
+}
+
+// TelemetryName is a metric or span name registered by a function outside the standard library and the frameworks
+type TelemetryName struct {
+	Name     string
+	Kind     string // counter, gauge, histogram, summary, metric, variable or meter, span or tracer for spans
+	Help     string `json:",omitempty"`
+	Function string
+	Address  uint64 // of the call
+}
+
+// The packages of each framework, the first matching prefix names it
+var telemetryFrameworks = []struct {
+	name     string
+	packages []string
+}{
+	{"Prometheus", []string{"github.com/prometheus/client_golang", "k8s.io/component-base/metrics"}},
+	{"OpenTelemetry", []string{"go.opentelemetry.io/otel"}},
+	{"OpenCensus", []string{"go.opencensus.io"}},
+	{"OpenTracing", []string{"github.com/opentracing/opentracing-go"}},
+	{"Jaeger", []string{"github.com/uber/jaeger-client-go"}},
+	{"Datadog", []string{"gopkg.in/DataDog/dd-trace-go.v1", "github.com/DataDog/dd-trace-go", "github.com/DataDog/datadog-go"}},
+	{"VictoriaMetrics", []string{"github.com/VictoriaMetrics/metrics"}},
+	{"go-metrics", []string{"github.com/rcrowley/go-metrics", "github.com/armon/go-metrics", "github.com/hashicorp/go-metrics"}},
+	{"statsd", []string{"github.com/cactus/go-statsd-client", "github.com/alexcesaro/statsd", "gopkg.in/alexcesaro/statsd.v2"}},
+	{"expvar", []string{"expvar"}},
+}
+
+// telemetryAPI is a function registering a name. The name is the first of its strings string arguments, or the
+// Namespace, Subsystem and Name of the opts struct it takes when strings is 0.
+type telemetryAPI struct {
+	kind    string
+	strings int
+}
+
+var telemetryAPIs = func() map[string]telemetryAPI {
+	apis := map[string]telemetryAPI{
+		"github.com/prometheus/client_golang/prometheus.NewDesc": {"metric", 2},
+		"expvar.NewInt": {"variable", 1}, "expvar.NewFloat": {"variable", 1}, "expvar.NewString": {"variable", 1},
+		"expvar.NewMap": {"variable", 1}, "expvar.Publish": {"variable", 1},
+		"go.opentelemetry.io/otel.Tracer": {"tracer", 1}, "go.opentelemetry.io/otel.Meter": {"meter", 1},
+		"go.opencensus.io/stats.Int64": {"metric", 2}, "go.opencensus.io/stats.Float64": {"metric", 2},
+		"go.opencensus.io/trace.StartSpan":                                    {"span", 1},
+		"github.com/opentracing/opentracing-go.StartSpan":                     {"span", 1},
+		"github.com/opentracing/opentracing-go.StartSpanFromContext":          {"span", 1},
+		"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer.StartSpan":            {"span", 1},
+		"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer.StartSpanFromContext": {"span", 1},
+		"github.com/DataDog/datadog-go/statsd.(*Client).Incr":                 {"counter", 1},
+		"github.com/DataDog/datadog-go/statsd.(*Client).Count":                {"counter", 1},
+		"github.com/DataDog/datadog-go/statsd.(*Client).Gauge":                {"gauge", 1},
+		"github.com/DataDog/datadog-go/statsd.(*Client).Histogram":            {"histogram", 1},
+		"github.com/DataDog/datadog-go/statsd.(*Client).Timing":               {"histogram", 1},
+	}
+	for _, kind := range []string{"Counter", "Gauge", "Histogram", "Summary"} {
+		lower := strings.ToLower(kind)
+		for _, pkg := range []string{"github.com/prometheus/client_golang/prometheus.", "github.com/prometheus/client_golang/prometheus/promauto.", "github.com/prometheus/client_golang/prometheus/promauto.Factory.", "k8s.io/component-base/metrics."} {
+			apis[pkg+"New"+kind] = telemetryAPI{lower, 0}
+			apis[pkg+"New"+kind+"Vec"] = telemetryAPI{lower, 0}
+		}
+		apis["github.com/VictoriaMetrics/metrics.New"+kind] = telemetryAPI{lower, 1}
+		apis["github.com/VictoriaMetrics/metrics.GetOrCreate"+kind] = telemetryAPI{lower, 1}
+		apis["github.com/rcrowley/go-metrics.NewRegistered"+kind] = telemetryAPI{lower, 1}
+		apis["github.com/rcrowley/go-metrics.GetOrRegister"+kind] = telemetryAPI{lower, 1}
+	}
+	apis["github.com/prometheus/client_golang/prometheus.NewCounterFunc"] = telemetryAPI{"counter", 0}
+	apis["github.com/prometheus/client_golang/prometheus.NewGaugeFunc"] = telemetryAPI{"gauge", 0}
+	return apis
+}()
+
+// telemetryFramework names the framework of a function. The packages are matched against the function name, the
+// package name of Go 1.18 and older programs is empty for packages starting with go. such as go.opentelemetry.io.
+func telemetryFramework(function string) string {
+	for _, framework := range telemetryFrameworks {
+		for _, prefix := range framework.packages {
+			if rest, ok := strings.CutPrefix(function, prefix); ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "/")) {
+				return framework.name
+			}
+		}
+	}
+	return ""
+}
+
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:.\-/]*$`)
+
+// extractTelemetry finds the frameworks from the packages, then decodes the functions calling their registering
+// functions. A static opts struct is the lowest data address loaded before the call whose first four fields read as
+// the Namespace, Subsystem, Name and Help strings.
+func extractTelemetry(ctx context.Context, file *objfile.File, tab *gosym.Table, is64bit bool, littleendian bool) (*TelemetryMetadata, error) {
+	apis := make(map[uint64]telemetryAPI)
+	targets := make(map[uint64]bool)
+	found := make(map[string]bool)
+	for _, fn := range tab.Funcs {
+		if api, ok := telemetryAPIs[fn.Name]; ok {
+			apis[fn.Entry] = api
+			targets[fn.Entry] = true
+		}
+		if framework := telemetryFramework(fn.Name); framework != "" {
+			found[framework] = true
+		}
+	}
+
+	report := &TelemetryMetadata{}
+	for _, framework := range telemetryFrameworks {
+		if found[framework.name] {
+			report.Frameworks = append(report.Frameworks, framework.name)
+		}
+	}
+	if len(report.Frameworks) == 0 {
+		return nil, nil
+	}
+	if len(apis) == 0 {
+		return report, nil
+	}
+
+	sections, err := loadStringSections(file)
+	if err != nil {
+		return report, err
+	}
+	textStart, text, err := file.Text()
+	if err != nil {
+		return report, err
+	}
+
+	var callers []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+		fn := tab.PCToFunc(pc)
+		if fn == nil || decoded[fn.Entry] || isStdPackage(fn.PackageName()) {
+			continue
+		}
+		decoded[fn.Entry] = true
+		if telemetryFramework(fn.Name) == "" {
+			callers = append(callers, fn)
+		}
+	}
+
+	ptrSize := uint64(4)
+	if is64bit {
+		ptrSize = 8
+	}
+	// readOpts reads the leading string fields of an opts struct, nil unless all of them are strings or empty
+	readOpts := func(address uint64) []string {
+		fields := make([]string, 4)
+		for i := range fields {
+			data, err := file.ReadPointerSizeMem(address+uint64(i)*2*ptrSize, is64bit, littleendian)
+			if err != nil {
+				return nil
+			}
+			length, err := file.ReadPointerSizeMem(address+uint64(i)*2*ptrSize+ptrSize, is64bit, littleendian)
+			if err != nil || (data == 0) != (length == 0) {
+				return nil
+			}
+			if data != 0 {
+				value, _, ok := readText(sections, data, length)
+				if !ok {
+					return nil
+				}
+				fields[i] = value
+			}
+		}
+		for _, part := range fields[:3] {
+			if part != "" && !metricNameRegex.MatchString(part) {
+				return nil
+			}
+		}
+		if fields[2] == "" {
+			return nil
+		}
+		return fields
+	}
+
+	seen := make(map[string]bool)
+	record := func(name TelemetryName) {
+		key := name.Kind + " " + name.Name
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		if name.Kind == "span" || name.Kind == "tracer" {
+			report.Spans = append(report.Spans, name)
+		} else {
+			report.Metrics = append(report.Metrics, name)
+		}
+	}
+
+	for _, fn := range callers {
+		if ctx.Err() != nil {
+			break
+		}
+		caller := fn.Name
+
+		// static opts, the struct copied from the data sections
+		static := make(map[uint64]bool)
+		var refs []uint64
+		file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			refs = append(refs, inst.Refs...)
+			if inst.Call == 0 {
+				return true
+			}
+			if api, ok := apis[inst.Call]; ok && api.strings == 0 {
+				sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+				for _, ref := range refs {
+					if opts := readOpts(ref); opts != nil {
+						var parts []string
+						for _, part := range opts[:3] {
+							if part != "" {
+								parts = append(parts, part)
+							}
+						}
+						record(TelemetryName{Name: strings.Join(parts, "_"), Kind: api.kind, Help: opts[3], Function: caller, Address: inst.PC})
+						static[inst.PC] = true
+						break
+					}
+				}
+			}
+			refs = refs[:0]
+			return true
+		})
+
+		// string arguments, and opts built on the stack from the strings stored since the previous registering call,
+		// with calls in between to allocate the label names or buckets. Only the Name and Help are told apart from
+		// the label names there.
+		var stored []string
+		callStringArguments(file, sections, fn, nil, func(pc uint64, target uint64, strs []string) {
+			api, ok := apis[target]
+			if !ok {
+				stored = append(stored, strs...)
+				return
+			}
+			stored = append(stored, strs...)
+			defer func() { stored = nil }()
+
+			switch {
+			case api.strings == 0 && !static[pc]:
+				for i := len(stored) - 2; i >= 0; i-- {
+					if metricNameRegex.MatchString(stored[i]) && strings.Contains(stored[i+1], " ") {
+						record(TelemetryName{Name: stored[i], Kind: api.kind, Help: stored[i+1], Function: caller, Address: pc})
+						break
+					}
+				}
+			case api.strings > 0 && len(strs) >= api.strings:
+				name := TelemetryName{Name: strs[len(strs)-api.strings], Kind: api.kind, Function: caller, Address: pc}
+				if api.strings > 1 {
+					name.Help = strs[len(strs)-api.strings+1]
+				}
+				if api.kind == "span" || metricNameRegex.MatchString(name.Name) {
+					record(name)
+				}
+			}
+		})
+	}
+
+	sort.Slice(report.Metrics, func(i, j int) bool { return report.Metrics[i].Name < report.Metrics[j].Name })
+	sort.Slice(report.Spans, func(i, j int) bool { return report.Spans[i].Name < report.Spans[j].Name })
+	return report, ctx.Err()
+}
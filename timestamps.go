@@ -0,0 +1,154 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// Timestamp is a time recorded in the binary. Header timestamps claim when it was linked, the others are times the
+// build can't predate: the commit it was built from and the newest pseudo-version among the dependencies.
+type Timestamp struct {
+	Source string // pe header, debug directory, dylib <name>, vcs.time or pseudo-version <module>
+	Time   time.Time
+	Kind   string // build for the claimed link time, earliest for a time the build can't predate
+}
+
+// TimestampMetadata reports the timestamps together with the inconsistencies between them that suggest forgery
+type TimestampMetadata struct {
+	Timestamps      []Timestamp
+	Inconsistencies []string `json:",omitempty"`
+}
+
+// Release dates of each Go minor version, a build can't predate the release it was built with
+var goReleaseDates = map[string]string{
+	"1.0": "2012-03-28", "1.1": "2013-05-13", "1.2": "2013-12-01", "1.3": "2014-06-18", "1.4": "2014-12-10",
+	"1.5": "2015-08-19", "1.6": "2016-02-17", "1.7": "2016-08-15", "1.8": "2017-02-16", "1.9": "2017-08-24",
+	"1.10": "2018-02-16", "1.11": "2018-08-24", "1.12": "2019-02-25", "1.13": "2019-09-03", "1.14": "2020-02-25",
+	"1.15": "2020-08-11", "1.16": "2021-02-16", "1.17": "2021-08-16", "1.18": "2022-03-15", "1.19": "2022-08-02",
+	"1.20": "2023-02-01", "1.21": "2023-08-08", "1.22": "2024-02-06", "1.23": "2024-08-13", "1.24": "2025-02-11",
+	"1.25": "2025-08-12",
+}
+
+// v0.0.0-20230405123456-abcdefabcdef and its variants after a pre-release or a base version
+var pseudoVersionRegex = regexp.MustCompile(`[.-](\d{14})-([0-9a-f]{12})$`)
+
+const (
+	// linkers that don't record the time write small constants instead, ld64 writes 2 into the dylib commands
+	minPlausibleTimestamp = 365 * 24 * 60 * 60
+
+	// header timestamps further apart than this weren't written by the same build
+	maxHeaderTimestampSkew = 24 * time.Hour
+)
+
+// collectTimestamps gathers the timestamps of the headers and the build info and checks them against each other, the
+// Go release and the current time. The Go build ID is a hash of the inputs and holds no time.
+func collectTimestamps(file *objfile.File, metadata ExtractMetadata, now time.Time) (*TimestampMetadata, error) {
+	report := &TimestampMetadata{}
+	inconsistent := func(format string, args ...any) {
+		report.Inconsistencies = append(report.Inconsistencies, fmt.Sprintf(format, args...))
+	}
+
+	headers, err := file.Timestamps()
+	for _, header := range headers {
+		if header.Value < minPlausibleTimestamp {
+			continue
+		}
+		report.Timestamps = append(report.Timestamps, Timestamp{Source: header.Name, Time: time.Unix(int64(header.Value), 0).UTC(), Kind: "build"})
+	}
+
+	for _, setting := range metadata.BuildInfo.Settings {
+		if setting.Key == "vcs.time" {
+			if vcsTime, err := time.Parse(time.RFC3339, setting.Value); err == nil {
+				report.Timestamps = append(report.Timestamps, Timestamp{Source: "vcs.time", Time: vcsTime.UTC(), Kind: "earliest"})
+			}
+		}
+	}
+
+	var newestPseudoVersion *Timestamp
+	for _, dep := range metadata.BuildInfo.Deps {
+		version := dep.Version
+		if dep.Replace != nil {
+			version = dep.Replace.Version
+		}
+		match := pseudoVersionRegex.FindStringSubmatch(version)
+		if match == nil {
+			continue
+		}
+		if commitTime, err := time.Parse("20060102150405", match[1]); err == nil && (newestPseudoVersion == nil || commitTime.After(newestPseudoVersion.Time)) {
+			newestPseudoVersion = &Timestamp{Source: "pseudo-version " + dep.Path, Time: commitTime, Kind: "earliest"}
+		}
+	}
+	if newestPseudoVersion != nil {
+		report.Timestamps = append(report.Timestamps, *newestPseudoVersion)
+	}
+
+	if len(report.Timestamps) == 0 {
+		return nil, err
+	}
+
+	// the Go linker writes no time into PE headers, a cgo build's external linker does
+	isPE := false
+	for _, ts := range report.Timestamps {
+		isPE = isPE || ts.Source == "pe header"
+	}
+	if isPE && metadata.Build != nil && metadata.Build.CGOEnabled != nil && !*metadata.Build.CGOEnabled {
+		inconsistent("the Go linker leaves the PE timestamp zero, but this build without cgo has one")
+	}
+
+	goVersion := goMinorVersion(metadata.Version)
+	goRelease, hasRelease := time.Time{}, false
+	if released, ok := goReleaseDates[goVersion]; ok {
+		var parseErr error
+		goRelease, parseErr = time.Parse("2006-01-02", released)
+		hasRelease = parseErr == nil
+	}
+
+	var firstBuild *Timestamp
+	for i, ts := range report.Timestamps {
+		if ts.Time.After(now) {
+			inconsistent("%s %s is in the future", ts.Source, ts.Time.Format(time.RFC3339))
+		}
+		if ts.Kind != "build" {
+			continue
+		}
+
+		if hasRelease && ts.Time.Before(goRelease) {
+			inconsistent("%s %s predates the release of Go %s on %s", ts.Source, ts.Time.Format(time.RFC3339), goVersion, goRelease.Format("2006-01-02"))
+		}
+		for _, earliest := range report.Timestamps {
+			if earliest.Kind == "earliest" && ts.Time.Before(earliest.Time) {
+				inconsistent("%s %s predates %s %s", ts.Source, ts.Time.Format(time.RFC3339), earliest.Source, earliest.Time.Format(time.RFC3339))
+			}
+		}
+
+		if firstBuild == nil {
+			firstBuild = &report.Timestamps[i]
+		} else if skew := ts.Time.Sub(firstBuild.Time); skew > maxHeaderTimestampSkew || skew < -maxHeaderTimestampSkew {
+			inconsistent("%s %s and %s %s are %s apart", firstBuild.Source, firstBuild.Time.Format(time.RFC3339), ts.Source, ts.Time.Format(time.RFC3339), skew.Abs().Round(time.Hour))
+		}
+	}
+
+	sort.SliceStable(report.Timestamps, func(i, j int) bool {
+		return report.Timestamps[i].Time.Before(report.Timestamps[j].Time)
+	})
+	return report, err
+}
+
+// goMinorVersion turns 1.21.3 or 1.22rc1 into 1.21 and 1.22
+func goMinorVersion(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "go"), ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(c rune) bool { return c < '0' || c > '9' }); i != -1 {
+		minor = minor[:i]
+	}
+	return parts[0] + "." + minor
+}
@@ -0,0 +1,28 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// TLSCallback is a function the Windows loader runs before the entry point, and again on every thread start. Go
+// itself doesn't register any, so callbacks of a Go binary come from cgo code or were added after the build.
+type TLSCallback struct {
+	Address  uint64
+	Function string `json:",omitempty"` // the recovered function the callback points into, if any
+}
+
+func tlsCallbacks(file *objfile.File, tab *gosym.Table) ([]TLSCallback, error) {
+	addresses, err := file.TLSCallbacks()
+
+	var callbacks []TLSCallback
+	for _, address := range addresses {
+		callback := TLSCallback{Address: address}
+		if fn := tab.PCToFunc(address); fn != nil {
+			callback.Function = fn.Name
+		}
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks, err
+}
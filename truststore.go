@@ -0,0 +1,208 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// The fingerprints of the public roots, see the comment at the top of the file
+//
+//go:embed rootcas/mozilla.txt
+var mozillaRootsList string
+
+var mozillaRoots = sync.OnceValues(loadMozillaRoots)
+
+// TimeZoneData is the timezone database the program carries with it, imported as time/tzdata or built with
+// -tags timetzdata, so that it doesn't depend on the host's
+type TimeZoneData struct {
+	Package string // time/tzdata
+	Address uint64 `json:",omitempty"` // of the zip of the zones
+	Zones   int    `json:",omitempty"`
+}
+
+// RootCAMetadata is the certificate authorities the program trusts besides, or instead of, the host's. A root that
+// isn't public lets whoever holds its key intercept the program's TLS connections, or sign its C2 servers.
+type RootCAMetadata struct {
+	Bundles      []string       `json:",omitempty"` // packages embedding a public root bundle
+	PoolBuilders []string       `json:",omitempty"` // functions outside the standard library adding certificates to a pool
+	Certificates int            // CA certificates embedded in the data sections
+	PublicRoots  int            // of those, the ones in the bundled Mozilla list
+	Custom       []CustomRootCA `json:",omitempty"` // the others
+}
+
+// CustomRootCA is an embedded CA certificate that isn't a public root, with its PEM encoding to import elsewhere
+type CustomRootCA struct {
+	Subject     string
+	Issuer      string
+	NotAfter    string
+	Fingerprint string
+	Address     uint64
+	Section     string
+	PEM         string
+}
+
+// Packages embedding a copy of a public root store
+var rootBundlePackages = []string{
+	"golang.org/x/crypto/x509roots/fallback", "github.com/certifi/gocertifi", "github.com/gwatts/rootcerts",
+	"github.com/breml/rootcerts",
+}
+
+// The functions adding certificates to a pool, or replacing the roots used when the host has none
+var certPoolAPIs = map[string]bool{
+	"crypto/x509.(*CertPool).AppendCertsFromPEM": true, "crypto/x509.(*CertPool).AddCert": true,
+	"crypto/x509.SetFallbackRoots": true,
+}
+
+const maxPoolBuilders = 10
+
+// loadMozillaRoots parses the bundled list into a set of fingerprints
+func loadMozillaRoots() (map[string]bool, error) {
+	roots := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(mozillaRootsList))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fingerprint, _, _ := strings.Cut(line, " ")
+		if len(fingerprint) != 64 {
+			return nil, fmt.Errorf("mozilla roots:%d: expected a SHA-256 fingerprint", lineNumber)
+		}
+		roots[fingerprint] = true
+	}
+	return roots, scanner.Err()
+}
+
+// detectTimeZoneData finds the zip time/tzdata registers with the time package and counts its zones
+func detectTimeZoneData(file *objfile.File, tab *gosym.Table) *TimeZoneData {
+	embedded := false
+	for _, fn := range tab.Funcs {
+		if fn.PackageName() == "time/tzdata" {
+			embedded = true
+			break
+		}
+	}
+	if !embedded {
+		return nil
+	}
+
+	tzdata := &TimeZoneData{Package: "time/tzdata"}
+	sections, err := file.Sections()
+	if err != nil {
+		return tzdata
+	}
+
+	// the zones are stored uncompressed in alphabetical order, the first is Africa/Abidjan
+	localHeader := []byte("PK\x03\x04")
+	for _, sec := range sections {
+		if sec.Executable || sec.FileSize == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		for offset := 0; ; {
+			idx := bytes.Index(data[offset:], localHeader)
+			if idx == -1 {
+				break
+			}
+			start := offset + idx
+			offset = start + len(localHeader)
+			if start+30+len("Africa/") > len(data) || !bytes.HasPrefix(data[start+30:], []byte("Africa/")) {
+				continue
+			}
+
+			tzdata.Address = sec.Addr + uint64(start)
+			if end := bytes.Index(data[start:], []byte("PK\x05\x06")); end != -1 && start+end+12 <= len(data) {
+				tzdata.Zones = int(binary.LittleEndian.Uint16(data[start+end+10:]))
+			}
+			return tzdata
+		}
+	}
+	return tzdata
+}
+
+// analyzeRootCAs separates the embedded CA certificates into public and custom roots, and finds the bundles and the
+// code building certificate pools. Returns nil when the program has none of them.
+func analyzeRootCAs(file *objfile.File, tab *gosym.Table, keyMaterial []KeyMaterial, publicRoots map[string]bool) (*RootCAMetadata, error) {
+	report := &RootCAMetadata{}
+
+	packages := make(map[string]bool)
+	targets := make(map[uint64]bool)
+	for _, fn := range tab.Funcs {
+		packages[fn.PackageName()] = true
+		if certPoolAPIs[fn.Name] {
+			targets[fn.Entry] = true
+		}
+	}
+	for _, pkg := range rootBundlePackages {
+		if packages[pkg] {
+			report.Bundles = append(report.Bundles, pkg)
+		}
+	}
+
+	var err error
+	if len(targets) > 0 {
+		var textStart uint64
+		var text []byte
+		if textStart, text, err = file.Text(); err == nil {
+			builders := make(map[string]bool)
+			for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+				fn := tab.PCToFunc(pc)
+				if fn == nil || isStdPackage(fn.PackageName()) {
+					continue
+				}
+				if slices.ContainsFunc(report.Bundles, func(bundle string) bool { return packageMatches(fn.PackageName(), bundle) }) {
+					continue
+				}
+				builders[fn.Name] = true
+			}
+			for name := range builders {
+				report.PoolBuilders = append(report.PoolBuilders, name)
+			}
+			sort.Strings(report.PoolBuilders)
+			if len(report.PoolBuilders) > maxPoolBuilders {
+				report.PoolBuilders = report.PoolBuilders[:maxPoolBuilders]
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range keyMaterial {
+		if key.Kind != "certificate" || !key.CA || seen[key.Fingerprint] {
+			continue
+		}
+		seen[key.Fingerprint] = true
+		report.Certificates++
+		if publicRoots[key.Fingerprint] {
+			report.PublicRoots++
+			continue
+		}
+		custom := CustomRootCA{Subject: key.Subject, Issuer: key.Issuer, Fingerprint: key.Fingerprint, Address: key.Address, Section: key.Section}
+		if key.NotAfter != nil {
+			custom.NotAfter = key.NotAfter.Format("2006-01-02")
+		}
+		if key.der != nil {
+			custom.PEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: key.der}))
+		}
+		report.Custom = append(report.Custom, custom)
+	}
+
+	if len(report.Bundles) == 0 && len(report.PoolBuilders) == 0 && report.Certificates == 0 {
+		return nil, err
+	}
+	return report, err
+}
@@ -0,0 +1,425 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// The result browser is a full screen list view drawn with plain ANSI escape sequences.
+// Every screen is a list of entries, opening an entry pushes a new screen, going back pops it.
+type tuiEntry struct {
+	text string
+	open func() *tuiScreen // nil for informational lines
+}
+
+type tuiScreen struct {
+	title   string
+	entries func() []tuiEntry // rebuilt on every draw so the package filter applies immediately
+	cursor  int
+	offset  int
+}
+
+type browser struct {
+	metadata          ExtractMetadata
+	functions         []FuncMetadata
+	functionsByName   map[string]FuncMetadata
+	stringsByFunction map[string][]StringMetadata
+
+	packageFilter *regexp.Regexp
+	stack         []*tuiScreen
+	topLevel      int // which top level list is shown, functions or strings
+
+	in     *bufio.Reader
+	out    *bufio.Writer
+	width  int
+	height int
+
+	editing bool
+	input   string
+	status  string
+}
+
+func newBrowser(metadata ExtractMetadata) *browser {
+	b := &browser{
+		metadata:          metadata,
+		functionsByName:   make(map[string]FuncMetadata),
+		stringsByFunction: make(map[string][]StringMetadata),
+		in:                bufio.NewReader(os.Stdin),
+		out:               bufio.NewWriter(os.Stdout),
+	}
+
+	b.functions = append(b.functions, metadata.UserFunctions...)
+	b.functions = append(b.functions, metadata.StdFunctions...)
+	sort.Slice(b.functions, func(i, j int) bool { return b.functions[i].Start < b.functions[j].Start })
+	for _, fn := range b.functions {
+		b.functionsByName[fn.FullName] = fn
+	}
+
+	for _, s := range metadata.Strings {
+		for _, fn := range s.Functions {
+			b.stringsByFunction[fn] = append(b.stringsByFunction[fn], s)
+		}
+	}
+
+	b.stack = []*tuiScreen{b.functionsScreen()}
+	return b
+}
+
+func (b *browser) packageAllowed(pkg string) bool {
+	return b.packageFilter == nil || b.packageFilter.MatchString(pkg)
+}
+
+// stringAllowed keeps strings referenced from a package matching the filter, unreferenced strings only show unfiltered
+func (b *browser) stringAllowed(s StringMetadata) bool {
+	if b.packageFilter == nil {
+		return true
+	}
+
+	for _, name := range s.Functions {
+		if fn, ok := b.functionsByName[name]; ok && b.packageAllowed(fn.PackageName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *browser) functionsScreen() *tuiScreen {
+	return &tuiScreen{
+		title: "Functions",
+		entries: func() []tuiEntry {
+			var entries []tuiEntry
+			for _, fn := range b.functions {
+				if !b.packageAllowed(fn.PackageName) {
+					continue
+				}
+
+				fn := fn
+				text := fmt.Sprintf("0x%-12x %s", fn.Start, fn.FullName)
+				if count := len(b.stringsByFunction[fn.FullName]); count > 0 {
+					text += fmt.Sprintf("  (%d strings)", count)
+				}
+				entries = append(entries, tuiEntry{text: text, open: func() *tuiScreen { return b.functionScreen(fn) }})
+			}
+			return entries
+		},
+	}
+}
+
+func (b *browser) stringsScreen() *tuiScreen {
+	return &tuiScreen{
+		title: "Strings",
+		entries: func() []tuiEntry {
+			var entries []tuiEntry
+			for _, s := range b.metadata.Strings {
+				if !b.stringAllowed(s) {
+					continue
+				}
+
+				s := s
+				text := fmt.Sprintf("0x%-12x %q", s.Address, s.Value)
+				if len(s.Xrefs) > 0 {
+					text += fmt.Sprintf("  (%d xrefs)", len(s.Xrefs))
+				}
+				entries = append(entries, tuiEntry{text: text, open: func() *tuiScreen { return b.stringScreen(s) }})
+			}
+			return entries
+		},
+	}
+}
+
+func (b *browser) functionScreen(fn FuncMetadata) *tuiScreen {
+	return &tuiScreen{
+		title: fn.FullName,
+		entries: func() []tuiEntry {
+			entries := []tuiEntry{
+				{text: fmt.Sprintf("%-10s 0x%x", "Start:", fn.Start)},
+				{text: fmt.Sprintf("%-10s 0x%x", "End:", fn.End)},
+				{text: fmt.Sprintf("%-10s %s", "Package:", fn.PackageName)},
+				{text: ""},
+			}
+
+			strs := b.stringsByFunction[fn.FullName]
+			if len(strs) == 0 {
+				return append(entries, tuiEntry{text: "<NO STRINGS REFERENCED>"})
+			}
+
+			entries = append(entries, tuiEntry{text: "Strings:"})
+			for _, s := range strs {
+				s := s
+				entries = append(entries, tuiEntry{text: fmt.Sprintf("  0x%-12x %q", s.Address, s.Value), open: func() *tuiScreen { return b.stringScreen(s) }})
+			}
+			return entries
+		},
+	}
+}
+
+func (b *browser) stringScreen(s StringMetadata) *tuiScreen {
+	return &tuiScreen{
+		title: fmt.Sprintf("String at 0x%x", s.Address),
+		entries: func() []tuiEntry {
+			entries := []tuiEntry{
+				{text: fmt.Sprintf("%-10s %q", "Value:", s.Value)},
+				{text: fmt.Sprintf("%-10s %s", "Section:", s.Section)},
+				{text: ""},
+			}
+
+			if len(s.Xrefs) == 0 {
+				return append(entries, tuiEntry{text: "<NO CODE REFERENCES>"})
+			}
+
+			entries = append(entries, tuiEntry{text: "Referenced by:"})
+			for _, xref := range s.Xrefs {
+				entry := tuiEntry{text: fmt.Sprintf("  0x%x", xref)}
+				for _, name := range s.Functions {
+					if fn, ok := b.functionsByName[name]; ok && xref >= fn.Start && xref < fn.End {
+						entry.text += "  " + name
+						entry.open = func() *tuiScreen { return b.functionScreen(fn) }
+						break
+					}
+				}
+				entries = append(entries, entry)
+			}
+			return entries
+		},
+	}
+}
+
+func (b *browser) draw() {
+	screen := b.stack[len(b.stack)-1]
+	entries := screen.entries()
+	listHeight := b.height - 3
+	if listHeight < 1 {
+		listHeight = 1
+	}
+
+	if screen.cursor >= len(entries) {
+		screen.cursor = len(entries) - 1
+	}
+	if screen.cursor < 0 {
+		screen.cursor = 0
+	}
+	if screen.cursor < screen.offset {
+		screen.offset = screen.cursor
+	}
+	if screen.cursor >= screen.offset+listHeight {
+		screen.offset = screen.cursor - listHeight + 1
+	}
+
+	b.out.WriteString("\033[H\033[2J")
+	header := fmt.Sprintf(" GoReSym %s | %s %s | %d entries", b.metadata.Version, b.metadata.OS, b.metadata.Arch, len(entries))
+	if b.packageFilter != nil {
+		header += fmt.Sprintf(" | package /%s/", b.packageFilter)
+	}
+	b.writeLine("\033[7m", header, screen.title)
+	b.out.WriteString("\r\n")
+
+	for i := screen.offset; i < len(entries) && i < screen.offset+listHeight; i++ {
+		style := ""
+		if i == screen.cursor {
+			style = "\033[1;7m"
+		}
+		b.writeLine(style, entries[i].text, "")
+		b.out.WriteString("\r\n")
+	}
+
+	b.out.WriteString(fmt.Sprintf("\033[%d;1H", b.height))
+	if b.editing {
+		b.writeLine("", "package filter (regex): "+b.input, "")
+	} else if b.status != "" {
+		b.writeLine("", b.status, "")
+	} else {
+		b.writeLine("\033[2m", "j/k move  enter open  esc back  tab functions/strings  / filter package  q quit", "")
+	}
+	b.out.Flush()
+}
+
+// writeLine draws left and right aligned text on the current line, truncated to the terminal width.
+// It doesn't end the line, a newline on the last row would scroll the screen.
+func (b *browser) writeLine(style string, left string, right string) {
+	line := left
+	if right != "" {
+		pad := b.width - len(left) - len(right) - 1
+		if pad < 1 {
+			pad = 1
+		}
+		line = left + strings.Repeat(" ", pad) + right + " "
+	}
+	if len(line) > b.width {
+		line = line[:b.width]
+	}
+
+	b.out.WriteString(style + line)
+	if style != "" {
+		b.out.WriteString(strings.Repeat(" ", b.width-len(line)) + "\033[0m")
+	}
+}
+
+// readKey returns a single key, escape sequences for arrows and paging are folded into names
+func (b *browser) readKey() (string, error) {
+	c, err := b.in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if c != 0x1b {
+		return string([]byte{c}), nil
+	}
+
+	if b.in.Buffered() == 0 {
+		return "esc", nil
+	}
+
+	seq := []byte{}
+	for b.in.Buffered() > 0 {
+		c, _ := b.in.ReadByte()
+		seq = append(seq, c)
+		if (c >= 'A' && c <= 'Z') || c == '~' {
+			break
+		}
+	}
+
+	switch string(seq) {
+	case "[A", "OA":
+		return "up", nil
+	case "[B", "OB":
+		return "down", nil
+	case "[C", "OC":
+		return "right", nil
+	case "[D", "OD":
+		return "left", nil
+	case "[5~":
+		return "pgup", nil
+	case "[6~":
+		return "pgdown", nil
+	case "[H", "[1~":
+		return "home", nil
+	case "[F", "[4~":
+		return "end", nil
+	}
+	return "", nil
+}
+
+func (b *browser) handleFilterKey(key string) {
+	switch key {
+	case "\r", "\n":
+		b.editing = false
+		if b.input == "" {
+			b.packageFilter = nil
+			return
+		}
+
+		re, err := regexp.Compile(b.input)
+		if err != nil {
+			b.status = fmt.Sprintf("invalid filter: %s", err)
+			return
+		}
+		b.packageFilter = re
+	case "esc":
+		b.editing = false
+	case "\x7f", "\b":
+		if len(b.input) > 0 {
+			b.input = b.input[:len(b.input)-1]
+		}
+	default:
+		if len(key) == 1 && key[0] >= 0x20 && key[0] < 0x7f {
+			b.input += key
+		}
+	}
+}
+
+// handleKey applies one key press, it returns false once the user quits
+func (b *browser) handleKey(key string) bool {
+	if b.editing {
+		b.handleFilterKey(key)
+		return true
+	}
+
+	b.status = ""
+	screen := b.stack[len(b.stack)-1]
+	page := b.height - 3
+	switch key {
+	case "q", "\x03":
+		return false
+	case "j", "down":
+		screen.cursor++
+	case "k", "up":
+		screen.cursor--
+	case " ", "pgdown", "\x06":
+		screen.cursor += page
+	case "b", "pgup", "\x02":
+		screen.cursor -= page
+	case "g", "home":
+		screen.cursor = 0
+	case "G", "end":
+		screen.cursor = len(screen.entries())
+	case "\r", "\n", "l", "right":
+		entries := screen.entries()
+		if screen.cursor < len(entries) && entries[screen.cursor].open != nil {
+			b.stack = append(b.stack, entries[screen.cursor].open())
+		}
+	case "esc", "h", "left", "\x7f", "\b":
+		if len(b.stack) > 1 {
+			b.stack = b.stack[:len(b.stack)-1]
+		}
+	case "\t":
+		b.topLevel = (b.topLevel + 1) % 2
+		if b.topLevel == 0 {
+			b.stack = []*tuiScreen{b.functionsScreen()}
+		} else {
+			b.stack = []*tuiScreen{b.stringsScreen()}
+		}
+	case "/":
+		b.editing = true
+		b.input = ""
+		if b.packageFilter != nil {
+			b.input = b.packageFilter.String()
+		}
+	}
+	return true
+}
+
+// browseResults shows the results in an interactive browser until the user quits
+func browseResults(metadata ExtractMetadata) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("the result browser needs an interactive terminal")
+	}
+
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, oldState)
+
+	b := newBrowser(metadata)
+
+	// alternate screen buffer, so the shell scrollback is left as it was
+	b.out.WriteString("\033[?1049h\033[?25l")
+	defer func() {
+		b.out.WriteString("\033[?25h\033[?1049l")
+		b.out.Flush()
+	}()
+
+	for {
+		b.width, b.height, err = term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || b.width <= 0 || b.height <= 0 {
+			b.width, b.height = 80, 24
+		}
+
+		b.draw()
+		key, err := b.readKey()
+		if err != nil {
+			return err
+		}
+
+		if !b.handleKey(key) {
+			return nil
+		}
+	}
+}
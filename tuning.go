@@ -0,0 +1,216 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mandiant/GoReSym/debug/gosym"
+	"github.com/mandiant/GoReSym/objfile"
+)
+
+// RuntimeSetting is a setting of the Go runtime the program imposes on itself: the GODEBUG defaults the linker
+// stamps from the //go:debug directives and the go.mod godebug lines, calls to runtime/debug and runtime with a
+// constant, and the runtime's environment variables the program sets before it re-executes itself or starts children.
+type RuntimeSetting struct {
+	Setting string   // the environment variable with the same effect, ex: GOGC, or the GODEBUG key
+	Value   string   `json:",omitempty"` // empty when it isn't a constant at the call site
+	Source  string   // the function called, DefaultGODEBUG or the library tuning the runtime
+	Callers []string `json:",omitempty"` // the first few functions making the call
+}
+
+// The functions taking the setting as their first argument, integers unless noted
+var runtimeTuningAPIs = map[string]string{
+	"runtime/debug.SetGCPercent":      "GOGC",
+	"runtime/debug.SetMemoryLimit":    "GOMEMLIMIT",
+	"runtime/debug.SetMaxThreads":     "max-threads",
+	"runtime/debug.SetMaxStack":       "max-stack",
+	"runtime/debug.SetPanicOnFault":   "panic-on-fault",
+	"runtime/debug.SetTraceback":      "GOTRACEBACK", // a string
+	"runtime.GOMAXPROCS":              "GOMAXPROCS",
+	"runtime.SetBlockProfileRate":     "block-profile-rate",
+	"runtime.SetMutexProfileFraction": "mutex-profile-fraction",
+	"runtime.SetCPUProfileRate":       "cpu-profile-rate",
+}
+
+// The functions setting environment variables, with the runtime's variables they can set
+var (
+	runtimeSetenvAPIs = map[string]bool{"os.Setenv": true, "syscall.Setenv": true}
+	runtimeVariables  = map[string]bool{"GOGC": true, "GOMEMLIMIT": true, "GOMAXPROCS": true, "GODEBUG": true, "GOTRACEBACK": true}
+)
+
+// Libraries that set GOMAXPROCS or GOMEMLIMIT from the CPU or memory quota of the container when imported
+var runtimeTuningLibraries = []string{"go.uber.org/automaxprocs", "github.com/KimMachineGun/automemlimit"}
+
+const maxTuningCallers = 5
+
+// runtimeSettingValue formats the constant passed to a tuning function like the matching environment variable
+func runtimeSettingValue(api string, value int64) string {
+	switch {
+	case api == "runtime/debug.SetGCPercent" && value < 0:
+		return "off"
+	case api == "runtime/debug.SetMemoryLimit" && value == math.MaxInt64:
+		return "off"
+	case api == "runtime/debug.SetPanicOnFault":
+		return strconv.FormatBool(value != 0)
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+// extractRuntimeTuning lists the GODEBUG defaults, the libraries tuning the runtime and the tuning calls, decoding the
+// functions calling the tuning functions. Integers are the constants held by the argument register or stack slot at
+// the call, strings the ones loaded before it.
+func extractRuntimeTuning(ctx context.Context, file *objfile.File, tab *gosym.Table, build *BuildSettings, version string) ([]RuntimeSetting, error) {
+	var settings []RuntimeSetting
+	if build != nil && build.GODEBUG != "" {
+		for _, pair := range strings.Split(build.GODEBUG, ",") {
+			if key, value, ok := strings.Cut(strings.TrimSpace(pair), "="); ok {
+				settings = append(settings, RuntimeSetting{Setting: key, Value: value, Source: "DefaultGODEBUG"})
+			}
+		}
+	}
+
+	libraries := make(map[string]bool)
+	apis := make(map[uint64]string)
+	for _, fn := range tab.Funcs {
+		if _, ok := runtimeTuningAPIs[fn.Name]; ok || runtimeSetenvAPIs[fn.Name] {
+			apis[fn.Entry] = fn.Name
+		}
+		for _, library := range runtimeTuningLibraries {
+			if packageMatches(fn.PackageName(), library) {
+				libraries[library] = true
+			}
+		}
+	}
+	for _, library := range runtimeTuningLibraries {
+		if libraries[library] {
+			setting := "GOMAXPROCS"
+			if strings.HasSuffix(library, "automemlimit") {
+				setting = "GOMEMLIMIT"
+			}
+			settings = append(settings, RuntimeSetting{Setting: setting, Source: library})
+		}
+	}
+	if len(apis) == 0 {
+		return settings, nil
+	}
+
+	sections, err := loadStringSections(file)
+	if err != nil {
+		return settings, err
+	}
+	textStart, text, err := file.Text()
+	if err != nil {
+		return settings, err
+	}
+
+	targets := make(map[uint64]bool, len(apis))
+	for entry := range apis {
+		targets[entry] = true
+	}
+	var callers []*gosym.Func
+	decoded := make(map[uint64]bool)
+	for _, pc := range directCallSites(file.GOARCH(), textStart, text, targets) {
+		fn := tab.PCToFunc(pc)
+		// the standard library's own calls, such as the runtime setting its defaults, aren't the program's
+		if fn == nil || decoded[fn.Entry] || targets[fn.Entry] || isStdlibPath(fn.PackageName()) {
+			continue
+		}
+		decoded[fn.Entry] = true
+		callers = append(callers, fn)
+	}
+
+	argument := "SP+0"
+	if registerABI(version, file.GOARCH()) {
+		argument = "AX"
+		if file.GOARCH() == "arm64" {
+			argument = "R0"
+		}
+	}
+
+	found := make(map[string]*RuntimeSetting)
+	var order []string
+	record := func(setting string, value string, source string, caller string) {
+		key := setting + "\x00" + value + "\x00" + source
+		entry, ok := found[key]
+		if !ok {
+			entry = &RuntimeSetting{Setting: setting, Value: value, Source: source}
+			found[key] = entry
+			order = append(order, key)
+		}
+		if len(entry.Callers) < maxTuningCallers && !slices.Contains(entry.Callers, caller) {
+			entry.Callers = append(entry.Callers, caller)
+		}
+	}
+
+	for _, fn := range callers {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// integer arguments, the constants held by registers and stack slots like enumerateSyscalls tracks them
+		constants := make(map[string]int64)
+		err := file.Decode(fn.Entry, fn.End, func(inst objfile.Instruction) bool {
+			if inst.Call != 0 {
+				api := apis[inst.Call]
+				if setting, ok := runtimeTuningAPIs[api]; ok && api != "runtime/debug.SetTraceback" {
+					value, known := constants[argument]
+					formatted := ""
+					if known {
+						formatted = runtimeSettingValue(api, value)
+					}
+					// GOMAXPROCS(0) only queries the setting, and is usually computed, so only constants are reported
+					if api != "runtime.GOMAXPROCS" || (known && value > 0) {
+						record(setting, formatted, api, fn.Name)
+					}
+				}
+				constants = make(map[string]int64)
+			}
+			if inst.Dest != "" {
+				dest := canonicalRegister(inst.Dest)
+				switch {
+				case (inst.Op == "MOV" || inst.Op == "MOVZ") && len(inst.Imms) == 1:
+					constants[dest] = inst.Imms[0]
+				case inst.Shape == "XOR r,r":
+					// the compiler zeroes registers by xoring them with themselves, other xors rarely precede a call
+					constants[dest] = 0
+				default:
+					delete(constants, dest)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return settings, err
+		}
+
+		// string arguments, the traceback level and the variables set with their value
+		caller := fn.Name
+		callStringArguments(file, sections, fn, targets, func(_ uint64, target uint64, strs []string) {
+			api := apis[target]
+			switch {
+			case api == "runtime/debug.SetTraceback":
+				value := ""
+				if len(strs) > 0 {
+					value = strs[len(strs)-1]
+				}
+				record("GOTRACEBACK", value, api, caller)
+			case runtimeSetenvAPIs[api] && len(strs) >= 2 && runtimeVariables[strs[len(strs)-2]]:
+				record(strs[len(strs)-2], strs[len(strs)-1], api, caller)
+			case runtimeSetenvAPIs[api] && len(strs) == 1 && runtimeVariables[strs[0]]:
+				record(strs[0], "", api, caller)
+			}
+		})
+	}
+
+	var calls []RuntimeSetting
+	for _, key := range order {
+		calls = append(calls, *found[key])
+	}
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].Setting < calls[j].Setting })
+	return append(settings, calls...), nil
+}
@@ -0,0 +1,246 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The bundled list of popular modules, -typosquat-list adds the paths of another file to it
+//
+//go:embed blocklists/popular.txt
+var popularModulesList string
+
+// TyposquatMatch is a dependency resembling a popular module without being it
+type TyposquatMatch struct {
+	Matched  string // the module or package path of the binary
+	Popular  string // the module it resembles
+	Kind     string // typo, case, homoglyph, or replace for a popular module replaced by another owner's
+	Distance int    `json:",omitempty"` // the edits between the two paths, for typo
+	Source   string // module for build info dependencies, package for recovered functions
+}
+
+// parsePopularModules reads one module path per line
+func parsePopularModules(name string, r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(line, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected a single module path", name, lineNumber)
+		}
+		paths = append(paths, stripMajorVersion(strings.TrimSuffix(line, "/")))
+	}
+	return paths, scanner.Err()
+}
+
+// loadPopularModules returns the bundled paths followed by those of the given file, if any
+func loadPopularModules(path string) ([]string, error) {
+	paths, err := parsePopularModules("popular modules", strings.NewReader(popularModulesList))
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return paths, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	extra, err := parsePopularModules(path, f)
+	if err != nil {
+		return nil, err
+	}
+	return append(paths, extra...), nil
+}
+
+var (
+	majorVersionRegex = regexp.MustCompile(`/v[0-9]+$`)
+	gopkgVersionRegex = regexp.MustCompile(`\.v[0-9]+$`)
+)
+
+// stripMajorVersion drops the major version suffix, /v2 or the .v3 of gopkg.in
+func stripMajorVersion(path string) string {
+	if strings.HasPrefix(path, "gopkg.in/") {
+		return gopkgVersionRegex.ReplaceAllString(path, "")
+	}
+	return majorVersionRegex.ReplaceAllString(path, "")
+}
+
+// moduleOwner returns the host and first element of a path, ex: github.com/spf13 for github.com/spf13/cobra. Squatting
+// a module of the same owner takes the owner's account, those are left alone.
+func moduleOwner(path string) string {
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 3 {
+		return path
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// Characters that look alike in most fonts, mapped to the ASCII letter they pass for
+var homoglyphs = strings.NewReplacer(
+	"0", "o", "1", "l", "I", "l", "rn", "m", "vv", "w",
+	// Cyrillic
+	"а", "a", "е", "e", "о", "o", "р", "p", "с", "c", "х", "x", "у", "y", "і", "i", "ј", "j", "ѕ", "s", "ԁ", "d", "һ", "h", "ӏ", "l",
+	// Greek
+	"α", "a", "ο", "o", "ν", "v", "ρ", "p", "ι", "i",
+)
+
+// homoglyphSkeleton maps a path to the ASCII letters it reads as
+func homoglyphSkeleton(path string) string {
+	return strings.ToLower(homoglyphs.Replace(path))
+}
+
+// editDistance is the optimal string alignment distance, insertions, deletions, substitutions and transpositions of
+// adjacent bytes count one
+func editDistance(a string, b string) int {
+	previous2 := make([]int, len(b)+1)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(b)]
+}
+
+// typosquatKind compares a path with a popular module, both without their major version. The edits tolerated depend
+// on the length of the module's name, one from 5 characters and two from 10, shorter names are too close to others.
+func typosquatKind(path string, popular string) (string, int) {
+	if path == popular || moduleOwner(path) == moduleOwner(popular) {
+		return "", 0
+	}
+	if strings.EqualFold(path, popular) {
+		return "case", 0
+	}
+	if homoglyphSkeleton(path) == homoglyphSkeleton(popular) {
+		return "homoglyph", 0
+	}
+	maxDistance := 0
+	switch name := popular[strings.LastIndex(popular, "/")+1:]; {
+	case len(name) >= 10:
+		maxDistance = 2
+	case len(name) >= 5:
+		maxDistance = 1
+	}
+	if diff := len(path) - len(popular); diff > maxDistance || -diff > maxDistance {
+		return "", 0
+	}
+	if distance := editDistance(path, popular); distance <= maxDistance {
+		return "typo", distance
+	}
+	return "", 0
+}
+
+// matchTyposquats compares the dependencies of the build info and their replacements, and for binaries without one
+// or with vendored code the packages of the recovered functions, with the popular modules. A popular module replaced
+// by another owner's is reported too, unless the main module's owner made the fork or the replacement is popular
+// itself, such as a successor.
+func matchTyposquats(metadata ExtractMetadata, popular []string) []TyposquatMatch {
+	known := make(map[string]bool, len(popular))
+	for _, path := range popular {
+		known[path] = true
+	}
+
+	var matches []TyposquatMatch
+	seen := make(map[string]bool)
+	report := func(match TyposquatMatch) {
+		key := match.Kind + " " + match.Matched + " " + match.Popular
+		if !seen[key] {
+			seen[key] = true
+			matches = append(matches, match)
+		}
+	}
+	check := func(path string, source string) {
+		stripped := stripMajorVersion(path)
+		parts := strings.Split(stripped, "/")
+		for count := 1; count <= len(parts); count++ {
+			// packages and nested modules of a popular module are part of it
+			if known[strings.Join(parts[:count], "/")] {
+				return
+			}
+		}
+		for _, candidate := range popular {
+			compared := stripped
+			if source == "package" {
+				// the package path's leading elements, as many as the module path has
+				count := strings.Count(candidate, "/") + 1
+				if len(parts) < count {
+					continue
+				}
+				compared = strings.Join(parts[:count], "/")
+			}
+			if kind, distance := typosquatKind(compared, candidate); kind != "" {
+				report(TyposquatMatch{Matched: compared, Popular: candidate, Kind: kind, Distance: distance, Source: source})
+			}
+		}
+	}
+
+	mainOwner := moduleOwner(metadata.BuildInfo.Main.Path)
+	for _, dep := range metadata.BuildInfo.Deps {
+		check(dep.Path, "module")
+		if dep.Replace == nil {
+			continue
+		}
+		check(dep.Replace.Path, "module")
+
+		replacement := dep.Replace.Path
+		local := strings.HasPrefix(replacement, ".") || strings.HasPrefix(replacement, "/")
+		if known[stripMajorVersion(dep.Path)] && !local && !known[stripMajorVersion(replacement)] && moduleOwner(replacement) != moduleOwner(dep.Path) && moduleOwner(replacement) != mainOwner {
+			report(TyposquatMatch{Matched: replacement, Popular: stripMajorVersion(dep.Path), Kind: "replace", Source: "module"})
+		}
+	}
+
+	// packages under a dependency of the build info were covered by its module
+	seenPackages := make(map[string]bool)
+	var packages []string
+	for _, fn := range metadata.UserFunctions {
+		pkg := fn.PackageName
+		if i := strings.LastIndex(pkg, "vendor/"); i == 0 || (i > 0 && pkg[i-1] == '/') {
+			pkg = pkg[i+len("vendor/"):]
+		}
+		if seenPackages[pkg] || pkg == "main" {
+			continue
+		}
+		seenPackages[pkg] = true
+		covered := packageMatches(pkg, metadata.BuildInfo.Main.Path)
+		for _, dep := range metadata.BuildInfo.Deps {
+			covered = covered || packageMatches(pkg, dep.Path)
+		}
+		if !covered {
+			packages = append(packages, pkg)
+		}
+	}
+	sort.Strings(packages)
+	for _, pkg := range packages {
+		check(pkg, "package")
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Matched < matches[j].Matched })
+	return matches
+}
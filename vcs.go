@@ -0,0 +1,148 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mandiant/GoReSym/runtime/debug"
+)
+
+// VCSMetadata is the version control state of the main module's checkout, recorded by Go 1.18 and later unless built
+// with -buildvcs=false. The revision names the commit the binary was built from, with the repository it can be
+// matched against for attribution.
+type VCSMetadata struct {
+	System          string   // git, hg, svn, fossil or bzr, from the vcs setting or guessed from the revision
+	Revision        string   `json:",omitempty"`
+	HashFormat      string   `json:",omitempty"` // sha1, sha256 (sha3-256 for fossil), revision-number or revision-id
+	Time            string   `json:",omitempty"` // the commit time
+	Modified        *bool    `json:",omitempty"` // the checkout had uncommitted changes
+	Repository      string   `json:",omitempty"` // the public repository of the main module, for the hosts known below
+	CommitURL       string   `json:",omitempty"`
+	Inconsistencies []string `json:",omitempty"` // the revision doesn't match its system or the main module's version
+}
+
+var (
+	sha1RevisionRegex   = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	sha256RevisionRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	numberRevisionRegex = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// The revision formats each system writes. Mercurial node ids are sha1 like git's, fossil moved to sha3-256.
+var vcsHashFormats = map[string][]string{
+	"git":    {"sha1", "sha256"},
+	"hg":     {"sha1"},
+	"fossil": {"sha1", "sha256"},
+	"svn":    {"revision-number"},
+	"bzr":    {"revision-id"},
+}
+
+// The commit pages of the forges, by host. The repository is the first two elements after the host.
+var vcsCommitPaths = map[string]string{
+	"github.com":    "/commit/",
+	"gitlab.com":    "/-/commit/",
+	"bitbucket.org": "/commits/",
+	"codeberg.org":  "/commit/",
+	"git.sr.ht":     "/commit/",
+}
+
+// hashFormat names the format of a revision
+func hashFormat(revision string) string {
+	switch {
+	case sha1RevisionRegex.MatchString(revision):
+		return "sha1"
+	case sha256RevisionRegex.MatchString(revision):
+		return "sha256"
+	case numberRevisionRegex.MatchString(revision):
+		return "revision-number"
+	case strings.Contains(revision, "@"):
+		return "revision-id"
+	}
+	return "unknown"
+}
+
+// vcsMetadata collects the vcs settings of the build info and checks them against each other and the version the go
+// command stamped the main module with, nil when none were recorded
+func vcsMetadata(info debug.BuildInfo) *VCSMetadata {
+	report := &VCSMetadata{}
+	inconsistent := func(format string, args ...any) {
+		report.Inconsistencies = append(report.Inconsistencies, fmt.Sprintf(format, args...))
+	}
+
+	found := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs":
+			report.System = setting.Value
+		case "vcs.revision":
+			report.Revision = setting.Value
+		case "vcs.time":
+			report.Time = setting.Value
+		case "vcs.modified":
+			modified := setting.Value == "true"
+			report.Modified = &modified
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil
+	}
+
+	if report.Revision != "" {
+		report.HashFormat = hashFormat(report.Revision)
+		if formats, ok := vcsHashFormats[report.System]; ok {
+			known := false
+			for _, format := range formats {
+				known = known || format == report.HashFormat
+			}
+			if !known {
+				inconsistent("%s doesn't write %s revisions", report.System, report.HashFormat)
+			}
+		} else if report.System == "" {
+			// sha1 is ambiguous between git and hg, sha256 between git and fossil
+			switch report.HashFormat {
+			case "revision-number":
+				report.System = "svn"
+			case "revision-id":
+				report.System = "bzr"
+			}
+		}
+	}
+
+	var commitTime time.Time
+	if report.Time != "" {
+		var err error
+		if commitTime, err = time.Parse(time.RFC3339, report.Time); err != nil {
+			inconsistent("vcs.time %s isn't a valid time", report.Time)
+		}
+	}
+
+	// Go 1.24 and later stamp the main module with a tag or a pseudo-version of the revision, +dirty when modified
+	version, dirty := strings.CutSuffix(info.Main.Version, "+dirty")
+	if report.Modified != nil && dirty && !*report.Modified {
+		inconsistent("version %s is dirty but vcs.modified is false", info.Main.Version)
+	}
+	if match := pseudoVersionRegex.FindStringSubmatch(version); match != nil {
+		if report.Revision != "" && !strings.HasPrefix(report.Revision, match[2]) {
+			inconsistent("version %s names commit %s, not the revision", info.Main.Version, match[2])
+		}
+		if !commitTime.IsZero() && commitTime.UTC().Format("20060102150405") != match[1] {
+			inconsistent("version %s names commit time %s, not the vcs.time", info.Main.Version, match[1])
+		}
+	}
+
+	if report.System == "git" {
+		parts := strings.Split(info.Main.Path, "/")
+		if commitPath, ok := vcsCommitPaths[parts[0]]; ok && len(parts) >= 3 {
+			report.Repository = "https://" + strings.Join(parts[:3], "/")
+			if report.Revision != "" {
+				report.CommitURL = report.Repository + commitPath + report.Revision
+			}
+		}
+	}
+	return report
+}
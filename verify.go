@@ -0,0 +1,295 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GoReSym verify checks that a shipped binary matches the source it claims. It rebuilds the main package with the Go
+// release and build settings recovered from the binary, then compares the functions, types and strings of both
+// builds like diff does. Byte for byte equal builds need -trimpath, or the same source paths as the original build.
+type VerifyReport struct {
+	Binary     string
+	Source     string   // the directory built in, or module@version
+	Toolchain  string   // GOTOOLCHAIN, local for the go command in PATH
+	Command    []string // the go command run
+	Env        []string `json:",omitempty"` // set on top of the environment
+	Identical  bool     // the rebuilt file is byte for byte the binary
+	Reproduced bool     // no function, type or string diverges
+	Diff       DiffReport
+}
+
+// rebuildCommand returns the go build arguments and environment reproducing the recovered build settings. The
+// toolchain is the one the binary was built with unless given, downloading toolchains needs Go 1.21 or later.
+func rebuildCommand(metadata ExtractMetadata, output string, toolchain string) ([]string, []string, error) {
+	pkg := metadata.BuildInfo.Path
+	if pkg == "" || pkg == "command-line-arguments" {
+		return nil, nil, fmt.Errorf("the build info doesn't record the main package path, nothing to rebuild")
+	}
+
+	if toolchain == "" {
+		version := strings.Fields(metadata.BuildInfo.GoVersion + " " + metadata.Version)
+		if len(version) == 0 || !strings.HasPrefix(version[0], "go1.") {
+			return nil, nil, fmt.Errorf("the Go release of the binary is unknown, pass -toolchain")
+		}
+		if semver := goSemver(version[0]); semver == "unknown" || compareSemver(semver, "1.21") < 0 {
+			return nil, nil, fmt.Errorf("%s predates toolchain downloads, install it and pass -toolchain local", version[0])
+		}
+		toolchain = version[0]
+	}
+	env := []string{"GOTOOLCHAIN=" + toolchain, "GOOS=" + metadata.OS, "GOARCH=" + metadata.Arch}
+
+	args := []string{"build", "-o", output}
+	if build := metadata.Build; build != nil {
+		if build.CGOEnabled != nil {
+			env = append(env, map[bool]string{true: "CGO_ENABLED=1", false: "CGO_ENABLED=0"}[*build.CGOEnabled])
+		}
+		if build.ArchLevel != "" {
+			env = append(env, build.ArchLevel)
+		}
+		if len(build.Experiments) > 0 {
+			env = append(env, "GOEXPERIMENT="+strings.Join(build.Experiments, ","))
+		}
+		if build.CryptoModule != "" {
+			env = append(env, "GOFIPS140="+build.CryptoModule)
+		}
+		var cgoFlags []string
+		for key, value := range build.CGOFlags {
+			cgoFlags = append(cgoFlags, key+"="+value)
+		}
+		sort.Strings(cgoFlags)
+		env = append(env, cgoFlags...)
+
+		if build.BuildMode != "" && build.BuildMode != "exe" {
+			args = append(args, "-buildmode="+build.BuildMode)
+		}
+		if build.Compiler != "" && build.Compiler != "gc" {
+			args = append(args, "-compiler="+build.Compiler)
+		}
+		if build.Trimpath != nil && *build.Trimpath {
+			args = append(args, "-trimpath")
+		}
+		if build.Race {
+			args = append(args, "-race")
+		}
+		if len(build.Tags) > 0 {
+			args = append(args, "-tags="+strings.Join(build.Tags, ","))
+		}
+		if build.Ldflags != "" {
+			args = append(args, "-ldflags="+build.Ldflags)
+		}
+		if build.Gcflags != "" {
+			args = append(args, "-gcflags="+build.Gcflags)
+		}
+		if build.Asmflags != "" {
+			args = append(args, "-asmflags="+build.Asmflags)
+		}
+	}
+
+	// the vcs settings are stamped in the build info, match their absence
+	stamped := false
+	for _, setting := range metadata.BuildInfo.Settings {
+		stamped = stamped || strings.HasPrefix(setting.Key, "vcs")
+	}
+	if !stamped {
+		args = append(args, "-buildvcs=false")
+	}
+	return append(args, pkg), env, nil
+}
+
+// resolveSource returns the directory to build in: the given directory, or the module cache directory of
+// module@version, downloaded with go mod download. An empty source is the main module at the version in the build
+// info, @version the main module at another version.
+func resolveSource(ctx context.Context, metadata ExtractMetadata, source string) (string, error) {
+	if source == "" {
+		if metadata.BuildInfo.Main.Version == "" || metadata.BuildInfo.Main.Version == "(devel)" {
+			return "", fmt.Errorf("the build info has no module version, pass the source directory or module@version")
+		}
+		source = metadata.BuildInfo.Main.Path + "@" + metadata.BuildInfo.Main.Version
+	}
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		return source, nil
+	}
+	if !strings.Contains(source, "@") {
+		return "", fmt.Errorf("%s is neither a directory nor module@version", source)
+	}
+	if strings.HasPrefix(source, "@") {
+		source = metadata.BuildInfo.Main.Path + source
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "mod", "download", "-json", source)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+	var module struct {
+		Dir   string
+		Error string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &module); err != nil || module.Error != "" || runErr != nil {
+		return "", fmt.Errorf("failed to download %s: %s%s", source, module.Error, strings.TrimSpace(stderr.String()))
+	}
+	return module.Dir, nil
+}
+
+// fileDigest hashes a file to tell byte for byte equal builds
+func fileDigest(fileName string) ([]byte, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// verifyBinary rebuilds the binary from source into rebuilt and compares the two builds
+func verifyBinary(ctx context.Context, binary string, source string, toolchain string, rebuilt string, printStdPkgs bool) (VerifyReport, error) {
+	report := VerifyReport{Binary: binary}
+
+	metadata, err := main_impl(ctx, binary, false, false, false, false, true, 0, "")
+	if err != nil {
+		return report, fmt.Errorf("failed to parse %s: %w", binary, err)
+	}
+
+	if rebuilt, err = filepath.Abs(rebuilt); err != nil {
+		return report, err
+	}
+	args, env, err := rebuildCommand(metadata, rebuilt, toolchain)
+	if err != nil {
+		return report, err
+	}
+	report.Command = append([]string{"go"}, args...)
+	report.Env = env
+	report.Toolchain = strings.TrimPrefix(env[0], "GOTOOLCHAIN=")
+
+	dir, err := resolveSource(ctx, metadata, source)
+	if err != nil {
+		return report, err
+	}
+	report.Source = dir
+
+	buildPhase := beginPhase("rebuilding from source")
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	buildPhase.end("")
+	if err != nil {
+		// the errors are printed as JSON strings, without escaping
+		flattened := strings.NewReplacer("\"", "'", "\n", "; ", "\\", "/").Replace(strings.TrimSpace(string(output)))
+		return report, fmt.Errorf("go build failed: %w: %s", err, flattened)
+	}
+
+	original, err := fileDigest(binary)
+	if err != nil {
+		return report, err
+	}
+	rebuiltDigest, err := fileDigest(rebuilt)
+	if err != nil {
+		return report, err
+	}
+	report.Identical = bytes.Equal(original, rebuiltDigest)
+
+	// functions are only paired when identical, a rename is a divergence like any other
+	if report.Diff, err = diffBinaries(ctx, binary, rebuilt, printStdPkgs, 0); err != nil {
+		return report, err
+	}
+	report.Reproduced = len(report.Diff.Added)+len(report.Diff.Removed)+len(report.Diff.Changed)+len(report.Diff.Renamed) == 0
+	return report, nil
+}
+
+func printVerifyForHuman(w io.Writer, report VerifyReport) {
+	fmt.Fprintln(w, "----GoReSym verify----")
+	fmt.Fprintf(w, "%-20s %s\n", "Binary:", report.Binary)
+	fmt.Fprintf(w, "%-20s %s\n", "Source:", report.Source)
+	fmt.Fprintf(w, "%-20s %s %s\n", "Command:", strings.Join(report.Env, " "), strings.Join(report.Command, " "))
+	fmt.Fprintf(w, "%-20s %t\n", "Identical:", report.Identical)
+	fmt.Fprintf(w, "%-20s %t\n", "Reproduced:", report.Reproduced)
+	if !report.Reproduced {
+		fmt.Fprintln(w)
+		printDiffForHuman(w, report.Diff)
+	}
+}
+
+// verifyMain implements `GoReSym verify [flags] binary [source]`, args excludes the subcommand name
+func verifyMain(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	printStdPkgs := flags.Bool("d", false, "Also compare functions of standard packages, to catch a different toolchain")
+	humanView := flags.Bool("human", false, "Human view, print the divergences flat rather than json")
+	timeout := flags.Duration("timeout", 0, "Stop after this long, including the rebuild, ex: 5m")
+	toolchain := flags.String("toolchain", "", "GOTOOLCHAIN to rebuild with, the release of the binary by default. local uses the go command in PATH")
+	rebuiltPath := flags.String("rebuilt", "", "Keep the rebuilt binary at this path, it's built in a temporary directory and removed by default")
+	outputPath := flags.String("o", "", "Write the report to this file instead of stdout. It's replaced atomically once the verification completes")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Println(TextToJson("error", "usage: GoReSym verify [flags] binary [directory or module@version]"))
+		return exitError
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	rebuilt := *rebuiltPath
+	if rebuilt == "" {
+		dir, err := os.MkdirTemp("", "goresym-verify")
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to create a temporary directory: %s", err)))
+			return exitError
+		}
+		defer os.RemoveAll(dir)
+		rebuilt = filepath.Join(dir, filepath.Base(flags.Arg(0)))
+	}
+
+	report, err := verifyBinary(ctx, flags.Arg(0), flags.Arg(1), *toolchain, rebuilt, *printStdPkgs)
+	if err != nil {
+		fmt.Println(TextToJson("error", err.Error()))
+		return exitCodeForError(err)
+	}
+
+	var out io.Writer = os.Stdout
+	var outputFile *atomicFile
+	if *outputPath != "" {
+		outputFile, err = createAtomicFile(*outputPath)
+		if err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to create output file: %s", err)))
+			return exitError
+		}
+		out = outputFile
+	}
+
+	if *humanView {
+		printVerifyForHuman(out, report)
+	} else {
+		fmt.Fprintln(out, DataToJson(report))
+	}
+
+	if outputFile != nil {
+		if err := outputFile.Commit(); err != nil {
+			fmt.Println(TextToJson("error", fmt.Sprintf("failed to write output file: %s", err)))
+			return exitError
+		}
+	}
+	if !report.Reproduced {
+		return exitNotReproduced
+	}
+	return exitOK
+}
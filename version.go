@@ -0,0 +1,58 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	rtdebug "runtime/debug"
+	"sync"
+)
+
+// The Go releases whose runtime structures GoReSym understands, keep in sync with the version switches in objfile
+const (
+	minSupportedGoVersion      = "1.2"
+	maxSupportedGoVersion      = "1.24"
+	minSupportedTypesGoVersion = "1.5"
+)
+
+var supportedPclntabLayouts = []string{"1.2", "1.16", "1.18", "1.20"}
+
+// ToolInfo identifies the GoReSym build that produced a report, so results can be traced back to the parsing logic used
+type ToolInfo struct {
+	Version             string
+	Commit              string `json:",omitempty"`
+	Modified            bool   `json:",omitempty"` // built from a tree with uncommitted changes
+	BuiltWith           string `json:",omitempty"`
+	SupportedGoVersions string // Go releases whose pclntab and moduledata can be parsed
+	TypesGoVersions     string // Go releases whose types can be parsed, older ones have no typelinks
+	PclntabLayouts      []string
+}
+
+var toolInfoOnce sync.Once
+var toolInfo ToolInfo
+
+// currentToolInfo reads the VCS details the go command stamped into our own binary, they're absent in test binaries
+func currentToolInfo() ToolInfo {
+	toolInfoOnce.Do(func() {
+		toolInfo = ToolInfo{
+			Version:             Version,
+			SupportedGoVersions: minSupportedGoVersion + "-" + maxSupportedGoVersion,
+			TypesGoVersions:     minSupportedTypesGoVersion + "-" + maxSupportedGoVersion,
+			PclntabLayouts:      supportedPclntabLayouts,
+		}
+
+		bi, ok := rtdebug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+
+		toolInfo.BuiltWith = bi.GoVersion
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				toolInfo.Commit = setting.Value
+			case "vcs.modified":
+				toolInfo.Modified = setting.Value == "true"
+			}
+		}
+	})
+	return toolInfo
+}
@@ -0,0 +1,1124 @@
+/*Copyright (C) 2022 Mandiant, Inc. All Rights Reserved.*/
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"rsc.io/binaryregexp"
+)
+
+// YaraMatch is a rule of -yara-rules matching the input file
+type YaraMatch struct {
+	Rule    string
+	Tags    []string          `json:",omitempty"`
+	Meta    map[string]string `json:",omitempty"`
+	Strings []YaraStringMatch `json:",omitempty"`
+}
+
+// YaraSkippedRule is a rule of -yara-rules GoReSym can't evaluate, it matching nothing says nothing about the input
+type YaraSkippedRule struct {
+	Rule   string
+	File   string
+	Reason string
+}
+
+type YaraStringMatch struct {
+	Identifier string
+	Count      int      // of the matches, up to maxYaraMatches
+	Offsets    []uint64 // file offsets of the first few matches
+}
+
+// GoReSym evaluates a subset of the YARA language without libyara: text, hex and regular expression strings with
+// the nocase, wide, ascii and fullword modifiers, and conditions of boolean, comparison and arithmetic operators over
+// the strings, their counts and offsets, filesize, the integers read at an offset, other rules and the "of" sets.
+// Rules using modules, for loops or other unsupported features are skipped, and reported along with the matches.
+type yaraRule struct {
+	name      string
+	tags      []string
+	meta      map[string]string
+	private   bool
+	global    bool
+	strings   []*yaraString
+	condition yaraExpr
+}
+
+type yaraString struct {
+	id       string
+	literal  []byte // matched as is when set, pattern otherwise
+	pattern  *binaryregexp.Regexp
+	fullword bool
+	private  bool
+}
+
+// the matches counted per string and the offsets reported
+const (
+	maxYaraMatches = 1000
+	maxYaraOffsets = 10
+)
+
+// yaraScan is the state of evaluating the rules against one file
+type yaraScan struct {
+	data    []byte
+	matches map[*yaraString][]int
+	rules   map[string]bool
+}
+
+type yaraExpr func(scan *yaraScan) int64
+
+// loadYaraRules reads a rules file, or every .yar and .yara file below a directory, and the rules it skipped
+func loadYaraRules(path string) ([]*yaraRule, []YaraSkippedRule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && (filepath.Ext(name) == ".yar" || filepath.Ext(name) == ".yara") {
+				files = append(files, name)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var rules []*yaraRule
+	var skipped []YaraSkippedRule
+	for _, name := range files {
+		source, err := os.ReadFile(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed, err := parseYaraRules(string(source), func(rule string, err error) {
+			logger.Warn("yara rule skipped", "file", name, "rule", rule, "error", err)
+			skipped = append(skipped, YaraSkippedRule{Rule: rule, File: name, Reason: err.Error()})
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		rules = append(rules, parsed...)
+	}
+	if len(rules) == 0 {
+		return nil, nil, fmt.Errorf("no supported rules in %s", path)
+	}
+	return rules, skipped, nil
+}
+
+// scanYara evaluates the rules in order, as a rule's condition may reference the rules before it
+func scanYara(rules []*yaraRule, data []byte) []YaraMatch {
+	scan := &yaraScan{data: data, matches: make(map[*yaraString][]int), rules: make(map[string]bool)}
+	for _, rule := range rules {
+		for _, str := range rule.strings {
+			scan.matches[str] = findYaraString(str, data)
+		}
+		scan.rules[rule.name] = rule.condition(scan) != 0
+	}
+	for _, rule := range rules {
+		if rule.global && !scan.rules[rule.name] {
+			return nil
+		}
+	}
+
+	var matches []YaraMatch
+	for _, rule := range rules {
+		if !scan.rules[rule.name] || rule.private {
+			continue
+		}
+		match := YaraMatch{Rule: rule.name, Tags: rule.tags, Meta: rule.meta}
+		for _, str := range rule.strings {
+			offsets := scan.matches[str]
+			if len(offsets) == 0 || str.private {
+				continue
+			}
+			stringMatch := YaraStringMatch{Identifier: str.id, Count: len(offsets)}
+			for _, offset := range offsets[:min(len(offsets), maxYaraOffsets)] {
+				stringMatch.Offsets = append(stringMatch.Offsets, uint64(offset))
+			}
+			match.Strings = append(match.Strings, stringMatch)
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+func findYaraString(str *yaraString, data []byte) []int {
+	var offsets []int
+	add := func(start, end int) {
+		if str.fullword && (start > 0 && isYaraWordByte(data[start-1]) || end < len(data) && isYaraWordByte(data[end])) {
+			return
+		}
+		offsets = append(offsets, start)
+	}
+	if str.literal != nil {
+		for offset := 0; len(offsets) < maxYaraMatches; {
+			i := bytes.Index(data[offset:], str.literal)
+			if i < 0 {
+				break
+			}
+			add(offset+i, offset+i+len(str.literal))
+			offset += i + 1
+		}
+		return offsets
+	}
+	for _, loc := range str.pattern.FindAllIndex(data, maxYaraMatches) {
+		add(loc[0], loc[1])
+	}
+	return offsets
+}
+
+func isYaraWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// yaraParser reads the source of the rules, the conditions are tokenized apart
+type yaraParser struct {
+	src string
+	pos int
+}
+
+func (p *yaraParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip passes spaces and comments
+func (p *yaraParser) skip() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])):
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *yaraParser) identifier() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.src) && (isYaraWordByte(p.src[p.pos]) || p.pos > start && p.src[p.pos] == '.') {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *yaraParser) consume(s string) bool {
+	p.skip()
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// quoted reads a double quoted string with the escapes of YARA
+func (p *yaraParser) quoted() ([]byte, error) {
+	if !p.consume(`"`) {
+		return nil, p.errorf("expected a string")
+	}
+	var value []byte
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return value, nil
+		case '\n':
+			return nil, p.errorf("unterminated string")
+		case '\\':
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("unterminated string")
+			}
+			escaped := p.src[p.pos]
+			p.pos++
+			switch escaped {
+			case 'n':
+				value = append(value, '\n')
+			case 't':
+				value = append(value, '\t')
+			case 'r':
+				value = append(value, '\r')
+			case 'x':
+				if p.pos+2 > len(p.src) {
+					return nil, p.errorf("invalid escape")
+				}
+				b, err := strconv.ParseUint(p.src[p.pos:p.pos+2], 16, 8)
+				if err != nil {
+					return nil, p.errorf("invalid escape \\x%s", p.src[p.pos:p.pos+2])
+				}
+				value = append(value, byte(b))
+				p.pos += 2
+			default:
+				value = append(value, escaped)
+			}
+		default:
+			value = append(value, c)
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+// parseYaraRules reads the rules of a file. A rule that can't be evaluated is reported to skipped, a syntax error
+// fails the whole file.
+func parseYaraRules(src string, skipped func(rule string, err error)) ([]*yaraRule, error) {
+	p := &yaraParser{src: src}
+	var rules []*yaraRule
+	known := make(map[string]bool)
+	for {
+		p.skip()
+		if p.pos >= len(p.src) {
+			return rules, nil
+		}
+
+		rule := &yaraRule{}
+		keyword := p.identifier()
+		switch keyword {
+		case "import":
+			// the modules aren't supported, the rules using them are skipped
+			if _, err := p.quoted(); err != nil {
+				return nil, err
+			}
+			continue
+		case "include":
+			return nil, p.errorf("include isn't supported")
+		}
+		for keyword == "private" || keyword == "global" {
+			rule.private = rule.private || keyword == "private"
+			rule.global = rule.global || keyword == "global"
+			keyword = p.identifier()
+		}
+		if keyword != "rule" {
+			return nil, p.errorf("expected rule, got %q", keyword)
+		}
+		rule.name = p.identifier()
+		if rule.name == "" {
+			return nil, p.errorf("expected a rule name")
+		}
+		if p.consume(":") {
+			for {
+				p.skip()
+				if p.pos >= len(p.src) || p.src[p.pos] == '{' {
+					break
+				}
+				tag := p.identifier()
+				if tag == "" {
+					return nil, p.errorf("invalid tag")
+				}
+				rule.tags = append(rule.tags, tag)
+			}
+		}
+		if !p.consume("{") {
+			return nil, p.errorf("expected { after rule %s", rule.name)
+		}
+
+		unsupported, err := p.ruleBody(rule, known)
+		if err != nil {
+			return nil, err
+		}
+		if unsupported != nil {
+			skipped(rule.name, unsupported)
+			continue
+		}
+		known[rule.name] = true
+		rules = append(rules, rule)
+	}
+}
+
+// ruleBody reads the sections of the rule up to its closing brace. An unsupported feature is returned apart from
+// syntax errors, the rest of the rule being read to carry on with the next one.
+func (p *yaraParser) ruleBody(rule *yaraRule, known map[string]bool) (unsupported error, err error) {
+	for {
+		section := p.identifier()
+		if !p.consume(":") {
+			return nil, p.errorf("expected a section in rule %s", rule.name)
+		}
+		switch section {
+		case "meta":
+			rule.meta = make(map[string]string)
+			for {
+				p.skip()
+				start := p.pos
+				key := p.identifier()
+				if key == "strings" || key == "condition" || !p.consume("=") {
+					p.pos = start
+					break
+				}
+				p.skip()
+				if strings.HasPrefix(p.src[p.pos:], `"`) {
+					value, err := p.quoted()
+					if err != nil {
+						return nil, err
+					}
+					rule.meta[key] = string(value)
+				} else {
+					rule.meta[key] = p.identifier()
+				}
+			}
+		case "strings":
+			for {
+				p.skip()
+				if !strings.HasPrefix(p.src[p.pos:], "$") {
+					break
+				}
+				str, problem, err := p.stringDefinition()
+				if err != nil {
+					return nil, err
+				}
+				if problem != nil && unsupported == nil {
+					unsupported = problem
+				}
+				rule.strings = append(rule.strings, str)
+			}
+		case "condition":
+			// the condition ends at the closing brace of the rule, outside of quotes
+			start := p.pos
+			quoted := false
+			for p.pos < len(p.src) && (quoted || p.src[p.pos] != '}') {
+				if p.src[p.pos] == '"' && p.src[p.pos-1] != '\\' {
+					quoted = !quoted
+				}
+				p.pos++
+			}
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("expected } closing rule %s", rule.name)
+			}
+			text := p.src[start:p.pos]
+			p.pos++
+			if unsupported != nil {
+				return unsupported, nil
+			}
+			condition, err := compileYaraCondition(text, rule.strings, known)
+			if err != nil {
+				return err, nil
+			}
+			rule.condition = condition
+			return nil, nil
+		default:
+			return nil, p.errorf("unknown section %s in rule %s", section, rule.name)
+		}
+	}
+}
+
+// stringDefinition reads $id = value modifiers, compiling the value to a literal or a pattern
+func (p *yaraParser) stringDefinition() (str *yaraString, unsupported error, err error) {
+	p.consume("$")
+	str = &yaraString{id: "$" + p.identifier()}
+	if !p.consume("=") {
+		return nil, nil, p.errorf("expected = after %s", str.id)
+	}
+	p.skip()
+
+	var text []byte
+	var pattern string
+	isText := false
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], `"`):
+		text, err = p.quoted()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(text) == 0 {
+			return nil, nil, p.errorf("empty string %s", str.id)
+		}
+		isText = true
+	case strings.HasPrefix(p.src[p.pos:], "{"):
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end < 0 {
+			return nil, nil, p.errorf("unterminated hex string %s", str.id)
+		}
+		pattern, err = yaraHexPattern(p.src[p.pos+1 : p.pos+end])
+		if err != nil {
+			// the rest of the rule parses fine, only this rule is skipped
+			unsupported, err = fmt.Errorf("%s: %w", str.id, err), nil
+		}
+		p.pos += end + 1
+	case strings.HasPrefix(p.src[p.pos:], "/"):
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.src) && p.src[p.pos] != '/' && p.src[p.pos] != '\n' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != '/' {
+			return nil, nil, p.errorf("unterminated regular expression %s", str.id)
+		}
+		pattern = p.src[start:p.pos]
+		p.pos++
+		flags := ""
+		for p.pos < len(p.src) && (p.src[p.pos] == 'i' || p.src[p.pos] == 's') {
+			flags += string(p.src[p.pos])
+			p.pos++
+		}
+		if flags != "" {
+			pattern = "(?" + flags + ")" + pattern
+		}
+	default:
+		return nil, nil, p.errorf("expected the value of %s", str.id)
+	}
+
+	nocase, wide, ascii := false, false, false
+	for {
+		p.skip()
+		start := p.pos
+		modifier := p.identifier()
+		switch modifier {
+		case "nocase":
+			nocase = true
+		case "wide":
+			wide = true
+		case "ascii":
+			ascii = true
+		case "fullword":
+			str.fullword = true
+		case "private":
+			str.private = true
+		case "":
+			goto done
+		default:
+			if modifier == "condition" || modifier == "meta" || modifier == "strings" {
+				p.pos = start
+				goto done
+			}
+			if p.consume("(") {
+				for p.pos < len(p.src) && p.src[p.pos] != ')' {
+					p.pos++
+				}
+				p.pos++
+			}
+			unsupported = fmt.Errorf("string modifier %s isn't supported", modifier)
+		}
+	}
+done:
+	if !isText {
+		if wide {
+			unsupported = fmt.Errorf("wide isn't supported for the hex strings and regular expressions")
+		}
+		if nocase {
+			pattern = "(?i)" + pattern
+		}
+		str.pattern, err = binaryregexp.Compile(pattern)
+		if err != nil && unsupported == nil {
+			unsupported = fmt.Errorf("%s: %w", str.id, err)
+		}
+		return str, unsupported, nil
+	}
+
+	var alternatives [][]byte
+	if ascii || !wide {
+		alternatives = append(alternatives, text)
+	}
+	if wide {
+		var widened []byte
+		for _, c := range text {
+			widened = append(widened, c, 0)
+		}
+		alternatives = append(alternatives, widened)
+	}
+	if len(alternatives) == 1 && !nocase {
+		str.literal = alternatives[0]
+		return str, unsupported, nil
+	}
+	var quoted []string
+	for _, alternative := range alternatives {
+		quoted = append(quoted, binaryregexp.QuoteMeta(string(alternative)))
+	}
+	pattern = strings.Join(quoted, "|")
+	if nocase {
+		pattern = "(?i)" + pattern
+	}
+	str.pattern = binaryregexp.MustCompile(pattern)
+	return str, unsupported, nil
+}
+
+// yaraHexPattern translates a hex string to a regular expression over bytes: ?? is any byte, a nibble wildcard
+// a class of bytes, ~XX any byte but XX, [n-m] a jump and ( | ) alternatives. Comments are ignored.
+func yaraHexPattern(hex string) (string, error) {
+	var pattern strings.Builder
+	fields := strings.NewReplacer("(", " ( ", ")", " ) ", "|", " | ", "[", " [", "]", "] ", "~", " ~").Replace(stripYaraComments(hex))
+	for _, token := range strings.Fields(fields) {
+		switch {
+		case token == "(":
+			pattern.WriteString("(?:")
+		case token == ")" || token == "|":
+			pattern.WriteString(token)
+		case strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]"):
+			jump := strings.TrimSuffix(strings.TrimPrefix(token, "["), "]")
+			low, high, isRange := strings.Cut(jump, "-")
+			if low == "" {
+				low = "0"
+			}
+			switch {
+			case !isRange:
+				pattern.WriteString("(?s:.{" + low + "})")
+			case high == "":
+				pattern.WriteString("(?s:.{" + low + ",})")
+			default:
+				pattern.WriteString("(?s:.{" + low + "," + high + "})")
+			}
+		default:
+			// ~XX matches any byte but XX, the negation only applies to the byte following it
+			negated := strings.HasPrefix(token, "~")
+			token = strings.TrimPrefix(token, "~")
+			if len(token)%2 != 0 || (negated && token == "") {
+				return "", fmt.Errorf("invalid hex byte %q", token)
+			}
+			for i := 0; i < len(token); i += 2 {
+				byteText := token[i : i+2]
+				switch {
+				case byteText == "??" && negated:
+					return "", fmt.Errorf("invalid negation ~??")
+				case byteText == "??":
+					pattern.WriteString("(?s:.)")
+				case byteText[0] == '?' || byteText[1] == '?':
+					if negated {
+						pattern.WriteString("[^")
+					} else {
+						pattern.WriteString("[")
+					}
+					for n := 0; n < 16; n++ {
+						candidate := strings.Replace(byteText, "?", strconv.FormatInt(int64(n), 16), 1)
+						b, err := strconv.ParseUint(candidate, 16, 8)
+						if err != nil {
+							return "", fmt.Errorf("invalid hex byte %q", byteText)
+						}
+						fmt.Fprintf(&pattern, `\x%02x`, b)
+					}
+					pattern.WriteString("]")
+				default:
+					b, err := strconv.ParseUint(byteText, 16, 8)
+					if err != nil {
+						return "", fmt.Errorf("invalid hex byte %q", byteText)
+					}
+					if negated {
+						fmt.Fprintf(&pattern, `[^\x%02x]`, b)
+					} else {
+						fmt.Fprintf(&pattern, `\x%02x`, b)
+					}
+				}
+				negated = false
+			}
+		}
+	}
+	return pattern.String(), nil
+}
+
+// stripYaraComments blanks the // and /* */ comments of a hex string
+func stripYaraComments(hex string) string {
+	var b strings.Builder
+	for len(hex) > 0 {
+		switch {
+		case strings.HasPrefix(hex, "//"):
+			end := strings.IndexByte(hex, '\n')
+			if end < 0 {
+				return b.String()
+			}
+			hex = hex[end:]
+		case strings.HasPrefix(hex, "/*"):
+			end := strings.Index(hex, "*/")
+			if end < 0 {
+				return b.String()
+			}
+			b.WriteByte(' ')
+			hex = hex[end+2:]
+		default:
+			b.WriteByte(hex[0])
+			hex = hex[1:]
+		}
+	}
+	return b.String()
+}
+
+// yaraConditionParser compiles a condition to closures, by recursive descent over its tokens
+type yaraConditionParser struct {
+	tokens  []string
+	pos     int
+	strings []*yaraString
+	rules   map[string]bool
+}
+
+func tokenizeYaraCondition(text string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '$' || c == '#' || c == '@' || c == '!' && i+1 < len(text) && text[i+1] != '=' || isYaraWordByte(c):
+			start := i
+			i++
+			// module members like pe.is_dll are read whole to be reported, the dots of ranges are operators
+			for i < len(text) && (isYaraWordByte(text[i]) || text[i] == '*' ||
+				text[i] == '.' && i+1 < len(text) && text[i+1] != '.' && !(c >= '0' && c <= '9')) {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+		default:
+			operator := string(c)
+			for _, two := range []string{"==", "!=", "<=", ">=", "<<", ">>", ".."} {
+				if strings.HasPrefix(text[i:], two) {
+					operator = two
+				}
+			}
+			if !strings.Contains("()[],+-*\\%&|^~<>=!..", operator) && len(operator) == 1 {
+				return nil, fmt.Errorf("unsupported character %q", c)
+			}
+			tokens = append(tokens, operator)
+			i += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+func compileYaraCondition(text string, strs []*yaraString, rules map[string]bool) (yaraExpr, error) {
+	tokens, err := tokenizeYaraCondition(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &yaraConditionParser{tokens: tokens, strings: strs, rules: rules}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in condition", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func (p *yaraConditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *yaraConditionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *yaraConditionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("expected %q in condition, got %q", token, got)
+	}
+	return nil
+}
+
+func yaraBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// binary parses the operands of one level of precedence joined by its operators
+func (p *yaraConditionParser) binary(operand func() (yaraExpr, error), operators map[string]func(a, b int64) int64) (yaraExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for operators[p.peek()] != nil {
+		apply := operators[p.next()]
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(scan *yaraScan) int64 { return apply(l(scan), right(scan)) }
+	}
+	return left, nil
+}
+
+func (p *yaraConditionParser) or() (yaraExpr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(scan *yaraScan) int64 { return yaraBool(l(scan) != 0 || right(scan) != 0) }
+	}
+	return left, nil
+}
+
+func (p *yaraConditionParser) and() (yaraExpr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(scan *yaraScan) int64 { return yaraBool(l(scan) != 0 && right(scan) != 0) }
+	}
+	return left, nil
+}
+
+func (p *yaraConditionParser) not() (yaraExpr, error) {
+	if p.peek() == "not" {
+		p.next()
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(scan *yaraScan) int64 { return yaraBool(operand(scan) == 0) }, nil
+	}
+	return p.comparison()
+}
+
+var yaraComparisons = map[string]func(a, b int64) int64{
+	"==": func(a, b int64) int64 { return yaraBool(a == b) },
+	"!=": func(a, b int64) int64 { return yaraBool(a != b) },
+	"<":  func(a, b int64) int64 { return yaraBool(a < b) },
+	"<=": func(a, b int64) int64 { return yaraBool(a <= b) },
+	">":  func(a, b int64) int64 { return yaraBool(a > b) },
+	">=": func(a, b int64) int64 { return yaraBool(a >= b) },
+}
+
+var yaraOperatorLevels = []map[string]func(a, b int64) int64{
+	{"|": func(a, b int64) int64 { return a | b }},
+	{"^": func(a, b int64) int64 { return a ^ b }},
+	{"&": func(a, b int64) int64 { return a & b }},
+	{"<<": func(a, b int64) int64 { return a << uint64(b&63) }, ">>": func(a, b int64) int64 { return a >> uint64(b&63) }},
+	{"+": func(a, b int64) int64 { return a + b }, "-": func(a, b int64) int64 { return a - b }},
+	{"*": func(a, b int64) int64 { return a * b }, "\\": yaraDivide, "%": yaraModulo},
+}
+
+func yaraDivide(a, b int64) int64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func yaraModulo(a, b int64) int64 {
+	if b == 0 {
+		return 0
+	}
+	return a % b
+}
+
+func (p *yaraConditionParser) comparison() (yaraExpr, error) {
+	left, err := p.arithmetic(0)
+	if err != nil {
+		return nil, err
+	}
+	if compare := yaraComparisons[p.peek()]; compare != nil {
+		p.next()
+		right, err := p.arithmetic(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(scan *yaraScan) int64 { return compare(left(scan), right(scan)) }, nil
+	}
+	return left, nil
+}
+
+func (p *yaraConditionParser) arithmetic(level int) (yaraExpr, error) {
+	if level == len(yaraOperatorLevels) {
+		return p.unary()
+	}
+	return p.binary(func() (yaraExpr, error) { return p.arithmetic(level + 1) }, yaraOperatorLevels[level])
+}
+
+func (p *yaraConditionParser) unary() (yaraExpr, error) {
+	switch p.peek() {
+	case "-":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(scan *yaraScan) int64 { return -operand(scan) }, nil
+	case "~":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(scan *yaraScan) int64 { return ^operand(scan) }, nil
+	}
+	return p.primary()
+}
+
+// yaraIntegerReaders are the functions reading an integer at an offset of the file
+var yaraIntegerReaders = map[string]struct {
+	size   int
+	signed bool
+	order  binary.ByteOrder
+}{
+	"uint8": {1, false, binary.LittleEndian}, "uint16": {2, false, binary.LittleEndian}, "uint32": {4, false, binary.LittleEndian},
+	"int8": {1, true, binary.LittleEndian}, "int16": {2, true, binary.LittleEndian}, "int32": {4, true, binary.LittleEndian},
+	"uint8be": {1, false, binary.BigEndian}, "uint16be": {2, false, binary.BigEndian}, "uint32be": {4, false, binary.BigEndian},
+	"int8be": {1, true, binary.BigEndian}, "int16be": {2, true, binary.BigEndian}, "int32be": {4, true, binary.BigEndian},
+}
+
+func (p *yaraConditionParser) primary() (yaraExpr, error) {
+	token := p.next()
+	switch {
+	case token == "(":
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case token == "true" || token == "false":
+		value := yaraBool(token == "true")
+		return func(*yaraScan) int64 { return value }, nil
+	case token == "filesize":
+		return func(scan *yaraScan) int64 { return int64(len(scan.data)) }, nil
+	case token == "any" || token == "all" || token == "none":
+		return p.of(token, nil)
+	case token != "" && token[0] >= '0' && token[0] <= '9':
+		value, err := parseYaraNumber(token)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() == "of" {
+			return p.of("", func(*yaraScan) int64 { return value })
+		}
+		return func(*yaraScan) int64 { return value }, nil
+	case yaraIntegerReaders[token].size > 0:
+		reader := yaraIntegerReaders[token]
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		offset, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return func(scan *yaraScan) int64 {
+			at := offset(scan)
+			if at < 0 || at+int64(reader.size) > int64(len(scan.data)) {
+				return 0
+			}
+			var buf [8]byte
+			copy(buf[:], scan.data[at:at+int64(reader.size)])
+			switch reader.size {
+			case 1:
+				if reader.signed {
+					return int64(int8(buf[0]))
+				}
+				return int64(buf[0])
+			case 2:
+				v := reader.order.Uint16(buf[:])
+				if reader.signed {
+					return int64(int16(v))
+				}
+				return int64(v)
+			}
+			v := reader.order.Uint32(buf[:])
+			if reader.signed {
+				return int64(int32(v))
+			}
+			return int64(v)
+		}, p.expect(")")
+	case strings.HasPrefix(token, "$"):
+		str := p.findString(token)
+		if str == nil {
+			return nil, fmt.Errorf("undefined string %s", token)
+		}
+		switch p.peek() {
+		case "at":
+			p.next()
+			at, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return func(scan *yaraScan) int64 {
+				target := at(scan)
+				for _, offset := range scan.matches[str] {
+					if int64(offset) == target {
+						return 1
+					}
+				}
+				return 0
+			}, nil
+		case "in":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			low, err := p.arithmetic(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(".."); err != nil {
+				return nil, err
+			}
+			high, err := p.arithmetic(0)
+			if err != nil {
+				return nil, err
+			}
+			return func(scan *yaraScan) int64 {
+				from, to := low(scan), high(scan)
+				for _, offset := range scan.matches[str] {
+					if int64(offset) >= from && int64(offset) <= to {
+						return 1
+					}
+				}
+				return 0
+			}, p.expect(")")
+		}
+		return func(scan *yaraScan) int64 { return yaraBool(len(scan.matches[str]) > 0) }, nil
+	case strings.HasPrefix(token, "#"):
+		str := p.findString("$" + token[1:])
+		if str == nil {
+			return nil, fmt.Errorf("undefined string %s", token)
+		}
+		return func(scan *yaraScan) int64 { return int64(len(scan.matches[str])) }, nil
+	case strings.HasPrefix(token, "@"):
+		str := p.findString("$" + token[1:])
+		if str == nil {
+			return nil, fmt.Errorf("undefined string %s", token)
+		}
+		index := func(*yaraScan) int64 { return 1 }
+		if p.peek() == "[" {
+			p.next()
+			var err error
+			if index, err = p.arithmetic(0); err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		return func(scan *yaraScan) int64 {
+			i := index(scan)
+			if i < 1 || i > int64(len(scan.matches[str])) {
+				return 0
+			}
+			return int64(scan.matches[str][i-1])
+		}, nil
+	case p.rules[token]:
+		return func(scan *yaraScan) int64 { return yaraBool(scan.rules[token]) }, nil
+	}
+	if strings.Contains(token, ".") {
+		return nil, fmt.Errorf("modules aren't supported: %s", token)
+	}
+	return nil, fmt.Errorf("unsupported %q in condition", token)
+}
+
+// of counts the strings of a set that matched, against all, any, none or a number
+func (p *yaraConditionParser) of(quantifier string, count yaraExpr) (yaraExpr, error) {
+	if err := p.expect("of"); err != nil {
+		return nil, err
+	}
+	var set []*yaraString
+	if p.peek() == "them" {
+		p.next()
+		set = p.strings
+	} else {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for {
+			pattern := p.next()
+			if !strings.HasPrefix(pattern, "$") {
+				return nil, fmt.Errorf("expected a string in the set, got %q", pattern)
+			}
+			found := false
+			for _, str := range p.strings {
+				if str.id == pattern || strings.HasSuffix(pattern, "*") && strings.HasPrefix(str.id, strings.TrimSuffix(pattern, "*")) {
+					set = append(set, str)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("undefined string %s", pattern)
+			}
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(scan *yaraScan) int64 {
+		matched := 0
+		for _, str := range set {
+			if len(scan.matches[str]) > 0 {
+				matched++
+			}
+		}
+		switch quantifier {
+		case "all":
+			return yaraBool(matched == len(set))
+		case "any":
+			return yaraBool(matched > 0)
+		case "none":
+			return yaraBool(matched == 0)
+		}
+		return yaraBool(int64(matched) >= count(scan))
+	}, nil
+}
+
+func (p *yaraConditionParser) findString(id string) *yaraString {
+	for _, str := range p.strings {
+		if str.id == id {
+			return str
+		}
+	}
+	return nil
+}
+
+// parseYaraNumber reads a decimal or hexadecimal number, with an optional KB or MB multiplier
+func parseYaraNumber(token string) (int64, error) {
+	multiplier := int64(1)
+	if strings.HasSuffix(token, "KB") {
+		multiplier, token = 1024, strings.TrimSuffix(token, "KB")
+	} else if strings.HasSuffix(token, "MB") {
+		multiplier, token = 1024*1024, strings.TrimSuffix(token, "MB")
+	}
+	value, err := strconv.ParseInt(token, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", token)
+	}
+	return value * multiplier, nil
+}